@@ -1,8 +1,6 @@
 package agent
 
 import (
-	"crypto/tls"
-	"net/http"
 	"time"
 )
 
@@ -11,38 +9,6 @@ const (
 	AgentQueryTimeout = time.Duration(2) * time.Second
 )
 
-var (
-	normalTransport   = http.DefaultTransport
-	insecureTransport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}
-)
-
-// GetHttpTransport Pour les appels aux agents : http.Transport keeps a pool of open connections for reuse.
-// donc les custom transport doivent être reutilisés, et non pas reinstencié à chaque requete
-// On fourni donc une fabrique pour ça
-//TODO : les cert auto signé devrait validé sur labase de leur signature
-// TLSClientConfig.GetCertificate permettrait ça ?
-func GetHttpTransport(insecure bool, cersignAllowed string) http.RoundTripper {
-	insec := insecure || (cersignAllowed != "")
-	if insec {
-		return insecureTransport
-	}
-	return normalTransport
-
-}
-
-// DoHttpRequest wrapper http.Do selon les contraintes de secu du transport demandé
-func DoHttpRequest(req *http.Request, timeout time.Duration, insecure bool, cersignAllowed string) (*http.Response, error) {
-	httpCli := &http.Client{
-		Transport: GetHttpTransport(insecure, cersignAllowed),
-		Timeout:   timeout,
-	}
-	return httpCli.Do(req)
-}
-
 //TaskView (repris du source de l'agent) est le json pour demaander l'execution d'une tache
 type TaskView struct {
 	Type    string `json:"type"`      //type de tache
@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// prefixe d'un pin de type hash SPKI (format HPKP : sha256/<base64>)
+	spkiPinPrefix = "sha256/"
+)
+
+var (
+	normalTransport   = newTransport(&tls.Config{})
+	insecureTransport = newTransport(&tls.Config{
+		InsecureSkipVerify: true,
+	})
+
+	// transports spécifiques (cert épinglé, CA dédié), un par agent
+	agentTransports   = make(map[int]*agentTransport)
+	agentTransportsMu sync.Mutex
+
+	// certificat client présenté aux agents (mTLS)
+	clientCert   *tls.Certificate
+	clientCertMu sync.RWMutex
+)
+
+// agentTransport transport dédié à un agent (cert épinglé et/ou CA spécifique)
+type agentTransport struct {
+	pin       string
+	caBundle  string
+	transport *http.Transport
+}
+
+// TLSEvalInfo info tls constatées lors d'un appel d'évaluation
+type TLSEvalInfo struct {
+	ClientCertConfigured bool // un certificat client est paramétré
+	ClientCertRequested  bool // l'agent a demandé un certificat client
+}
+
+// SetClientCertificate charge le certificat client (cert/clé PEM) présenté aux agents
+// fichiers vides : pas de certificat client
+func SetClientCertificate(certFile, keyFile string) error {
+	if certFile == "" && keyFile == "" {
+		setClientCertificate(nil)
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("load client certificate : %w", err)
+	}
+	setClientCertificate(&cert)
+	return nil
+}
+
+// setClientCertificate setter certificat client
+func setClientCertificate(cert *tls.Certificate) {
+	clientCertMu.Lock()
+	clientCert = cert
+	clientCertMu.Unlock()
+
+	// les connexions établies l'ont été avec l'ancien certificat
+	normalTransport.CloseIdleConnections()
+	insecureTransport.CloseIdleConnections()
+	agentTransportsMu.Lock()
+	for _, at := range agentTransports {
+		at.transport.CloseIdleConnections()
+	}
+	agentTransportsMu.Unlock()
+}
+
+// getClientCertificate callback tls : certificat client fourni sur demande de l'agent
+// (certificat vide si non paramétré, l'agent décide alors s'il accepte la connexion)
+func getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	clientCertMu.RLock()
+	defer clientCertMu.RUnlock()
+	if clientCert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return clientCert, nil
+}
+
+// hasClientCertificate retourne vrai si un certificat client est paramétré
+func hasClientCertificate() bool {
+	clientCertMu.RLock()
+	defer clientCertMu.RUnlock()
+	return clientCert != nil
+}
+
+// newTransport transport avec la conf tls fournie, complété du certificat client
+func newTransport(tlsCfg *tls.Config) *http.Transport {
+	tlsCfg.GetClientCertificate = getClientCertificate
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsCfg,
+	}
+}
+
+// CertPoolFromPEM constitue un pool de CA depuis un bundle PEM
+func CertPoolFromPEM(caBundle string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+		return nil, fmt.Errorf("no valid certificate in CA bundle")
+	}
+	return pool, nil
+}
+
+// CertMatchPin retourne vrai si le certificat correspond au pin fourni :
+// - "sha256/<base64>" : hash sha256 de la clé publique (SPKI)
+// - sinon signature du certificat en hex (valeur remontée par l'eval de l'agent)
+func CertMatchPin(cert *x509.Certificate, pin string) bool {
+	pin = strings.TrimSpace(pin)
+	if cert == nil || pin == "" {
+		return false
+	}
+	if strings.HasPrefix(strings.ToLower(pin), spkiPinPrefix) {
+		h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return pin[len(spkiPinPrefix):] == base64.StdEncoding.EncodeToString(h[:])
+	}
+	return strings.EqualFold(pin, hex.EncodeToString(cert.Signature))
+}
+
+// CertSPKIPin calcule le pin SPKI d'un certificat (format sha256/<base64>)
+func CertSPKIPin(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return spkiPinPrefix + base64.StdEncoding.EncodeToString(h[:])
+}
+
+// newAgentTransport transport dédié à un agent :
+// - pin seul : cert auto signé, seul le pin est controlé (la chaine de confiance ne l'est pas)
+// - caBundle : la chaine est validé sur les CA fournis (+ pin si renseigné)
+func newAgentTransport(pin string, caBundle string) (*http.Transport, error) {
+	tlsCfg := &tls.Config{}
+	if caBundle != "" {
+		pool, err := CertPoolFromPEM(caBundle)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	} else if pin != "" {
+		tlsCfg.InsecureSkipVerify = true //verif faite par VerifyPeerCertificate
+	}
+	if pin != "" {
+		tlsCfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no peer certificate")
+			}
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("invalid peer certificate : %w", err)
+			}
+			if !CertMatchPin(cert, pin) {
+				return fmt.Errorf("peer certificate doesn't match the approuved one")
+			}
+			return nil
+		}
+	}
+	return newTransport(tlsCfg), nil
+}
+
+// GetHttpTransport Pour les appels aux agents : http.Transport keeps a pool of open connections for reuse.
+// donc les custom transport doivent être reutilisés, et non pas reinstencié à chaque requete
+// On fourni donc une fabrique pour ça :
+// - insecure : aucun controle du certificat (usage eval)
+// - cersignAllowed et/ou caBundle renseigné : transport dédié à l'agent mis en cache
+func GetHttpTransport(agentID int, insecure bool, cersignAllowed string, caBundle string) (http.RoundTripper, error) {
+	if insecure {
+		return insecureTransport, nil
+	}
+	if cersignAllowed == "" && caBundle == "" {
+		return normalTransport, nil
+	}
+
+	agentTransportsMu.Lock()
+	defer agentTransportsMu.Unlock()
+	if at, exists := agentTransports[agentID]; exists {
+		if at.pin == cersignAllowed && at.caBundle == caBundle {
+			return at.transport, nil
+		}
+		//conf modifié, les connexions établies sur l'ancienne sont abandonnées
+		at.transport.CloseIdleConnections()
+		delete(agentTransports, agentID)
+	}
+	t, err := newAgentTransport(cersignAllowed, caBundle)
+	if err != nil {
+		return nil, err
+	}
+	agentTransports[agentID] = &agentTransport{
+		pin:       cersignAllowed,
+		caBundle:  caBundle,
+		transport: t,
+	}
+	return t, nil
+}
+
+// ReleaseHttpTransport libére le transport en cache d'un agent (agent modifié ou supprimé)
+func ReleaseHttpTransport(agentID int) {
+	agentTransportsMu.Lock()
+	defer agentTransportsMu.Unlock()
+	if at, exists := agentTransports[agentID]; exists {
+		at.transport.CloseIdleConnections()
+		delete(agentTransports, agentID)
+	}
+}
+
+// DoHttpRequest wrapper http.Do selon les contraintes de secu du transport demandé
+func DoHttpRequest(req *http.Request, timeout time.Duration, agentID int, insecure bool, cersignAllowed string, caBundle string) (*http.Response, error) {
+	t, err := GetHttpTransport(agentID, insecure, cersignAllowed, caBundle)
+	if err != nil {
+		return nil, err
+	}
+	httpCli := &http.Client{
+		Transport: t,
+		Timeout:   timeout,
+	}
+	return httpCli.Do(req)
+}
+
+// DoEvalHttpRequest appel d'évaluation d'un agent : aucun controle du certificat serveur
+// (c'est l'appelant qui l'analyse), avec relevé de la demande de certificat client par l'agent
+func DoEvalHttpRequest(req *http.Request, timeout time.Duration) (*http.Response, TLSEvalInfo, error) {
+	var mu sync.Mutex
+	info := TLSEvalInfo{
+		ClientCertConfigured: hasClientCertificate(),
+	}
+	t := newTransport(&tls.Config{
+		InsecureSkipVerify: true,
+	})
+	t.DisableKeepAlives = true //transport a usage unique
+	t.TLSClientConfig.GetClientCertificate = func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		mu.Lock()
+		info.ClientCertRequested = true
+		mu.Unlock()
+		return getClientCertificate(cri)
+	}
+
+	httpCli := &http.Client{
+		Transport: t,
+		Timeout:   timeout,
+	}
+	resp, err := httpCli.Do(req)
+
+	mu.Lock()
+	defer mu.Unlock()
+	return resp, info, err
+}
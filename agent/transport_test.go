@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClientCert génère un certificat client auto signé
+func newTestClientCert(t *testing.T) (*tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cmdscheduler"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}, cert
+}
+
+// newTestAgent agent https de test, certificat client exigé si clientCA fourni
+func newTestAgent(clientCA *x509.Certificate) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+		srv.TLS = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		}
+	}
+	srv.StartTLS()
+	return srv
+}
+
+// doTestCall appel ping de l'agent
+func doTestCall(srv *httptest.Server, agentID int, pin string, caBundle string) error {
+	req, _ := http.NewRequest("GET", srv.URL+"/task/ping", nil)
+	resp, err := DoHttpRequest(req, 5*time.Second, agentID, false, pin, caBundle)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("status %v", resp.StatusCode)
+	}
+	return nil
+}
+
+func TestCertMatchPin(t *testing.T) {
+	srv := newTestAgent(nil)
+	defer srv.Close()
+
+	cert := srv.Certificate()
+	if !CertMatchPin(cert, hex.EncodeToString(cert.Signature)) || !CertMatchPin(cert, " "+CertSPKIPin(cert)+" ") {
+		t.Errorf("pin mismatch")
+	}
+	if CertMatchPin(cert, "") || CertMatchPin(nil, CertSPKIPin(cert)) || CertMatchPin(cert, "sha256/AAAA") {
+		t.Errorf("unexpected pin match")
+	}
+}
+
+func TestPinnedTransport(t *testing.T) {
+	srv := newTestAgent(nil)
+	defer srv.Close()
+	defer ReleaseHttpTransport(1)
+
+	cert := srv.Certificate()
+	if err := doTestCall(srv, 1, hex.EncodeToString(cert.Signature), ""); err != nil {
+		t.Errorf("signature pin : %v", err)
+	}
+	if err := doTestCall(srv, 1, CertSPKIPin(cert), ""); err != nil {
+		t.Errorf("spki pin : %v", err)
+	}
+	if err := doTestCall(srv, 1, "sha256/AAAA", ""); err == nil {
+		t.Errorf("pin mismatch : error expected")
+	}
+	if err := doTestCall(srv, 1, "", ""); err == nil {
+		t.Errorf("self signed without pin : error expected")
+	}
+
+	//transport réutilisé tant que la conf ne change pas
+	pin := CertSPKIPin(cert)
+	tr, _ := GetHttpTransport(1, false, pin, "")
+	if tr2, _ := GetHttpTransport(1, false, pin, ""); tr2 != tr {
+		t.Errorf("transport not reused")
+	}
+	ReleaseHttpTransport(1)
+	if tr2, _ := GetHttpTransport(1, false, pin, ""); tr2 == tr {
+		t.Errorf("transport not released")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	clientCert, clientCA := newTestClientCert(t)
+	srv := newTestAgent(clientCA)
+	defer srv.Close()
+	defer ReleaseHttpTransport(2)
+	defer setClientCertificate(nil)
+
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	setClientCertificate(nil)
+	if err := doTestCall(srv, 2, "", caBundle); err == nil {
+		t.Errorf("no client cert : error expected")
+	}
+
+	setClientCertificate(clientCert)
+	if err := doTestCall(srv, 2, "", caBundle); err != nil {
+		t.Errorf("client cert + CA bundle : %v", err)
+	}
+	if err := doTestCall(srv, 2, CertSPKIPin(srv.Certificate()), caBundle); err != nil {
+		t.Errorf("client cert + CA bundle + pin : %v", err)
+	}
+
+	//eval
+	req, _ := http.NewRequest("GET", srv.URL+"/task/ping", nil)
+	resp, info, err := DoEvalHttpRequest(req, 5*time.Second)
+	if err != nil {
+		t.Fatalf("eval : %v", err)
+	}
+	resp.Body.Close()
+	if !info.ClientCertConfigured || !info.ClientCertRequested {
+		t.Errorf("eval : client cert info %+v", info)
+	}
+}
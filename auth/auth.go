@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/slog"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCredentials authentification refusée
+var ErrInvalidCredentials = dal.ErrInvalidCredentials
+
+// Provider fournisseur d'authentification login / mot de passe
+type Provider interface {
+	// Name nom du fournisseur (local, ldap...)
+	Name() string
+	// Authenticate contrôle des identifiants, retourne l'utilisateur correspondant en base
+	// ErrInvalidCredentials si refusé, autre erreur si le fournisseur est indisponible
+	Authenticate(login string, password string) (dal.DbUser, error)
+}
+
+// chaine des fournisseurs, base locale tant que Init n'est pas appelé
+var providers = []Provider{LocalProvider{}}
+
+// Init fournisseurs d'authentification, essayés dans l'ordre
+func Init(p ...Provider) {
+	providers = p
+}
+
+// Authenticate authentification via la chaine des fournisseurs, le premier qui accepte l'emporte
+func Authenticate(login string, password string) (dal.DbUser, error) {
+	for _, p := range providers {
+		usr, err := p.Authenticate(login, password)
+		if err == nil && usr.ID > 0 && !usr.Deleted {
+			return usr, nil
+		}
+		if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+			slog.Warning("auth", "%v %v : %v", p.Name(), login, err)
+		}
+	}
+	return dal.DbUser{}, ErrInvalidCredentials
+}
+
+// LocalProvider comptes locaux, mot de passe en base
+type LocalProvider struct{}
+
+// Name nom du fournisseur
+func (LocalProvider) Name() string {
+	return "local"
+}
+
+// Authenticate contrôle du mot de passe en base, les comptes externes sont ignorés
+func (LocalProvider) Authenticate(login string, password string) (dal.DbUser, error) {
+	usr, err := dal.UserCheckAuth(login, password)
+	if err != nil {
+		return dal.DbUser{}, err
+	}
+	if usr.Source != "" {
+		return dal.DbUser{}, ErrInvalidCredentials
+	}
+	return usr, nil
+}
+
+// provision compte local d'un utilisateur externe : créé à la premiére connexion puis
+// nom et droits synchronisés à chaque connexion
+func provision(source string, login string, name string, rightLevel int) (dal.DbUser, error) {
+	login = strings.ToLower(login)
+	usr, err := dal.UserGetByLogin(login)
+	if err != nil {
+		return dal.DbUser{}, err
+	}
+
+	if usr.ID == 0 {
+		usr = dal.DbUser{Login: login, Name: name, RightLevel: rightLevel, Source: source}
+		if err = dal.UserInsert(&usr, 0); err != nil {
+			return dal.DbUser{}, err
+		}
+		slog.Trace("auth", "%v user %v provisioned", source, login)
+		return dal.UserGet(usr.ID)
+	}
+
+	//pas de reprise d'un compte local ou d'un autre fournisseur
+	if usr.Source != source {
+		slog.Warning("auth", "%v user %v : login already used by a %v account", source, login, sourceName(usr.Source))
+		return dal.DbUser{}, ErrInvalidCredentials
+	}
+	if usr.Deleted {
+		return dal.DbUser{}, ErrInvalidCredentials
+	}
+	if usr.Name != name || usr.RightLevel != rightLevel {
+		usr.Name = name
+		usr.RightLevel = rightLevel
+		usr.Password = ""
+		if err = dal.UserUpdate(usr, 0, nil); err != nil {
+			return dal.DbUser{}, err
+		}
+		return dal.UserGet(usr.ID)
+	}
+	return usr, nil
+}
+
+func sourceName(source string) string {
+	if source == "" {
+		return "local"
+	}
+	return source
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"CmdScheduler/dal"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig paramétrage du fournisseur ldap / active directory (section [ldap] de la config)
+type LDAPConfig struct {
+	URL                string         `mapstructure:"url"` // ldap://host:389 ou ldaps://host:636
+	StartTLS           bool           `mapstructure:"starttls"`
+	InsecureSkipVerify bool           `mapstructure:"insecure_skip_verify"`
+	CAFile             string         `mapstructure:"ca_file"` // autorité du certificat serveur, PEM
+	BindDN             string         `mapstructure:"bind_dn"` // compte de service pour la recherche, anonyme si vide
+	BindPassword       string         `mapstructure:"bind_password"`
+	BaseDN             string         `mapstructure:"base_dn"`
+	UserFilter         string         `mapstructure:"user_filter"`  // %s : login, ex AD (&(objectClass=user)(sAMAccountName=%s))
+	NameAttr           string         `mapstructure:"name_attr"`    // nom affiché
+	GroupAttr          string         `mapstructure:"group_attr"`   // groupes portés par l'utilisateur (memberOf)
+	GroupFilter        string         `mapstructure:"group_filter"` // alternative : recherche des groupes, %s : dn utilisateur
+	GroupBaseDN        string         `mapstructure:"group_base_dn"`
+	GroupRights        map[string]int `mapstructure:"group_rights"`       // dn ou cn du groupe -> RightLevel, le plus élevé l'emporte
+	DefaultRightLevel  int            `mapstructure:"default_rightlevel"` // sans groupe reconnu, 0 : accès refusé
+	Timeout            time.Duration  `mapstructure:"timeout"`
+}
+
+// LDAPProvider authentification par bind ldap, comptes provisionnés en base à la premiére connexion
+type LDAPProvider struct {
+	cfg       LDAPConfig
+	tlsConfig *tls.Config
+}
+
+// NewLDAPProvider contrôle de la config et valeurs par défaut
+func NewLDAPProvider(cfg LDAPConfig) (*LDAPProvider, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("invalid ldap url %v", cfg.URL)
+	}
+	if cfg.BaseDN == "" {
+		return nil, fmt.Errorf("invalid ldap base_dn")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if strings.Count(cfg.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("invalid ldap user_filter %v, %%s expected", cfg.UserFilter)
+	}
+	if cfg.GroupFilter != "" && strings.Count(cfg.GroupFilter, "%s") != 1 {
+		return nil, fmt.Errorf("invalid ldap group_filter %v, %%s expected", cfg.GroupFilter)
+	}
+	if cfg.GroupBaseDN == "" {
+		cfg.GroupBaseDN = cfg.BaseDN
+	}
+	if cfg.NameAttr == "" {
+		cfg.NameAttr = "displayName"
+	}
+	if cfg.GroupAttr == "" {
+		cfg.GroupAttr = "memberOf"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	//clés comparées sans la casse (viper passe les clés en minuscule)
+	rights := make(map[string]int, len(cfg.GroupRights))
+	for k, v := range cfg.GroupRights {
+		rights[strings.ToLower(k)] = v
+	}
+	cfg.GroupRights = rights
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldap ca_file %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ldap ca_file %v, no certificate found", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &LDAPProvider{cfg: cfg, tlsConfig: tlsConfig}, nil
+}
+
+// Name nom du fournisseur
+func (p *LDAPProvider) Name() string {
+	return "ldap"
+}
+
+// Authenticate recherche de l'utilisateur puis bind avec son mot de passe
+func (p *LDAPProvider) Authenticate(login string, password string) (dal.DbUser, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+	//mot de passe vide : bind anonyme accepté par la plupart des serveurs
+	if login == "" || password == "" {
+		return dal.DbUser{}, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return dal.DbUser{}, err
+	}
+	defer conn.Close()
+
+	if p.cfg.BindDN != "" {
+		if err = conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return dal.DbUser{}, fmt.Errorf("ldap service bind %w", err)
+		}
+	}
+
+	//recherche de l'utilisateur, unique
+	sr, err := conn.Search(ldap.NewSearchRequest(p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(p.cfg.Timeout.Seconds()), false, fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(login)),
+		[]string{p.cfg.NameAttr, p.cfg.GroupAttr}, nil))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return dal.DbUser{}, ErrInvalidCredentials
+		}
+		return dal.DbUser{}, fmt.Errorf("ldap search %w", err)
+	}
+	if len(sr.Entries) != 1 {
+		return dal.DbUser{}, ErrInvalidCredentials
+	}
+	entry := sr.Entries[0]
+
+	//bind utilisateur
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return dal.DbUser{}, ErrInvalidCredentials
+		}
+		return dal.DbUser{}, fmt.Errorf("ldap user bind %w", err)
+	}
+
+	groups := entry.GetAttributeValues(p.cfg.GroupAttr)
+	if p.cfg.GroupFilter != "" {
+		sr, err = conn.Search(ldap.NewSearchRequest(p.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, int(p.cfg.Timeout.Seconds()), false, fmt.Sprintf(p.cfg.GroupFilter, ldap.EscapeFilter(entry.DN)),
+			[]string{"dn"}, nil))
+		if err != nil {
+			return dal.DbUser{}, fmt.Errorf("ldap group search %w", err)
+		}
+		for _, g := range sr.Entries {
+			groups = append(groups, g.DN)
+		}
+	}
+
+	rightLevel := p.rightLevel(groups)
+	if rightLevel <= 0 {
+		return dal.DbUser{}, fmt.Errorf("ldap user %v : no group granting access", login)
+	}
+
+	name := entry.GetAttributeValue(p.cfg.NameAttr)
+	if name == "" {
+		name = login
+	}
+	return provision("ldap", login, name, rightLevel)
+}
+
+// dial connexion, tls selon l'url ou starttls
+func (p *LDAPProvider) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: p.cfg.Timeout}), ldap.DialWithTLSConfig(p.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial %w", err)
+	}
+	conn.SetTimeout(p.cfg.Timeout)
+	if p.cfg.StartTLS {
+		if err = conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// rightLevel droits issus des groupes (dn complet ou cn), le plus élevé l'emporte
+func (p *LDAPProvider) rightLevel(groups []string) int {
+	ret := p.cfg.DefaultRightLevel
+	for _, g := range groups {
+		keys := []string{strings.ToLower(g)}
+		if dn, err := ldap.ParseDN(g); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			keys = append(keys, strings.ToLower(dn.RDNs[0].Attributes[0].Value))
+		}
+		for _, k := range keys {
+			if r, ok := p.cfg.GroupRights[k]; ok && r > ret {
+				ret = r
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/slog"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testBaseDN  = "dc=example,dc=com"
+	testSvcDN   = "cn=svc,ou=services,dc=example,dc=com"
+	testAdmins  = "cn=cmds-admins,ou=groups,dc=example,dc=com"
+	testViewers = "cn=cmds-viewers,ou=groups,dc=example,dc=com"
+)
+
+func testEntries() []ldapEntry {
+	return []ldapEntry{
+		{DN: testSvcDN, Password: "svcpwd"},
+		{DN: "uid=alice,ou=people,dc=example,dc=com", Password: "alicepwd", Attrs: map[string][]string{
+			"uid": {"alice"}, "displayName": {"Alice Martin"}, "memberOf": {testAdmins, testViewers}}},
+		{DN: "uid=bob,ou=people,dc=example,dc=com", Password: "bobpwd", Attrs: map[string][]string{
+			"uid": {"bob"}, "displayName": {"Bob Durand"}, "memberOf": {testViewers}}},
+		{DN: "uid=carol,ou=people,dc=example,dc=com", Password: "carolpwd", Attrs: map[string][]string{
+			"uid": {"carol"}, "memberOf": {"cn=others,ou=groups,dc=example,dc=com"}}},
+		{DN: "uid=admin,ou=people,dc=example,dc=com", Password: "ldapadmin", Attrs: map[string][]string{
+			"uid": {"admin"}, "memberOf": {testAdmins}}},
+		//groupes openldap (groupOfNames)
+		{DN: testAdmins, Attrs: map[string][]string{
+			"objectClass": {"groupOfNames"}, "member": {"uid=dave,ou=people,dc=example,dc=com"}}},
+		{DN: "uid=dave,ou=people,dc=example,dc=com", Password: "davepwd", Attrs: map[string][]string{
+			"uid": {"dave"}}},
+	}
+}
+
+func testConfig(url string) LDAPConfig {
+	return LDAPConfig{
+		URL:          url,
+		BindDN:       testSvcDN,
+		BindPassword: "svcpwd",
+		BaseDN:       "ou=people," + testBaseDN,
+		GroupRights:  map[string]int{testAdmins: 100, "CMDS-Viewers": 1},
+		Timeout:      2 * time.Second,
+	}
+}
+
+func initTestDb(t *testing.T) {
+	slog.InitLogs("", 0, 0, false)
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err = dal.InitDb("sqlite3", "file:"+filepath.Join(dir, "data.db"), "SCHED"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLDAPProvider bind, provisionnement et droits issus des groupes
+func TestLDAPProvider(t *testing.T) {
+	initTestDb(t)
+	srv, err := newTestLDAPServer(nil, testEntries()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	p, err := NewLDAPProvider(testConfig(srv.URL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//premiére connexion : compte crée, groupe admin (dn) le plus élevé
+	usr, err := p.Authenticate("Alice", "alicepwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.ID == 0 || usr.Login != "alice" || usr.Name != "Alice Martin" || usr.Source != "ldap" || usr.RightLevel != 100 {
+		t.Fatalf("provisioned user %+v", usr)
+	}
+	binds := srv.lastBinds()
+	if len(binds) != 2 || binds[0] != testSvcDN || binds[1] != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Fatalf("binds %v", binds)
+	}
+	//reconnexion : même compte
+	usr2, err := p.Authenticate("alice", "alicepwd")
+	if err != nil || usr2.ID != usr.ID {
+		t.Fatalf("second login %+v %v", usr2, err)
+	}
+
+	//groupe reconnu par son cn, sans la casse
+	bob, err := p.Authenticate("bob", "bobpwd")
+	if err != nil || bob.RightLevel != 1 {
+		t.Fatalf("bob %+v %v", bob, err)
+	}
+	//changement de groupe dans l'annuaire : droits synchronisés
+	srv.setEntry(ldapEntry{DN: "uid=bob,ou=people,dc=example,dc=com", Password: "bobpwd", Attrs: map[string][]string{
+		"uid": {"bob"}, "displayName": {"Bob Durand"}, "memberOf": {testViewers, testAdmins}}})
+	bob, err = p.Authenticate("bob", "bobpwd")
+	if err != nil || bob.RightLevel != 100 {
+		t.Fatalf("bob sync %+v %v", bob, err)
+	}
+
+	//refus
+	for _, c := range []struct{ login, pwd string }{
+		{"alice", "bad"},  //mauvais mot de passe
+		{"alice", ""},     //bind anonyme
+		{"nobody", "x"},   //inconnu
+		{"*", "alicepwd"}, //filtre échappé
+	} {
+		if _, err = p.Authenticate(c.login, c.pwd); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%v/%v : %v", c.login, c.pwd, err)
+		}
+	}
+
+	//aucun groupe reconnu : refusé, sauf droits par défaut
+	if _, err = p.Authenticate("carol", "carolpwd"); err == nil {
+		t.Fatal("carol without group accepted")
+	}
+	cfg := testConfig(srv.URL())
+	cfg.DefaultRightLevel = 1
+	pDef, _ := NewLDAPProvider(cfg)
+	if carol, err := pDef.Authenticate("carol", "carolpwd"); err != nil || carol.RightLevel != 1 || carol.Name != "carol" {
+		t.Fatalf("carol default %+v %v", carol, err)
+	}
+
+	//compte désactivé en base : refusé
+	if err = dal.UserDelete(usr.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Authenticate("alice", "alicepwd"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("deleted user %v", err)
+	}
+
+	//mauvais compte de service
+	cfg = testConfig(srv.URL())
+	cfg.BindPassword = "bad"
+	pBad, _ := NewLDAPProvider(cfg)
+	if _, err = pBad.Authenticate("bob", "bobpwd"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("bad service bind %v", err)
+	}
+
+	//groupes par recherche (openldap sans memberOf)
+	cfg = testConfig(srv.URL())
+	cfg.GroupFilter = "(&(objectClass=groupOfNames)(member=%s))"
+	cfg.GroupBaseDN = "ou=groups," + testBaseDN
+	pGrp, _ := NewLDAPProvider(cfg)
+	if dave, err := pGrp.Authenticate("dave", "davepwd"); err != nil || dave.RightLevel != 100 {
+		t.Fatalf("dave group search %+v %v", dave, err)
+	}
+}
+
+// TestAuthenticate chaine local puis ldap
+func TestAuthenticate(t *testing.T) {
+	initTestDb(t)
+	srv, err := newTestLDAPServer(nil, testEntries()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	p, err := NewLDAPProvider(testConfig(srv.URL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Init(LocalProvider{}, p)
+	defer Init(LocalProvider{})
+
+	//compte local
+	usr, err := Authenticate("admin", "admin")
+	if err != nil || usr.Source != "" {
+		t.Fatalf("local admin %+v %v", usr, err)
+	}
+	//même login dans l'annuaire : pas de reprise du compte local
+	if _, err = Authenticate("admin", "ldapadmin"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("ldap admin %v", err)
+	}
+	//compte ldap
+	usr, err = Authenticate("alice", "alicepwd")
+	if err != nil || usr.Source != "ldap" {
+		t.Fatalf("ldap alice %+v %v", usr, err)
+	}
+	//le fournisseur local ne valide pas un compte ldap
+	if _, err = (LocalProvider{}).Authenticate("alice", "alicepwd"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("local alice %v", err)
+	}
+	if _, err = Authenticate("alice", "bad"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("bad password %v", err)
+	}
+
+	//annuaire indisponible : comptes locaux toujours accessibles
+	srv.Close()
+	if _, err = Authenticate("alice", "alicepwd"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("ldap down %v", err)
+	}
+	if _, err = Authenticate("admin", "admin"); err != nil {
+		t.Fatalf("local admin, ldap down %v", err)
+	}
+}
+
+// TestLDAPTLS ldaps, certificat serveur vérifié via ca_file ou ignoré
+func TestLDAPTLS(t *testing.T) {
+	initTestDb(t)
+	certPEM, cert := testCertificate(t)
+	srv, err := newTestLDAPServer(&tls.Config{Certificates: []tls.Certificate{cert}}, testEntries()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	//certificat inconnu : refus de la connexion
+	p, err := NewLDAPProvider(testConfig(srv.URL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Authenticate("bob", "bobpwd"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("untrusted certificate %v", err)
+	}
+
+	//autorité fournie
+	caFile := filepath.Join(os.TempDir(), "auth-ldap-ca.pem")
+	if err = ioutil.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caFile)
+	cfg := testConfig(srv.URL())
+	cfg.CAFile = caFile
+	if p, err = NewLDAPProvider(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Authenticate("bob", "bobpwd"); err != nil {
+		t.Fatalf("ca_file %v", err)
+	}
+
+	//vérification désactivée
+	cfg = testConfig(srv.URL())
+	cfg.InsecureSkipVerify = true
+	if p, err = NewLDAPProvider(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Authenticate("bob", "bobpwd"); err != nil {
+		t.Fatalf("insecure_skip_verify %v", err)
+	}
+}
+
+// TestNewLDAPProvider contrôle de la config
+func TestNewLDAPProvider(t *testing.T) {
+	for _, cfg := range []LDAPConfig{
+		{URL: "http://host", BaseDN: testBaseDN},
+		{URL: "ldap://host", BaseDN: ""},
+		{URL: "ldap://host", BaseDN: testBaseDN, UserFilter: "(uid=alice)"},
+		{URL: "ldap://host", BaseDN: testBaseDN, GroupFilter: "(member=x)"},
+		{URL: "ldap://host", BaseDN: testBaseDN, CAFile: "/nonexistent.pem"},
+	} {
+		if _, err := NewLDAPProvider(cfg); err == nil {
+			t.Fatalf("invalid config accepted %+v", cfg)
+		}
+	}
+	p, err := NewLDAPProvider(LDAPConfig{URL: "ldaps://host:636", BaseDN: testBaseDN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.cfg.UserFilter != "(uid=%s)" || p.cfg.GroupAttr != "memberOf" || p.tlsConfig.ServerName != "host" {
+		t.Fatalf("defaults %+v", p.cfg)
+	}
+}
+
+// testCertificate certificat auto-signé pour 127.0.0.1
+func testCertificate(t *testing.T) ([]byte, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM, cert
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// opérations ldap (tags application) utilisées par le serveur de test
+const (
+	ldapBindRequest       = 0
+	ldapBindResponse      = 1
+	ldapUnbindRequest     = 2
+	ldapSearchRequest     = 3
+	ldapSearchResultEntry = 4
+	ldapSearchResultDone  = 5
+)
+
+// ldapEntry entrée de l'annuaire de test
+type ldapEntry struct {
+	DN       string
+	Password string
+	Attrs    map[string][]string
+}
+
+// testLDAPServer annuaire ldap minimal en mémoire : bind simple, recherche par filtre and/or/not/égalité/présence
+// la recherche nécessite un bind non anonyme
+type testLDAPServer struct {
+	ln      net.Listener
+	secure  bool
+	mu      sync.Mutex
+	entries []ldapEntry
+	binds   []string //dn des binds réussis
+}
+
+// newTestLDAPServer serveur en écoute locale, ldaps si tlsConfig fourni
+func newTestLDAPServer(tlsConfig *tls.Config, entries ...ldapEntry) (*testLDAPServer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	s := &testLDAPServer{ln: ln, secure: tlsConfig != nil, entries: entries}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, nil
+}
+
+// URL url du serveur
+func (s *testLDAPServer) URL() string {
+	if s.secure {
+		return "ldaps://" + s.ln.Addr().String()
+	}
+	return "ldap://" + s.ln.Addr().String()
+}
+
+// Close arrêt de l'écoute
+func (s *testLDAPServer) Close() {
+	s.ln.Close()
+}
+
+// setEntry ajout ou remplacement d'une entrée
+func (s *testLDAPServer) setEntry(e ldapEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].DN, e.DN) {
+			s.entries[i] = e
+			return
+		}
+	}
+	s.entries = append(s.entries, e)
+}
+
+// lastBinds dn des binds réussis depuis le dernier appel
+func (s *testLDAPServer) lastBinds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := s.binds
+	s.binds = nil
+	return ret
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID := packet.Children[0].Value
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldapBindRequest:
+			dn := op.Children[1].Data.String()
+			pwd := op.Children[2].Data.String()
+			code := int64(49) //invalidCredentials
+			if dn == "" && pwd == "" {
+				bound, code = "", 0
+			} else if e := s.find(dn); e != nil && pwd != "" && e.Password == pwd {
+				bound, code = e.DN, 0
+				s.mu.Lock()
+				s.binds = append(s.binds, e.DN)
+				s.mu.Unlock()
+			}
+			conn.Write(ldapResult(msgID, ldapBindResponse, code).Bytes())
+		case ldapSearchRequest:
+			if bound == "" {
+				conn.Write(ldapResult(msgID, ldapSearchResultDone, 50).Bytes()) //insufficientAccessRights
+				continue
+			}
+			s.search(conn, msgID, op)
+		case ldapUnbindRequest:
+			return
+		default:
+			conn.Write(ldapResult(msgID, ber.Tag(op.Tag+1), 2).Bytes()) //protocolError
+		}
+	}
+}
+
+func (s *testLDAPServer) find(dn string) *ldapEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].DN, dn) {
+			e := s.entries[i]
+			return &e
+		}
+	}
+	return nil
+}
+
+func (s *testLDAPServer) search(conn net.Conn, msgID interface{}, op *ber.Packet) {
+	base := strings.ToLower(op.Children[0].Data.String())
+	sizeLimit := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, a.Data.String())
+	}
+
+	s.mu.Lock()
+	var found []ldapEntry
+	for _, e := range s.entries {
+		if strings.HasSuffix(strings.ToLower(e.DN), base) && matchFilter(e, filter) {
+			found = append(found, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for i, e := range found {
+		if sizeLimit > 0 && int64(i) >= sizeLimit {
+			conn.Write(ldapResult(msgID, ldapSearchResultDone, 4).Bytes()) //sizeLimitExceeded
+			return
+		}
+		resp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+		entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchResultEntry, nil, "Search Result Entry")
+		entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "DN"))
+		list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for _, a := range attrs {
+			vals, ok := attrValues(e, a)
+			if !ok {
+				continue
+			}
+			attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, v := range vals {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+			}
+			attr.AppendChild(set)
+			list.AppendChild(attr)
+		}
+		entry.AppendChild(list)
+		resp.AppendChild(entry)
+		conn.Write(resp.Bytes())
+	}
+	conn.Write(ldapResult(msgID, ldapSearchResultDone, 0).Bytes())
+}
+
+// attrValues valeurs d'un attribut, nom sans la casse
+func attrValues(e ldapEntry, name string) ([]string, bool) {
+	for k, v := range e.Attrs {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// matchFilter évaluation d'un filtre (and, or, not, égalité, présence)
+func matchFilter(e ldapEntry, f *ber.Packet) bool {
+	switch f.Tag {
+	case 0: //and
+		for _, c := range f.Children {
+			if !matchFilter(e, c) {
+				return false
+			}
+		}
+		return true
+	case 1: //or
+		for _, c := range f.Children {
+			if matchFilter(e, c) {
+				return true
+			}
+		}
+		return false
+	case 2: //not
+		return !matchFilter(e, f.Children[0])
+	case 3: //égalité
+		vals, _ := attrValues(e, f.Children[0].Data.String())
+		for _, v := range vals {
+			if strings.EqualFold(v, f.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case 7: //présence
+		_, ok := attrValues(e, f.Data.String())
+		return ok || strings.EqualFold(f.Data.String(), "objectClass")
+	}
+	return false
+}
+
+// ldapResult réponse ldap standard (resultCode, matchedDN, diagnosticMessage)
+func ldapResult(msgID interface{}, tag ber.Tag, code int64) *ber.Packet {
+	resp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	resp.AppendChild(res)
+	return resp
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"CmdScheduler/dal"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig paramétrage du fournisseur openid connect (section [oidc] de la config)
+type OIDCConfig struct {
+	Issuer            string         `mapstructure:"issuer"` // url de découverte : issuer + /.well-known/openid-configuration
+	ClientID          string         `mapstructure:"client_id"`
+	ClientSecret      string         `mapstructure:"client_secret"` // vide : client public, PKCE seul
+	RedirectURL       string         `mapstructure:"redirect_url"`  // https://host/cmdscheduler/auth/oidc/callback
+	Scopes            []string       `mapstructure:"scopes"`        // openid ajouté si absent
+	LoginClaim        string         `mapstructure:"login_claim"`   // défaut preferred_username
+	NameClaim         string         `mapstructure:"name_claim"`
+	GroupsClaim       string         `mapstructure:"groups_claim"`
+	GroupRights       map[string]int `mapstructure:"group_rights"`       // groupe -> RightLevel, le plus élevé l'emporte
+	DefaultRightLevel int            `mapstructure:"default_rightlevel"` // sans groupe reconnu, 0 : accès refusé
+	SuccessURL        string         `mapstructure:"success_url"`        // redirection aprés connexion, token de session en fragment (#token=)
+}
+
+// oidcClient client http des appels au fournisseur
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// OIDCProvider connexion par code d'autorisation + PKCE, comptes provisionnés en base à la premiére connexion
+// la découverte du fournisseur est faite au premier usage, et retentée tant qu'elle échoue
+type OIDCProvider struct {
+	cfg      OIDCConfig
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// OIDCLogin paramètres d'une connexion en cours, conservés côté navigateur jusqu'au retour (callback)
+type OIDCLogin struct {
+	State    string
+	Nonce    string
+	Verifier string //PKCE code_verifier
+}
+
+// NewOIDCProvider contrôle de la config et valeurs par défaut
+func NewOIDCProvider(cfg OIDCConfig) (*OIDCProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("invalid oidc config, issuer, client_id and redirect_url expected")
+	}
+	hasOpenID := false
+	for _, s := range cfg.Scopes {
+		hasOpenID = hasOpenID || s == oidc.ScopeOpenID
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"profile", "email"}
+	}
+	if !hasOpenID {
+		cfg.Scopes = append([]string{oidc.ScopeOpenID}, cfg.Scopes...)
+	}
+	if cfg.LoginClaim == "" {
+		cfg.LoginClaim = "preferred_username"
+	}
+	if cfg.NameClaim == "" {
+		cfg.NameClaim = "name"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	rights := make(map[string]int, len(cfg.GroupRights))
+	for k, v := range cfg.GroupRights {
+		rights[strings.ToLower(k)] = v
+	}
+	cfg.GroupRights = rights
+	return &OIDCProvider{cfg: cfg}, nil
+}
+
+// Name nom du fournisseur
+func (p *OIDCProvider) Name() string {
+	return "oidc"
+}
+
+// SuccessURL redirection aprés connexion, vide : réponse json
+func (p *OIDCProvider) SuccessURL() string {
+	return p.cfg.SuccessURL
+}
+
+// discover découverte du fournisseur (endpoints, clés de signature)
+func (p *OIDCProvider) discover() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+	//contexte de fond : conservé par le fournisseur pour le rechargement des clés de signature
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), oidcClient), p.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery %w", err)
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	return p.oauth, p.verifier, nil
+}
+
+// Login nouvelle connexion : url d'autorisation du fournisseur, et paramètres à conserver jusqu'au retour
+func (p *OIDCProvider) Login() (string, OIDCLogin, error) {
+	oauth, _, err := p.discover()
+	if err != nil {
+		return "", OIDCLogin{}, err
+	}
+	login := OIDCLogin{State: randomString(), Nonce: randomString(), Verifier: randomString()}
+	u := oauth.AuthCodeURL(login.State, oidc.Nonce(login.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(login.Verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	return u, login, nil
+}
+
+// Callback échange du code contre les tokens, vérification de l'id token puis provisionnement du compte
+func (p *OIDCProvider) Callback(ctx context.Context, login OIDCLogin, state string, code string) (dal.DbUser, error) {
+	if login.State == "" || state != login.State {
+		return dal.DbUser{}, fmt.Errorf("oidc invalid state")
+	}
+	if code == "" {
+		return dal.DbUser{}, fmt.Errorf("oidc missing code")
+	}
+	oauth, verifier, err := p.discover()
+	if err != nil {
+		return dal.DbUser{}, err
+	}
+
+	tok, err := oauth.Exchange(oidc.ClientContext(ctx, oidcClient), code, oauth2.SetAuthURLParam("code_verifier", login.Verifier))
+	if err != nil {
+		return dal.DbUser{}, fmt.Errorf("oidc exchange %w", err)
+	}
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return dal.DbUser{}, fmt.Errorf("oidc missing id_token")
+	}
+	idToken, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		return dal.DbUser{}, fmt.Errorf("oidc id_token %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return dal.DbUser{}, fmt.Errorf("oidc invalid nonce")
+	}
+
+	claims := make(map[string]interface{})
+	if err = idToken.Claims(&claims); err != nil {
+		return dal.DbUser{}, fmt.Errorf("oidc claims %w", err)
+	}
+	usrLogin, _ := claims[p.cfg.LoginClaim].(string)
+	usrLogin = strings.ToLower(strings.TrimSpace(usrLogin))
+	if usrLogin == "" {
+		return dal.DbUser{}, fmt.Errorf("oidc missing claim %v", p.cfg.LoginClaim)
+	}
+	rightLevel := p.rightLevel(claimStrings(claims[p.cfg.GroupsClaim]))
+	if rightLevel <= 0 {
+		return dal.DbUser{}, fmt.Errorf("oidc user %v : no group granting access", usrLogin)
+	}
+	name, _ := claims[p.cfg.NameClaim].(string)
+	if name == "" {
+		name = usrLogin
+	}
+	return provision("oidc", usrLogin, name, rightLevel)
+}
+
+// rightLevel droits issus des groupes, le plus élevé l'emporte
+func (p *OIDCProvider) rightLevel(groups []string) int {
+	ret := p.cfg.DefaultRightLevel
+	for _, g := range groups {
+		if r, ok := p.cfg.GroupRights[strings.ToLower(g)]; ok && r > ret {
+			ret = r
+		}
+	}
+	return ret
+}
+
+// claimStrings valeurs d'un claim liste ou simple chaine
+func claimStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		ret := make([]string, 0, len(t))
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// randomString valeur aléatoire url-safe (state, nonce, code_verifier)
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// pkceChallenge code_challenge S256 (RFC 7636)
+func pkceChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"CmdScheduler/auth/oidctest"
+	"CmdScheduler/dal"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// oidcAuthorize passage par l'autorisation du fournisseur de test : state et code retournés
+func oidcAuthorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status %v", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("state"), loc.Query().Get("code")
+}
+
+// TestOIDCProvider code d'autorisation + PKCE, vérification de l'id token et provisionnement
+func TestOIDCProvider(t *testing.T) {
+	initTestDb(t)
+	idp := oidctest.NewProvider("cmds", "secret")
+	defer idp.Close()
+	idp.Claims = map[string]interface{}{"sub": "u1", "preferred_username": "Erin", "name": "Erin Petit", "groups": []string{"ops", "CMDS-Admins"}}
+
+	p, err := NewOIDCProvider(OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "cmds",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/cmdscheduler/auth/oidc/callback",
+		GroupRights:  map[string]int{"cmds-admins": 100, "ops": 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	authURL, login, err := p.Login()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("code_challenge") != pkceChallenge(login.Verifier) || q.Get("code_challenge_method") != "S256" ||
+		q.Get("state") != login.State || q.Get("nonce") != login.Nonce || q.Get("scope") != "openid profile email" {
+		t.Fatalf("auth url %v", authURL)
+	}
+	state, code := oidcAuthorize(t, authURL)
+	usr, err := p.Callback(ctx, login, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.ID == 0 || usr.Login != "erin" || usr.Name != "Erin Petit" || usr.Source != "oidc" || usr.RightLevel != 100 {
+		t.Fatalf("provisioned user %+v", usr)
+	}
+	//code à usage unique
+	if _, err = p.Callback(ctx, login, state, code); err == nil {
+		t.Fatal("code reused")
+	}
+
+	//refus
+	for name, c := range map[string]struct {
+		tamper func(*OIDCLogin, *string)
+		mutate func(map[string]interface{})
+		badSig bool
+	}{
+		"state":     {tamper: func(l *OIDCLogin, s *string) { *s = "other" }},
+		"verifier":  {tamper: func(l *OIDCLogin, s *string) { l.Verifier = randomString() }},
+		"nonce":     {tamper: func(l *OIDCLogin, s *string) { l.Nonce = randomString() }},
+		"expired":   {mutate: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		"audience":  {mutate: func(c map[string]interface{}) { c["aud"] = "other" }},
+		"issuer":    {mutate: func(c map[string]interface{}) { c["iss"] = "https://other" }},
+		"signature": {badSig: true},
+		"no login":  {mutate: func(c map[string]interface{}) { delete(c, "preferred_username") }},
+		"no group":  {mutate: func(c map[string]interface{}) { c["groups"] = []string{"others"} }},
+		"deleted":   {mutate: func(c map[string]interface{}) { c["preferred_username"] = "erin"; c["groups"] = "ops" }},
+	} {
+		idp.Mutate, idp.BadSignature = c.mutate, c.badSig
+		if name == "deleted" {
+			if err = dal.UserDelete(usr.ID, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		authURL, login, err = p.Login()
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, code = oidcAuthorize(t, authURL)
+		if c.tamper != nil {
+			c.tamper(&login, &state)
+		}
+		if _, err = p.Callback(ctx, login, state, code); err == nil {
+			t.Fatalf("%v accepted", name)
+		}
+	}
+	idp.Mutate, idp.BadSignature = nil, false
+
+	//groupe unique en chaine
+	idp.Claims = map[string]interface{}{"sub": "u2", "preferred_username": "frank", "groups": "ops"}
+	authURL, login, _ = p.Login()
+	state, code = oidcAuthorize(t, authURL)
+	if usr, err = p.Callback(ctx, login, state, code); err != nil || usr.RightLevel != 10 || usr.Name != "frank" {
+		t.Fatalf("frank %+v %v", usr, err)
+	}
+
+	//login d'un compte local : pas de reprise
+	idp.Claims = map[string]interface{}{"sub": "u3", "preferred_username": "admin", "groups": "ops"}
+	authURL, login, _ = p.Login()
+	state, code = oidcAuthorize(t, authURL)
+	if _, err = p.Callback(ctx, login, state, code); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("local admin %v", err)
+	}
+
+	//mauvais secret client
+	pBad, _ := NewOIDCProvider(OIDCConfig{Issuer: idp.URL, ClientID: "cmds", ClientSecret: "bad", RedirectURL: "http://localhost/cb"})
+	authURL, login, _ = pBad.Login()
+	state, code = oidcAuthorize(t, authURL)
+	if _, err = pBad.Callback(ctx, login, state, code); err == nil {
+		t.Fatal("bad client secret accepted")
+	}
+
+	//fournisseur injoignable
+	pDown, _ := NewOIDCProvider(OIDCConfig{Issuer: "http://127.0.0.1:1", ClientID: "cmds", RedirectURL: "http://localhost/cb"})
+	if _, _, err = pDown.Login(); err == nil {
+		t.Fatal("unreachable provider")
+	}
+}
+
+// TestNewOIDCProvider contrôle de la config
+func TestNewOIDCProvider(t *testing.T) {
+	if _, err := NewOIDCProvider(OIDCConfig{Issuer: "https://idp", ClientID: "cmds"}); err == nil {
+		t.Fatal("missing redirect_url accepted")
+	}
+	p, err := NewOIDCProvider(OIDCConfig{Issuer: "https://idp", ClientID: "cmds", RedirectURL: "https://cmds/cb", Scopes: []string{"email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.cfg.Scopes) != 2 || p.cfg.Scopes[0] != "openid" || p.cfg.LoginClaim != "preferred_username" || p.cfg.GroupsClaim != "groups" {
+		t.Fatalf("defaults %+v", p.cfg)
+	}
+}
@@ -0,0 +1,833 @@
+package client
+
+import (
+	"CmdScheduler/ctrl"
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// routes des listes, pour Pager
+const (
+	PathAudit         = "/audit"
+	PathGitOpsManaged = "/gitops/managed"
+	PathUsers         = "/users"
+	PathAPITokens     = "/apitokens"
+	PathMyAPITokens   = "/my/apitokens"
+	PathRoles         = "/roles"
+	PathGroups        = "/groups"
+	PathAgents        = "/agents"
+	PathQueues        = "/queues"
+	PathTags          = "/tags"
+	PathSecrets       = "/secrets"
+	PathNotifications = "/notifications"
+	PathTasks         = "/tasks"
+	PathScheds        = "/scheds"
+	PathTaskFlows     = "/taskflows"
+	PathRuns          = "/runs"
+	PathSLABreaches   = "/slabreaches"
+)
+
+func itemPath(path string, id int) string {
+	return path + "/" + strconv.Itoa(id)
+}
+
+// Ping healthcheck
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Raw(ctx, http.MethodGet, "/ping", nil, "", nil)
+	return err
+}
+
+// Login ouverture de session avec login/mot de passe (WithCredentials)
+func (c *Client) Login(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodPost, c.url+Root+"/auth", nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(c.login, c.password)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	b, err := readResp(resp)
+	if err != nil {
+		return err
+	}
+	var tok ctrl.JSONTokenResp
+	if err = json.Unmarshal(b, &tok); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.token = tok.Token
+	c.mutex.Unlock()
+	return nil
+}
+
+// Logout fermeture de la session
+func (c *Client) Logout(ctx context.Context) error {
+	token := c.Token()
+	if token == "" {
+		return nil
+	}
+	_, err := c.sendWithToken(ctx, c.http, request{method: http.MethodGet, path: "/disconnect"}, token)
+	c.mutex.Lock()
+	c.token = ""
+	c.mutex.Unlock()
+	return err
+}
+
+// MyRights droits de l'utilisateur connecté
+func (c *Client) MyRights(ctx context.Context) (map[string]dal.RightView, error) {
+	var resp map[string]dal.RightView
+	err := c.Do(ctx, http.MethodGet, "/my/right", nil, nil, &resp)
+	return resp, err
+}
+
+// QueueState état des queues et taskflows en cours
+func (c *Client) QueueState(ctx context.Context) (schd.WipView, error) {
+	var resp schd.WipView
+	err := c.Do(ctx, http.MethodGet, "/queue/state", nil, nil, &resp)
+	return resp, err
+}
+
+// Metrics métriques au format texte prometheus
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	b, err := c.Raw(ctx, http.MethodGet, "/metrics", nil, "", nil)
+	return string(b), err
+}
+
+// Event évènement du flux /events, Data à décoder selon Type (cf schd.EvtXxx)
+type Event struct {
+	Type string          `json:"type"`
+	At   time.Time       `json:"at"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Events abonnement au flux d'évènements, bloquant jusqu'à annulation du contexte, fin du flux ou erreur de fn
+func (c *Client) Events(ctx context.Context, fn func(Event) error) error {
+	//pas de timeout global sur un flux
+	h := *c.http
+	h.Timeout = 0
+	resp, err := c.send(ctx, &h, request{method: http.MethodGet, path: "/events"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, err = readResp(resp)
+		return err
+	}
+	defer resp.Body.Close()
+
+	scan := bufio.NewScanner(resp.Body)
+	scan.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scan.Scan() {
+		line := scan.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var evt Event
+			err = json.Unmarshal([]byte(data.String()), &evt)
+			data.Reset()
+			if err != nil {
+				return err
+			}
+			if err = fn(evt); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scan.Err()
+}
+
+// AuditList trace des modifications
+func (c *Client) AuditList(ctx context.Context, q Query) ([]dal.DbAudit, dal.PagedResponse, error) {
+	var data []dal.DbAudit
+	resp, err := c.list(ctx, PathAudit, q, &data)
+	return data, resp, err
+}
+
+// AuditPager parcours de la trace des modifications
+func (c *Client) AuditPager(q Query) *Pager { return c.Pager(PathAudit, q) }
+
+// Export bundle de configuration
+func (c *Client) Export(ctx context.Context) (dal.Bundle, error) {
+	var resp dal.Bundle
+	err := c.Do(ctx, http.MethodGet, "/export", nil, nil, &resp)
+	return resp, err
+}
+
+// ExportYAML bundle de configuration au format yaml
+func (c *Client) ExportYAML(ctx context.Context) ([]byte, error) {
+	return c.Raw(ctx, http.MethodGet, "/export", url.Values{"format": {"yaml"}}, "", nil)
+}
+
+func importQuery(dryRun, prune bool) url.Values {
+	q := url.Values{}
+	if dryRun {
+		q.Set("dryrun", "1")
+	}
+	if prune {
+		q.Set("prune", "1")
+	}
+	return q
+}
+
+// Import plan (dryRun) ou application d'un bundle, prune : suppression de l'existant absent du bundle
+func (c *Client) Import(ctx context.Context, b *dal.Bundle, dryRun, prune bool) (ctrl.BundleImportResp, error) {
+	var resp ctrl.BundleImportResp
+	err := c.Do(ctx, http.MethodPost, "/import", importQuery(dryRun, prune), b, &resp)
+	return resp, err
+}
+
+// ImportYAML import d'un bundle yaml
+func (c *Client) ImportYAML(ctx context.Context, data []byte, dryRun, prune bool) (ctrl.BundleImportResp, error) {
+	var resp ctrl.BundleImportResp
+	b, err := c.Raw(ctx, http.MethodPost, "/import", importQuery(dryRun, prune), "application/yaml", data)
+	if err == nil {
+		err = json.Unmarshal(b, &resp)
+	}
+	return resp, err
+}
+
+func legacyQuery(opt dal.LegacyImportOpt, dryRun bool) url.Values {
+	q := importQuery(dryRun, false)
+	q.Set("agent", opt.Agent)
+	if opt.Queue != "" {
+		q.Set("queue", opt.Queue)
+	}
+	if opt.Prefix != "" {
+		q.Set("prefix", opt.Prefix)
+	}
+	if opt.Activ {
+		q.Set("activ", "1")
+	}
+	if opt.TimeZone != "" {
+		q.Set("tz", opt.TimeZone)
+	}
+	if opt.System {
+		q.Set("system", "1")
+	}
+	return q
+}
+
+// ImportCrontab conversion et plan/application d'une crontab
+func (c *Client) ImportCrontab(ctx context.Context, crontab string, opt dal.LegacyImportOpt, dryRun bool) (ctrl.LegacyImportResp, error) {
+	var resp ctrl.LegacyImportResp
+	b, err := c.Raw(ctx, http.MethodPost, "/import/crontab", legacyQuery(opt, dryRun), "text/plain", []byte(crontab))
+	if err == nil {
+		err = json.Unmarshal(b, &resp)
+	}
+	return resp, err
+}
+
+// ImportSchTasks conversion et plan/application de l'export xml d'une tache planifiée windows
+func (c *Client) ImportSchTasks(ctx context.Context, name string, data []byte, opt dal.LegacyImportOpt, dryRun bool) (ctrl.LegacyImportResp, error) {
+	var resp ctrl.LegacyImportResp
+	q := legacyQuery(opt, dryRun)
+	q.Set("name", name)
+	b, err := c.Raw(ctx, http.MethodPost, "/import/schtasks", q, "application/xml", data)
+	if err == nil {
+		err = json.Unmarshal(b, &resp)
+	}
+	return resp, err
+}
+
+// GitOpsStatus état de la synchro gitops
+func (c *Client) GitOpsStatus(ctx context.Context) (schd.GitOpsStatus, error) {
+	var resp schd.GitOpsStatus
+	err := c.Do(ctx, http.MethodGet, "/gitops/status", nil, nil, &resp)
+	return resp, err
+}
+
+// GitOpsSync synchro gitops immédiate
+func (c *Client) GitOpsSync(ctx context.Context) (schd.GitOpsStatus, error) {
+	var resp schd.GitOpsStatus
+	err := c.Do(ctx, http.MethodPost, "/gitops/sync", nil, nil, &resp)
+	return resp, err
+}
+
+// GitOpsManaged entités gérées par gitops
+func (c *Client) GitOpsManaged(ctx context.Context, q Query) ([]dal.DbManaged, dal.PagedResponse, error) {
+	var data []dal.DbManaged
+	resp, err := c.list(ctx, PathGitOpsManaged, q, &data)
+	return data, resp, err
+}
+
+// UserList liste des utilisateurs
+func (c *Client) UserList(ctx context.Context, q Query) ([]dal.DbUser, dal.PagedResponse, error) {
+	var data []dal.DbUser
+	resp, err := c.list(ctx, PathUsers, q, &data)
+	return data, resp, err
+}
+
+// UserPager parcours des utilisateurs
+func (c *Client) UserPager(q Query) *Pager { return c.Pager(PathUsers, q) }
+
+// UserGet lecture d'un utilisateur
+func (c *Client) UserGet(ctx context.Context, id int) (dal.DbUser, error) {
+	var resp dal.DbUser
+	err := c.Do(ctx, http.MethodGet, itemPath(PathUsers, id), nil, nil, &resp)
+	return resp, err
+}
+
+// UserCreate création d'un utilisateur
+func (c *Client) UserCreate(ctx context.Context, elm dal.DbUser) (dal.DbUser, error) {
+	err := c.Do(ctx, http.MethodPost, PathUsers, nil, &elm, &elm)
+	return elm, err
+}
+
+// UserUpdate maj d'un utilisateur
+func (c *Client) UserUpdate(ctx context.Context, elm dal.DbUser) (dal.DbUser, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathUsers, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// UserDelete suppression d'un utilisateur
+func (c *Client) UserDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathUsers, id), nil, nil, nil)
+}
+
+// APITokenList liste des tokens d'api de tous les utilisateurs (admin)
+func (c *Client) APITokenList(ctx context.Context, q Query) ([]dal.DbAPIToken, dal.PagedResponse, error) {
+	var data []dal.DbAPIToken
+	resp, err := c.list(ctx, PathAPITokens, q, &data)
+	return data, resp, err
+}
+
+// APITokenGet lecture d'un token d'api (sans sa valeur)
+func (c *Client) APITokenGet(ctx context.Context, id int) (dal.DbAPIToken, error) {
+	var resp dal.DbAPIToken
+	err := c.Do(ctx, http.MethodGet, itemPath(PathAPITokens, id), nil, nil, &resp)
+	return resp, err
+}
+
+// APITokenCreate création d'un token pour l'utilisateur elm.UserID, valeur du token dans Token
+func (c *Client) APITokenCreate(ctx context.Context, elm dal.DbAPIToken) (dal.DbAPIToken, error) {
+	err := c.Do(ctx, http.MethodPost, PathAPITokens, nil, &elm, &elm)
+	return elm, err
+}
+
+// APITokenUpdate maj d'un token (nom, droits, tags, expiration)
+func (c *Client) APITokenUpdate(ctx context.Context, elm dal.DbAPIToken) (dal.DbAPIToken, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathAPITokens, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// APITokenDelete révocation d'un token
+func (c *Client) APITokenDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathAPITokens, id), nil, nil, nil)
+}
+
+// RoleList liste des rôles
+func (c *Client) RoleList(ctx context.Context, q Query) ([]dal.DbRole, dal.PagedResponse, error) {
+	var data []dal.DbRole
+	resp, err := c.list(ctx, PathRoles, q, &data)
+	return data, resp, err
+}
+
+// RoleGet lecture d'un rôle
+func (c *Client) RoleGet(ctx context.Context, id int) (dal.DbRole, error) {
+	var resp dal.DbRole
+	err := c.Do(ctx, http.MethodGet, itemPath(PathRoles, id), nil, nil, &resp)
+	return resp, err
+}
+
+// RoleCreate création d'un rôle et de ses membres
+func (c *Client) RoleCreate(ctx context.Context, elm dal.DbRole) (dal.DbRole, error) {
+	err := c.Do(ctx, http.MethodPost, PathRoles, nil, &elm, &elm)
+	return elm, err
+}
+
+// RoleUpdate maj d'un rôle (permissions, périmétre, membres)
+func (c *Client) RoleUpdate(ctx context.Context, elm dal.DbRole) (dal.DbRole, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathRoles, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// RoleDelete suppression d'un rôle
+func (c *Client) RoleDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathRoles, id), nil, nil, nil)
+}
+
+// GroupList liste des groupes
+func (c *Client) GroupList(ctx context.Context, q Query) ([]dal.DbGroup, dal.PagedResponse, error) {
+	var data []dal.DbGroup
+	resp, err := c.list(ctx, PathGroups, q, &data)
+	return data, resp, err
+}
+
+// GroupGet lecture d'un groupe
+func (c *Client) GroupGet(ctx context.Context, id int) (dal.DbGroup, error) {
+	var resp dal.DbGroup
+	err := c.Do(ctx, http.MethodGet, itemPath(PathGroups, id), nil, nil, &resp)
+	return resp, err
+}
+
+// GroupCreate création d'un groupe et de ses membres
+func (c *Client) GroupCreate(ctx context.Context, elm dal.DbGroup) (dal.DbGroup, error) {
+	err := c.Do(ctx, http.MethodPost, PathGroups, nil, &elm, &elm)
+	return elm, err
+}
+
+// GroupUpdate maj d'un groupe (tags, emails, membres)
+func (c *Client) GroupUpdate(ctx context.Context, elm dal.DbGroup) (dal.DbGroup, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathGroups, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// GroupDelete suppression d'un groupe, ses éléments deviennent sans propriétaire
+func (c *Client) GroupDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathGroups, id), nil, nil, nil)
+}
+
+// MyGroups groupes de l'utilisateur connecté
+func (c *Client) MyGroups(ctx context.Context) ([]dal.DbGroup, error) {
+	var resp []dal.DbGroup
+	err := c.Do(ctx, http.MethodGet, "/my/groups", nil, nil, &resp)
+	return resp, err
+}
+
+// MyAPITokenList tokens d'api de l'utilisateur connecté
+func (c *Client) MyAPITokenList(ctx context.Context, q Query) ([]dal.DbAPIToken, dal.PagedResponse, error) {
+	var data []dal.DbAPIToken
+	resp, err := c.list(ctx, PathMyAPITokens, q, &data)
+	return data, resp, err
+}
+
+// MyAPITokenCreate création d'un token pour l'utilisateur connecté, valeur du token dans Token
+func (c *Client) MyAPITokenCreate(ctx context.Context, elm dal.DbAPIToken) (dal.DbAPIToken, error) {
+	err := c.Do(ctx, http.MethodPost, PathMyAPITokens, nil, &elm, &elm)
+	return elm, err
+}
+
+// MyAPITokenDelete révocation d'un token de l'utilisateur connecté
+func (c *Client) MyAPITokenDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathMyAPITokens, id), nil, nil, nil)
+}
+
+// AgentList liste des agents
+func (c *Client) AgentList(ctx context.Context, q Query) ([]dal.DbAgent, dal.PagedResponse, error) {
+	var data []dal.DbAgent
+	resp, err := c.list(ctx, PathAgents, q, &data)
+	return data, resp, err
+}
+
+// AgentPager parcours des agents
+func (c *Client) AgentPager(q Query) *Pager { return c.Pager(PathAgents, q) }
+
+// AgentGet lecture d'un agent
+func (c *Client) AgentGet(ctx context.Context, id int) (dal.DbAgent, error) {
+	var resp dal.DbAgent
+	err := c.Do(ctx, http.MethodGet, itemPath(PathAgents, id), nil, nil, &resp)
+	return resp, err
+}
+
+// AgentCreate création d'un agent
+func (c *Client) AgentCreate(ctx context.Context, elm dal.DbAgent) (dal.DbAgent, error) {
+	err := c.Do(ctx, http.MethodPost, PathAgents, nil, &elm, &elm)
+	return elm, err
+}
+
+// AgentUpdate maj d'un agent
+func (c *Client) AgentUpdate(ctx context.Context, elm dal.DbAgent) (dal.DbAgent, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathAgents, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// AgentDelete suppression d'un agent
+func (c *Client) AgentDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathAgents, id), nil, nil, nil)
+}
+
+// AgentEvaluate test de connexion à un agent, résultat dans les champs EvalResultXxx
+func (c *Client) AgentEvaluate(ctx context.Context, elm dal.DbAgent) (dal.DbAgent, error) {
+	err := c.Do(ctx, http.MethodPost, PathAgents+"/eval", nil, &elm, &elm)
+	return elm, err
+}
+
+// QueueList liste des queues
+func (c *Client) QueueList(ctx context.Context, q Query) ([]dal.DbQueue, dal.PagedResponse, error) {
+	var data []dal.DbQueue
+	resp, err := c.list(ctx, PathQueues, q, &data)
+	return data, resp, err
+}
+
+// QueuePager parcours des queues
+func (c *Client) QueuePager(q Query) *Pager { return c.Pager(PathQueues, q) }
+
+// QueueGet lecture d'une queue
+func (c *Client) QueueGet(ctx context.Context, id int) (dal.DbQueue, error) {
+	var resp dal.DbQueue
+	err := c.Do(ctx, http.MethodGet, itemPath(PathQueues, id), nil, nil, &resp)
+	return resp, err
+}
+
+// QueueCreate création d'une queue
+func (c *Client) QueueCreate(ctx context.Context, elm dal.DbQueue) (dal.DbQueue, error) {
+	err := c.Do(ctx, http.MethodPost, PathQueues, nil, &elm, &elm)
+	return elm, err
+}
+
+// QueueUpdate maj d'une queue (pause incluse)
+func (c *Client) QueueUpdate(ctx context.Context, elm dal.DbQueue) (dal.DbQueue, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathQueues, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// QueueDelete suppression d'une queue
+func (c *Client) QueueDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathQueues, id), nil, nil, nil)
+}
+
+// TagList liste des tags
+func (c *Client) TagList(ctx context.Context, q Query) ([]dal.DbTag, dal.PagedResponse, error) {
+	var data []dal.DbTag
+	resp, err := c.list(ctx, PathTags, q, &data)
+	return data, resp, err
+}
+
+// TagPager parcours des tags
+func (c *Client) TagPager(q Query) *Pager { return c.Pager(PathTags, q) }
+
+// TagGet lecture d'un tag
+func (c *Client) TagGet(ctx context.Context, id int) (dal.DbTag, error) {
+	var resp dal.DbTag
+	err := c.Do(ctx, http.MethodGet, itemPath(PathTags, id), nil, nil, &resp)
+	return resp, err
+}
+
+// TagCreate création d'un tag
+func (c *Client) TagCreate(ctx context.Context, elm dal.DbTag) (dal.DbTag, error) {
+	err := c.Do(ctx, http.MethodPost, PathTags, nil, &elm, &elm)
+	return elm, err
+}
+
+// TagUpdate maj d'un tag
+func (c *Client) TagUpdate(ctx context.Context, elm dal.DbTag) (dal.DbTag, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathTags, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// TagDelete suppression d'un tag
+func (c *Client) TagDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathTags, id), nil, nil, nil)
+}
+
+// SecretList liste des secrets (valeurs masquées)
+func (c *Client) SecretList(ctx context.Context, q Query) ([]dal.DbSecret, dal.PagedResponse, error) {
+	var data []dal.DbSecret
+	resp, err := c.list(ctx, PathSecrets, q, &data)
+	return data, resp, err
+}
+
+// SecretPager parcours des secrets
+func (c *Client) SecretPager(q Query) *Pager { return c.Pager(PathSecrets, q) }
+
+// SecretGet lecture d'un secret
+func (c *Client) SecretGet(ctx context.Context, id int) (dal.DbSecret, error) {
+	var resp dal.DbSecret
+	err := c.Do(ctx, http.MethodGet, itemPath(PathSecrets, id), nil, nil, &resp)
+	return resp, err
+}
+
+// SecretCreate création d'un secret
+func (c *Client) SecretCreate(ctx context.Context, elm dal.DbSecret) (dal.DbSecret, error) {
+	err := c.Do(ctx, http.MethodPost, PathSecrets, nil, &elm, &elm)
+	return elm, err
+}
+
+// SecretUpdate maj d'un secret
+func (c *Client) SecretUpdate(ctx context.Context, elm dal.DbSecret) (dal.DbSecret, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathSecrets, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// SecretDelete suppression d'un secret
+func (c *Client) SecretDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathSecrets, id), nil, nil, nil)
+}
+
+// NotificationList liste des canaux de notification
+func (c *Client) NotificationList(ctx context.Context, q Query) ([]dal.DbNotification, dal.PagedResponse, error) {
+	var data []dal.DbNotification
+	resp, err := c.list(ctx, PathNotifications, q, &data)
+	return data, resp, err
+}
+
+// NotificationPager parcours des canaux de notification
+func (c *Client) NotificationPager(q Query) *Pager { return c.Pager(PathNotifications, q) }
+
+// NotificationGet lecture d'un canal de notification
+func (c *Client) NotificationGet(ctx context.Context, id int) (dal.DbNotification, error) {
+	var resp dal.DbNotification
+	err := c.Do(ctx, http.MethodGet, itemPath(PathNotifications, id), nil, nil, &resp)
+	return resp, err
+}
+
+// NotificationCreate création d'un canal de notification
+func (c *Client) NotificationCreate(ctx context.Context, elm dal.DbNotification) (dal.DbNotification, error) {
+	err := c.Do(ctx, http.MethodPost, PathNotifications, nil, &elm, &elm)
+	return elm, err
+}
+
+// NotificationUpdate maj d'un canal de notification
+func (c *Client) NotificationUpdate(ctx context.Context, elm dal.DbNotification) (dal.DbNotification, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathNotifications, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// NotificationDelete suppression d'un canal de notification
+func (c *Client) NotificationDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathNotifications, id), nil, nil, nil)
+}
+
+// NotificationTest envoi d'un évènement de test sur le canal
+func (c *Client) NotificationTest(ctx context.Context, elm dal.DbNotification) error {
+	return c.Do(ctx, http.MethodPost, PathNotifications+"/test", nil, &elm, nil)
+}
+
+// TaskList liste des taches
+func (c *Client) TaskList(ctx context.Context, q Query) ([]dal.DbTask, dal.PagedResponse, error) {
+	var data []dal.DbTask
+	resp, err := c.list(ctx, PathTasks, q, &data)
+	return data, resp, err
+}
+
+// TaskPager parcours des taches
+func (c *Client) TaskPager(q Query) *Pager { return c.Pager(PathTasks, q) }
+
+// TaskGet lecture d'une tache
+func (c *Client) TaskGet(ctx context.Context, id int) (dal.DbTask, error) {
+	var resp dal.DbTask
+	err := c.Do(ctx, http.MethodGet, itemPath(PathTasks, id), nil, nil, &resp)
+	return resp, err
+}
+
+// TaskCreate création d'une tache
+func (c *Client) TaskCreate(ctx context.Context, elm dal.DbTask) (dal.DbTask, error) {
+	err := c.Do(ctx, http.MethodPost, PathTasks, nil, &elm, &elm)
+	return elm, err
+}
+
+// TaskUpdate maj d'une tache
+func (c *Client) TaskUpdate(ctx context.Context, elm dal.DbTask) (dal.DbTask, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathTasks, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// TaskDelete suppression d'une tache
+func (c *Client) TaskDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathTasks, id), nil, nil, nil)
+}
+
+// CfgList liste des clés de config
+func (c *Client) CfgList(ctx context.Context) ([]dal.KVJSON, error) {
+	var resp []dal.KVJSON
+	err := c.Do(ctx, http.MethodGet, "/cfgs", nil, nil, &resp)
+	return resp, err
+}
+
+// CfgGet lecture d'une clé de config
+func (c *Client) CfgGet(ctx context.Context, key string) (dal.KVJSON, error) {
+	var resp dal.KVJSON
+	err := c.Do(ctx, http.MethodGet, "/cfgs/"+url.PathEscape(key), nil, nil, &resp)
+	return resp, err
+}
+
+// CfgSet maj d'une clé de config
+func (c *Client) CfgSet(ctx context.Context, key, value string) (dal.KVJSON, error) {
+	elm := dal.KVJSON{Key: key, Value: value}
+	err := c.Do(ctx, http.MethodPost, "/cfgs", nil, &elm, &elm)
+	return elm, err
+}
+
+// VarList liste des variables globales
+func (c *Client) VarList(ctx context.Context) ([]dal.DbVar, error) {
+	var resp []dal.DbVar
+	err := c.Do(ctx, http.MethodGet, "/vars", nil, nil, &resp)
+	return resp, err
+}
+
+// VarSet maj d'une variable globale (valeur vide : suppression)
+func (c *Client) VarSet(ctx context.Context, elm dal.DbVar) (dal.DbVar, error) {
+	err := c.Do(ctx, http.MethodPost, "/vars", nil, &elm, &elm)
+	return elm, err
+}
+
+// VarUsages taches et taskflows utilisant les variables (name vide : toutes)
+func (c *Client) VarUsages(ctx context.Context, name string) ([]dal.VarUsage, error) {
+	var resp []dal.VarUsage
+	var q url.Values
+	if name != "" {
+		q = url.Values{"name": {name}}
+	}
+	err := c.Do(ctx, http.MethodGet, "/vars/usages", q, nil, &resp)
+	return resp, err
+}
+
+// SchedList liste des planifications
+func (c *Client) SchedList(ctx context.Context, q Query) ([]dal.DbSched, dal.PagedResponse, error) {
+	var data []dal.DbSched
+	resp, err := c.list(ctx, PathScheds, q, &data)
+	return data, resp, err
+}
+
+// SchedPager parcours des planifications
+func (c *Client) SchedPager(q Query) *Pager { return c.Pager(PathScheds, q) }
+
+// SchedGet lecture d'une planification
+func (c *Client) SchedGet(ctx context.Context, id int) (dal.DbSched, error) {
+	var resp dal.DbSched
+	err := c.Do(ctx, http.MethodGet, itemPath(PathScheds, id), nil, nil, &resp)
+	return resp, err
+}
+
+// SchedCreate création d'une planification
+func (c *Client) SchedCreate(ctx context.Context, elm dal.DbSched) (dal.DbSched, error) {
+	err := c.Do(ctx, http.MethodPost, PathScheds, nil, &elm, &elm)
+	return elm, err
+}
+
+// SchedUpdate maj d'une planification
+func (c *Client) SchedUpdate(ctx context.Context, elm dal.DbSched) (dal.DbSched, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathScheds, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// SchedDelete suppression d'une planification
+func (c *Client) SchedDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathScheds, id), nil, nil, nil)
+}
+
+// TaskFlowList liste des taskflows
+func (c *Client) TaskFlowList(ctx context.Context, q Query) ([]dal.DbTaskFlow, dal.PagedResponse, error) {
+	var data []dal.DbTaskFlow
+	resp, err := c.list(ctx, PathTaskFlows, q, &data)
+	return data, resp, err
+}
+
+// TaskFlowPager parcours des taskflows
+func (c *Client) TaskFlowPager(q Query) *Pager { return c.Pager(PathTaskFlows, q) }
+
+// TaskFlowGet lecture d'un taskflow
+func (c *Client) TaskFlowGet(ctx context.Context, id int) (dal.DbTaskFlow, error) {
+	var resp dal.DbTaskFlow
+	err := c.Do(ctx, http.MethodGet, itemPath(PathTaskFlows, id), nil, nil, &resp)
+	return resp, err
+}
+
+// TaskFlowCreate création d'un taskflow
+func (c *Client) TaskFlowCreate(ctx context.Context, elm dal.DbTaskFlow) (dal.DbTaskFlow, error) {
+	err := c.Do(ctx, http.MethodPost, PathTaskFlows, nil, &elm, &elm)
+	return elm, err
+}
+
+// TaskFlowUpdate maj d'un taskflow
+func (c *Client) TaskFlowUpdate(ctx context.Context, elm dal.DbTaskFlow) (dal.DbTaskFlow, error) {
+	err := c.Do(ctx, http.MethodPut, itemPath(PathTaskFlows, elm.ID), nil, &elm, &elm)
+	return elm, err
+}
+
+// TaskFlowDelete suppression d'un taskflow
+func (c *Client) TaskFlowDelete(ctx context.Context, id int) error {
+	return c.Do(ctx, http.MethodDelete, itemPath(PathTaskFlows, id), nil, nil, nil)
+}
+
+// TaskFlowLaunch lancement manuel, args : surcharge des arguments nommés, retourne le run id
+func (c *Client) TaskFlowLaunch(ctx context.Context, id int, args map[string]string) (string, error) {
+	var resp ctrl.LaunchResp
+	err := c.Do(ctx, http.MethodPost, PathTaskFlows+"/launch", nil, &ctrl.LaunchQuery{ID: id, Args: args}, &resp)
+	return resp.RunID, err
+}
+
+// TaskFlowRenderArgs rendu d'un modéle d'argument
+func (c *Client) TaskFlowRenderArgs(ctx context.Context, q ctrl.RenderArgsQuery) (ctrl.RenderArgsResp, error) {
+	var resp ctrl.RenderArgsResp
+	err := c.Do(ctx, http.MethodPost, PathTaskFlows+"/renderargs", nil, &q, &resp)
+	return resp, err
+}
+
+// TaskFlowVersionList versions d'un taskflow (sans les définitions)
+func (c *Client) TaskFlowVersionList(ctx context.Context, id int, q Query) ([]dal.DbTaskFlowVersion, dal.PagedResponse, error) {
+	var data []dal.DbTaskFlowVersion
+	resp, err := c.list(ctx, itemPath(PathTaskFlows, id)+"/versions", q, &data)
+	return data, resp, err
+}
+
+func versionPath(id, version int) string {
+	return itemPath(PathTaskFlows, id) + "/versions/" + strconv.Itoa(version)
+}
+
+// TaskFlowVersionGet lecture d'une version, 0 : dernière
+func (c *Client) TaskFlowVersionGet(ctx context.Context, id, version int) (dal.DbTaskFlowVersion, error) {
+	var resp dal.DbTaskFlowVersion
+	err := c.Do(ctx, http.MethodGet, versionPath(id, version), nil, nil, &resp)
+	return resp, err
+}
+
+// TaskFlowVersionDiff diff de la version vers la version to (0 : dernière)
+func (c *Client) TaskFlowVersionDiff(ctx context.Context, id, version, to int) (map[string]interface{}, error) {
+	var resp map[string]interface{}
+	q := url.Values{"to": {strconv.Itoa(to)}}
+	err := c.Do(ctx, http.MethodGet, versionPath(id, version)+"/diff", q, nil, &resp)
+	return resp, err
+}
+
+// TaskFlowVersionRestore restauration d'une version, tasks : taches référencées incluses
+func (c *Client) TaskFlowVersionRestore(ctx context.Context, id, version int, tasks bool) (dal.DbTaskFlow, error) {
+	var resp dal.DbTaskFlow
+	var q url.Values
+	if tasks {
+		q = url.Values{"tasks": {"1"}}
+	}
+	err := c.Do(ctx, http.MethodPost, versionPath(id, version)+"/restore", q, nil, &resp)
+	return resp, err
+}
+
+// RunList historique d'exec
+func (c *Client) RunList(ctx context.Context, q Query) ([]dal.DbTaskFlowRun, dal.PagedResponse, error) {
+	var data []dal.DbTaskFlowRun
+	resp, err := c.list(ctx, PathRuns, q, &data)
+	return data, resp, err
+}
+
+// RunPager parcours de l'historique d'exec
+func (c *Client) RunPager(q Query) *Pager { return c.Pager(PathRuns, q) }
+
+// RunGet trace d'exec d'un run id, IsNotFound tant que l'exec n'est pas terminée
+func (c *Client) RunGet(ctx context.Context, runID string) (dal.DbTaskFlowRun, error) {
+	data, _, err := c.RunList(ctx, Query{}.Where("runid", "eq:"+runID))
+	if err != nil {
+		return dal.DbTaskFlowRun{}, err
+	}
+	if len(data) == 0 {
+		return dal.DbTaskFlowRun{}, &APIError{StatusCode: http.StatusNotFound, Message: "run " + runID + " not found"}
+	}
+	return data[0], nil
+}
+
+// SLABreachList historique des dépassements de sla
+func (c *Client) SLABreachList(ctx context.Context, q Query) ([]dal.DbSLABreach, dal.PagedResponse, error) {
+	var data []dal.DbSLABreach
+	resp, err := c.list(ctx, PathSLABreaches, q, &data)
+	return data, resp, err
+}
+
+// SLABreachPager parcours des dépassements de sla
+func (c *Client) SLABreachPager(q Query) *Pager { return c.Pager(PathSLABreaches, q) }
@@ -0,0 +1,308 @@
+// Package client client go de l'api rest CmdScheduler
+//
+//	c := client.New("http://host:8100", client.WithCredentials("login", "pass"))
+//	runID, err := c.TaskFlowLaunch(ctx, 12, map[string]string{"day": "2024-01-02"})
+//
+// Le token de session est obtenu au premier appel puis renouvelé sur 401 (session expirée)
+package client
+
+import (
+	"CmdScheduler/dal"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Root racine des routes de l'api
+const Root = "/cmdscheduler"
+
+// Client accés à l'api, utilisable en concurrence
+type Client struct {
+	url      string
+	login    string
+	password string
+	http     *http.Client
+
+	mutex sync.Mutex
+	token string
+}
+
+// Option paramétrage du client
+type Option func(*Client)
+
+// WithCredentials login/mot de passe : authentification automatique, et renouvelée si la session expire
+func WithCredentials(login, password string) Option {
+	return func(c *Client) {
+		c.login = login
+		c.password = password
+	}
+}
+
+// WithToken token de session existant, ou token d'api (cst_...)
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient client http spécifique (tls, proxy, timeout)
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// New client de l'api, baseURL : http://host:port
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		url:  strings.TrimSuffix(baseURL, "/"),
+		http: &http.Client{Timeout: 60 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token token de session en cours
+func (c *Client) Token() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.token
+}
+
+// APIError réponse d'erreur de l'api
+type APIError struct {
+	StatusCode int
+	Message    string `json:"errorMessage"`
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("api error %v %v", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("api error %v : %v", e.StatusCode, e.Message)
+}
+
+// IsNotFound erreur 404 de l'api
+func IsNotFound(err error) bool {
+	e, ok := err.(*APIError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// request requete à émettre, corps rejouable pour la ré-authentification
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	contentType string
+	body        []byte
+}
+
+// send émission, 401 : ré-authentification puis nouvel essai si login/mot de passe fournis
+func (c *Client) send(ctx context.Context, h *http.Client, rq request) (*http.Response, error) {
+	token := c.Token()
+	if token == "" && c.login != "" {
+		if err := c.Login(ctx); err != nil {
+			return nil, err
+		}
+		token = c.Token()
+	}
+	resp, err := c.sendWithToken(ctx, h, rq, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.login == "" {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	//session expirée : nouvelle session, sauf si déjà renouvelée par un autre appel
+	c.mutex.Lock()
+	renewed := c.token != token
+	c.mutex.Unlock()
+	if !renewed {
+		if err = c.Login(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return c.sendWithToken(ctx, h, rq, c.Token())
+}
+
+func (c *Client) sendWithToken(ctx context.Context, h *http.Client, rq request, token string) (*http.Response, error) {
+	u := c.url + Root + rq.path
+	if len(rq.query) > 0 {
+		u += "?" + rq.query.Encode()
+	}
+	var body io.Reader
+	if rq.body != nil {
+		body = bytes.NewReader(rq.body)
+	}
+	req, err := http.NewRequest(rq.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if rq.contentType != "" {
+		req.Header.Set("Content-Type", rq.contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return h.Do(req)
+}
+
+// readResp corps de réponse, APIError si statut hors 2xx
+func readResp(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return b, nil
+	}
+	e := APIError{}
+	json.Unmarshal(b, &e)
+	e.StatusCode = resp.StatusCode
+	return nil, &e
+}
+
+// Raw appel brut : corps de réponse (2xx) ou APIError
+func (c *Client) Raw(ctx context.Context, method, path string, query url.Values, contentType string, body []byte) ([]byte, error) {
+	resp, err := c.send(ctx, c.http, request{method: method, path: path, query: query, contentType: contentType, body: body})
+	if err != nil {
+		return nil, err
+	}
+	return readResp(resp)
+}
+
+// Do appel json, in et out optionnels
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body []byte
+	contentType := ""
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+	b, err := c.Raw(ctx, method, path, query, contentType, body)
+	if err != nil || out == nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// Query filtre, tri et paging d'une liste (cf dal.NewSearchQueryFromRequest)
+type Query struct {
+	Filter url.Values // champ -> valeur, eq:, not:, like:, in:a,b, lt:, gt:..., préfixe o pour OR (oeq:)
+	Sort   string     // ex : lib ou desc:id
+	Limit  int        // 0 : taille de page par défaut de l'api
+	Page   int        // 1 : première page
+}
+
+// Where ajout d'un filtre
+func (q Query) Where(field, cond string) Query {
+	f := url.Values{}
+	for k, v := range q.Filter {
+		f[k] = append([]string(nil), v...)
+	}
+	f.Add(field, cond)
+	q.Filter = f
+	return q
+}
+
+func (q Query) values() url.Values {
+	v := url.Values{}
+	for k, vals := range q.Filter {
+		v[k] = append([]string(nil), vals...)
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Page > 0 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	return v
+}
+
+// list lecture d'une page, data : ptr vers un slice
+func (c *Client) list(ctx context.Context, path string, q Query, data interface{}) (dal.PagedResponse, error) {
+	resp := dal.PagedResponse{Data: data}
+	if err := c.Do(ctx, http.MethodGet, path, q.values(), nil, &resp); err != nil {
+		return resp, err
+	}
+	resp.Data = data
+	return resp, nil
+}
+
+// Pager parcours page par page d'une liste
+//
+//	p := c.TaskFlowPager(client.Query{Limit: 100})
+//	var tfs []dal.DbTaskFlow
+//	for p.Next(ctx, &tfs) {
+//		...
+//	}
+//	err := p.Err()
+type Pager struct {
+	c     *Client
+	path  string
+	q     Query
+	done  bool
+	err   error
+	paged dal.PagedResponse
+}
+
+// Pager parcours de la liste path (ex : /taskflows)
+func (c *Client) Pager(path string, q Query) *Pager {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	return &Pager{c: c, path: path, q: q}
+}
+
+// Next lecture de la page suivante dans data (ptr vers un slice), false en fin de liste ou sur erreur
+func (p *Pager) Next(ctx context.Context, data interface{}) bool {
+	if p.done {
+		return false
+	}
+	p.paged, p.err = p.c.list(ctx, p.path, p.q, data)
+	if p.err != nil {
+		p.done = true
+		return false
+	}
+	//nb de lignes de la page : l'api ne compte pas les lignes (TotalRecord à 0)
+	//ni ne pagine (toutes les lignes) pour une limite <= 1
+	n := 0
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		n = v.Elem().Len()
+	}
+	limit := p.paged.Limit
+	if n == 0 || limit <= 0 || n != limit || (p.paged.TotalRecord > 0 && p.paged.Page >= p.paged.TotalPage) {
+		p.done = true
+	}
+	p.q.Page++
+	return n > 0
+}
+
+// Paged infos de paging de la dernière page lue
+func (p *Pager) Paged() dal.PagedResponse {
+	return p.paged
+}
+
+// Err erreur ayant interrompu le parcours
+func (p *Pager) Err() error {
+	return p.err
+}
@@ -0,0 +1,480 @@
+package client
+
+import (
+	"CmdScheduler/ctrl"
+	"CmdScheduler/dal"
+	"CmdScheduler/sessions"
+	"CmdScheduler/slog"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClient appels de l'api via le routeur réel
+func TestClient(t *testing.T) {
+	slog.InitLogs("", 0, 0, false)
+	dir, err := ioutil.TempDir("", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = dal.InitDb("sqlite3", "file:"+filepath.Join(dir, "data.db"), "SCHED"); err != nil {
+		t.Fatal(err)
+	}
+	sessions.InitSessionStore(dal.NewSessionStore(time.Hour))
+	srv := httptest.NewServer(ctrl.NewRouter())
+	defer srv.Close()
+	ctx := context.Background()
+
+	if err = New(srv.URL).Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	//mauvais mot de passe
+	_, err = New(srv.URL, WithCredentials("admin", "bad")).MyRights(ctx)
+	if e, ok := err.(*APIError); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad credentials %v", err)
+	}
+
+	//authentification au premier appel
+	c := New(srv.URL, WithCredentials("admin", "admin"))
+	rights, err := c.MyRights(ctx)
+	if err != nil || len(rights) == 0 || c.Token() == "" {
+		t.Fatalf("rights %v %v", rights, err)
+	}
+
+	//sessions persistées : toujours valides aprés redémarrage (nouveau store)
+	if s := dal.NewSessionStore(time.Hour).Get(c.Token()); s == nil || s.Login != "admin" || s.UserID == 0 {
+		t.Fatalf("persisted session %+v", s)
+	}
+	if n := sessions.Count(); n != 1 {
+		t.Errorf("sessions %v", n)
+	}
+
+	//session expirée : nouvelle session transparente
+	token := c.Token()
+	sessions.Remove(token)
+	if _, err = c.QueueState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token() == token {
+		t.Error("token not renewed")
+	}
+	//sans login/mot de passe : 401 remonté
+	_, err = New(srv.URL, WithToken(token)).QueueState(ctx)
+	if e, ok := err.(*APIError); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expired token %v", err)
+	}
+
+	//crud et paging
+	for i := 1; i <= 5; i++ {
+		if _, err = c.TagCreate(ctx, dal.DbTag{Lib: "cltag" + strconv.Itoa(i), Group: "client"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := c.TagPager(Query{Limit: 2, Sort: "desc:lib"}.Where("lib", "like:cltag"))
+	var page []dal.DbTag
+	var libs []string
+	pages := 0
+	for p.Next(ctx, &page) {
+		pages++
+		for _, tag := range page {
+			libs = append(libs, tag.Lib)
+		}
+	}
+	if p.Err() != nil || pages != 3 || len(libs) != 5 || libs[0] != "cltag5" || p.Paged().TotalRecord != 5 {
+		t.Fatalf("pager %v %v %v", pages, libs, p.Err())
+	}
+	//limite 1 : pas de comptage côté api, arrêt sur page incomplète
+	p = c.TagPager(Query{Limit: 1}.Where("lib", "like:cltag"))
+	libs, pages = nil, 0
+	for p.Next(ctx, &page) {
+		pages++
+		for _, tag := range page {
+			libs = append(libs, tag.Lib)
+		}
+		if pages > 10 {
+			break
+		}
+	}
+	if p.Err() != nil || len(libs) != 5 || pages > 5 {
+		t.Fatalf("pager limit 1 %v %v %v", pages, libs, p.Err())
+	}
+	_, err = c.TagGet(ctx, 99999)
+	if !IsNotFound(err) {
+		t.Errorf("not found %v", err)
+	}
+
+	//canal de notification : valeurs des entêtes masquées, conservées sur renvoi du masque
+	notif, err := c.NotificationCreate(ctx, dal.DbNotification{Lib: "clhook", URL: "http://127.0.0.1:1/hook",
+		Headers: map[string]string{"Authorization": "Bearer cltoken"}})
+	if err != nil || notif.Headers["Authorization"] != dal.SecretMask {
+		t.Fatalf("notification %+v %v", notif, err)
+	}
+	notif.Lib = "clhook2"
+	if notif, err = c.NotificationUpdate(ctx, notif); err != nil || notif.Headers["Authorization"] != dal.SecretMask {
+		t.Fatalf("notification update %+v %v", notif, err)
+	}
+	if cur, err := dal.NotificationGet(notif.ID); err != nil || cur.Headers["Authorization"] != "Bearer cltoken" {
+		t.Errorf("notification headers %+v %v", cur, err)
+	}
+	notif.ID = 0
+	if _, err = c.NotificationCreate(ctx, notif); err == nil || err.(*APIError).StatusCode != http.StatusBadRequest {
+		t.Errorf("masked header on create %v", err)
+	}
+
+	//audit des canaux et du coffre, valeurs masquées
+	sec, err := c.SecretCreate(ctx, dal.DbSecret{Name: "CL_PWD", Value: "clpassword"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SecretDelete(ctx, sec.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, entity := range []string{"NOTIF", "SECRET"} {
+		audits, _, err := c.AuditList(ctx, Query{}.Where("entity", entity))
+		if err != nil || len(audits) < 2 {
+			t.Fatalf("%v audit %v %v", entity, audits, err)
+		}
+		for _, a := range audits {
+			if strings.Contains(a.Diff, "cltoken") || strings.Contains(a.Diff, "clpassword") {
+				t.Errorf("%v audit not masked %v", entity, a.Diff)
+			}
+		}
+	}
+
+	//taskflow créé par import d'une crontab
+	if _, err = c.AgentCreate(ctx, dal.DbAgent{Host: "clhost:1", APIKey: "0123456789abcdef0123456789abcdef"}); err != nil {
+		t.Fatal(err)
+	}
+	imp, err := c.ImportCrontab(ctx, "0 3 * * * echo hi\n", dal.LegacyImportOpt{Agent: "clhost:1", Prefix: "cl "}, false)
+	if err != nil || len(imp.Plan) != 3 {
+		t.Fatalf("import %+v %v", imp, err)
+	}
+	tfs, _, err := c.TaskFlowList(ctx, Query{}.Where("lib", "like:cl "))
+	if err != nil || len(tfs) != 1 {
+		t.Fatalf("taskflows %v %v", tfs, err)
+	}
+	tf, err := c.TaskFlowGet(ctx, tfs[0].ID)
+	if err != nil || len(tf.Detail) != 1 {
+		t.Fatalf("taskflow %+v %v", tf, err)
+	}
+	tf.SLAMaxDuration = 60
+	tf.NamedArgs = map[string]string{"day": "0"}
+	if tf, err = c.TaskFlowUpdate(ctx, tf); err != nil || tf.SLAMaxDuration != 60 {
+		t.Fatalf("update %+v %v", tf, err)
+	}
+	versions, _, err := c.TaskFlowVersionList(ctx, tf.ID, Query{})
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("versions %v %v", versions, err)
+	}
+	//scheduleur non démarré : pas de run
+	runID, err := c.TaskFlowLaunch(ctx, tf.ID, map[string]string{"day": "1"})
+	if err != nil || runID != "" {
+		t.Errorf("launch %v %v", runID, err)
+	}
+	//arguments non déclarés ou avec tags refusés
+	for _, args := range []map[string]string{{"other": "1"}, {"day": "<%secret:db%>"}} {
+		if _, err = c.TaskFlowLaunch(ctx, tf.ID, args); err == nil || err.(*APIError).StatusCode != http.StatusBadRequest {
+			t.Errorf("launch %v %v", args, err)
+		}
+	}
+	for _, id := range []string{"clrun1", "clrun2"} {
+		if err = dal.TaskFlowRunInsert(&dal.DbTaskFlowRun{RunID: id, TaskFlowID: tf.ID, Result: dal.SchedResOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if run, err := c.RunGet(ctx, "clrun2"); err != nil || run.RunID != "clrun2" {
+		t.Errorf("run %+v %v", run, err)
+	}
+	if _, err = c.RunGet(ctx, "none"); !IsNotFound(err) {
+		t.Errorf("run %v", err)
+	}
+
+	//export / import à l'identique
+	b, err := c.Export(ctx)
+	if err != nil || len(b.TaskFlows) == 0 {
+		t.Fatalf("export %v", err)
+	}
+	plan, err := c.Import(ctx, &b, true, false)
+	if err != nil || !plan.DryRun || len(plan.Plan) != 0 {
+		t.Errorf("import %+v %v", plan, err)
+	}
+
+	//tache gérée par gitops : restauration avec les taches refusée, rien n'est restauré
+	var managed dal.Bundle
+	for _, e := range b.Tasks {
+		if e.Lib == b.TaskFlows[0].Detail[0].Task {
+			managed.Tasks = append(managed.Tasks, e)
+		}
+	}
+	if _, err = dal.BundleImport(&managed, dal.BundleImportOpt{Apply: true, Managed: &dal.BundleSources{Tasks: []string{"tasks.yaml"}}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.TaskFlowVersionRestore(ctx, tf.ID, 1, true); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("managed task restore %v", err)
+	}
+	if cur, _ := c.TaskFlowGet(ctx, tf.ID); cur.SLAMaxDuration != 60 {
+		t.Errorf("restored %+v", cur)
+	}
+	if _, err = dal.BundleImport(&dal.Bundle{}, dal.BundleImportOpt{Apply: true, Managed: &dal.BundleSources{}}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	//token d'api restreint au tag du taskflow, droits plafonnés
+	tag, err := c.TagCreate(ctx, dal.DbTag{Lib: "cltoken", Group: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf.Tags = []int{tag.ID}
+	if tf, err = c.TaskFlowUpdate(ctx, tf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.ImportCrontab(ctx, "0 4 * * * echo other\n", dal.LegacyImportOpt{Agent: "clhost:1", Prefix: "cl2 "}, false); err != nil {
+		t.Fatal(err)
+	}
+	others, _, err := c.TaskFlowList(ctx, Query{}.Where("lib", "like:cl2 "))
+	if err != nil || len(others) != 1 {
+		t.Fatalf("other taskflow %v %v", others, err)
+	}
+	if _, err = c.MyAPITokenCreate(ctx, dal.DbAPIToken{Name: "old", ExpiresAt: time.Now().Add(-time.Hour)}); err == nil {
+		t.Error("expired token created")
+	}
+	tk, err := c.MyAPITokenCreate(ctx, dal.DbAPIToken{Name: "ci", RightLevel: dal.RightLvlTaskRunner, Tags: []int{tag.ID}})
+	if err != nil || !strings.HasPrefix(tk.Token, dal.APITokenPrefix) || tk.UserID == 0 {
+		t.Fatalf("token %+v %v", tk, err)
+	}
+	tc := New(srv.URL, WithToken(tk.Token))
+	if tfs, _, err = tc.TaskFlowList(ctx, Query{}); err != nil || len(tfs) != 1 || tfs[0].ID != tf.ID {
+		t.Errorf("scoped list %v %v", tfs, err)
+	}
+	if _, err = tc.TaskFlowGet(ctx, others[0].ID); !IsNotFound(err) {
+		t.Errorf("out of scope %v", err)
+	}
+	if _, err = tc.TagCreate(ctx, dal.DbTag{Lib: "cltoken2", Group: "client"}); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("token rights %v", err)
+	}
+	if _, err = tc.MyAPITokenCreate(ctx, dal.DbAPIToken{Name: "wide"}); err == nil {
+		t.Error("token created out of the scope")
+	}
+
+	//token admin restreint au tag : taskflows, taches, queues et exécutions uniquement
+	ak, err := c.MyAPITokenCreate(ctx, dal.DbAPIToken{Name: "admin", RightLevel: dal.RightLvlAdmin, Tags: []int{tag.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac := New(srv.URL, WithToken(ak.Token))
+	if _, err = ac.UserUpdate(ctx, dal.DbUser{ID: tk.UserID, Login: "admin", RightLevel: dal.RightLvlAdmin}); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("scoped admin user update %v", err)
+	}
+	if _, err = ac.TaskFlowGet(ctx, tf.ID); err != nil {
+		t.Errorf("scoped admin taskflow %v", err)
+	}
+
+	//token task builder restreint au tag : états, sla et taches limités au périmétre, pas d'export
+	bk, err := c.MyAPITokenCreate(ctx, dal.DbAPIToken{Name: "builder", RightLevel: dal.RightLvlTaskBuilder, Tags: []int{tag.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := New(srv.URL, WithToken(bk.Token))
+	if _, err := bc.Export(ctx); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("scoped export %v", err)
+	}
+	if _, err = bc.QueueState(ctx); err != nil {
+		t.Errorf("scoped queue state %v", err)
+	}
+	for _, id := range []int{tf.ID, others[0].ID} {
+		if err = dal.SLABreachInsert(&dal.DbSLABreach{TaskFlowID: id, Kind: dal.SLAKindDuration, DetectedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if breaches, _, err := bc.SLABreachList(ctx, Query{}); err != nil || len(breaches) != 1 || breaches[0].TaskFlowID != tf.ID {
+		t.Errorf("scoped sla breaches %+v %v", breaches, err)
+	}
+	otherTask, err := c.TaskGet(ctx, others[0].Detail[0].TaskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.TaskUpdate(ctx, otherTask); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("task out of scope update %v", err)
+	}
+	if err = bc.TaskDelete(ctx, otherTask.ID); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("task out of scope delete %v", err)
+	}
+	ownTask, err := c.TaskGet(ctx, tf.Detail[0].TaskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.TaskUpdate(ctx, ownTask); err != nil {
+		t.Errorf("task in scope update %v", err)
+	}
+	//version 1 sans le tag : hors périmétre
+	if _, err = bc.TaskFlowVersionRestore(ctx, tf.ID, 1, false); err == nil || err.(*APIError).StatusCode != http.StatusBadRequest {
+		t.Errorf("restore out of scope %v", err)
+	}
+
+	tks, _, err := c.APITokenList(ctx, Query{}.Where("name", "ci"))
+	if err != nil || len(tks) != 1 || tks[0].Token != "" || tks[0].LastUsedAt.IsZero() || tks[0].Login != "admin" {
+		t.Errorf("tokens %+v %v", tks, err)
+	}
+	if err = c.MyAPITokenDelete(ctx, tk.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = tc.TaskFlowList(ctx, Query{}); err == nil || err.(*APIError).StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked token %v", err)
+	}
+
+	//rôle : viewer autorisé à voir et lancer les taskflows du tag, et à mettre en pause une queue
+	usr, err := c.UserCreate(ctx, dal.DbUser{Login: "clviewer", Name: "viewer", RightLevel: dal.RightLvlViewer, Password: "Viewer#123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := c.QueueCreate(ctx, dal.DbQueue{Lib: "clqueue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.RoleCreate(ctx, dal.DbRole{Name: "cl", Permissions: []string{"queue:pause"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.RoleCreate(ctx, dal.DbRole{Name: "bad", Permissions: []string{"taskflow:pause"}}); err == nil {
+		t.Error("invalid permission accepted")
+	}
+	if _, err = c.RoleCreate(ctx, dal.DbRole{Name: "bad", Permissions: []string{"task:edit"}, Tags: []int{tag.ID}}); err == nil {
+		t.Error("scoped task permission accepted")
+	}
+	roles, _, err := c.RoleList(ctx, Query{}.Where("name", "cl"))
+	if err != nil || len(roles) != 1 || len(roles[0].Users) != 0 {
+		t.Fatalf("roles %+v %v", roles, err)
+	}
+	role := roles[0]
+	role.Permissions = []string{"TaskFlow:Launch", "taskflow:view", "queue:pause", "taskflow:launch"}
+	role.Tags, role.Queues, role.Users = []int{tag.ID}, []int{q.ID}, []int{usr.ID}
+	if role, err = c.RoleUpdate(ctx, role); err != nil || len(role.Permissions) != 3 || len(role.Users) != 1 {
+		t.Fatalf("role %+v %v", role, err)
+	}
+	tf.ManualLaunch = true
+	if tf, err = c.TaskFlowUpdate(ctx, tf); err != nil {
+		t.Fatal(err)
+	}
+	vc := New(srv.URL, WithCredentials("clviewer", "Viewer#123"))
+	if tfs, _, err = vc.TaskFlowList(ctx, Query{}); err != nil || len(tfs) != 1 || tfs[0].ID != tf.ID {
+		t.Errorf("role list %v %v", tfs, err)
+	}
+	if _, err = vc.TaskFlowGet(ctx, others[0].ID); !IsNotFound(err) {
+		t.Errorf("role out of scope %v", err)
+	}
+	if breaches, _, err := vc.SLABreachList(ctx, Query{}); err != nil || len(breaches) != 1 || breaches[0].TaskFlowID != tf.ID {
+		t.Errorf("role sla breaches %+v %v", breaches, err)
+	}
+	if _, err = vc.QueueState(ctx); err != nil {
+		t.Errorf("role queue state %v", err)
+	}
+	//export accordé sans restriction, limité au périmétre de lecture des taskflows
+	exp, err := c.RoleCreate(ctx, dal.DbRole{Name: "clexport", Permissions: []string{"bundle:view"}, Users: []int{usr.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := vc.Export(ctx); err != nil || len(b.TaskFlows) != 1 || b.TaskFlows[0].Lib != tf.Lib {
+		t.Errorf("role export %+v %v", b, err)
+	}
+	if err = c.RoleDelete(ctx, exp.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = vc.TaskFlowLaunch(ctx, tf.ID, nil); err != nil {
+		t.Errorf("role launch %v", err)
+	}
+	if _, err = vc.TaskFlowLaunch(ctx, others[0].ID, nil); err == nil {
+		t.Error("role launch out of scope")
+	}
+	if _, err = vc.TaskFlowUpdate(ctx, tf); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("role edit %v", err)
+	}
+	q.PausedManual = true
+	if q, err = vc.QueueUpdate(ctx, q); err != nil || !q.PausedManual {
+		t.Errorf("role pause %+v %v", q, err)
+	}
+	q.Slot = 3
+	if _, err = vc.QueueUpdate(ctx, q); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("role queue edit %v", err)
+	}
+	if rights, err = vc.MyRights(ctx); err != nil || !rights["TASKFLOW"].Allowed || !rights["TASKFLOW"].ReadOnly {
+		t.Errorf("role rights %v %v", rights, err)
+	}
+	if _, _, err = vc.RoleList(ctx, Query{}); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("role crud %v", err)
+	}
+	if err = c.RoleDelete(ctx, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = vc.TaskFlowList(ctx, Query{}); err == nil || err.(*APIError).StatusCode != http.StatusForbidden {
+		t.Errorf("role deleted %v", err)
+	}
+
+	//groupe : listes restreintes par défaut aux taskflows du groupe (propriétaire ou tag du groupe)
+	grp, err := c.GroupCreate(ctx, dal.DbGroup{Name: " clteam ", Emails: []string{"team@cl.local"}, Tags: []int{tag.ID}, Members: []int{tk.UserID}})
+	if err != nil || grp.Name != "clteam" || len(grp.Members) != 1 {
+		t.Fatalf("group %+v %v", grp, err)
+	}
+	if mine, err := c.MyGroups(ctx); err != nil || len(mine) != 1 || mine[0].ID != grp.ID {
+		t.Errorf("my groups %v %v", mine, err)
+	}
+	if usr, err = c.UserGet(ctx, tk.UserID); err != nil || len(usr.Groups) != 1 || usr.Groups[0] != grp.ID {
+		t.Errorf("user groups %+v %v", usr, err)
+	}
+	if tfs, _, err = c.TaskFlowList(ctx, Query{}); err != nil || len(tfs) != 1 || tfs[0].ID != tf.ID {
+		t.Errorf("group list %v %v", tfs, err)
+	}
+	if tfs, _, err = c.TaskFlowList(ctx, Query{}.Where("groups", "all")); err != nil || len(tfs) < 2 {
+		t.Errorf("all groups list %v %v", tfs, err)
+	}
+	other, err := c.TaskFlowGet(ctx, others[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.OwnerGroup = 99999
+	if _, err = c.TaskFlowUpdate(ctx, other); err == nil || err.(*APIError).StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown owner group %v", err)
+	}
+	other.OwnerGroup = grp.ID
+	if other, err = c.TaskFlowUpdate(ctx, other); err != nil || other.OwnerGroup != grp.ID {
+		t.Fatalf("owner group %+v %v", other, err)
+	}
+	if tfs, _, err = c.TaskFlowList(ctx, Query{}); err != nil || len(tfs) != 2 {
+		t.Errorf("owned list %v %v", tfs, err)
+	}
+	if tfs, _, err = c.TaskFlowList(ctx, Query{}.Where("owner_group", strconv.Itoa(grp.ID))); err != nil || len(tfs) != 1 || tfs[0].ID != other.ID {
+		t.Errorf("owner filter %v %v", tfs, err)
+	}
+	if err = c.GroupDelete(ctx, grp.ID); err != nil {
+		t.Fatal(err)
+	}
+	if other, err = c.TaskFlowGet(ctx, other.ID); err != nil || other.OwnerGroup != 0 {
+		t.Errorf("group deleted %+v %v", other, err)
+	}
+
+	//flux d'évènements : état initial des queues
+	ectx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	stop := errors.New("stop")
+	var evt Event
+	err = c.Events(ectx, func(e Event) error {
+		evt = e
+		return stop
+	})
+	if err != stop || evt.Type == "" {
+		t.Errorf("events %+v %v", evt, err)
+	}
+
+	//contexte annulé
+	cancel()
+	if _, err = c.QueueState(ectx); err == nil {
+		t.Error("canceled context")
+	}
+}
@@ -10,7 +10,7 @@ import (
 )
 
 //Chargement <app name>.toml ou config.toml
-func readConfig() error {
+func readConfig(cfgArg string) error {
 	var err error
 
 	//def de quelques valeurs par defaut
@@ -19,13 +19,18 @@ func readConfig() error {
 	viper.SetDefault("db_driver", "sqlite3")
 	viper.SetDefault("db_datasource", "file:data.db")
 	viper.SetDefault("db_prefix", "SCHED")
+	viper.SetDefault("secret_key_file", "secret.key")
+	viper.SetDefault("gitops_poll", 30)
+	viper.SetDefault("gitops_resync", 60)
+	viper.SetDefault("session_store", "memory")
+	viper.SetDefault("auth_providers", []string{"local"})
 
 	//on s'appui sur viper :
 	//nom du fichier de config = fourni en param
 	cfgPath := ""
 	cfgPath2 := ""
-	if len(os.Args) > 1 && strings.TrimSpace(os.Args[1]) != "" {
-		cfgPath = strings.TrimSpace(os.Args[1])
+	if strings.TrimSpace(cfgArg) != "" {
+		cfgPath = strings.TrimSpace(cfgArg)
 	} else {
 		//on recherche relativement à l'exe <appname>.toml ou config.toml
 		execPath, err := os.Executable()
@@ -0,0 +1,23 @@
+package ctl
+
+import (
+	"CmdScheduler/client"
+	"fmt"
+	"net/http"
+)
+
+// newAPIClient client de l'api, authentifié par le token de session
+func newAPIClient(baseURL, token string) *client.Client {
+	return client.New(baseURL, client.WithToken(token))
+}
+
+// apiErr erreur d'appel de l'api, invitation au login si non authentifié
+func apiErr(err error) error {
+	if e, ok := err.(*client.APIError); ok && e.StatusCode == http.StatusUnauthorized {
+		if e.Message == "" {
+			return fmt.Errorf("unauthorized, run ctl login")
+		}
+		return fmt.Errorf("unauthorized (%v), run ctl login", e.Message)
+	}
+	return err
+}
@@ -0,0 +1,407 @@
+package ctl
+
+import (
+	"CmdScheduler/client"
+	"CmdScheduler/ctrl"
+	"CmdScheduler/dal"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFmt format des dates en sortie table
+const timeFmt = "2006-01-02 15:04:05"
+
+func fmtTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(timeFmt)
+}
+
+func fmtResult(res int) string {
+	switch res {
+	case dal.SchedResOK:
+		return "ok"
+	case dal.SchedResKO:
+		return "failed"
+	}
+	return ""
+}
+
+// idArg id en 1er argument puis options
+func idArg(args []string) (int, []string, error) {
+	if len(args) == 0 {
+		return 0, nil, fmt.Errorf("missing id")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id <= 0 {
+		return 0, nil, fmt.Errorf("invalid id %v", args[0])
+	}
+	return id, args[1:], nil
+}
+
+// login authentification et mémorisation du token
+func (c *ctl) login(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	user := fs.String("user", c.cfg.Login, "login")
+	password := fs.String("password", os.Getenv("CMDSCHEDULER_PASSWORD"), "password, prompted if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *user == "" {
+		return fmt.Errorf("missing -user")
+	}
+	if *password == "" {
+		var err error
+		if *password, err = c.readPassword("password : "); err != nil {
+			return err
+		}
+	}
+	api := client.New(c.cfg.URL, client.WithCredentials(*user, *password))
+	if err := api.Login(c.ctx); err != nil {
+		return err
+	}
+	c.cfg.Login = *user
+	c.cfg.Token = api.Token()
+	if err := c.saveConfig(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "logged in %v as %v\n", c.cfg.URL, *user)
+	return nil
+}
+
+// logout fin de session
+func (c *ctl) logout() error {
+	c.api.Logout(c.ctx)
+	c.cfg.Token = ""
+	return c.saveConfig()
+}
+
+// taskflow commandes tf
+func (c *ctl) taskflow(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage : tf list|get|create|update|launch")
+	}
+	switch args[0] {
+	case "list":
+		return c.tfList(args[1:])
+	case "get":
+		id, _, err := idArg(args[1:])
+		if err != nil {
+			return err
+		}
+		tf, err := c.api.TaskFlowGet(c.ctx, id)
+		if err != nil {
+			return err
+		}
+		return c.printObject(&tf)
+	case "create", "update":
+		return c.tfSave(args[0], args[1:])
+	case "launch":
+		return c.tfLaunch(args[1:])
+	}
+	return fmt.Errorf("unknown tf command %v", args[0])
+}
+
+// listQuery options de liste communes : filtres, tri et paging
+func listQuery(fs *flag.FlagSet) func() (client.Query, error) {
+	var filters multiFlag
+	fs.Var(&filters, "f", "filter field=value, eq:, like:, in:... (repeatable)")
+	sortArg := fs.String("sort", "", "sort, desc:field")
+	limit := fs.Int("limit", 0, "records per page")
+	page := fs.Int("page", 0, "page")
+	return func() (client.Query, error) {
+		q := client.Query{Sort: *sortArg, Limit: *limit, Page: *page}
+		for _, f := range filters {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				return q, fmt.Errorf("invalid filter %v", f)
+			}
+			q = q.Where(kv[0], kv[1])
+		}
+		return q, nil
+	}
+}
+
+// tfList liste des taskflows
+func (c *ctl) tfList(args []string) error {
+	fs := flag.NewFlagSet("tf list", flag.ContinueOnError)
+	query := listQuery(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	q, err := query()
+	if err != nil {
+		return err
+	}
+	tfs, resp, err := c.api.TaskFlowList(c.ctx, q)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(&resp)
+	}
+	rows := make([][]string, 0, len(tfs))
+	for _, tf := range tfs {
+		rows = append(rows, []string{strconv.Itoa(tf.ID), tf.Lib, strconv.FormatBool(tf.Activ), strconv.Itoa(tf.ScheduleID),
+			strconv.Itoa(tf.QueueID), fmtTime(tf.LastStart), fmtResult(tf.LastResult)})
+	}
+	if err = c.printTable([]string{"ID", "LIB", "ACTIV", "SCHED", "QUEUE", "LAST START", "RESULT"}, rows); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "page %v/%v, %v record(s)\n", resp.Page, resp.TotalPage, resp.TotalRecord)
+	return nil
+}
+
+// tfSave création ou maj d'un taskflow depuis un fichier json
+func (c *ctl) tfSave(action string, args []string) error {
+	id := 0
+	if action == "update" {
+		var err error
+		if id, args, err = idArg(args); err != nil {
+			return err
+		}
+	}
+	fs := flag.NewFlagSet("tf "+action, flag.ContinueOnError)
+	file := fs.String("file", "", "taskflow definition (json), - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	b, err := c.readInput(*file)
+	if err != nil {
+		return err
+	}
+	var tf dal.DbTaskFlow
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&tf); err != nil {
+		return err
+	}
+	if action == "create" {
+		tf.ID = 0
+		tf, err = c.api.TaskFlowCreate(c.ctx, tf)
+	} else {
+		tf.ID = id
+		tf, err = c.api.TaskFlowUpdate(c.ctx, tf)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printObject(&tf)
+}
+
+// tfLaunch lancement manuel, attente optionnelle de la fin d'exec
+func (c *ctl) tfLaunch(args []string) error {
+	id, args, err := idArg(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("tf launch", flag.ContinueOnError)
+	var launchArgs multiFlag
+	fs.Var(&launchArgs, "arg", "named argument name=value (repeatable)")
+	wait := fs.Bool("wait", false, "wait for the end of the run, fail if the run fails")
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+	named := make(map[string]string)
+	for _, a := range launchArgs {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid arg %v", a)
+		}
+		named[kv[0]] = kv[1]
+	}
+	resp := ctrl.LaunchResp{}
+	if resp.RunID, err = c.api.TaskFlowLaunch(c.ctx, id, named); err != nil {
+		return err
+	}
+	if resp.RunID == "" {
+		return fmt.Errorf("taskflow %v not launched (inactive or unknown to the scheduler)", id)
+	}
+	if !*wait {
+		return c.printObject(&resp)
+	}
+
+	//attente de la trace d'exec
+	fmt.Fprintf(os.Stderr, "run %v launched, waiting...\n", resp.RunID)
+	for {
+		run, err := c.api.RunGet(c.ctx, resp.RunID)
+		if client.IsNotFound(err) {
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = c.printObject(&run); err != nil {
+			return err
+		}
+		if run.Result != dal.SchedResOK {
+			return fmt.Errorf("run %v failed", run.RunID)
+		}
+		return nil
+	}
+}
+
+// queues état des queues, répété toutes les n secondes avec -watch
+func (c *ctl) queues(args []string) error {
+	fs := flag.NewFlagSet("queues", flag.ContinueOnError)
+	watch := fs.Int("watch", 0, "refresh every n seconds")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	for {
+		if c.json {
+			b, err := c.api.Raw(c.ctx, http.MethodGet, "/queue/state", nil, "", nil)
+			if err != nil {
+				return err
+			}
+			if err = c.printJSON(json.RawMessage(b)); err != nil {
+				return err
+			}
+		} else {
+			v, err := c.api.QueueState(c.ctx)
+			if err != nil {
+				return err
+			}
+			if *watch > 0 {
+				fmt.Fprintf(c.out, "\n%v\n", time.Now().Format(timeFmt))
+			}
+			rows := make([][]string, 0)
+			for _, q := range v.QueueState {
+				lib := q.Lib
+				if q.ID == 0 && lib == "" {
+					lib = "(direct)"
+				}
+				rows = append(rows, []string{lib, strconv.Itoa(q.Slot), strconv.Itoa(q.Processing), strconv.Itoa(q.Waiting),
+					strconv.FormatBool(q.PausedManual), strconv.Itoa(q.Launched), strconv.Itoa(q.Terminated)})
+			}
+			if err := c.printTable([]string{"QUEUE", "SLOT", "RUNNING", "WAITING", "PAUSED", "LAUNCHED", "TERMINATED"}, rows); err != nil {
+				return err
+			}
+			if len(v.Tasks) > 0 {
+				fmt.Fprintln(c.out)
+				rows = rows[:0]
+				for _, t := range v.Tasks {
+					rows = append(rows, []string{strconv.Itoa(t.TFID), t.TFLib, t.RunID, t.QueueLib, strconv.Itoa(t.State), fmtTime(t.StartAt)})
+				}
+				if err := c.printTable([]string{"TF", "LIB", "RUN", "QUEUE", "STATE", "START"}, rows); err != nil {
+					return err
+				}
+			}
+		}
+		if *watch <= 0 {
+			return nil
+		}
+		time.Sleep(time.Duration(*watch) * time.Second)
+	}
+}
+
+// runs historique d'exec, le plus récent en premier
+func (c *ctl) runs(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ContinueOnError)
+	tfID := fs.Int("tf", 0, "taskflow id")
+	limit := fs.Int("limit", 20, "number of runs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	q := client.Query{Sort: "desc:id", Limit: *limit}
+	if *tfID > 0 {
+		q = q.Where("taskflowid", "eq:"+strconv.Itoa(*tfID))
+	}
+	runs, _, err := c.api.RunList(c.ctx, q)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(runs)
+	}
+	rows := make([][]string, 0, len(runs))
+	for _, r := range runs {
+		msg := r.Msg
+		if i := strings.LastIndex(strings.TrimSpace(msg), "\n"); i >= 0 {
+			msg = strings.TrimSpace(msg)[i+1:] //derniére ligne du transcript
+		}
+		rows = append(rows, []string{strconv.Itoa(r.ID), r.RunID, r.TaskFlowLib, fmtTime(r.StartAt), fmtTime(r.StopAt),
+			fmtResult(r.Result), cell(msg)})
+	}
+	return c.printTable([]string{"ID", "RUN", "TASKFLOW", "START", "STOP", "RESULT", "MSG"}, rows)
+}
+
+// export bundle de configuration sur la sortie
+func (c *ctl) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	yamlFmt := fs.Bool("yaml", false, "yaml format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	q := url.Values{}
+	if *yamlFmt {
+		q.Set("format", "yaml")
+	}
+	b, err := c.api.Raw(c.ctx, http.MethodGet, "/export", q, "", nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(b)
+	return err
+}
+
+// importBundle import d'un bundle de configuration, plan affiché
+func (c *ctl) importBundle(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dryrun", false, "plan only")
+	prune := fs.Bool("prune", false, "delete entities missing from the bundle")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage : import [-dryrun] [-prune] file")
+	}
+	b, err := c.readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	contentType := "application/json"
+	if ext := strings.ToLower(filepath.Ext(fs.Arg(0))); ext == ".yaml" || ext == ".yml" {
+		contentType = "application/yaml"
+	}
+	q := url.Values{}
+	if *dryRun {
+		q.Set("dryrun", "1")
+	}
+	if *prune {
+		q.Set("prune", "1")
+	}
+	b, err = c.api.Raw(c.ctx, http.MethodPost, "/import", q, contentType, b)
+	if err != nil {
+		return err
+	}
+	var resp ctrl.BundleImportResp
+	if err = json.Unmarshal(b, &resp); err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(&resp)
+	}
+	rows := make([][]string, 0, len(resp.Plan))
+	for _, p := range resp.Plan {
+		rows = append(rows, []string{p.Action, p.Entity, p.Name, strconv.Itoa(p.ID), cell(string(p.Diff))})
+	}
+	if err = c.printTable([]string{"ACTION", "ENTITY", "NAME", "ID", "DIFF"}, rows); err != nil {
+		return err
+	}
+	if resp.DryRun {
+		fmt.Fprintf(os.Stderr, "dry run, %v change(s) planned\n", len(resp.Plan))
+	}
+	return nil
+}
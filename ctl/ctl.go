@@ -0,0 +1,250 @@
+// Package ctl client en ligne de commande de l'api rest : cmdscheduler ctl <commande>
+package ctl
+
+import (
+	"CmdScheduler/client"
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const usage = `usage : ctl [-url http://host:port] [-o table|json] <command> [options]
+
+commands :
+  login -user login [-password pass]   authenticate and store the session token
+  logout                               close the session
+  tf list [-f field=filter] [-sort desc:lib] [-limit n] [-page n]
+  tf get <id>
+  tf create -file taskflow.json        (- : stdin)
+  tf update <id> -file taskflow.json
+  tf launch <id> [-arg name=value]... [-wait]
+  queues [-watch seconds]              queue state and taskflows in progress
+  runs [-tf id] [-limit n]             execution history
+  export [-yaml]                       configuration bundle
+  import [-dryrun] [-prune] file       configuration bundle (yaml or json)
+
+filters : eq:, not:, like:, in:a,b, lt:, gt:, prefixed by o for OR (oeq:)
+env : CMDSCHEDULER_URL, CMDSCHEDULER_TOKEN, CMDSCHEDULER_PASSWORD, CMDSCHEDULER_CTL_CONFIG`
+
+// config connexion mémorisée par login
+type config struct {
+	URL   string `json:"url"`
+	Login string `json:"login"`
+	Token string `json:"token"`
+}
+
+// configPath fichier de connexion, dans le répertoire de config de l'utilisateur à défaut
+func configPath() (string, error) {
+	if p := os.Getenv("CMDSCHEDULER_CTL_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cmdscheduler", "ctl.json"), nil
+}
+
+// ctl état d'une commande
+type ctl struct {
+	cfg     config
+	cfgPath string
+	api     *client.Client
+	ctx     context.Context
+	json    bool
+	in      io.Reader
+	out     io.Writer
+}
+
+// Run exécution d'une commande ctl
+func Run(args []string, in io.Reader, out io.Writer) error {
+	c := &ctl{in: in, out: out, ctx: context.Background()}
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), usage) }
+	urlArg := fs.String("url", "", "API url, http://host:port")
+	output := fs.String("o", "table", "output format : table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing command")
+	}
+	c.json = *output == "json"
+
+	//connexion mémorisée, surchargée par env puis arguments
+	var err error
+	if c.cfgPath, err = configPath(); err != nil {
+		return err
+	}
+	if b, err := ioutil.ReadFile(c.cfgPath); err == nil {
+		json.Unmarshal(b, &c.cfg)
+	}
+	savedURL := c.cfg.URL
+	if v := os.Getenv("CMDSCHEDULER_URL"); v != "" {
+		c.cfg.URL = v
+	}
+	if *urlArg != "" {
+		c.cfg.URL = *urlArg
+	}
+	if c.cfg.URL == "" {
+		c.cfg.URL = "http://localhost:8100"
+	}
+	//token mémorisé valable uniquement pour l'url du login
+	if c.cfg.URL != savedURL {
+		c.cfg.Token = ""
+	}
+	if v := os.Getenv("CMDSCHEDULER_TOKEN"); v != "" {
+		c.cfg.Token = v
+	}
+	c.api = newAPIClient(c.cfg.URL, c.cfg.Token)
+
+	return apiErr(c.run(fs.Arg(0), fs.Args()[1:]))
+}
+
+// run exécution de la commande
+func (c *ctl) run(cmd string, cmdArgs []string) error {
+	switch cmd {
+	case "login":
+		return c.login(cmdArgs)
+	case "logout":
+		return c.logout()
+	case "tf":
+		return c.taskflow(cmdArgs)
+	case "queues":
+		return c.queues(cmdArgs)
+	case "runs":
+		return c.runs(cmdArgs)
+	case "export":
+		return c.export(cmdArgs)
+	case "import":
+		return c.importBundle(cmdArgs)
+	}
+	fmt.Fprintln(os.Stderr, usage)
+	return fmt.Errorf("unknown command %v", cmd)
+}
+
+// saveConfig mémorisation de la connexion (fichier privé)
+func (c *ctl) saveConfig() error {
+	b, err := json.MarshalIndent(&c.cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.cfgPath), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.cfgPath, b, 0600)
+}
+
+// printJSON sortie json indentée
+func (c *ctl) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable sortie en colonnes
+func (c *ctl) printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(w, strings.Join(r, "\t"))
+	}
+	return w.Flush()
+}
+
+// printObject sortie d'un élément : champ / valeur en mode table
+func (c *ctl) printObject(v interface{}) error {
+	if c.json {
+		return c.printJSON(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var m map[string]json.RawMessage
+	if err = json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, 0, len(keys))
+	for _, k := range keys {
+		val := string(m[k])
+		var s string
+		if json.Unmarshal(m[k], &s) == nil {
+			val = s
+		}
+		rows = append(rows, []string{k, cell(val)})
+	}
+	return c.printTable([]string{"FIELD", "VALUE"}, rows)
+}
+
+// cell valeur sur une ligne, tronquée
+func cell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 80 {
+		s = string(r[:77]) + "..."
+	}
+	return s
+}
+
+// readInput contenu d'un fichier, stdin si -
+func (c *ctl) readInput(file string) ([]byte, error) {
+	if file == "" {
+		return nil, fmt.Errorf("missing -file")
+	}
+	if file == "-" {
+		return ioutil.ReadAll(c.in)
+	}
+	return ioutil.ReadFile(file)
+}
+
+// readLine lecture d'une ligne sur l'entrée
+func (c *ctl) readLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(c.in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPassword lecture d'un mot de passe, sans écho sur un terminal
+func (c *ctl) readPassword(prompt string) (string, error) {
+	f, ok := c.in.(*os.File)
+	if !ok || !terminal.IsTerminal(int(f.Fd())) {
+		return c.readLine(prompt)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := terminal.ReadPassword(int(f.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// multiFlag option répétable
+type multiFlag []string
+
+func (m *multiFlag) String() string { return strings.Join(*m, ",") }
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
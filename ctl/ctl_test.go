@@ -0,0 +1,108 @@
+package ctl
+
+import (
+	"CmdScheduler/client"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCtl(t *testing.T) {
+	var launch map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == client.Root+"/auth" {
+			if u, p, _ := r.BasicAuth(); u != "admin" || p != "pwd" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"errorMessage":"bad login","result":"ERROR"}`))
+				return
+			}
+			w.Write([]byte(`{"token":"tok1"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer tok1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errorMessage":"no session","result":"ERROR"}`))
+			return
+		}
+		switch r.URL.Path {
+		case client.Root + "/taskflows":
+			if r.URL.Query().Get("lib") != "like:backup" {
+				t.Errorf("filter %v", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"page":1,"totalPage":1,"totalRecord":1,"data":[{"id":3,"lib":"backup db","activ":true}]}`))
+		case client.Root + "/taskflows/launch":
+			json.NewDecoder(r.Body).Decode(&launch)
+			w.Write([]byte(`{"run_id":"run-1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfgPath := filepath.Join(dir, "ctl.json")
+	os.Setenv("CMDSCHEDULER_CTL_CONFIG", cfgPath)
+	defer os.Unsetenv("CMDSCHEDULER_CTL_CONFIG")
+
+	var out bytes.Buffer
+	if err = Run([]string{"-url", srv.URL, "tf", "list"}, nil, &out); err == nil || !strings.Contains(err.Error(), "ctl login") {
+		t.Fatalf("list without login : %v", err)
+	}
+	if err = Run([]string{"-url", srv.URL, "login", "-user", "admin", "-password", "bad"}, nil, &out); err == nil {
+		t.Fatal("login with a bad password")
+	}
+	//mot de passe lu sur l'entrée
+	if err = Run([]string{"-url", srv.URL, "login", "-user", "admin"}, strings.NewReader("pwd\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(cfgPath)
+	var cfg config
+	json.Unmarshal(b, &cfg)
+	if cfg.Token != "tok1" || cfg.URL != srv.URL || cfg.Login != "admin" {
+		t.Fatalf("config %+v", cfg)
+	}
+
+	//url et token mémorisés
+	out.Reset()
+	if err = Run([]string{"tf", "list", "-f", "lib=like:backup"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "backup db") {
+		t.Fatalf("table %q", out.String())
+	}
+
+	out.Reset()
+	if err = Run([]string{"-o", "json", "tf", "launch", "3", "-arg", "day=2024-01-02"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"run_id": "run-1"`) {
+		t.Fatalf("launch %q", out.String())
+	}
+	if launch["id"] != float64(3) || launch["args"].(map[string]interface{})["day"] != "2024-01-02" {
+		t.Fatalf("launch query %v", launch)
+	}
+
+	//autre url : token mémorisé non envoyé
+	var auth string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errorMessage":"no session","result":"ERROR"}`))
+	}))
+	defer other.Close()
+	if err = Run([]string{"-url", other.URL, "tf", "list"}, nil, &out); err == nil || auth != "" {
+		t.Fatalf("token sent to another url : %q %v", auth, err)
+	}
+}
@@ -29,6 +29,7 @@ func apiAgentGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrNotFound(w, "id not found")
 		return
 	}
+	maskAgentSecrets(r, &resp)
 
 	//retour ok
 	writeStdJSONResp(w, http.StatusOK, resp)
@@ -40,11 +41,14 @@ func apiAgentList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbAgent{}, false)
 
 	//get liste
-	_, resp, err := dal.AgentList(searchQ)
+	arr, resp, err := dal.AgentList(searchQ)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	for i := range arr {
+		maskAgentSecrets(r, &arr[i])
+	}
 	//retour ok
 	writeStdJSONResp(w, http.StatusOK, resp)
 }
@@ -66,7 +70,7 @@ func apiAgentCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		return
 	}
 
-	err = dal.AgentInsert(&elm, getUsrIdFromCtx(r))
+	err = dal.AgentInsert(&elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
@@ -80,6 +84,9 @@ func apiAgentCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "AGENT", elm.ID, dal.AuditActCreate, nil, &elm)
+
+	maskAgentSecrets(r, &elm)
 
 	//retour ok : 201 created
 	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
@@ -96,12 +103,19 @@ func apiAgentPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	}
 	elm.ID, _ = strconv.Atoi(p.ByName("id"))
 
+	err = restoreAgentSecrets(&elm)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
 	err = elm.Validate(false)
 	if err != nil {
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
 
+	before, _ := dal.AgentGet(elm.ID)
 	err = dal.AgentUpdate(elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
@@ -116,6 +130,9 @@ func apiAgentPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "AGENT", elm.ID, dal.AuditActUpdate, &before, &elm)
+
+	maskAgentSecrets(r, &elm)
 
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
@@ -135,11 +152,12 @@ func apiAgentDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		return
 	}
 	if elm.ID > 0 {
-		err = dal.AgentDelete(elm.ID, getUsrIdFromCtx(r))
+		err = dal.AgentDelete(elm.ID, getUsrIdFromCtx(r), nil)
 		if err != nil {
 			writeStdJSONErrInternalServer(w, err.Error())
 			return
 		}
+		auditLog(r, "AGENT", elm.ID, dal.AuditActDelete, &elm, nil)
 		//notif sched
 		schd.UpdateSchedFromDb("DbAgent", elm.ID)
 	}
@@ -157,7 +175,10 @@ func apiAgentEvaluate(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 		return
 	}
 
-	err = elm.Validate(elm.ID == 0)
+	err = restoreAgentSecrets(&elm)
+	if err == nil {
+		err = elm.Validate(elm.ID == 0)
+	}
 	if err != nil {
 		elm.EvalResultInfo = err.Error()
 	} else {
@@ -166,6 +187,27 @@ func apiAgentEvaluate(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 			elm.EvalResultInfo = err.Error()
 		}
 	}
+	maskAgentSecrets(r, &elm)
 
 	writeStdJSONResp(w, http.StatusOK, elm)
 }
+
+//maskAgentSecrets masque la clé api, sauf demande explicite d'un admin
+func maskAgentSecrets(r *http.Request, elm *dal.DbAgent) {
+	if elm.APIKey != "" && !showSecrets(r) {
+		elm.APIKey = dal.SecretMask
+	}
+}
+
+//restoreAgentSecrets clé api masquée renvoyée par le client : on conserve la clé existante
+func restoreAgentSecrets(elm *dal.DbAgent) error {
+	if elm.ID <= 0 || elm.APIKey != dal.SecretMask {
+		return nil
+	}
+	cur, err := dal.AgentGet(elm.ID)
+	if err != nil {
+		return err
+	}
+	elm.APIKey = cur.APIKey
+	return nil
+}
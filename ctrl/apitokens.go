@@ -0,0 +1,239 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiAPITokenGet handler get /apitokens/:id
+func apiAPITokenGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//inputs :
+	id, _ := strconv.Atoi(p.ByName("id"))
+	if id <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	//get dal
+	elm, err := dal.APITokenGet(id)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if elm.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, elm)
+}
+
+//apiAPITokenList handler get /apitokens
+func apiAPITokenList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbAPIToken{}, false)
+
+	//get liste
+	_, resp, err := dal.APITokenList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiAPITokenCreate handler post /apitokens, token pour un utilisateur donné
+//si ok : 201, la valeur du token n'est retournée qu'à cette occasion
+func apiAPITokenCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbAPIToken
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	createAPIToken(w, r, elm)
+}
+
+//apiAPITokenPut handler put /apitokens/:id (nom, droits, tags, expiration)
+func apiAPITokenPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//deserial input
+	var elm dal.DbAPIToken
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	elm.ID, _ = strconv.Atoi(p.ByName("id"))
+
+	before, err := dal.APITokenGet(elm.ID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if before.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+	elm.UserID = before.UserID //token non transférable
+
+	err = elm.Validate(false)
+	if err == nil {
+		err = checkAPITokenRights(r, &elm)
+	}
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = dal.APITokenUpdate(elm)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	elm, err = dal.APITokenGet(elm.ID) //reprise valeur sur bdd
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "APITOKEN", elm.ID, dal.AuditActUpdate, &before, &elm)
+
+	//retour ok : 200
+	writeStdJSONOK(w, &elm)
+}
+
+//apiAPITokenDelete handler delete /apitokens/:id, révocation
+func apiAPITokenDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	id, _ := strconv.Atoi(p.ByName("id"))
+	deleteAPIToken(w, r, id, false)
+}
+
+//apiMyAPITokenList handler get /my/apitokens, tokens de l'utilisateur en cours
+func apiMyAPITokenList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbAPIToken{}, false)
+	if searchQ.SQLFilter != "" {
+		searchQ.SQLFilter = "(" + searchQ.SQLFilter + ") AND "
+	}
+	searchQ.SQLFilter += "APITOKEN.usr_id = ?"
+	searchQ.SQLParams = append(searchQ.SQLParams, getUsrIdFromCtx(r))
+
+	//get liste
+	_, resp, err := dal.APITokenList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiMyAPITokenCreate handler post /my/apitokens, droits par défaut : ceux de l'utilisateur en cours
+func apiMyAPITokenCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbAPIToken
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	elm.UserID = getUsrIdFromCtx(r)
+	if elm.RightLevel == 0 {
+		elm.RightLevel = getSessionFromCtx(r).RightLevel
+	}
+	createAPIToken(w, r, elm)
+}
+
+//apiMyAPITokenDelete handler delete /my/apitokens/:id
+func apiMyAPITokenDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	id, _ := strconv.Atoi(p.ByName("id"))
+	deleteAPIToken(w, r, id, true)
+}
+
+//createAPIToken controle et création, réponse 201 avec la valeur du token
+func createAPIToken(w http.ResponseWriter, r *http.Request, elm dal.DbAPIToken) {
+	err := elm.Validate(true)
+	if err == nil {
+		err = checkAPITokenRights(r, &elm)
+	}
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = dal.APITokenInsert(&elm, getUsrIdFromCtx(r))
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	token := elm.Token
+
+	elm, err = dal.APITokenGet(elm.ID) //reprise valeur sur bdd
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "APITOKEN", elm.ID, dal.AuditActCreate, nil, &elm)
+	elm.Token = token
+
+	//retour ok : 201 created
+	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
+}
+
+//deleteAPIToken révocation, own : restreint aux tokens de l'utilisateur en cours
+func deleteAPIToken(w http.ResponseWriter, r *http.Request, id int, own bool) {
+	if id <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+	elm, err := dal.APITokenGet(id)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if elm.ID == 0 || (own && elm.UserID != getUsrIdFromCtx(r)) {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+	err = dal.APITokenDelete(elm.ID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "APITOKEN", elm.ID, dal.AuditActDelete, &elm, nil)
+
+	//retour ok : 200
+	writeStdJSONOK(w, nil)
+}
+
+//checkAPITokenRights droits d'un token plafonnés à ceux de son utilisateur et de la session en cours,
+//un token restreint à des tags ne peut créer que des tokens restreints à ces tags
+func checkAPITokenRights(r *http.Request, elm *dal.DbAPIToken) error {
+	usr, err := dal.UserGet(elm.UserID)
+	if err != nil {
+		return err
+	}
+	if usr.ID == 0 || usr.Deleted {
+		return fmt.Errorf("invalid user")
+	}
+	if elm.RightLevel > usr.RightLevel || elm.RightLevel > getSessionFromCtx(r).RightLevel {
+		return fmt.Errorf("invalid rightlevel, above the user rights")
+	}
+	if len(tagScope(r)) > 0 {
+		if len(elm.Tags) == 0 {
+			return fmt.Errorf("invalid tags, out of the api token scope")
+		}
+		for _, t := range elm.Tags {
+			if !inTagScope(r, []int{t}) {
+				return fmt.Errorf("invalid tags, out of the api token scope")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/slog"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiAuditList handler get /audit
+func apiAuditList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbAudit{}, false)
+
+	//get liste
+	_, resp, err := dal.AuditList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//auditLog trace d'une modification (before nil : création, after nil : suppression)
+//un échec de trace n'interrompt pas la requete, secrets : champs supplémentaires à masquer
+func auditLog(r *http.Request, entity string, entityID interface{}, action string, before, after interface{}, secrets ...string) {
+	elm := dal.DbAudit{
+		Entity:   entity,
+		EntityID: fmt.Sprint(entityID),
+		Action:   action,
+		Diff:     dal.AuditDiff(before, after, secrets...),
+	}
+	if s := getSessionFromCtx(r); s != nil {
+		elm.UsrID = getUsrIdFromCtx(r)
+		elm.Login = s.Login
+	}
+	//modification sans effet : rien à tracer
+	if action == dal.AuditActUpdate && elm.Diff == "" {
+		return
+	}
+	if err := dal.AuditInsert(&elm); err != nil {
+		slog.Warning("api", "Audit %v %v %v : %v", action, entity, elm.EntityID, err)
+	}
+}
@@ -1,6 +1,7 @@
 package ctrl
 
 import (
+	"CmdScheduler/auth"
 	"CmdScheduler/dal"
 	"CmdScheduler/sessions"
 	"net/http"
@@ -22,8 +23,8 @@ func apiAuth(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	//check auth
-	usr, errAuth := dal.UserCheckAuth(login, pass)
+	//check auth, fournisseurs configurés (local, ldap...)
+	usr, errAuth := auth.Authenticate(login, pass)
 	if usr.ID <= 0 || usr.Deleted || errAuth != nil {
 		writeStdJSONUnauthorized(w, "invalid credential")
 		return
@@ -36,13 +37,14 @@ func apiAuth(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	// init nouvelle session
-	s := sessions.New()
-	s.Login = usr.Login
-	s.RightLevel = usr.RightLevel
-	s.Data["USRID"] = usr.ID
+	s, err := sessions.New(usr.Login, usr.ID, usr.RightLevel)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
 
 	//on attache les droits à la réponse
-	rl := dal.GetRigthList(dal.RightLevel(s.RightLevel))
+	rl := sessionPermissions(s).RightList()
 
 	writeStdJSONResp(w, http.StatusOK, JSONTokenResp{
 		Token:  s.SessionId,
@@ -65,9 +67,9 @@ func apiDisconnect(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 func apiGetRightList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	//deserial input
 	var rl map[string]dal.RightView
-	s := sessions.Get(getBearerToken(r))
+	s := getSession(getBearerToken(r))
 	if s != nil {
-		rl = dal.GetRigthList(dal.RightLevel(s.RightLevel))
+		rl = sessionPermissions(s).RightList()
 	}
 	writeStdJSONResp(w, http.StatusOK, rl)
 }
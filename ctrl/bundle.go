@@ -0,0 +1,212 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v2"
+)
+
+//bundleYAML format yaml demandé (?format=yaml ou header yaml), json à défaut
+func bundleYAML(r *http.Request, header string) bool {
+	return strings.EqualFold(r.URL.Query().Get("format"), "yaml") || strings.Contains(r.Header.Get(header), "yaml")
+}
+
+//apiBundleExport handler get /export
+func apiBundleExport(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp, err := dal.BundleExport()
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//périmétre restreint : taskflows accessibles et leurs taches
+	if scope := taskFlowScope(r, dal.ActView); !scope.Unrestricted() {
+		var searchQ dal.SearchQuery
+		scope.Filter(&searchQ, "TASKFLOW.tags", "TASKFLOW.queueid")
+		tfs, _, err := dal.TaskFlowList(searchQ)
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return
+		}
+		libs := make(map[string]bool)
+		for _, tf := range tfs {
+			libs[tf.Lib] = true
+		}
+		resp.RestrictTaskFlows(libs)
+	}
+	if !bundleYAML(r, "Accept") {
+		writeStdJSONOK(w, &resp)
+		return
+	}
+	b, err := yaml.Marshal(&resp)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+//BundleImportResp retour d'import
+type BundleImportResp struct {
+	DryRun bool                 `json:"dry_run"`
+	Plan   []dal.BundlePlanItem `json:"plan"`
+}
+
+//apiBundleImport handler post /import?dryrun=1&prune=1
+//dryrun : plan seul, prune : suppression de l'existant absent du bundle
+func apiBundleImport(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input, champs inconnus refusés
+	var elm dal.Bundle
+	b, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		if bundleYAML(r, "Content-Type") {
+			err = yaml.UnmarshalStrict(b, &elm)
+		} else {
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.DisallowUnknownFields()
+			err = dec.Decode(&elm)
+		}
+	}
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	resp := BundleImportResp{
+		DryRun: r.URL.Query().Get("dryrun") == "1",
+	}
+	opt := dal.BundleImportOpt{
+		Apply: !resp.DryRun,
+		Prune: r.URL.Query().Get("prune") == "1",
+	}
+	var ok bool
+	if resp.Plan, ok = bundleImport(w, r, &elm, opt); !ok {
+		return
+	}
+
+	//retour ok : 200
+	writeStdJSONOK(w, &resp)
+}
+
+//bundleImport plan ou application d'un bundle : audit, versions des taskflows et rechargement du scheduleur
+//false si erreur (réponse déjà écrite)
+func bundleImport(w http.ResponseWriter, r *http.Request, elm *dal.Bundle, opt dal.BundleImportOpt) ([]dal.BundlePlanItem, bool) {
+	//entités gérées par gitops : non modifiables par import manuel
+	opt.Protected = true
+	plan, err := dal.BundleImport(elm, opt, getUsrIdFromCtx(r))
+	if errors.Is(err, dal.ErrManagedEntity) {
+		writeStdJSONErrForbidden(w, err.Error())
+		return nil, false
+	}
+	if errors.Is(err, dal.ErrInvalidBundle) {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return nil, false
+	}
+
+	if opt.Apply && len(plan) > 0 {
+		for _, item := range plan {
+			auditLog(r, item.Entity, item.ID, item.Action, item.Before, item.After)
+		}
+		//versions des taskflows (taches modifiées incluses)
+		tfs, _, err := dal.TaskFlowList(dal.SearchQuery{})
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return nil, false
+		}
+		for _, tf := range tfs {
+			if !saveTaskFlowVersion(w, r, tf.ID) {
+				return nil, false
+			}
+		}
+		//notif sched : rechargement complet
+		schd.UpdateSchedFromDb("*", 0)
+	}
+	return plan, true
+}
+
+//LegacyImportResp retour d'import de planifs externes
+type LegacyImportResp struct {
+	DryRun      bool                    `json:"dry_run"`
+	Plan        []dal.BundlePlanItem    `json:"plan"`
+	Unsupported []dal.LegacyUnsupported `json:"unsupported"` // constructions non reprises ou approximées
+	Bundle      dal.Bundle              `json:"bundle"`      // configuration générée
+}
+
+//legacyImportOpt options de conversion extraites du get
+//?agent=host&queue=lib&prefix=p&activ=1&tz=Europe/Paris&system=1
+func legacyImportOpt(r *http.Request) dal.LegacyImportOpt {
+	q := r.URL.Query()
+	return dal.LegacyImportOpt{
+		Agent:    q.Get("agent"),
+		Queue:    q.Get("queue"),
+		Prefix:   q.Get("prefix"),
+		Activ:    q.Get("activ") == "1",
+		TimeZone: q.Get("tz"),
+		System:   q.Get("system") == "1",
+	}
+}
+
+//legacyImport plan ou application du bundle converti
+func legacyImport(w http.ResponseWriter, r *http.Request, resp *LegacyImportResp) {
+	resp.DryRun = r.URL.Query().Get("dryrun") == "1"
+	var ok bool
+	if resp.Plan, ok = bundleImport(w, r, &resp.Bundle, dal.BundleImportOpt{Apply: !resp.DryRun}); !ok {
+		return
+	}
+
+	//retour ok : 200
+	writeStdJSONOK(w, resp)
+}
+
+//apiImportCrontab handler post /import/crontab?agent=host (crontab en body)
+func apiImportCrontab(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	opt := legacyImportOpt(r)
+	if opt.Agent == "" {
+		writeStdJSONErrBadRequest(w, "agent required")
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	var resp LegacyImportResp
+	resp.Bundle, resp.Unsupported = dal.CrontabToBundle(string(b), opt)
+	legacyImport(w, r, &resp)
+}
+
+//apiImportSchTasks handler post /import/schtasks?agent=host&name=x (export xml d'une tache windows en body)
+func apiImportSchTasks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	opt := legacyImportOpt(r)
+	if opt.Agent == "" {
+		writeStdJSONErrBadRequest(w, "agent required")
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	var resp LegacyImportResp
+	resp.Bundle, resp.Unsupported, err = dal.SchTasksToBundle(r.URL.Query().Get("name"), b, opt)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	legacyImport(w, r, &resp)
+}
@@ -25,6 +25,10 @@ func apiCfgGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
+	if resp != "" && dal.CfgKVIsSecret(key) && !showSecrets(r) {
+		resp = dal.SecretMask
+	}
+
 	//retour ok
 	writeStdJSONResp(w, http.StatusOK, &dal.KVJSON{
 		Key:   key,
@@ -40,6 +44,11 @@ func apiCfgList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	for i := range resp {
+		if resp[i].Value != "" && dal.CfgKVIsSecret(resp[i].Key) && !showSecrets(r) {
+			resp[i].Value = dal.SecretMask
+		}
+	}
 	//retour ok
 	writeStdJSONResp(w, http.StatusOK, resp)
 }
@@ -54,8 +63,8 @@ func apiCfgPost(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	if elm.Key == "" {
-		writeStdJSONErrBadRequest(w, "empty key forbidden")
+	if err = elm.Validate(); err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
 	if dal.CfgKVIsSystem(elm.Key) {
@@ -63,11 +72,47 @@ func apiCfgPost(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
+	//valeur masquée renvoyée : valeur existante conservée
+	if dal.CfgKVIsSecret(elm.Key) && elm.Value == dal.SecretMask {
+		writeStdJSONOK(w, &elm)
+		return
+	}
+
+	before, _ := dal.CfgKVGet(elm.Key)
 	err = dal.CfgKVSet(elm.Key, elm.Value)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditCfg(r, elm.Key, before, elm.Value)
+	if dal.CfgKVIsSecret(elm.Key) && elm.Value != "" {
+		elm.Value = dal.SecretMask
+	}
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
 }
+
+//auditCfg trace de la modification d'une clé de config (valeurs sensibles masquées)
+func auditCfg(r *http.Request, key string, before, after string) {
+	if before == after {
+		return
+	}
+	action := dal.AuditActUpdate
+	if before == "" {
+		action = dal.AuditActCreate
+	} else if after == "" {
+		action = dal.AuditActDelete
+	}
+	secrets := []string{}
+	if dal.CfgKVIsSecret(key) {
+		secrets = append(secrets, "value")
+	}
+	var b, a *dal.KVJSON
+	if before != "" {
+		b = &dal.KVJSON{Key: key, Value: before}
+	}
+	if after != "" {
+		a = &dal.KVJSON{Key: key, Value: after}
+	}
+	auditLog(r, "CONFIG", strings.ToLower(strings.TrimSpace(key)), action, b, a, secrets...)
+}
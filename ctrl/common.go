@@ -1,6 +1,7 @@
 package ctrl
 
 import (
+	"CmdScheduler/auth"
 	"CmdScheduler/dal"
 	"CmdScheduler/sessions"
 	"CmdScheduler/slog"
@@ -23,7 +24,9 @@ const (
 
 //variable globale controleur
 var (
-	SessionKey []byte //clé de cryptage cookie
+	SessionKey   []byte             //clé de cryptage cookie
+	OIDC         *auth.OIDCProvider //connexion openid connect, nil si non configurée
+	MetricsToken string             //token de scrape prometheus de /metrics, vide : session ou token d'api requis
 )
 
 //JSONStdResponse réponse json générique
@@ -46,6 +49,11 @@ func getBearerToken(r *http.Request) string {
 // secMiddleWare middleware pour la gestion de la sécurité
 type altAutorisation func(*sessions.Session) bool
 
+//authenticated autorisation alternative : tout utilisateur authentifié
+func authenticated(s *sessions.Session) bool {
+	return s != nil
+}
+
 // secMiddleWare middleware pour la gestion de la sécurité
 func secMiddleWare(crudCode string, fnChekAllowed altAutorisation, cors bool, next httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -68,7 +76,7 @@ func secMiddleWare(crudCode string, fnChekAllowed altAutorisation, cors bool, ne
 			token := getBearerToken(r)
 
 			//pas de token, ou token invalide -> auth required 401
-			s = sessions.Get(token)
+			s = getSession(token)
 			if token == "" || s == nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
@@ -76,8 +84,11 @@ func secMiddleWare(crudCode string, fnChekAllowed altAutorisation, cors bool, ne
 
 			if fnChekAllowed == nil {
 				//check test role user, on déduit le fait que ce soit une tentative de modif/insertion/delete de part le verbe
-				edit := r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" || r.Method == "DELETE"
-				if !dal.IsAutorised(dal.RightLevel(s.RightLevel), crudCode, edit) {
+				action := dal.ActView
+				if r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" || r.Method == "DELETE" {
+					action = dal.ActEdit
+				}
+				if !sessionPermissions(s).Allowed(strings.ToLower(crudCode), action) {
 					w.WriteHeader(http.StatusForbidden)
 					return
 				}
@@ -101,6 +112,147 @@ func secMiddleWare(crudCode string, fnChekAllowed altAutorisation, cors bool, ne
 	}
 }
 
+// getSession session d'un bearer : session ouverte par /auth, ou session transitoire d'un token d'api
+func getSession(token string) *sessions.Session {
+	if !dal.IsAPIToken(token) {
+		return sessions.Get(token)
+	}
+	tk, usr, err := dal.APITokenCheck(token)
+	if err != nil {
+		return nil
+	}
+	return &sessions.Session{
+		Login:      usr.Login,
+		RightLevel: tk.RightLevel,
+		UserID:     usr.ID,
+		SessionId:  tk.Prefix,
+		Data: map[string]interface{}{
+			"APITOKEN": tk.ID,
+			"TAGS":     tk.Tags,
+		},
+	}
+}
+
+// tagScope tags auxquels la session est restreinte (token d'api), vide : pas de restriction
+func tagScope(r *http.Request) []int {
+	s := getSessionFromCtx(r)
+	if s == nil {
+		return nil
+	}
+	tags, _ := s.Data["TAGS"].([]int)
+	return tags
+}
+
+// inTagScope vrai si un taskflow portant ces tags est accessible à la session
+func inTagScope(r *http.Request, tags []int) bool {
+	scope := tagScope(r)
+	if len(scope) == 0 {
+		return true
+	}
+	for _, t := range tags {
+		for _, st := range scope {
+			if t == st {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sessionPermissions droits effectifs de la session : niveau de droits et rôles de l'utilisateur
+// un token d'api est limité à son niveau de droits, et aux taskflows / taches / queues s'il est restreint à des tags
+func sessionPermissions(s *sessions.Session) dal.Permissions {
+	if s == nil {
+		return dal.Permissions{}
+	}
+	level := dal.RightLevel(s.RightLevel)
+	if _, isToken := s.Data["APITOKEN"]; isToken {
+		perms := dal.Permissions{Level: level}
+		//token limité à des tags : taskflows, taches, queues et exécutions uniquement
+		if tags, _ := s.Data["TAGS"].([]int); len(tags) > 0 {
+			perms.Resources = []string{"taskflow", "task", "queue", "run"}
+		}
+		return perms
+	}
+	perms, err := dal.UserPermissions(s.UserID, level)
+	if err != nil {
+		slog.Warning("api", "sessionPermissions %v", err)
+	}
+	return perms
+}
+
+// taskFlowScope périmétre des taskflows pour une action, restriction de tags du token d'api comprise
+func taskFlowScope(r *http.Request, action string) dal.Scope {
+	scope := sessionPermissions(getSessionFromCtx(r)).Scope("taskflow", action)
+	scope.RequiredTags = tagScope(r)
+	return scope
+}
+
+// taskFlowIDScope prédicat de périmétre par id de taskflow, chaque taskflow n'est lu qu'une fois
+func taskFlowIDScope(scope dal.Scope) func(int) bool {
+	known := make(map[int]bool)
+	return func(tfID int) bool {
+		if scope.Unrestricted() {
+			return true
+		}
+		in, exists := known[tfID]
+		if !exists {
+			tf, err := dal.TaskFlowGet(tfID)
+			in = err == nil && tf.ID != 0 && scope.TaskFlow(tf.Tags, tf.QueueID)
+			known[tfID] = in
+		}
+		return in
+	}
+}
+
+// checkTaskTagScope token d'api restreint à des tags : la tache ne doit être utilisée
+// que par des taskflows portant un de ces tags
+func checkTaskTagScope(w http.ResponseWriter, r *http.Request, taskID int) bool {
+	if len(tagScope(r)) == 0 {
+		return true
+	}
+	tfIDs, err := dal.TaskFlowIDsUsingTask(taskID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return false
+	}
+	for _, tfID := range tfIDs {
+		tf, err := dal.TaskFlowGet(tfID)
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return false
+		}
+		if !inTagScope(r, tf.Tags) {
+			writeStdJSONErrForbidden(w, "task used by a taskflow out of scope")
+			return false
+		}
+	}
+	return true
+}
+
+// checkTaskFlowScope controle d'accés à un taskflow pour une action : 404 si hors périmétre de lecture, 403 si hors périmétre de l'action
+func checkTaskFlowScope(w http.ResponseWriter, r *http.Request, tfID int, action string) bool {
+	view := taskFlowScope(r, dal.ActView)
+	scope := taskFlowScope(r, action)
+	if view.Unrestricted() && scope.Unrestricted() {
+		return true
+	}
+	tf, err := dal.TaskFlowGet(tfID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return false
+	}
+	if tf.ID == 0 || !(view.TaskFlow(tf.Tags, tf.QueueID) || scope.TaskFlow(tf.Tags, tf.QueueID)) {
+		writeStdJSONErrNotFound(w, "taskflow not found")
+		return false
+	}
+	if !scope.TaskFlow(tf.Tags, tf.QueueID) {
+		writeStdJSONErrForbidden(w, "taskflow out of scope")
+		return false
+	}
+	return true
+}
+
 // getSessionFromCtx helper pour récupérer la session attaché à la requete par secMiddleWare
 func getSessionFromCtx(r *http.Request) *sessions.Session {
 	return r.Context().Value(CtxSession).(*sessions.Session)
@@ -110,11 +262,21 @@ func getSessionFromCtx(r *http.Request) *sessions.Session {
 func getUsrIdFromCtx(r *http.Request) int {
 	s := getSessionFromCtx(r)
 	if s != nil {
-		return s.Data["USRID"].(int)
+		return s.UserID
 	}
 	return 0
 }
 
+// showSecrets retourne vrai si les données sensibles sont explicitement demandées (?secrets=1) par un admin
+func showSecrets(r *http.Request) bool {
+	v := r.URL.Query().Get("secrets")
+	if v != "1" && !strings.EqualFold(v, "true") {
+		return false
+	}
+	s := getSessionFromCtx(r)
+	return s != nil && s.RightLevel >= dal.RightLvlAdmin
+}
+
 // Helpers pour les réponses API
 
 //writeStdJSONResp output json réponse std
@@ -0,0 +1,99 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// période d'envoi d'un commentaire sse pour maintenir la connexion (et controle de la session)
+var sseKeepAlive = 15 * time.Second
+
+//apiEvents handler get /events
+//flux server-sent events : états des queues, début/fin de taches, rechargement de config
+//chaque évènement n'est transmis que si le droit de lecture associé est accordé
+func apiEvents(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeStdJSONErrInternalServer(w, "streaming not supported")
+		return
+	}
+	s := getSessionFromCtx(r)
+	token := getBearerToken(r)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ch := schd.SubscribeEvents()
+	defer schd.UnsubscribeEvents(ch)
+
+	//périmétre de la session, réévalué à chaque keepalive et rechargement de config (tags, queues, droits)
+	var (
+		perms  dal.Permissions
+		queues func(int) bool
+		inTF   func(int) bool
+	)
+	loadScope := func() {
+		perms = sessionPermissions(s)
+		queues = queueScope(r, dal.ActView).Queue
+		inTF = taskFlowIDScope(taskFlowScope(r, dal.ActView))
+	}
+	loadScope()
+
+	//état initial des queues, évènements restreints au périmétre de la session
+	state := schd.GetViewState().Restrict(queues, inTF)
+	if perms.Allowed("queue", dal.ActView) {
+		writeSSE(w, schd.SchedEvent{Type: schd.EvtQueueState, At: time.Now(), Data: state.QueueState})
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			//session expirée ou fermée : fin du flux
+			if getSession(token) == nil {
+				return
+			}
+			loadScope()
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case evt, ok := <-ch:
+			if !ok {
+				return
+			}
+			if evt.Type == schd.EvtConfigReload {
+				loadScope()
+			}
+			if !perms.Allowed(strings.ToLower(evt.CrudCode), dal.ActView) {
+				continue
+			}
+			if evt, ok = evt.Restrict(queues, inTF); !ok {
+				continue
+			}
+			writeSSE(w, evt)
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE écriture d'un évènement au format sse
+func writeSSE(w http.ResponseWriter, evt schd.SchedEvent) {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", evt.Type, b)
+}
@@ -0,0 +1,68 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiGitOpsStatus handler get /gitops/status
+func apiGitOpsStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp := schd.GetGitOpsStatus()
+	writeStdJSONOK(w, &resp)
+}
+
+//apiGitOpsSync handler post /gitops/sync : synchro immédiate
+func apiGitOpsSync(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !schd.GetGitOpsStatus().Enabled {
+		writeStdJSONErrNotFound(w, "gitops sync disabled")
+		return
+	}
+	//échec de synchro visible dans l'état retourné
+	schd.SyncGitOps(true)
+	resp := schd.GetGitOpsStatus()
+	writeStdJSONOK(w, &resp)
+}
+
+//apiGitOpsManaged handler get /gitops/managed
+func apiGitOpsManaged(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbManaged{}, false)
+
+	//get liste
+	_, resp, err := dal.ManagedList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//managedForbidden entité gérée par la synchro gitops : refus de modif (403), true si refusé
+func managedForbidden(w http.ResponseWriter, entity string, id int) bool {
+	m, err := dal.ManagedGet(entity, id)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return true
+	}
+	if m.Entity != "" {
+		writeStdJSONErrForbidden(w, "read only, managed by gitops ("+m.Source+")")
+		return true
+	}
+	return false
+}
+
+//managedReadOnly modification refusée pour une entité :id gérée par la synchro gitops
+func managedReadOnly(entity string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		id, _ := strconv.Atoi(p.ByName("id"))
+		if id > 0 && managedForbidden(w, entity, id) {
+			return
+		}
+		next(w, r, p)
+	}
+}
@@ -0,0 +1,201 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiGroupGet handler get /groups/:id
+func apiGroupGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//inputs :
+	id, _ := strconv.Atoi(p.ByName("id"))
+	if id <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	//get dal
+	resp, err := dal.GroupGet(id)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if resp.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiGroupList handler get /groups
+func apiGroupList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbGroup{}, false)
+
+	//get liste
+	_, resp, err := dal.GroupList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiMyGroupList handler get /my/groups, groupes de l'user connecté
+func apiMyGroupList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp, err := dal.UserGroups(getUsrIdFromCtx(r))
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiGroupCreate handler post /groups
+//si ok : create 201 (Created and contain an entity, and a Location header.) ou 200
+func apiGroupCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbGroup
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = elm.Validate(true)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = dal.GroupInsert(&elm, getUsrIdFromCtx(r))
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	//notif sched : groupes propriétaires des taskflows
+	schd.UpdateSchedFromDb("DbGroup", elm.ID)
+
+	elm, err = dal.GroupGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "GROUP", elm.ID, dal.AuditActCreate, nil, &elm)
+	//retour ok : 201 created
+	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
+}
+
+//apiGroupPut handler put /groups/:id
+func apiGroupPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//deserial input
+	var elm dal.DbGroup
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	elm.ID, _ = strconv.Atoi(p.ByName("id"))
+
+	err = elm.Validate(false)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	before, err := dal.GroupGet(elm.ID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if before.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+	err = dal.GroupUpdate(elm, getUsrIdFromCtx(r), nil)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	//notif sched : groupes propriétaires des taskflows
+	schd.UpdateSchedFromDb("DbGroup", elm.ID)
+
+	elm, err = dal.GroupGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "GROUP", elm.ID, dal.AuditActUpdate, &before, &elm)
+
+	//retour ok : 200
+	writeStdJSONOK(w, &elm)
+}
+
+//apiGroupDelete handler delete /groups/:id
+//les taskflows, taches et queues du groupe deviennent sans propriétaire
+func apiGroupDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	elmID, _ := strconv.Atoi(p.ByName("id"))
+	if elmID <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	elm, err := dal.GroupGet(elmID)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	if elm.ID > 0 {
+		err = dal.GroupDelete(elm.ID)
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return
+		}
+		schd.UpdateSchedFromDb("DbGroup", elm.ID)
+		auditLog(r, "GROUP", elm.ID, dal.AuditActDelete, &elm, nil)
+	}
+	//retour ok : 200
+	writeStdJSONOK(w, nil)
+}
+
+//ownerFilter restreint une liste aux éléments des groupes de l'user connecté (sans effet s'il n'est membre d'aucun groupe)
+//?groups=all ou un filtre explicite sur owner_group : pas de restriction
+func ownerFilter(r *http.Request, searchQ *dal.SearchQuery, ownerField string, tagsField string) error {
+	q := r.URL.Query()
+	if q.Get("groups") == "all" || q.Get("owner_group") != "" {
+		return nil
+	}
+	groups, err := dal.UserGroups(getUsrIdFromCtx(r))
+	if err != nil {
+		return err
+	}
+	searchQ.AndOwnedBy(groups, ownerField, tagsField)
+	return nil
+}
+
+//checkOwnerGroup controle d'existence du groupe propriétaire (0 : aucun), réponse d'erreur écrite si ko
+func checkOwnerGroup(w http.ResponseWriter, groupID int) bool {
+	if groupID == 0 {
+		return true
+	}
+	grp, err := dal.GroupGet(groupID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return false
+	}
+	if grp.ID == 0 {
+		writeStdJSONErrBadRequest(w, "unknown owner group")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/sessions"
+	"CmdScheduler/slog"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOwnerFilter restriction par défaut aux taskflows des groupes de l'utilisateur, levée par ?groups=all
+func TestOwnerFilter(t *testing.T) {
+	slog.InitLogs("", 0, 0, false)
+	dir, err := ioutil.TempDir("", "ctrl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = dal.InitDb("sqlite3", "file:"+filepath.Join(dir, "data.db"), "SCHED"); err != nil {
+		t.Fatal(err)
+	}
+
+	const member, loner = 101, 102
+	team := dal.DbGroup{Name: "team", Tags: []int{911}, Members: []int{member}}
+	other := dal.DbGroup{Name: "other", Tags: []int{911}}
+	for _, g := range []*dal.DbGroup{&team, &other} {
+		if err = dal.GroupInsert(g, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//propriétaire explicite, par tag, hors groupe, autre propriétaire malgré le tag
+	tfs := []dal.DbTaskFlow{
+		{Lib: "owned", OwnerGroup: team.ID},
+		{Lib: "tagged", Tags: []int{911}},
+		{Lib: "foreign", Tags: []int{912}},
+		{Lib: "other", OwnerGroup: other.ID, Tags: []int{911}},
+	}
+	for i := range tfs {
+		if err = dal.TaskFlowInsert(&tfs[i], 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(usrID int, query string) []string {
+		r := httptest.NewRequest("GET", "/api/taskflows"+query, nil)
+		r = r.WithContext(context.WithValue(r.Context(), CtxSession, &sessions.Session{UserID: usrID}))
+		var searchQ dal.SearchQuery
+		if err := ownerFilter(r, &searchQ, "TASKFLOW.owner_grp", "TASKFLOW.tags"); err != nil {
+			t.Fatal(err)
+		}
+		lst, _, err := dal.TaskFlowList(searchQ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		libs := make([]string, 0, len(lst))
+		for _, tf := range lst {
+			libs = append(libs, tf.Lib)
+		}
+		return libs
+	}
+
+	//défaut : groupes de l'utilisateur
+	if libs := list(member, ""); len(libs) != 2 || libs[0] != "owned" || libs[1] != "tagged" {
+		t.Errorf("my groups %v", libs)
+	}
+	//tous les groupes
+	if libs := list(member, "?groups=all"); len(libs) != len(tfs) {
+		t.Errorf("all groups %v", libs)
+	}
+	//utilisateur sans groupe : pas de restriction
+	if libs := list(loner, ""); len(libs) != len(tfs) {
+		t.Errorf("no group %v", libs)
+	}
+}
@@ -3,8 +3,10 @@ package ctrl
 import (
 	"CmdScheduler/dal"
 	"CmdScheduler/schd"
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -13,10 +15,21 @@ type IdOnly struct {
 	ID int `json:"id"`
 }
 
-//apiManualLaunchTF handler post /queues
+// LaunchQuery lancement manuel, args : surcharge des arguments nommés du taskflow
+type LaunchQuery struct {
+	ID   int               `json:"id"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// LaunchResp retour de lancement manuel
+type LaunchResp struct {
+	RunID string `json:"run_id"`
+}
+
+//apiManualLaunchTF handler post /taskflows/launch
 func apiManualLaunchTF(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	//deserial input
-	var elm IdOnly
+	var elm LaunchQuery
 	err := json.NewDecoder(r.Body).Decode(&elm)
 	if err != nil {
 		writeStdJSONErrBadRequest(w, err.Error())
@@ -27,32 +40,97 @@ func apiManualLaunchTF(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		return
 	}
 
-	//check existance tf
+	//check existance tf et périmétre de lancement
 	tf, _ := dal.TaskFlowGet(elm.ID)
-	if tf.ID == 0 {
+	launch := taskFlowScope(r, dal.ActLaunch)
+	if tf.ID == 0 || !(launch.TaskFlow(tf.Tags, tf.QueueID) || taskFlowScope(r, dal.ActView).TaskFlow(tf.Tags, tf.QueueID)) {
 		writeStdJSONErrBadRequest(w, "invalid id")
 		return
 	}
+	if !launch.TaskFlow(tf.Tags, tf.QueueID) {
+		writeStdJSONErrForbidden(w, "taskflow out of scope")
+		return
+	}
 
 	// recup session user
 	s := getSessionFromCtx(r)
 
-	// tf non coché "lancement manu autorisé", interdit sauf droit task builder ou +
-	if !tf.ManualLaunch && s.RightLevel < dal.RightLvlTaskBuilder {
+	// tf non coché "lancement manu autorisé", interdit sauf droit de modification du taskflow
+	if !tf.ManualLaunch && !taskFlowScope(r, dal.ActEdit).TaskFlow(tf.Tags, tf.QueueID) {
 		writeStdJSONErrBadRequest(w, "this taskflow cannot be launched manually")
 		return
 	}
 
+	if elm.Args, err = tf.ValidateLaunchArgs(elm.Args); err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
 	//insection directe taskflow
-	schd.ManualLaunchTF(elm.ID, s.Login)
+	resp := LaunchResp{RunID: schd.ManualLaunchTF(elm.ID, s.Login, elm.Args)}
+	auditLog(r, "TASKFLOW", elm.ID, dal.AuditActLaunch, nil, &elm)
 
-	//retour ok : 201 created
-	writeStdJSONOK(w, nil)
+	//retour ok
+	writeStdJSONOK(w, &resp)
 }
 
 //apiGetQueuesStates info encours scheduleur
 func apiGetQueuesStates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	qstate := schd.GetViewState()
+	//restreint aux queues et taskflows du périmétre
+	qstate := schd.GetViewState().Restrict(queueScope(r, dal.ActView).Queue, taskFlowIDScope(taskFlowScope(r, dal.ActView)))
 
 	writeStdJSONOK(w, &qstate)
 }
+
+// RenderArgsQuery modéle d'argument à rendre
+type RenderArgsQuery struct {
+	Template   string    `json:"template"`
+	DtRef      time.Time `json:"dt_ref"` //maintenant si absent
+	TaskFlowID int       `json:"taskflow_id"`
+}
+
+// RenderArgsResp rendu d'un modéle d'argument
+type RenderArgsResp struct {
+	RenderArgsQuery
+	Rendered    string   `json:"rendered"`
+	UnknownTags []string `json:"unknown_tags"`
+}
+
+//apiRenderArgs handler post /taskflows/renderargs
+//validation d'un modéle d'argument (tags <%xxx%>) pour une date de référence
+func apiRenderArgs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm RenderArgsQuery
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	if elm.DtRef.IsZero() {
+		elm.DtRef = time.Now()
+	}
+
+	resp := RenderArgsResp{RenderArgsQuery: elm}
+	resp.Rendered, resp.UnknownTags = schd.RenderArgsTags(elm.Template, elm.DtRef, elm.TaskFlowID)
+
+	//retour ok : 200
+	writeStdJSONOK(w, &resp)
+}
+
+//metricsScrape accés à /metrics par le token de scrape (MetricsToken), à défaut controle standard de la session
+func metricsScrape(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if MetricsToken != "" && subtle.ConstantTimeCompare([]byte(getBearerToken(r)), []byte(MetricsToken)) == 1 {
+			apiMetrics(w, r, p)
+			return
+		}
+		next(w, r, p)
+	}
+}
+
+//apiMetrics handler get /metrics, format texte prometheus
+func apiMetrics(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	schd.WriteMetrics(w)
+}
@@ -0,0 +1,29 @@
+package ctrl
+
+import (
+	"CmdScheduler/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestMetricsScrape accés à /metrics par le token de scrape, sans session
+func TestMetricsScrape(t *testing.T) {
+	sessions.InitSessionStore(sessions.NewMemoryStore(time.Hour))
+	MetricsToken = "scrape-token"
+	defer func() { MetricsToken = "" }()
+	router := NewRouter()
+
+	for token, code := range map[string]int{"scrape-token": http.StatusOK, "other": http.StatusUnauthorized, "": http.StatusUnauthorized} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/cmdscheduler/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Errorf("token %q : %v, %v expected", token, rec.Code, code)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiNotificationGet handler get /notifications/:id
+func apiNotificationGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//inputs :
+	id, _ := strconv.Atoi(p.ByName("id"))
+	if id <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	//get dal
+	resp, err := dal.NotificationGet(id)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if resp.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+	maskNotificationSecrets(r, &resp)
+
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiNotificationList handler get /notifications
+func apiNotificationList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbNotification{}, false)
+
+	//get liste
+	arr, resp, err := dal.NotificationList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	for i := range arr {
+		maskNotificationSecrets(r, &arr[i])
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiNotificationCreate handler post /notifications
+//si ok : create 201 (Created and contain an entity, and a Location header.) ou 200
+func apiNotificationCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbNotification
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = elm.Validate(true)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = dal.NotificationInsert(&elm, getUsrIdFromCtx(r))
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	//notif sched
+	schd.UpdateSchedFromDb("DbNotification", elm.ID)
+
+	elm, err = dal.NotificationGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "NOTIF", elm.ID, dal.AuditActCreate, nil, &elm, "headers")
+
+	maskNotificationSecrets(r, &elm)
+
+	//retour ok : 201 created
+	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
+}
+
+//apiNotificationPut handler put /notifications/:id
+func apiNotificationPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//deserial input
+	var elm dal.DbNotification
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	elm.ID, _ = strconv.Atoi(p.ByName("id"))
+
+	err = restoreNotificationSecrets(&elm)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	err = elm.Validate(false)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	before, err := dal.NotificationGet(elm.ID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	err = dal.NotificationUpdate(elm, getUsrIdFromCtx(r), nil)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	//notif sched
+	schd.UpdateSchedFromDb("DbNotification", elm.ID)
+
+	elm, err = dal.NotificationGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "NOTIF", elm.ID, dal.AuditActUpdate, &before, &elm, "headers")
+
+	maskNotificationSecrets(r, &elm)
+
+	//retour ok : 200
+	writeStdJSONOK(w, &elm)
+}
+
+//apiNotificationDelete handler delete /notifications/:id
+func apiNotificationDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	elmID, _ := strconv.Atoi(p.ByName("id"))
+	if elmID <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	elm, err := dal.NotificationGet(elmID)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	if elm.ID > 0 {
+		err = dal.NotificationDelete(elm.ID, getUsrIdFromCtx(r))
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return
+		}
+		auditLog(r, "NOTIF", elm.ID, dal.AuditActDelete, &elm, nil, "headers")
+		//notif sched
+		schd.UpdateSchedFromDb("DbNotification", elm.ID)
+	}
+	//retour ok : 200
+	writeStdJSONOK(w, nil)
+}
+
+//apiNotificationTest handler post /notifications/test
+//envoi d'un évènement de test sur le canal fourni
+func apiNotificationTest(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbNotification
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = restoreNotificationSecrets(&elm)
+	if err == nil {
+		err = elm.Validate(elm.ID == 0)
+	}
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = schd.TestNotification(elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	writeStdJSONOK(w, nil)
+}
+
+//maskNotificationSecrets masque la clé hmac et les valeurs des entêtes (authorization...) sauf demande explicite d'un admin
+func maskNotificationSecrets(r *http.Request, elm *dal.DbNotification) {
+	if showSecrets(r) {
+		return
+	}
+	if elm.HMACKey != "" {
+		elm.HMACKey = dal.SecretMask
+	}
+	if len(elm.Headers) == 0 {
+		return
+	}
+	headers := make(map[string]string, len(elm.Headers))
+	for k, v := range elm.Headers {
+		if v != "" {
+			v = dal.SecretMask
+		}
+		headers[k] = v
+	}
+	elm.Headers = headers
+}
+
+//restoreNotificationSecrets clé hmac ou valeurs d'entêtes masquées renvoyées par le client : on conserve les valeurs existantes
+func restoreNotificationSecrets(elm *dal.DbNotification) error {
+	masked := elm.HMACKey == dal.SecretMask
+	for _, v := range elm.Headers {
+		masked = masked || v == dal.SecretMask
+	}
+	if elm.ID <= 0 || !masked {
+		return nil
+	}
+	cur, err := dal.NotificationGet(elm.ID)
+	if err != nil {
+		return err
+	}
+	if elm.HMACKey == dal.SecretMask {
+		elm.HMACKey = cur.HMACKey
+	}
+	for k, v := range elm.Headers {
+		if cv, exists := cur.Headers[k]; exists && v == dal.SecretMask {
+			elm.Headers[k] = cv
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package ctrl
+
+import (
+	"CmdScheduler/auth"
+	"CmdScheduler/sessions"
+	"CmdScheduler/slog"
+	"crypto/sha256"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+	"github.com/julienschmidt/httprouter"
+)
+
+//cookie de la connexion oidc en cours (state, nonce, code_verifier), chiffré, durée de vie courte
+const (
+	oidcCookie       = "cmds_oidc"
+	oidcCookieMaxAge = 600
+)
+
+//oidcCookieCodec chiffrement du cookie via la clé de session
+func oidcCookieCodec() *securecookie.SecureCookie {
+	blockKey := sha256.Sum256(SessionKey)
+	return securecookie.New(SessionKey, blockKey[:]).MaxAge(oidcCookieMaxAge)
+}
+
+//oidcSetCookie cookie limité aux routes oidc, vide : suppression
+func oidcSetCookie(w http.ResponseWriter, r *http.Request, value string) {
+	maxAge := oidcCookieMaxAge
+	if value == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     r.URL.Path[:strings.LastIndex(r.URL.Path, "/")],
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode, //cookie renvoyé lors de la redirection du fournisseur
+	})
+}
+
+//apiOIDCLogin handler get /auth/oidc/login, redirection vers le fournisseur (code d'autorisation + PKCE)
+func apiOIDCLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if OIDC == nil {
+		writeStdJSONErrNotFound(w, "oidc not configured")
+		return
+	}
+	u, login, err := OIDC.Login()
+	if err != nil {
+		slog.Warning("ctrl", "oidc login %v", err)
+		writeStdJSONErrInternalServer(w, "oidc provider unavailable")
+		return
+	}
+	v, err := oidcCookieCodec().Encode(oidcCookie, login)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	oidcSetCookie(w, r, v)
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+//apiOIDCCallback handler get /auth/oidc/callback, retour du fournisseur : session créée si l'id token est valide
+//redirection vers success_url (token en fragment) si configuré, sinon réponse json comme /auth
+func apiOIDCCallback(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if OIDC == nil {
+		writeStdJSONErrNotFound(w, "oidc not configured")
+		return
+	}
+	q := r.URL.Query()
+
+	//cookie à usage unique
+	var login auth.OIDCLogin
+	c, err := r.Cookie(oidcCookie)
+	if err == nil {
+		err = oidcCookieCodec().Decode(oidcCookie, c.Value, &login)
+	}
+	oidcSetCookie(w, r, "")
+	if e := q.Get("error"); e != "" {
+		writeStdJSONUnauthorized(w, "oidc "+e)
+		return
+	}
+	if err != nil {
+		writeStdJSONErrBadRequest(w, "oidc login expired or invalid")
+		return
+	}
+
+	usr, err := OIDC.Callback(r.Context(), login, q.Get("state"), q.Get("code"))
+	if err != nil {
+		slog.Warning("ctrl", "oidc callback %v", err)
+		writeStdJSONUnauthorized(w, "invalid credential")
+		return
+	}
+
+	// init nouvelle session
+	s, err := sessions.New(usr.Login, usr.ID, usr.RightLevel)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	if OIDC.SuccessURL() != "" {
+		http.Redirect(w, r, OIDC.SuccessURL()+"#token="+url.QueryEscape(s.SessionId), http.StatusFound)
+		return
+	}
+	writeStdJSONResp(w, http.StatusOK, JSONTokenResp{
+		Token:  s.SessionId,
+		Rights: sessionPermissions(s).RightList(),
+	})
+}
@@ -0,0 +1,131 @@
+package ctrl
+
+import (
+	"CmdScheduler/auth"
+	"CmdScheduler/auth/oidctest"
+	"CmdScheduler/dal"
+	"CmdScheduler/sessions"
+	"CmdScheduler/slog"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOIDCLogin parcours navigateur : login, fournisseur, callback puis session
+func TestOIDCLogin(t *testing.T) {
+	slog.InitLogs("", 0, 0, false)
+	dir, err := ioutil.TempDir("", "ctrl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = dal.InitDb("sqlite3", "file:"+filepath.Join(dir, "data.db"), "SCHED"); err != nil {
+		t.Fatal(err)
+	}
+	sessions.InitSessionStore(sessions.NewMemoryStore(time.Hour))
+	SessionKey = []byte("0123456789abcdef0123456789abcdef")
+	defer func() { OIDC = nil }()
+
+	srv := httptest.NewServer(NewRouter())
+	defer srv.Close()
+	idp := oidctest.NewProvider("cmds", "")
+	defer idp.Close()
+	idp.Claims = map[string]interface{}{"sub": "u1", "preferred_username": "grace", "groups": []string{"operators"}}
+
+	jar, _ := cookiejar.New(nil)
+	noFollow := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	get := func(u string) *http.Response {
+		resp, err := noFollow.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	//non configuré
+	if resp := get(srv.URL + "/cmdscheduler/auth/oidc/login"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("not configured %v", resp.StatusCode)
+	}
+
+	OIDC, err = auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:      idp.URL,
+		ClientID:    "cmds",
+		RedirectURL: srv.URL + "/cmdscheduler/auth/oidc/callback",
+		GroupRights: map[string]int{"operators": int(dal.RightLvlTaskRunner)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//login : redirection vers le fournisseur, cookie posé
+	resp := get(srv.URL + "/cmdscheduler/auth/oidc/login")
+	if resp.StatusCode != http.StatusFound || !strings.HasPrefix(resp.Header.Get("Location"), idp.URL+"/authorize?") {
+		t.Fatalf("login %v %v", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if len(resp.Cookies()) != 1 || resp.Cookies()[0].Name != oidcCookie || !resp.Cookies()[0].HttpOnly {
+		t.Fatalf("login cookie %v", resp.Cookies())
+	}
+	//fournisseur : retour vers le callback
+	resp = get(resp.Header.Get("Location"))
+	callback := resp.Header.Get("Location")
+	if !strings.HasPrefix(callback, srv.URL+"/cmdscheduler/auth/oidc/callback?") {
+		t.Fatalf("authorize %v %v", resp.StatusCode, callback)
+	}
+	//callback : session
+	resp, err = noFollow.Get(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tok JSONTokenResp
+	err = json.NewDecoder(resp.Body).Decode(&tok)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || tok.Token == "" {
+		t.Fatalf("callback %v %v %+v", resp.StatusCode, err, tok)
+	}
+	s := sessions.Get(tok.Token)
+	if s == nil || s.Login != "grace" || s.RightLevel != int(dal.RightLvlTaskRunner) || s.UserID == 0 {
+		t.Fatalf("session %+v", s)
+	}
+	//cookie consommé : rejeu refusé
+	if resp = get(callback); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("replay %v", resp.StatusCode)
+	}
+
+	//refus du fournisseur
+	get(srv.URL + "/cmdscheduler/auth/oidc/login")
+	if resp = get(srv.URL + "/cmdscheduler/auth/oidc/callback?error=access_denied"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("access denied %v", resp.StatusCode)
+	}
+	//id token invalide
+	idp.BadSignature = true
+	resp = get(get(srv.URL + "/cmdscheduler/auth/oidc/login").Header.Get("Location"))
+	if resp = get(resp.Header.Get("Location")); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad signature %v", resp.StatusCode)
+	}
+	idp.BadSignature = false
+
+	//redirection vers l'application, token en fragment
+	OIDC, _ = auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:      idp.URL,
+		ClientID:    "cmds",
+		RedirectURL: srv.URL + "/cmdscheduler/auth/oidc/callback",
+		GroupRights: map[string]int{"operators": int(dal.RightLvlTaskRunner)},
+		SuccessURL:  "https://cmds.example.com/",
+	})
+	resp = get(get(srv.URL + "/cmdscheduler/auth/oidc/login").Header.Get("Location"))
+	resp = get(resp.Header.Get("Location"))
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || loc.Host != "cmds.example.com" || !strings.HasPrefix(loc.Fragment, "token=") ||
+		sessions.Get(strings.TrimPrefix(loc.Fragment, "token=")) == nil {
+		t.Fatalf("success url %v %v", resp.StatusCode, loc)
+	}
+}
@@ -0,0 +1,540 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//docRoute route déclarée, chemin sans la racine au format httprouter (:id)
+type docRoute struct {
+	Method string
+	Path   string
+}
+
+//docRouter routeur mémorisant les routes déclarées pour la doc openapi
+type docRouter struct {
+	*httprouter.Router
+	root   string
+	routes []docRoute
+}
+
+func (r *docRouter) record(method, path string) {
+	r.routes = append(r.routes, docRoute{Method: method, Path: strings.TrimPrefix(path, r.root)})
+}
+
+//GET déclaration d'une route get
+func (r *docRouter) GET(path string, h httprouter.Handle) {
+	r.record(http.MethodGet, path)
+	r.Router.GET(path, h)
+}
+
+//POST déclaration d'une route post
+func (r *docRouter) POST(path string, h httprouter.Handle) {
+	r.record(http.MethodPost, path)
+	r.Router.POST(path, h)
+}
+
+//PUT déclaration d'une route put
+func (r *docRouter) PUT(path string, h httprouter.Handle) {
+	r.record(http.MethodPut, path)
+	r.Router.PUT(path, h)
+}
+
+//DELETE déclaration d'une route delete
+func (r *docRouter) DELETE(path string, h httprouter.Handle) {
+	r.record(http.MethodDelete, path)
+	r.Router.DELETE(path, h)
+}
+
+//actions routes path/<action> : un seul segment variable possible par niveau (httprouter),
+//les actions sont donc aiguillées depuis path/:id
+func (r *docRouter) actions(method, path string, actions map[string]httprouter.Handle) {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.record(method, path+"/"+name)
+	}
+	r.Router.Handle(method, path+"/:id", func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
+		if h, exists := actions[p.ByName("id")]; exists {
+			h(w, req, p)
+			return
+		}
+		writeStdJSONErrNotFound(w, "unknown action "+p.ByName("id"))
+	})
+}
+
+//apiDoc description d'une route
+type apiDoc struct {
+	Summary    string
+	Tag        string
+	Public     bool        // sans authentification
+	Basic      bool        // authentification basic (/auth)
+	List       interface{} // liste paginée de l'entité (ptr) : filtres et tris
+	Body       interface{} // corps json
+	BodyType   string      // corps non json (content type)
+	Resp       interface{} // réponse json
+	RespType   string      // réponse non json (content type)
+	Created    bool        // 201 created
+	Redirect   string      // 302, destination de la redirection
+	Query      []docParam  // paramétres get spécifiques
+	PathString []string    // paramétres de chemin non numériques
+}
+
+//docParam paramétre get
+type docParam struct {
+	Name string
+	Type string
+	Desc string
+}
+
+var (
+	secretsParam = docParam{"secrets", "boolean", "1 : clear sensitive values (admin only)"}
+	dryRunParam  = docParam{"dryrun", "boolean", "1 : plan only, nothing applied"}
+)
+
+//crudDocs routes crud standard d'une entité
+func crudDocs(docs map[string]apiDoc, path, tag, lib string, model interface{}, query ...docParam) {
+	docs["GET "+path] = apiDoc{Summary: "List " + lib + "s", Tag: tag, List: model, Query: query}
+	docs["GET "+path+"/:id"] = apiDoc{Summary: "Get a " + lib, Tag: tag, Resp: model, Query: query}
+	docs["POST "+path] = apiDoc{Summary: "Create a " + lib, Tag: tag, Body: model, Resp: model, Created: true}
+	docs["PUT "+path+"/:id"] = apiDoc{Summary: "Update a " + lib, Tag: tag, Body: model, Resp: model}
+	docs["DELETE "+path+"/:id"] = apiDoc{Summary: "Delete a " + lib, Tag: tag, Resp: &JSONStdResponse{}}
+}
+
+//routeDocs description des routes, clé "METHOD chemin"
+func routeDocs() map[string]apiDoc {
+	legacyQuery := []docParam{
+		{"agent", "string", "host of the agent running the tasks (required)"},
+		{"queue", "string", "queue of the taskflows"},
+		{"prefix", "string", "prefix of the generated names"},
+		{"activ", "boolean", "1 : activate the taskflows"},
+		{"tz", "string", "time zone of the schedules"},
+		dryRunParam,
+	}
+	docs := map[string]apiDoc{
+		"GET /ping":         {Summary: "Health check", Tag: "misc", Public: true, RespType: "text/plain"},
+		"GET /openapi.json": {Summary: "This OpenAPI document", Tag: "misc", Public: true, RespType: "application/json"},
+		"POST /auth":        {Summary: "Open a session, returns the bearer token", Tag: "auth", Basic: true, Resp: &JSONTokenResp{}},
+		"GET /disconnect":   {Summary: "Close the session", Tag: "auth", Public: true, Resp: &JSONTokenResp{}},
+		"GET /my/right":     {Summary: "Rights of the current user", Tag: "auth", Resp: map[string]dal.RightView{}},
+
+		"GET /auth/oidc/login": {Summary: "Start an OpenID Connect login (authorization code + PKCE)", Tag: "auth", Public: true,
+			Redirect: "the identity provider"},
+		"GET /auth/oidc/callback": {Summary: "OpenID Connect login return, opens a session", Tag: "auth", Public: true, Resp: &JSONTokenResp{},
+			Redirect: "the configured success url, the token in the fragment (#token=)",
+			Query:    []docParam{{Name: "code", Type: "string", Desc: "authorization code"}, {Name: "state", Type: "string", Desc: "login state"}}},
+
+		"GET /my/apitokens":        {Summary: "List the api tokens of the current user", Tag: "apitokens", List: &dal.DbAPIToken{}},
+		"POST /my/apitokens":       {Summary: "Create an api token for the current user, the token value is only returned here", Tag: "apitokens", Body: &dal.DbAPIToken{}, Resp: &dal.DbAPIToken{}, Created: true},
+		"DELETE /my/apitokens/:id": {Summary: "Revoke an api token of the current user", Tag: "apitokens", Resp: &JSONStdResponse{}},
+		"GET /my/groups":           {Summary: "List the groups of the current user", Tag: "groups", List: &dal.DbGroup{}},
+
+		"GET /queue/state": {Summary: "Queues state, taskflows in progress and next launches", Tag: "dashboard", Resp: &schd.WipView{}},
+		"GET /events":      {Summary: "Server-sent events stream (queue state, task start/end, config reload)", Tag: "dashboard", RespType: "text/event-stream"},
+		"GET /metrics":     {Summary: "Prometheus metrics", Tag: "dashboard", RespType: "text/plain"},
+		"GET /audit":       {Summary: "List audit records", Tag: "audit", List: &dal.DbAudit{}},
+
+		"GET /export": {Summary: "Export the configuration bundle", Tag: "bundle", Resp: &dal.Bundle{},
+			Query: []docParam{{"format", "string", "yaml : yaml bundle (or Accept: application/yaml)"}}},
+		"POST /import": {Summary: "Plan or apply a configuration bundle (json or yaml)", Tag: "bundle", Body: &dal.Bundle{}, Resp: &BundleImportResp{},
+			Query: []docParam{dryRunParam, {"prune", "boolean", "1 : delete the entities missing from the bundle"}}},
+		"POST /import/crontab": {Summary: "Convert and import a crontab", Tag: "bundle", BodyType: "text/plain", Resp: &LegacyImportResp{},
+			Query: append(legacyQuery, docParam{"system", "boolean", "1 : system crontab, with a user field"})},
+		"POST /import/schtasks": {Summary: "Convert and import a Windows scheduled task (xml export)", Tag: "bundle", BodyType: "application/xml", Resp: &LegacyImportResp{},
+			Query: append(legacyQuery, docParam{"name", "string", "task name"})},
+
+		"GET /gitops/status":  {Summary: "GitOps synchronisation state", Tag: "gitops", Resp: &schd.GitOpsStatus{}},
+		"POST /gitops/sync":   {Summary: "Synchronise now", Tag: "gitops", Resp: &schd.GitOpsStatus{}},
+		"GET /gitops/managed": {Summary: "List the entities managed by GitOps (read only)", Tag: "gitops", List: &dal.DbManaged{}},
+
+		"POST /agents/eval":        {Summary: "Evaluate the connection to an agent", Tag: "agents", Body: &dal.DbAgent{}, Resp: &dal.DbAgent{}},
+		"POST /notifications/test": {Summary: "Send a test event to a notification channel", Tag: "notifications", Body: &dal.DbNotification{}, Resp: &JSONStdResponse{}},
+
+		"GET /cfgs":     {Summary: "List the configuration keys", Tag: "configs", Resp: []dal.KVJSON{}, Query: []docParam{secretsParam}},
+		"GET /cfgs/:id": {Summary: "Get a configuration key", Tag: "configs", Resp: &dal.KVJSON{}, Query: []docParam{secretsParam}, PathString: []string{"id"}},
+		"POST /cfgs":    {Summary: "Set a configuration key", Tag: "configs", Body: &dal.KVJSON{}, Resp: &dal.KVJSON{}},
+
+		"GET /vars":        {Summary: "List the global variables", Tag: "variables", Resp: []dal.DbVar{}},
+		"GET /vars/usages": {Summary: "Tasks and taskflows using the variables", Tag: "variables", Resp: []dal.VarUsage{}, Query: []docParam{{"name", "string", "single variable"}}},
+		"POST /vars":       {Summary: "Set a global variable (empty value : delete)", Tag: "variables", Body: &dal.DbVar{}, Resp: &dal.DbVar{}},
+
+		"POST /taskflows/launch":     {Summary: "Manual launch, returns the run id", Tag: "taskflows", Body: &LaunchQuery{}, Resp: &LaunchResp{}},
+		"POST /taskflows/renderargs": {Summary: "Render an argument template", Tag: "taskflows", Body: &RenderArgsQuery{}, Resp: &RenderArgsResp{}},
+
+		"GET /taskflows/:id/versions":    {Summary: "List the versions of a taskflow", Tag: "taskflows", List: &dal.DbTaskFlowVersion{}},
+		"GET /taskflows/:id/versions/:v": {Summary: "Get a version (0 : last)", Tag: "taskflows", Resp: &dal.DbTaskFlowVersion{}},
+		"GET /taskflows/:id/versions/:v/diff": {Summary: "Diff between two versions", Tag: "taskflows", Resp: map[string]interface{}{},
+			Query: []docParam{{"to", "integer", "target version, last by default"}}},
+		"POST /taskflows/:id/versions/:v/restore": {Summary: "Restore a version as a new version", Tag: "taskflows", Resp: &dal.DbTaskFlow{},
+			Query: []docParam{{"tasks", "boolean", "1 : restore the tasks too"}}},
+
+		"GET /runs":        {Summary: "List the taskflow runs", Tag: "runs", List: &dal.DbTaskFlowRun{}},
+		"GET /slabreaches": {Summary: "List the SLA breaches", Tag: "runs", List: &dal.DbSLABreach{}},
+	}
+	crudDocs(docs, "/users", "users", "user", &dal.DbUser{})
+	crudDocs(docs, "/apitokens", "apitokens", "api token", &dal.DbAPIToken{})
+	crudDocs(docs, "/roles", "roles", "role", &dal.DbRole{})
+	crudDocs(docs, "/groups", "groups", "group", &dal.DbGroup{})
+	crudDocs(docs, "/agents", "agents", "agent", &dal.DbAgent{}, secretsParam)
+	crudDocs(docs, "/queues", "queues", "queue", &dal.DbQueue{})
+	crudDocs(docs, "/tags", "tags", "tag", &dal.DbTag{})
+	crudDocs(docs, "/secrets", "secrets", "secret", &dal.DbSecret{}, secretsParam)
+	crudDocs(docs, "/notifications", "notifications", "notification channel", &dal.DbNotification{}, secretsParam)
+	crudDocs(docs, "/tasks", "tasks", "task", &dal.DbTask{})
+	crudDocs(docs, "/scheds", "schedules", "schedule", &dal.DbSched{})
+	crudDocs(docs, "/taskflows", "taskflows", "taskflow", &dal.DbTaskFlow{})
+	return docs
+}
+
+//openAPIInfo description générale, syntaxe des listes
+const openAPIInfo = `CmdScheduler REST API. Authenticate with POST /auth (basic) then send the token as "Authorization: Bearer <token>".
+Long-lived api tokens (cst_..., /my/apitokens) are sent the same way, with the rights and taskflow tags of the token. A token restricted to tags only reaches taskflows, tasks, queues and runs.
+
+Lists are paged : offset or page, limit (default ` + "%d" + `, max ` + "%d" + `). sort : comma separated sortable fields, desc: prefix for a descending order (sort=desc:lib,id).
+Filters : field=value or field=op:value, op : eq, not, like (% wildcard), in (comma separated list), lt, lte, gt, gte, nu (is null), nn (is not null).
+A repeated filter is combined with AND, an op prefixed with o (oeq:, olike:...) combines with OR.`
+
+//schemaGen génération des schémas json des types
+type schemaGen struct {
+	schemas map[string]interface{}
+	types   map[string]reflect.Type
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+//schemaName nom de composant d'un type nommé, préfixé du package si homonyme
+func (g *schemaGen) schemaName(t reflect.Type) string {
+	name := t.Name()
+	if name != "" {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	if prev, exists := g.types[name]; exists && prev != t {
+		pkg := t.PkgPath()
+		if i := strings.LastIndex(pkg, "/"); i >= 0 {
+			pkg = pkg[i+1:]
+		}
+		name = strings.Title(pkg) + name
+	}
+	return name
+}
+
+//schema schéma d'un type, référence vers les composants pour les structs nommées
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawJSONType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := g.schemaName(t)
+		if _, exists := g.types[name]; !exists {
+			g.types[name] = t
+			g.schemas[name] = map[string]interface{}{} //types récursifs
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+//object schéma d'une struct selon les tags json, structs anonymes incluses à plat
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	g.properties(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (g *schemaGen) properties(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" && len(tag) == 1 {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag[0] == "" && ft.Kind() == reflect.Struct {
+			g.properties(ft, props)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue //non exporté
+		}
+		name := tag[0]
+		if name == "" {
+			name = f.Name
+		}
+		s := g.schema(f.Type)
+		for _, opt := range tag[1:] {
+			if opt == "string" {
+				s = map[string]interface{}{"type": "string"}
+			}
+		}
+		props[name] = s
+	}
+}
+
+//pathParams chemin openapi ({id}) et paramétres de chemin
+func pathParams(path string, doc apiDoc) (string, []interface{}) {
+	params := make([]interface{}, 0)
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if !strings.HasPrefix(s, ":") {
+			continue
+		}
+		name := s[1:]
+		segs[i] = "{" + name + "}"
+		typ := "integer"
+		for _, ps := range doc.PathString {
+			if ps == name {
+				typ = "string"
+			}
+		}
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": typ},
+		})
+	}
+	return strings.Join(segs, "/"), params
+}
+
+//listParams paramétres de paging, tri et filtres d'une liste
+func listParams(model interface{}) []interface{} {
+	sortable := make([]string, 0)
+	filters := make([]interface{}, 0)
+	for _, f := range dal.SearchFields(model) {
+		if f.Sortable {
+			sortable = append(sortable, f.Name)
+		}
+		if !f.Searchable {
+			continue
+		}
+		filters = append(filters, map[string]interface{}{
+			"name":        f.Name,
+			"in":          "query",
+			"description": "filter on " + f.Type + " : value, eq:, not:, like:, in:a,b, lt:, lte:, gt:, gte:, nu:, nn: (o prefix for OR), repeated for AND",
+			"style":       "form",
+			"explode":     true,
+			"schema":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		})
+	}
+	intParam := func(name, desc string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "in": "query", "description": desc, "schema": map[string]interface{}{"type": "integer", "minimum": 0}}
+	}
+	params := []interface{}{
+		intParam("offset", "first record (0 based)"),
+		intParam("page", "page (1 based), alternative to offset"),
+		intParam("limit", "records per page, default "+strconv.Itoa(dal.DefaultRecordPerPage)+", max "+strconv.Itoa(dal.MaxRecordPerPage)),
+	}
+	if len(sortable) > 0 {
+		params = append(params, map[string]interface{}{
+			"name":        "sort",
+			"in":          "query",
+			"description": "comma separated fields, desc: prefix for a descending order. Sortable : " + strings.Join(sortable, ", "),
+			"example":     "desc:" + sortable[0],
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	return append(params, filters...)
+}
+
+//operationID identifiant d'opération déduit de la route : GET /taskflows/:id -> getTaskflowsById
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, s := range strings.Split(path, "/") {
+		s = strings.Map(func(r rune) rune {
+			if r == '.' || r == '-' {
+				return '_'
+			}
+			return r
+		}, s)
+		if s == "" {
+			continue
+		}
+		if strings.HasPrefix(s, ":") {
+			s = "By" + strings.Title(s[1:])
+		}
+		for _, p := range strings.Split(s, "_") {
+			id += strings.Title(p)
+		}
+	}
+	return id
+}
+
+//openAPISpec document openapi 3 des routes déclarées, routes non décrites signalées dans undocumented
+func openAPISpec(root string, routes []docRoute) (spec map[string]interface{}, undocumented []string) {
+	docs := routeDocs()
+	g := &schemaGen{schemas: make(map[string]interface{}), types: make(map[string]reflect.Type)}
+	errRef := map[string]interface{}{"$ref": "#/components/responses/Error"}
+	g.schema(reflect.TypeOf(JSONStdResponse{}))
+	pagedRef := g.schema(reflect.TypeOf(dal.PagedResponse{}))
+
+	paths := make(map[string]interface{})
+	for _, rt := range routes {
+		doc, exists := docs[rt.Method+" "+rt.Path]
+		if !exists {
+			undocumented = append(undocumented, rt.Method+" "+rt.Path)
+		}
+		path, params := pathParams(rt.Path, doc)
+		op := map[string]interface{}{
+			"operationId": operationID(rt.Method, rt.Path),
+			"summary":     doc.Summary,
+		}
+		if doc.Tag != "" {
+			op["tags"] = []string{doc.Tag}
+		}
+		if doc.List != nil {
+			params = append(params, listParams(doc.List)...)
+		}
+		for _, q := range doc.Query {
+			typ := q.Type
+			if typ == "boolean" {
+				typ = "string" //1 ou true
+			}
+			params = append(params, map[string]interface{}{
+				"name": q.Name, "in": "query", "description": q.Desc, "schema": map[string]interface{}{"type": typ},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		//corps
+		if doc.Body != nil {
+			content := map[string]interface{}{"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Body))}}
+			if rt.Path == "/import" {
+				content["application/yaml"] = map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Body))}
+			}
+			op["requestBody"] = map[string]interface{}{"required": true, "content": content}
+		} else if doc.BodyType != "" {
+			op["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+				doc.BodyType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			}}
+		}
+
+		//réponses
+		ok := map[string]interface{}{"description": "OK"}
+		switch {
+		case doc.List != nil:
+			ok["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{
+				"allOf": []interface{}{pagedRef, map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+					"data": map[string]interface{}{"type": "array", "items": g.schema(reflect.TypeOf(doc.List))},
+				}}},
+			}}}
+		case doc.Resp != nil:
+			content := map[string]interface{}{"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Resp))}}
+			if rt.Path == "/export" {
+				content["application/yaml"] = map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Resp))}
+			}
+			ok["content"] = content
+		case doc.RespType != "":
+			ok["content"] = map[string]interface{}{doc.RespType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+		}
+		responses := map[string]interface{}{"default": errRef}
+		if doc.Created {
+			ok["description"] = "Created"
+			responses["201"] = ok
+		} else if ok["content"] != nil || doc.Redirect == "" {
+			responses["200"] = ok
+		}
+		if doc.Redirect != "" {
+			responses["302"] = map[string]interface{}{"description": "Redirect to " + doc.Redirect}
+		}
+		switch {
+		case doc.Public:
+			op["security"] = []interface{}{}
+		case doc.Basic:
+			op["security"] = []interface{}{map[string]interface{}{"basicAuth": []string{}}}
+			responses["401"] = map[string]interface{}{"description": "Invalid credentials"}
+		default:
+			responses["401"] = map[string]interface{}{"description": "Missing or expired token"}
+			responses["403"] = map[string]interface{}{"description": "Forbidden"}
+		}
+		op["responses"] = responses
+
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	spec = map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "CmdScheduler API",
+			"version":     "1",
+			"description": strings.Replace(strings.Replace(openAPIInfo, "%d", strconv.Itoa(dal.DefaultRecordPerPage), 1), "%d", strconv.Itoa(dal.MaxRecordPerPage), 1),
+		},
+		"servers":  []interface{}{map[string]interface{}{"url": root}},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "Error",
+					"content": map[string]interface{}{"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{"$ref": "#/components/schemas/JSONStdResponse"},
+					}},
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"basicAuth":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+	}
+	return spec, undocumented
+}
+
+//apiOpenAPI handler get /openapi.json
+func apiOpenAPI(spec []byte) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(spec)
+	}
+}
@@ -0,0 +1,181 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// refs collecte des $ref d'un document
+func refs(v interface{}, found *[]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if s, ok := e.(string); ok && k == "$ref" {
+				*found = append(*found, s)
+				continue
+			}
+			refs(e, found)
+		}
+	case []interface{}:
+		for _, e := range t {
+			refs(e, found)
+		}
+	}
+}
+
+// resolve résolution d'un pointeur json local (#/a/b)
+func resolve(doc map[string]interface{}, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	var cur interface{} = doc
+	for _, p := range strings.Split(ref[2:], "/") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if cur, ok = m[p]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func param(op map[string]interface{}, name string) map[string]interface{} {
+	params, _ := op["parameters"].([]interface{})
+	for _, p := range params {
+		if pm := p.(map[string]interface{}); pm["name"] == name {
+			return pm
+		}
+	}
+	return nil
+}
+
+func TestOpenAPI(t *testing.T) {
+	router := newRouter()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cmdscheduler/openapi.json", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("openapi.json %v %v", rec.Code, rec.Header())
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	//structure générale
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.0.") {
+		t.Errorf("version %v", doc["openapi"])
+	}
+	info := doc["info"].(map[string]interface{})
+	if info["title"] == "" || info["version"] == "" {
+		t.Errorf("info %v", info)
+	}
+
+	//toutes les routes déclarées sont décrites
+	if _, undocumented := openAPISpec(router.root, router.routes); len(undocumented) != 0 {
+		t.Errorf("undocumented routes %v", undocumented)
+	}
+
+	//références résolues
+	var found []string
+	refs(doc, &found)
+	if len(found) == 0 {
+		t.Error("no $ref")
+	}
+	for _, ref := range found {
+		if !resolve(doc, ref) {
+			t.Errorf("unresolved %v", ref)
+		}
+	}
+
+	//paramétres de chemin déclarés, operationId uniques, réponses
+	pathParam := regexp.MustCompile(`\{([^}]+)\}`)
+	opIDs := make(map[string]string)
+	for path, item := range doc["paths"].(map[string]interface{}) {
+		if strings.Contains(path, ":") {
+			t.Errorf("httprouter syntax in %v", path)
+		}
+		for method, o := range item.(map[string]interface{}) {
+			op := o.(map[string]interface{})
+			id, _ := op["operationId"].(string)
+			if prev, exists := opIDs[id]; exists || id == "" {
+				t.Errorf("operationId %q %v %v / %v", id, method, path, prev)
+			}
+			opIDs[id] = method + " " + path
+			if op["summary"] == "" {
+				t.Errorf("no summary %v %v", method, path)
+			}
+			if resp, _ := op["responses"].(map[string]interface{}); resp["200"] == nil && resp["201"] == nil && resp["302"] == nil {
+				t.Errorf("no success response %v %v", method, path)
+			}
+			declared := 0
+			params, _ := op["parameters"].([]interface{})
+			for _, p := range params {
+				if pm := p.(map[string]interface{}); pm["in"] == "path" {
+					declared++
+					if pm["required"] != true || !strings.Contains(path, "{"+pm["name"].(string)+"}") {
+						t.Errorf("path param %v %v %v", method, path, pm)
+					}
+				}
+			}
+			if n := len(pathParam.FindAllString(path, -1)); n != declared {
+				t.Errorf("path params %v %v : %v/%v", method, path, declared, n)
+			}
+		}
+	}
+
+	//liste : paging, tri et filtres selon les tags du modéle
+	paths := doc["paths"].(map[string]interface{})
+	list := paths["/taskflows"].(map[string]interface{})["get"].(map[string]interface{})
+	for _, p := range []string{"offset", "page", "limit", "sort", "lib", "activ"} {
+		if param(list, p) == nil {
+			t.Errorf("taskflows list param %v", p)
+		}
+	}
+	if d, _ := param(list, "sort")["description"].(string); !strings.Contains(d, "desc:") || !strings.Contains(d, "lib") {
+		t.Errorf("sort %v", d)
+	}
+	if d, _ := param(list, "lib")["description"].(string); !strings.Contains(d, "in:") || !strings.Contains(d, "o prefix") {
+		t.Errorf("filter %v", d)
+	}
+	runs := paths["/runs"].(map[string]interface{})["get"].(map[string]interface{})
+	if param(runs, "runid") == nil || param(runs, "taskflowid") == nil || param(runs, "run_id") != nil {
+		t.Errorf("runs filters %v", runs["parameters"])
+	}
+	//actions des taskflows
+	if launch, _ := paths["/taskflows/launch"].(map[string]interface{}); launch["post"] == nil {
+		t.Error("launch action")
+	}
+	if _, exists := paths["/taskflows/{id}"].(map[string]interface{})["post"]; exists {
+		t.Error("action dispatcher documented")
+	}
+	unknown := httptest.NewRecorder()
+	router.ServeHTTP(unknown, httptest.NewRequest(http.MethodPost, "/cmdscheduler/taskflows/unknown", nil))
+	if unknown.Code != http.StatusNotFound || !strings.HasPrefix(unknown.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("unknown action %v %v", unknown.Code, unknown.Header())
+	}
+
+	//schémas selon les tags json
+	tf := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})["DbTaskFlow"].(map[string]interface{})
+	props := tf["properties"].(map[string]interface{})
+	detail, _ := props["detail"].(map[string]interface{})
+	if props["lib"] == nil || detail["type"] != "array" {
+		t.Errorf("DbTaskFlow %v", props)
+	}
+	if !strings.Contains(rec.Body.String(), `"format":"date-time"`) {
+		t.Error("time format")
+	}
+
+	//publique, auth basic
+	if sec, _ := paths["/ping"].(map[string]interface{})["get"].(map[string]interface{})["security"].([]interface{}); sec == nil || len(sec) != 0 {
+		t.Errorf("ping security %v", sec)
+	}
+	if sec, _ := paths["/auth"].(map[string]interface{})["post"].(map[string]interface{})["security"].([]interface{}); len(sec) != 1 {
+		t.Errorf("auth security %v", sec)
+	}
+}
@@ -3,6 +3,7 @@ package ctrl
 import (
 	"CmdScheduler/dal"
 	"CmdScheduler/schd"
+	"CmdScheduler/sessions"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -25,7 +26,7 @@ func apiQueueGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
-	if resp.ID == 0 {
+	if resp.ID == 0 || !queueScope(r, dal.ActView).Queue(resp.ID) {
 		writeStdJSONErrNotFound(w, "id not found")
 		return
 	}
@@ -38,6 +39,11 @@ func apiQueueGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 func apiQueueList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// filtre extrait du get
 	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbQueue{}, false)
+	queueScope(r, dal.ActView).Filter(&searchQ, "", "QUEUE.id")
+	if err := ownerFilter(r, &searchQ, "QUEUE.owner_grp", ""); err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
 
 	//get liste
 	_, resp, err := dal.QueueList(searchQ)
@@ -65,8 +71,15 @@ func apiQueueCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
+	if !checkOwnerGroup(w, elm.OwnerGroup) {
+		return
+	}
+	if !queueScope(r, dal.ActEdit).All {
+		writeStdJSONErrForbidden(w, "queue creation out of scope")
+		return
+	}
 
-	err = dal.QueueInsert(&elm, getUsrIdFromCtx(r))
+	err = dal.QueueInsert(&elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
@@ -80,6 +93,7 @@ func apiQueueCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "QUEUE", elm.ID, dal.AuditActCreate, nil, &elm)
 
 	//retour ok : 201 created
 	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
@@ -101,6 +115,26 @@ func apiQueuePut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
+	if !checkOwnerGroup(w, elm.OwnerGroup) {
+		return
+	}
+
+	before, _ := dal.QueueGet(elm.ID)
+
+	//seule la pause change : droit de pause suffisant
+	action := dal.ActEdit
+	if before.ID > 0 && !queueDefChanged(before, elm) {
+		action = dal.ActPause
+	}
+	if !queueScope(r, action).Queue(elm.ID) {
+		writeStdJSONErrForbidden(w, "queue out of scope")
+		return
+	}
+
+	//queue gérée par gitops : seule la pause reste modifiable
+	if queueDefChanged(before, elm) && managedForbidden(w, "QUEUE", elm.ID) {
+		return
+	}
 
 	err = dal.QueueUpdate(elm, 0, false, nil)
 	if err != nil {
@@ -116,11 +150,41 @@ func apiQueuePut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "QUEUE", elm.ID, dal.AuditActUpdate, &before, &elm)
 
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
 }
 
+//queuePutAllowed autorisation put /queues/:id : droit de modification ou de mise en pause
+func queuePutAllowed(s *sessions.Session) bool {
+	p := sessionPermissions(s)
+	return p.Allowed("queue", dal.ActEdit) || p.Allowed("queue", dal.ActPause)
+}
+
+//queueScope périmétre des queues pour une action
+func queueScope(r *http.Request, action string) dal.Scope {
+	return sessionPermissions(getSessionFromCtx(r)).Scope("queue", action)
+}
+
+//queueDefChanged définition modifiée (hors pause)
+func queueDefChanged(a, b dal.DbQueue) bool {
+	if a.Lib != b.Lib || a.Slot != b.Slot || a.MaxSize != b.MaxSize || a.MaxDuration != b.MaxDuration ||
+		len(a.NoExecWhile) != len(b.NoExecWhile) {
+		return true
+	}
+	ids := make(map[int]bool)
+	for _, id := range a.NoExecWhile {
+		ids[id] = true
+	}
+	for _, id := range b.NoExecWhile {
+		if !ids[id] {
+			return true
+		}
+	}
+	return false
+}
+
 //apiQueueDelete handler delete /queues/:id
 func apiQueueDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	elmID, _ := strconv.Atoi(p.ByName("id"))
@@ -134,12 +198,17 @@ func apiQueueDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
+	if elm.ID > 0 && !queueScope(r, dal.ActEdit).Queue(elm.ID) {
+		writeStdJSONErrForbidden(w, "queue out of scope")
+		return
+	}
 	if elm.ID > 0 {
-		err = dal.QueueDelete(elm.ID, getUsrIdFromCtx(r))
+		err = dal.QueueDelete(elm.ID, getUsrIdFromCtx(r), nil)
 		if err != nil {
 			writeStdJSONErrInternalServer(w, err.Error())
 			return
 		}
+		auditLog(r, "QUEUE", elm.ID, dal.AuditActDelete, &elm, nil)
 		//notif sched
 		schd.UpdateSchedFromDb("DbQueue", elm.ID)
 	}
@@ -0,0 +1,150 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiRoleGet handler get /roles/:id
+func apiRoleGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//inputs :
+	id, _ := strconv.Atoi(p.ByName("id"))
+	if id <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	//get dal
+	resp, err := dal.RoleGet(id)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if resp.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiRoleList handler get /roles
+func apiRoleList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbRole{}, false)
+
+	//get liste
+	_, resp, err := dal.RoleList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiRoleCreate handler post /roles
+//si ok : create 201 (Created and contain an entity, and a Location header.) ou 200
+func apiRoleCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbRole
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = elm.Validate(true)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = dal.RoleInsert(&elm, getUsrIdFromCtx(r))
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	elm, err = dal.RoleGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "ROLE", elm.ID, dal.AuditActCreate, nil, &elm)
+	//retour ok : 201 created
+	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
+}
+
+//apiRolePut handler put /roles/:id
+func apiRolePut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//deserial input
+	var elm dal.DbRole
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	elm.ID, _ = strconv.Atoi(p.ByName("id"))
+
+	err = elm.Validate(false)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	before, err := dal.RoleGet(elm.ID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if before.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+	err = dal.RoleUpdate(elm, getUsrIdFromCtx(r), nil)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	elm, err = dal.RoleGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "ROLE", elm.ID, dal.AuditActUpdate, &before, &elm)
+
+	//retour ok : 200
+	writeStdJSONOK(w, &elm)
+}
+
+//apiRoleDelete handler delete /roles/:id
+func apiRoleDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	elmID, _ := strconv.Atoi(p.ByName("id"))
+	if elmID <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	elm, err := dal.RoleGet(elmID)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	if elm.ID > 0 {
+		err = dal.RoleDelete(elm.ID)
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return
+		}
+		auditLog(r, "ROLE", elm.ID, dal.AuditActDelete, &elm, nil)
+	}
+	//retour ok : 200
+	writeStdJSONOK(w, nil)
+}
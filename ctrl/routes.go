@@ -5,6 +5,7 @@ import (
 	"CmdScheduler/sessions"
 	"CmdScheduler/slog"
 	"context"
+	"encoding/json"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,26 +14,45 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-//ListenAndServe met en place les routes et lance le serveur
-func ListenAndServe(ListenOn string) error {
-	//point d'entrée du ws
-	router := httprouter.New()
+//NewRouter met en place les routes de l'api
+func NewRouter() *httprouter.Router {
+	return newRouter().Router
+}
 
+func newRouter() *docRouter {
+	//point d'entrée du ws
 	root := "/cmdscheduler"
+	router := &docRouter{Router: httprouter.New(), root: root}
 
 	//TODO protection https://github.com/gorilla/csrf
 	//type Handle func(http.ResponseWriter, *http.Request, Params)
 	router.GET(root+"/ping", ping) //healthcheck
 
 	// Auth pour obtention token api
-	router.POST(root+"/auth", secMiddleWare("", nil, true, apiAuth))            //200, 401
-	router.GET(root+"/disconnect", secMiddleWare("", nil, true, apiDisconnect)) //200
+	router.POST(root+"/auth", secMiddleWare("", nil, true, apiAuth))                      //200, 401
+	router.GET(root+"/disconnect", secMiddleWare("", nil, true, apiDisconnect))           //200
+	router.GET(root+"/auth/oidc/login", secMiddleWare("", nil, true, apiOIDCLogin))       //302 vers le fournisseur, 404 si non configuré
+	router.GET(root+"/auth/oidc/callback", secMiddleWare("", nil, true, apiOIDCCallback)) //200 ou 302 vers success_url, 401
 
 	// user en cours
-	router.GET(root+"/my/right", secMiddleWare("", nil, true, apiGetRightList)) //200, 401
+	router.GET(root+"/my/right", secMiddleWare("", nil, true, apiGetRightList))                          //200, 401
+	router.GET(root+"/my/apitokens", secMiddleWare("", authenticated, true, apiMyAPITokenList))          //tokens d'api de l'user (200, 401)
+	router.POST(root+"/my/apitokens", secMiddleWare("", authenticated, true, apiMyAPITokenCreate))       //create 201, token en clair dans la réponse
+	router.DELETE(root+"/my/apitokens/:id", secMiddleWare("", authenticated, true, apiMyAPITokenDelete)) //révocation (200, 404)
+	router.GET(root+"/my/groups", secMiddleWare("", authenticated, true, apiMyGroupList))                //groupes de l'user (200, 401)
 
 	//info dash
-	router.GET(root+"/queue/state", secMiddleWare("QUEUE", nil, true, apiGetQueuesStates)) //200
+	router.GET(root+"/queue/state", secMiddleWare("QUEUE", nil, true, apiGetQueuesStates))      //200
+	router.GET(root+"/events", secMiddleWare("", authenticated, true, apiEvents))               //flux sse (200, 401)
+	router.GET(root+"/metrics", metricsScrape(secMiddleWare("QUEUE", nil, true, apiMetrics)))   //métriques prometheus, session ou token de scrape (200, 401)
+	router.GET(root+"/audit", secMiddleWare("AUDIT", nil, true, apiAuditList))                  //trace des modifications (200, 403)
+	router.GET(root+"/export", secMiddleWare("BUNDLE", nil, true, apiBundleExport))             //export de la configuration (200, 403)
+	router.POST(root+"/import", secMiddleWare("BUNDLE", nil, true, apiBundleImport))            //import/plan de la configuration (200, 400, 403)
+	router.POST(root+"/import/crontab", secMiddleWare("BUNDLE", nil, true, apiImportCrontab))   //import/plan d'une crontab (200, 400, 403)
+	router.POST(root+"/import/schtasks", secMiddleWare("BUNDLE", nil, true, apiImportSchTasks)) //import/plan d'une tache planifiée windows (200, 400, 403)
+	router.GET(root+"/gitops/status", secMiddleWare("BUNDLE", nil, true, apiGitOpsStatus))      //état de la synchro gitops (200, 403)
+	router.POST(root+"/gitops/sync", secMiddleWare("BUNDLE", nil, true, apiGitOpsSync))         //synchro immédiate (200, 404 désactivée, 403)
+	router.GET(root+"/gitops/managed", secMiddleWare("BUNDLE", nil, true, apiGitOpsManaged))    //entités gérées, en lecture seule (200, 403)
 
 	//CRUD users
 	router.GET(root+"/users", secMiddleWare("USER", nil, true, apiUserList))          //liste (rep 200, 403)
@@ -41,72 +61,136 @@ func ListenAndServe(ListenOn string) error {
 	router.PUT(root+"/users/:id", secMiddleWare("USER", nil, true, apiUserPut))       //update (200)
 	router.DELETE(root+"/users/:id", secMiddleWare("USER", nil, true, apiUserDelete)) //delete (200)
 
+	//CRUD tokens d'api de tous les utilisateurs (comptes de service)
+	router.GET(root+"/apitokens", secMiddleWare("APITOKEN", nil, true, apiAPITokenList))          //liste (rep 200, 403)
+	router.GET(root+"/apitokens/:id", secMiddleWare("APITOKEN", nil, true, apiAPITokenGet))       //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/apitokens", secMiddleWare("APITOKEN", nil, true, apiAPITokenCreate))       //create 201, token en clair dans la réponse
+	router.PUT(root+"/apitokens/:id", secMiddleWare("APITOKEN", nil, true, apiAPITokenPut))       //update (200)
+	router.DELETE(root+"/apitokens/:id", secMiddleWare("APITOKEN", nil, true, apiAPITokenDelete)) //révocation (200)
+
+	//CRUD rôles (permissions par tags / queues)
+	router.GET(root+"/roles", secMiddleWare("ROLE", nil, true, apiRoleList))          //liste (rep 200, 403)
+	router.GET(root+"/roles/:id", secMiddleWare("ROLE", nil, true, apiRoleGet))       //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/roles", secMiddleWare("ROLE", nil, true, apiRoleCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/roles/:id", secMiddleWare("ROLE", nil, true, apiRolePut))       //update (200)
+	router.DELETE(root+"/roles/:id", secMiddleWare("ROLE", nil, true, apiRoleDelete)) //delete (200)
+
+	//CRUD groupes (propriétaires de taskflows, taches et queues)
+	router.GET(root+"/groups", secMiddleWare("GROUP", nil, true, apiGroupList))          //liste (rep 200, 403)
+	router.GET(root+"/groups/:id", secMiddleWare("GROUP", nil, true, apiGroupGet))       //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/groups", secMiddleWare("GROUP", nil, true, apiGroupCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/groups/:id", secMiddleWare("GROUP", nil, true, apiGroupPut))       //update (200)
+	router.DELETE(root+"/groups/:id", secMiddleWare("GROUP", nil, true, apiGroupDelete)) //delete, les éléments du groupe deviennent sans propriétaire (200)
+
 	//CRUD agents
-	router.GET(root+"/agents", secMiddleWare("AGENT", nil, true, apiAgentList))           //liste (rep 200, 403)
-	router.GET(root+"/agents/:id", secMiddleWare("AGENT", nil, true, apiAgentGet))        //get item (rep 200, 404 not found, 403)
-	router.POST(root+"/agents", secMiddleWare("AGENT", nil, true, apiAgentCreate))        //create 201 (Created and contain an entity, and a Location header.) ou 200
-	router.PUT(root+"/agents/:id", secMiddleWare("AGENT", nil, true, apiAgentPut))        //update (200)
-	router.DELETE(root+"/agents/:id", secMiddleWare("AGENT", nil, true, apiAgentDelete))  //delete (200)
-	router.POST(root+"/agents/eval", secMiddleWare("AGENT", nil, true, apiAgentEvaluate)) //eval d'un agent
+	router.GET(root+"/agents", secMiddleWare("AGENT", nil, true, apiAgentList))                                    //liste (rep 200, 403)
+	router.GET(root+"/agents/:id", secMiddleWare("AGENT", nil, true, apiAgentGet))                                 //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/agents", secMiddleWare("AGENT", nil, true, apiAgentCreate))                                 //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/agents/:id", secMiddleWare("AGENT", nil, true, managedReadOnly("AGENT", apiAgentPut)))       //update (200)
+	router.DELETE(root+"/agents/:id", secMiddleWare("AGENT", nil, true, managedReadOnly("AGENT", apiAgentDelete))) //delete (200)
+	router.POST(root+"/agents/eval", secMiddleWare("AGENT", nil, true, apiAgentEvaluate))                          //eval d'un agent
 
 	//CRUD queues
-	router.GET(root+"/queues", secMiddleWare("QUEUE", nil, true, apiQueueList))          //liste (rep 200, 403)
-	router.GET(root+"/queues/:id", secMiddleWare("QUEUE", nil, true, apiQueueGet))       //get item (rep 200, 404 not found, 403)
-	router.POST(root+"/queues", secMiddleWare("QUEUE", nil, true, apiQueueCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
-	router.PUT(root+"/queues/:id", secMiddleWare("QUEUE", nil, true, apiQueuePut))       //update (200)
-	router.DELETE(root+"/queues/:id", secMiddleWare("QUEUE", nil, true, apiQueueDelete)) //delete (200)
+	router.GET(root+"/queues", secMiddleWare("QUEUE", nil, true, apiQueueList))                                    //liste (rep 200, 403)
+	router.GET(root+"/queues/:id", secMiddleWare("QUEUE", nil, true, apiQueueGet))                                 //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/queues", secMiddleWare("QUEUE", nil, true, apiQueueCreate))                                 //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/queues/:id", secMiddleWare("QUEUE", queuePutAllowed, true, apiQueuePut))                     //update (200), modification ou mise en pause
+	router.DELETE(root+"/queues/:id", secMiddleWare("QUEUE", nil, true, managedReadOnly("QUEUE", apiQueueDelete))) //delete (200)
 
 	//CRUD tags
-	router.GET(root+"/tags", secMiddleWare("TAGS", nil, true, apiTagList))          //liste (rep 200, 403)
-	router.GET(root+"/tags/:id", secMiddleWare("TAGS", nil, true, apiTagGet))       //get item (rep 200, 404 not found, 403)
-	router.POST(root+"/tags", secMiddleWare("TAGS", nil, true, apiTagCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
-	router.PUT(root+"/tags/:id", secMiddleWare("TAGS", nil, true, apiTagPut))       //update (200)
-	router.DELETE(root+"/tags/:id", secMiddleWare("TAGS", nil, true, apiTagDelete)) //delete (200)
+	router.GET(root+"/tags", secMiddleWare("TAGS", nil, true, apiTagList))                                   //liste (rep 200, 403)
+	router.GET(root+"/tags/:id", secMiddleWare("TAGS", nil, true, apiTagGet))                                //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/tags", secMiddleWare("TAGS", nil, true, apiTagCreate))                                //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/tags/:id", secMiddleWare("TAGS", nil, true, managedReadOnly("TAGS", apiTagPut)))       //update (200)
+	router.DELETE(root+"/tags/:id", secMiddleWare("TAGS", nil, true, managedReadOnly("TAGS", apiTagDelete))) //delete (200)
+
+	//CRUD secrets
+	router.GET(root+"/secrets", secMiddleWare("SECRET", nil, true, apiSecretList))          //liste (rep 200, 403)
+	router.GET(root+"/secrets/:id", secMiddleWare("SECRET", nil, true, apiSecretGet))       //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/secrets", secMiddleWare("SECRET", nil, true, apiSecretCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/secrets/:id", secMiddleWare("SECRET", nil, true, apiSecretPut))       //update (200)
+	router.DELETE(root+"/secrets/:id", secMiddleWare("SECRET", nil, true, apiSecretDelete)) //delete (200)
+
+	//CRUD notifications
+	router.GET(root+"/notifications", secMiddleWare("NOTIF", nil, true, apiNotificationList))          //liste (rep 200, 403)
+	router.GET(root+"/notifications/:id", secMiddleWare("NOTIF", nil, true, apiNotificationGet))       //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/notifications", secMiddleWare("NOTIF", nil, true, apiNotificationCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/notifications/:id", secMiddleWare("NOTIF", nil, true, apiNotificationPut))       //update (200)
+	router.DELETE(root+"/notifications/:id", secMiddleWare("NOTIF", nil, true, apiNotificationDelete)) //delete (200)
+	router.POST(root+"/notifications/test", secMiddleWare("NOTIF", nil, true, apiNotificationTest))    //envoi d'un évènement de test
 
 	//CRUD tasks
-	router.GET(root+"/tasks", secMiddleWare("TASK", nil, true, apiTaskList))          //liste (rep 200, 403)
-	router.GET(root+"/tasks/:id", secMiddleWare("TASK", nil, true, apiTaskGet))       //get item (rep 200, 404 not found, 403)
-	router.POST(root+"/tasks", secMiddleWare("TASK", nil, true, apiTaskCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
-	router.PUT(root+"/tasks/:id", secMiddleWare("TASK", nil, true, apiTaskPut))       //update (200)
-	router.DELETE(root+"/tasks/:id", secMiddleWare("TASK", nil, true, apiTaskDelete)) //delete (200)
+	router.GET(root+"/tasks", secMiddleWare("TASK", nil, true, apiTaskList))                                   //liste (rep 200, 403)
+	router.GET(root+"/tasks/:id", secMiddleWare("TASK", nil, true, apiTaskGet))                                //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/tasks", secMiddleWare("TASK", nil, true, apiTaskCreate))                                //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/tasks/:id", secMiddleWare("TASK", nil, true, managedReadOnly("TASK", apiTaskPut)))       //update (200)
+	router.DELETE(root+"/tasks/:id", secMiddleWare("TASK", nil, true, managedReadOnly("TASK", apiTaskDelete))) //delete (200)
 
 	//SET/GET/LIST configs
 	router.GET(root+"/cfgs", secMiddleWare("CONFIG", nil, true, apiCfgList))    //liste (rep 200, 403)
 	router.GET(root+"/cfgs/:id", secMiddleWare("CONFIG", nil, true, apiCfgGet)) //get item (rep 200, 404 not found, 403)
 	router.POST(root+"/cfgs", secMiddleWare("CONFIG", nil, true, apiCfgPost))   //200
 
+	//SET/LIST variables globales
+	router.GET(root+"/vars", secMiddleWare("VAR", nil, true, apiVarList))          //liste (rep 200, 403)
+	router.GET(root+"/vars/usages", secMiddleWare("VAR", nil, true, apiVarUsages)) //utilisation par les taches/taskflows (rep 200, 403)
+	router.POST(root+"/vars", secMiddleWare("VAR", nil, true, apiVarPost))         //200
+
 	//CRUD scheds
-	router.GET(root+"/scheds", secMiddleWare("SCHED", nil, true, apiSchedList))          //liste (rep 200, 403)
-	router.GET(root+"/scheds/:id", secMiddleWare("SCHED", nil, true, apiSchedGet))       //get item (rep 200, 404 not found, 403)
-	router.POST(root+"/scheds", secMiddleWare("SCHED", nil, true, apiSchedCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
-	router.PUT(root+"/scheds/:id", secMiddleWare("SCHED", nil, true, apiSchedPut))       //update (200)
-	router.DELETE(root+"/scheds/:id", secMiddleWare("SCHED", nil, true, apiSchedDelete)) //delete (200)
+	router.GET(root+"/scheds", secMiddleWare("SCHED", nil, true, apiSchedList))                                    //liste (rep 200, 403)
+	router.GET(root+"/scheds/:id", secMiddleWare("SCHED", nil, true, apiSchedGet))                                 //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/scheds", secMiddleWare("SCHED", nil, true, apiSchedCreate))                                 //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/scheds/:id", secMiddleWare("SCHED", nil, true, managedReadOnly("SCHED", apiSchedPut)))       //update (200)
+	router.DELETE(root+"/scheds/:id", secMiddleWare("SCHED", nil, true, managedReadOnly("SCHED", apiSchedDelete))) //delete (200)
 
 	//CRUD taskflows
-	router.GET(root+"/taskflows", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowList))          //liste (rep 200, 403)
-	router.GET(root+"/taskflows/:id", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowGet))       //get item (rep 200, 404 not found, 403)
-	router.POST(root+"/taskflows", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowCreate))       //create 201 (Created and contain an entity, and a Location header.) ou 200
-	router.PUT(root+"/taskflows/:id", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowPut))       //update (200)
-	router.DELETE(root+"/taskflows/:id", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowDelete)) //delete (200)
-
-	// lancement de taskflow manuel
-	router.POST(root+"/taskflows/launch", secMiddleWare("TASKFLOW", func(s *sessions.Session) bool {
-		if s != nil && s.RightLevel >= dal.RightLvlTaskRunner {
-			return true
-		}
-		return false
-	}, true, apiManualLaunchTF)) //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.GET(root+"/taskflows", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowList))                                       //liste (rep 200, 403)
+	router.GET(root+"/taskflows/:id", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowGet))                                    //get item (rep 200, 404 not found, 403)
+	router.POST(root+"/taskflows", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowCreate))                                    //create 201 (Created and contain an entity, and a Location header.) ou 200
+	router.PUT(root+"/taskflows/:id", secMiddleWare("TASKFLOW", nil, true, managedReadOnly("TASKFLOW", apiTaskFlowPut)))       //update (200)
+	router.DELETE(root+"/taskflows/:id", secMiddleWare("TASKFLOW", nil, true, managedReadOnly("TASKFLOW", apiTaskFlowDelete))) //delete (200)
+
+	// actions post /taskflows/xxx
+	router.actions(http.MethodPost, root+"/taskflows", map[string]httprouter.Handle{
+		// lancement de taskflow manuel
+		"launch": secMiddleWare("TASKFLOW", func(s *sessions.Session) bool {
+			return sessionPermissions(s).Allowed("taskflow", dal.ActLaunch)
+		}, true, apiManualLaunchTF), //create 201 (Created and contain an entity, and a Location header.) ou 200
+		// validation/rendu d'un modéle d'argument
+		"renderargs": secMiddleWare("TASKFLOW", nil, true, apiRenderArgs), //200
+	})
+
+	// versions des taskflows et historique d'exec
+	router.GET(root+"/taskflows/:id/versions", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowVersionList))                                             //liste (rep 200, 403)
+	router.GET(root+"/taskflows/:id/versions/:v", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowVersionGet))                                           //get version, 0 : derniére (rep 200, 404 not found, 403)
+	router.GET(root+"/taskflows/:id/versions/:v/diff", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowVersionDiff))                                     //diff vers ?to=n (défaut derniére version)
+	router.POST(root+"/taskflows/:id/versions/:v/restore", secMiddleWare("TASKFLOW", nil, true, managedReadOnly("TASKFLOW", apiTaskFlowVersionRestore))) //restauration (200)
+	router.GET(root+"/runs", secMiddleWare("TASKFLOW", nil, true, apiTaskFlowRunList))                                                                   //historique d'exec (rep 200, 403)
+
+	// historique des dépassements de sla
+	router.GET(root+"/slabreaches", secMiddleWare("TASKFLOW", nil, true, apiSLABreachList)) //liste (rep 200, 403)
 
 	//requete browser preflight cors
 	router.OPTIONS(root+"/*path", secMiddleWare("", nil, true, nil))
 
+	//documentation openapi des routes déclarées ci-dessus
+	router.record(http.MethodGet, root+"/openapi.json")
+	spec, _ := openAPISpec(root, router.routes)
+	b, _ := json.Marshal(spec)
+	router.Router.GET(root+"/openapi.json", apiOpenAPI(b))
+
 	//gestion des erreurs qui provoquerait un crash (panic)
 	router.PanicHandler = panicHandler
 
+	return router
+}
+
+//ListenAndServe met en place les routes et lance le serveur
+func ListenAndServe(ListenOn string) error {
 	//mise en place de la gestion du ctrl-c
 	server := &http.Server{ //server custom simplement pour avoir accés au shutdown
 		Addr:    ListenOn,
-		Handler: router,
+		Handler: NewRouter(),
 	}
 	//go routine en attente du ctrl-c
 	interrupt := make(chan os.Signal, 1)
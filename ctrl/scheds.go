@@ -66,7 +66,7 @@ func apiSchedCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		return
 	}
 
-	err = dal.SchedInsert(&elm, getUsrIdFromCtx(r))
+	err = dal.SchedInsert(&elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
@@ -80,6 +80,7 @@ func apiSchedCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "SCHED", elm.ID, dal.AuditActCreate, nil, &elm)
 
 	//retour ok : 201 created
 	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
@@ -102,6 +103,7 @@ func apiSchedPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
+	before, _ := dal.SchedGet(elm.ID)
 	err = dal.SchedUpdate(elm, 0, true, nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
@@ -116,6 +118,7 @@ func apiSchedPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "SCHED", elm.ID, dal.AuditActUpdate, &before, &elm)
 
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
@@ -135,11 +138,12 @@ func apiSchedDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		return
 	}
 	if elm.ID > 0 {
-		err = dal.SchedDelete(elm.ID, getUsrIdFromCtx(r))
+		err = dal.SchedDelete(elm.ID, getUsrIdFromCtx(r), nil)
 		if err != nil {
 			writeStdJSONErrInternalServer(w, err.Error())
 			return
 		}
+		auditLog(r, "SCHED", elm.ID, dal.AuditActDelete, &elm, nil)
 	}
 
 	//noti sched
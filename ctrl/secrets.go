@@ -0,0 +1,147 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiSecretGet handler get /secrets/:id
+func apiSecretGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//inputs :
+	id, _ := strconv.Atoi(p.ByName("id"))
+	if id <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	//get dal
+	resp, err := dal.SecretGet(id)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if resp.ID == 0 {
+		writeStdJSONErrNotFound(w, "id not found")
+		return
+	}
+
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiSecretList handler get /secrets
+func apiSecretList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbSecret{}, false)
+
+	//get liste
+	_, resp, err := dal.SecretList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiSecretCreate handler post /secrets
+//la valeur est en écriture seule, elle n'est jamais restituée
+//si ok : create 201 (Created and contain an entity, and a Location header.) ou 200
+func apiSecretCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbSecret
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = elm.Validate(true)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = dal.SecretInsert(&elm, getUsrIdFromCtx(r))
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "SECRET", elm.ID, dal.AuditActCreate, nil, &elm, "value")
+
+	elm, err = dal.SecretGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok : 201 created
+	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
+}
+
+//apiSecretPut handler put /secrets/:id
+func apiSecretPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	//deserial input
+	var elm dal.DbSecret
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	elm.ID, _ = strconv.Atoi(p.ByName("id"))
+
+	err = elm.Validate(false)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	before, err := dal.SecretGet(elm.ID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	err = dal.SecretUpdate(elm, getUsrIdFromCtx(r), nil)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "SECRET", elm.ID, dal.AuditActUpdate, &before, &elm, "value") //valeur saisie, masquée
+
+	elm, err = dal.SecretGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	//retour ok : 200
+	writeStdJSONOK(w, &elm)
+}
+
+//apiSecretDelete handler delete /secrets/:id
+func apiSecretDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	elmID, _ := strconv.Atoi(p.ByName("id"))
+	if elmID <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+
+	elm, err := dal.SecretGet(elmID)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	if elm.ID > 0 {
+		err = dal.SecretDelete(elm.ID, getUsrIdFromCtx(r))
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return
+		}
+		auditLog(r, "SECRET", elm.ID, dal.AuditActDelete, &elm, nil)
+	}
+	//retour ok : 200
+	writeStdJSONOK(w, nil)
+}
@@ -65,7 +65,7 @@ func apiTagCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	err = dal.TagInsert(&elm, getUsrIdFromCtx(r))
+	err = dal.TagInsert(&elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
@@ -76,6 +76,7 @@ func apiTagCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "TAGS", elm.ID, dal.AuditActCreate, nil, &elm)
 	//retour ok : 201 created
 	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
 }
@@ -97,6 +98,7 @@ func apiTagPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
+	before, _ := dal.TagGet(elm.ID)
 	err = dal.TagUpdate(elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
@@ -108,6 +110,7 @@ func apiTagPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "TAGS", elm.ID, dal.AuditActUpdate, &before, &elm)
 
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
@@ -127,11 +130,12 @@ func apiTagDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 	if elm.ID > 0 {
-		err = dal.TagDelete(elm.ID, getUsrIdFromCtx(r))
+		err = dal.TagDelete(elm.ID, getUsrIdFromCtx(r), nil)
 		if err != nil {
 			writeStdJSONErrInternalServer(w, err.Error())
 			return
 		}
+		auditLog(r, "TAGS", elm.ID, dal.AuditActDelete, &elm, nil)
 	}
 	//retour ok : 200
 	writeStdJSONOK(w, nil)
@@ -25,7 +25,7 @@ func apiTaskFlowGet(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
-	if resp.ID == 0 {
+	if resp.ID == 0 || !taskFlowScope(r, dal.ActView).TaskFlow(resp.Tags, resp.QueueID) {
 		writeStdJSONErrNotFound(w, "id not found")
 		return
 	}
@@ -38,6 +38,11 @@ func apiTaskFlowGet(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 func apiTaskFlowList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// filtre extrait du get
 	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbTaskFlow{}, false)
+	taskFlowScope(r, dal.ActView).Filter(&searchQ, "TASKFLOW.tags", "TASKFLOW.queueid")
+	if err := ownerFilter(r, &searchQ, "TASKFLOW.owner_grp", "TASKFLOW.tags"); err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
 
 	//get liste
 	_, resp, err := dal.TaskFlowList(searchQ)
@@ -65,8 +70,15 @@ func apiTaskFlowCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
+	if !checkOwnerGroup(w, elm.OwnerGroup) {
+		return
+	}
+	if !taskFlowScope(r, dal.ActEdit).TaskFlow(elm.Tags, elm.QueueID) {
+		writeStdJSONErrBadRequest(w, "tags or queue out of scope")
+		return
+	}
 
-	err = dal.TaskFlowInsert(&elm, getUsrIdFromCtx(r))
+	err = dal.TaskFlowInsert(&elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
@@ -80,6 +92,7 @@ func apiTaskFlowCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "TASKFLOW", elm.ID, dal.AuditActCreate, nil, &elm)
 
 	//retour ok : 201 created
 	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
@@ -101,8 +114,19 @@ func apiTaskFlowPut(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
+	if !checkOwnerGroup(w, elm.OwnerGroup) {
+		return
+	}
+	if !checkTaskFlowScope(w, r, elm.ID, dal.ActEdit) {
+		return
+	}
+	if !taskFlowScope(r, dal.ActEdit).TaskFlow(elm.Tags, elm.QueueID) {
+		writeStdJSONErrBadRequest(w, "tags or queue out of scope")
+		return
+	}
 
-	err = dal.TaskFlowUpdate(elm, 0, true, nil)
+	before, _ := dal.TaskFlowGet(elm.ID)
+	err = dal.TaskFlowUpdate(elm, getUsrIdFromCtx(r), true, nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
@@ -116,6 +140,7 @@ func apiTaskFlowPut(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "TASKFLOW", elm.ID, dal.AuditActUpdate, &before, &elm)
 
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
@@ -128,6 +153,9 @@ func apiTaskFlowDelete(w http.ResponseWriter, r *http.Request, p httprouter.Para
 		writeStdJSONErrBadRequest(w, "invalid id")
 		return
 	}
+	if !checkTaskFlowScope(w, r, elmID, dal.ActEdit) {
+		return
+	}
 
 	elm, err := dal.TaskFlowGet(elmID)
 	if err != nil {
@@ -135,14 +163,31 @@ func apiTaskFlowDelete(w http.ResponseWriter, r *http.Request, p httprouter.Para
 		return
 	}
 	if elm.ID > 0 {
-		err = dal.TaskFlowDelete(elm.ID, getUsrIdFromCtx(r))
+		err = dal.TaskFlowDelete(elm.ID, getUsrIdFromCtx(r), nil)
 		if err != nil {
 			writeStdJSONErrInternalServer(w, err.Error())
 			return
 		}
+		auditLog(r, "TASKFLOW", elm.ID, dal.AuditActDelete, &elm, nil)
 		//notif sched
 		schd.UpdateSchedFromDb("DbTaskFlow", elm.ID)
 	}
 	//retour ok : 200
 	writeStdJSONOK(w, nil)
 }
+
+//apiSLABreachList handler get /slabreaches
+func apiSLABreachList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbSLABreach{}, false)
+	taskFlowScope(r, dal.ActView).Filter(&searchQ, "TASKFLOW.tags", "TASKFLOW.queueid")
+
+	//get liste
+	_, resp, err := dal.SLABreachList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
@@ -38,6 +38,10 @@ func apiTaskGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 func apiTaskList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// filtre extrait du get
 	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbTask{}, false)
+	if err := ownerFilter(r, &searchQ, "TASK.owner_grp", ""); err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
 
 	//get liste
 	_, resp, err := dal.TaskList(searchQ)
@@ -65,8 +69,11 @@ func apiTaskCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
+	if !checkOwnerGroup(w, elm.OwnerGroup) {
+		return
+	}
 
-	err = dal.TaskInsert(&elm, getUsrIdFromCtx(r))
+	err = dal.TaskInsert(&elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
@@ -80,6 +87,7 @@ func apiTaskCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "TASK", elm.ID, dal.AuditActCreate, nil, &elm)
 
 	//retour ok : 201 created
 	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
@@ -101,7 +109,11 @@ func apiTaskPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrBadRequest(w, err.Error())
 		return
 	}
+	if !checkOwnerGroup(w, elm.OwnerGroup) || !checkTaskTagScope(w, r, elm.ID) {
+		return
+	}
 
+	before, _ := dal.TaskGet(elm.ID)
 	err = dal.TaskUpdate(elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
@@ -111,11 +123,25 @@ func apiTaskPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	//notif sched
 	schd.UpdateSchedFromDb("DbTask", elm.ID)
 
+	//nouvelle version des taskflows utilisant la tache
+	tfIDs, err := dal.TaskFlowIDsUsingTask(elm.ID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	for _, tfID := range tfIDs {
+		if !saveTaskFlowVersion(w, r, tfID) {
+			return
+		}
+		schd.UpdateSchedFromDb("DbTaskFlow", tfID)
+	}
+
 	elm, err = dal.TaskGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "TASK", elm.ID, dal.AuditActUpdate, &before, &elm)
 
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
@@ -135,11 +161,15 @@ func apiTaskDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		return
 	}
 	if elm.ID > 0 {
-		err = dal.TaskDelete(elm.ID, getUsrIdFromCtx(r))
+		if !checkTaskTagScope(w, r, elm.ID) {
+			return
+		}
+		err = dal.TaskDelete(elm.ID, getUsrIdFromCtx(r), nil)
 		if err != nil {
 			writeStdJSONErrInternalServer(w, err.Error())
 			return
 		}
+		auditLog(r, "TASK", elm.ID, dal.AuditActDelete, &elm, nil)
 		//notif sched
 		schd.UpdateSchedFromDb("DbTask", elm.ID)
 	}
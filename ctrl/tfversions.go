@@ -0,0 +1,199 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/schd"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//saveTaskFlowVersion enregistre une nouvelle version du taskflow si sa définition a changé
+//false si erreur (réponse déjà écrite)
+func saveTaskFlowVersion(w http.ResponseWriter, r *http.Request, tfID int) bool {
+	if _, err := dal.TaskFlowVersionSave(tfID, getUsrIdFromCtx(r), nil); err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return false
+	}
+	return true
+}
+
+//apiTaskFlowVersionList handler get /taskflows/:id/versions
+func apiTaskFlowVersionList(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	id, _ := strconv.Atoi(p.ByName("id"))
+	if id <= 0 {
+		writeStdJSONErrBadRequest(w, "invalid id")
+		return
+	}
+	if !checkTaskFlowScope(w, r, id, dal.ActView) {
+		return
+	}
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbTaskFlowVersion{}, false)
+
+	//get liste (sans les définitions)
+	_, resp, err := dal.TaskFlowVersionList(id, searchQ, false)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiTaskFlowVersionGet handler get /taskflows/:id/versions/:v
+func apiTaskFlowVersionGet(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	elm, ok := getTaskFlowVersion(w, r, p.ByName("id"), p.ByName("v"), dal.ActView)
+	if !ok {
+		return
+	}
+	writeStdJSONResp(w, http.StatusOK, elm)
+}
+
+//apiTaskFlowVersionDiff handler get /taskflows/:id/versions/:v/diff?to=n
+//diff de la version v vers la version n (à défaut la derniére version)
+func apiTaskFlowVersionDiff(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	from, ok := getTaskFlowVersion(w, r, p.ByName("id"), p.ByName("v"), dal.ActView)
+	if !ok {
+		return
+	}
+	toV := r.URL.Query().Get("to")
+	if toV == "" {
+		toV = "0"
+	}
+	to, ok := getTaskFlowVersion(w, r, p.ByName("id"), toV, dal.ActView)
+	if !ok {
+		return
+	}
+
+	resp := dal.TaskFlowVersionDiff(from.Definition, to.Definition)
+	resp["from"] = from.Version
+	resp["to"] = to.Version
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiTaskFlowVersionRestore handler post /taskflows/:id/versions/:v/restore
+//la définition restaurée devient une nouvelle version, ?tasks=1 pour restaurer aussi les taches
+func apiTaskFlowVersionRestore(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ver, ok := getTaskFlowVersion(w, r, p.ByName("id"), p.ByName("v"), dal.ActEdit)
+	if !ok {
+		return
+	}
+	if !taskFlowScope(r, dal.ActEdit).TaskFlow(ver.Definition.TaskFlow.Tags, ver.Definition.TaskFlow.QueueID) {
+		writeStdJSONErrBadRequest(w, "tags or queue out of scope")
+		return
+	}
+	before, err := dal.TaskFlowGet(ver.TaskFlowID)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	if before.ID == 0 {
+		writeStdJSONErrNotFound(w, "taskflow not found")
+		return
+	}
+
+	//taches référencées, controlées avant toute restauration
+	restoreTasks := r.URL.Query().Get("tasks") == "1"
+	curTasks := make([]dal.DbTask, len(ver.Definition.Tasks))
+	for i, t := range ver.Definition.Tasks {
+		cur, err := dal.TaskGet(t.ID)
+		if err != nil {
+			writeStdJSONErrInternalServer(w, err.Error())
+			return
+		}
+		if cur.ID == 0 {
+			writeStdJSONErrBadRequest(w, "task "+strconv.Itoa(t.ID)+" no longer exists")
+			return
+		}
+		curTasks[i] = cur
+		if !restoreTasks {
+			continue
+		}
+		if managedForbidden(w, "TASK", t.ID) || !checkTaskTagScope(w, r, t.ID) {
+			return
+		}
+		if err = t.Validate(false); err != nil {
+			writeStdJSONErrBadRequest(w, "task "+strconv.Itoa(t.ID)+" : "+err.Error())
+			return
+		}
+	}
+	if restoreTasks {
+		for i, t := range ver.Definition.Tasks {
+			cur := curTasks[i]
+			if err = dal.TaskUpdate(t, getUsrIdFromCtx(r), nil); err != nil {
+				writeStdJSONErrInternalServer(w, err.Error())
+				return
+			}
+			t, _ = dal.TaskGet(t.ID)
+			auditLog(r, "TASK", t.ID, dal.AuditActUpdate, &cur, &t)
+			schd.UpdateSchedFromDb("DbTask", t.ID)
+		}
+	}
+
+	elm := ver.Definition.TaskFlow
+	elm.ID = ver.TaskFlowID
+	err = elm.Validate(false)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+	err = dal.TaskFlowUpdate(elm, getUsrIdFromCtx(r), true, nil)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	//notif sched
+	schd.UpdateSchedFromDb("DbTaskFlow", elm.ID)
+
+	elm, err = dal.TaskFlowGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditLog(r, "TASKFLOW", elm.ID, dal.AuditActUpdate, &before, &elm)
+
+	//retour ok : 200
+	writeStdJSONOK(w, &elm)
+}
+
+//getTaskFlowVersion lecture d'une version ("0" : derniére) sous controle du périmétre de l'action, réponse d'erreur écrite si ko
+func getTaskFlowVersion(w http.ResponseWriter, r *http.Request, tfID string, version string, action string) (dal.DbTaskFlowVersion, bool) {
+	id, _ := strconv.Atoi(tfID)
+	v, err := strconv.Atoi(version)
+	if id <= 0 || err != nil || v < 0 {
+		writeStdJSONErrBadRequest(w, "invalid id or version")
+		return dal.DbTaskFlowVersion{}, false
+	}
+	if !checkTaskFlowScope(w, r, id, action) {
+		return dal.DbTaskFlowVersion{}, false
+	}
+	elm, err := dal.TaskFlowVersionGet(id, v)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return elm, false
+	}
+	if elm.Definition == nil {
+		writeStdJSONErrNotFound(w, "version not found")
+		return elm, false
+	}
+	return elm, true
+}
+
+//apiTaskFlowRunList handler get /runs
+func apiTaskFlowRunList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// filtre extrait du get
+	searchQ := dal.NewSearchQueryFromRequest(r, &dal.DbTaskFlowRun{}, false)
+	taskFlowScope(r, dal.ActView).Filter(&searchQ, "TASKFLOW.tags", "TASKFLOW.queueid")
+
+	//get liste
+	_, resp, err := dal.TaskFlowRunList(searchQ)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
@@ -78,6 +78,7 @@ func apiUserCreate(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	auditLog(r, "USER", elm.ID, dal.AuditActCreate, nil, &elm)
 
 	//retour ok : 201 created
 	writeStdJSONCreated(w, r.URL.Path, strconv.Itoa(elm.ID), &elm)
@@ -100,6 +101,8 @@ func apiUserPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
+	before, _ := dal.UserGet(elm.ID)
+	pwdChanged := (elm.Password != "")
 	err = dal.UserUpdate(elm, getUsrIdFromCtx(r), nil)
 	if err != nil {
 		writeStdJSONErrInternalServer(w, err.Error())
@@ -108,7 +111,7 @@ func apiUserPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
 	//ras sessions concernés par cet usr id, sauf cas de l'user qui modifie lui même
 	if elm.ID != getUsrIdFromCtx(r) {
-		removeSessionByUsrId(elm.ID)
+		sessions.RemoveUser(elm.ID)
 	}
 
 	elm, err = dal.UserGet(elm.ID) //reprise valeur sur bdd pour champ calc ou autre val par defaut
@@ -116,6 +119,11 @@ func apiUserPut(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		writeStdJSONErrInternalServer(w, err.Error())
 		return
 	}
+	after := elm
+	if pwdChanged {
+		after.Password = dal.SecretMask //changement tracé, sans la valeur
+	}
+	auditLog(r, "USER", elm.ID, dal.AuditActUpdate, &before, &after)
 
 	//retour ok : 200
 	writeStdJSONOK(w, &elm)
@@ -140,23 +148,12 @@ func apiUserDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 			writeStdJSONErrInternalServer(w, err.Error())
 			return
 		}
+		auditLog(r, "USER", elm.ID, dal.AuditActDelete, &elm, nil)
 		//ras sessions concernés par cet usr id, sauf cas de l'user qui modifie lui même
 		if elm.ID != getUsrIdFromCtx(r) {
-			removeSessionByUsrId(elm.ID)
+			sessions.RemoveUser(elm.ID)
 		}
 	}
 	//retour ok : 200
 	writeStdJSONOK(w, nil)
 }
-
-//removeSessionByUsrId supprimer la/les session d'un utilisateur donnée
-// (utilisé en cas de modif pour ne pas laisser des clients connecté sur d'anciens drois )
-func removeSessionByUsrId(usrID int) {
-	sessionLst := sessions.List()
-	for token, s := range sessionLst {
-		if s.Data["USRID"].(int) == usrID {
-			sessions.Remove(token)
-			break
-		}
-	}
-}
@@ -0,0 +1,74 @@
+package ctrl
+
+import (
+	"CmdScheduler/dal"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//apiVarList handler get /vars
+func apiVarList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//get liste
+	resp, err := dal.VarList()
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
+
+//apiVarPost handler post /vars (valeur vide : suppression)
+func apiVarPost(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	//deserial input
+	var elm dal.DbVar
+	err := json.NewDecoder(r.Body).Decode(&elm)
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	err = elm.Validate()
+	if err != nil {
+		writeStdJSONErrBadRequest(w, err.Error())
+		return
+	}
+
+	before, _ := dal.CfgKVGet(elm.CfgKey())
+	err = dal.VarSet(elm)
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+	auditCfg(r, elm.CfgKey(), before, elm.Value)
+	//retour ok : 200
+	writeStdJSONOK(w, &elm)
+}
+
+//apiVarUsages handler get /vars/usages
+//liste des taches et taskflows utilisant chaque variable (?name=xxx pour une seule variable)
+func apiVarUsages(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp, err := dal.VarUsages()
+	if err != nil {
+		writeStdJSONErrInternalServer(w, err.Error())
+		return
+	}
+
+	name := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("name")))
+	if name != "" {
+		for _, u := range resp {
+			if u.Name == name {
+				writeStdJSONResp(w, http.StatusOK, []dal.VarUsage{u})
+				return
+			}
+		}
+		writeStdJSONErrNotFound(w, "variable not found")
+		return
+	}
+
+	//retour ok
+	writeStdJSONResp(w, http.StatusOK, resp)
+}
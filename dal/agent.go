@@ -30,7 +30,7 @@ func AgentList(filter SearchQuery) ([]DbAgent, PagedResponse, error) {
 	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
 
 	// listing
-	q := ` SELECT AGENT.id, AGENT.host, AGENT.apikey, AGENT.certsignallowed
+	q := ` SELECT AGENT.id, AGENT.host, AGENT.apikey, AGENT.certsignallowed, AGENT.ca_bundle
 		, USERC.login as loginC, AGENT.created_at
 		, USERU.login as loginU, AGENT.updated_at
 		, USERD.login as loginD, AGENT.deleted_at
@@ -51,6 +51,7 @@ func AgentList(filter SearchQuery) ([]DbAgent, PagedResponse, error) {
 		host      sql.NullString
 		apikey    sql.NullString
 		certsign  sql.NullString
+		caBundle  sql.NullString
 		loginC    sql.NullString
 		loginU    sql.NullString
 		loginD    sql.NullString
@@ -59,15 +60,20 @@ func AgentList(filter SearchQuery) ([]DbAgent, PagedResponse, error) {
 		deletedAt sql.NullTime
 	)
 	for rows.Next() {
-		err = rows.Scan(&id, &host, &apikey, &certsign, &loginC, &createdAt, &loginU, &updatedAt, &loginD, &deletedAt)
+		err = rows.Scan(&id, &host, &apikey, &certsign, &caBundle, &loginC, &createdAt, &loginU, &updatedAt, &loginD, &deletedAt)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("AgentList scan %w", err)
 		}
+		key, err := decryptSecret(apikey.String)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("AgentList apikey %v %w", id, err)
+		}
 		arr = append(arr, DbAgent{
 			ID:              id,
 			Host:            host.String,
-			APIKey:          apikey.String,
+			APIKey:          key,
 			CertSignAllowed: certsign.String,
+			CABundle:        caBundle.String,
 			Tls:             strings.HasPrefix(host.String, "https://"),
 			Deleted:         deletedAt.Valid,
 			Info:            stdInfo(&loginC, &loginU, &loginD, &createdAt, &updatedAt, &deletedAt),
@@ -112,12 +118,17 @@ func AgentUpdate(elm DbAgent, usrUpdater int, tx *sql.Tx) error {
 		strDelQ = ", deleted_by = " + strconv.Itoa(usrUpdater) + ", deleted_at = '" + time.Now().Format("2006-01-02T15:04:05.999") + "'"
 	}
 
+	apikey, err := encryptSecret(elm.APIKey)
+	if err != nil {
+		return fmt.Errorf("AgentUpdate apikey %w", err)
+	}
+
 	q := `UPDATE ` + tblPrefix + `AGENT SET
 		updated_by = ?, updated_at = ?  ` + strDelQ + `
-		, host = ?, apikey = ?, certsignallowed = ?
+		, host = ?, apikey = ?, certsignallowed = ?, ca_bundle = ?
 		where id = ? `
 
-	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Host, elm.APIKey, elm.CertSignAllowed, elm.ID)
+	_, err = TxExec(tx, q, usrUpdater, time.Now(), elm.Host, apikey, elm.CertSignAllowed, elm.CABundle, elm.ID)
 	if err != nil {
 		return fmt.Errorf("AgentUpdate err %w", err)
 	}
@@ -126,9 +137,9 @@ func AgentUpdate(elm DbAgent, usrUpdater int, tx *sql.Tx) error {
 }
 
 // AgentDelete flag agent suppression
-func AgentDelete(elmID int, usrUpdater int) error {
+func AgentDelete(elmID int, usrUpdater int, tx *sql.Tx) error {
 	q := `UPDATE ` + tblPrefix + `AGENT SET deleted_by = ?, deleted_at = ? where id = ? `
-	_, err := TxExec(nil, q, usrUpdater, time.Now(), elmID)
+	_, err := TxExec(tx, q, usrUpdater, time.Now(), elmID)
 	if err != nil {
 		return fmt.Errorf("AgentDelete err %w", err)
 	}
@@ -136,12 +147,17 @@ func AgentDelete(elmID int, usrUpdater int) error {
 }
 
 // AgentInsert insertion agent
-func AgentInsert(elm *DbAgent, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("AgentInsert err %w", err)
+func AgentInsert(elm *DbAgent, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("AgentInsert err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	//insert base
 	q := `INSERT INTO ` + tblPrefix + `AGENT (created_by, created_at) VALUES(?,?) `
@@ -157,9 +173,11 @@ func AgentInsert(elm *DbAgent, usrUpdater int) error {
 		return fmt.Errorf("AgentInsert err %w", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("AgentInsert err %w", err)
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("AgentInsert err %w", err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,203 @@
+package dal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// APITokenPrefix préfixe des tokens d'api, distingue un token d'api d'un id de session
+	APITokenPrefix = "cst_"
+	// apiTokenUsedDelay intervalle min entre deux maj de la date de derniére utilisation
+	apiTokenUsedDelay = time.Minute
+)
+
+// IsAPIToken vrai si le bearer fourni est un token d'api (et non une session)
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// apiTokenHash hash stocké en base, le token est aléatoire : pas de salt nécessaire
+func apiTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// APITokenList liste des tokens d'api
+func APITokenList(filter SearchQuery) ([]DbAPIToken, PagedResponse, error) {
+	var err error
+	arr := make([]DbAPIToken, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `APITOKEN APITOKEN
+		left join ` + tblPrefix + `USR USR on USR.id = APITOKEN.usr_id
+		` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("APITokenList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT APITOKEN.id, APITOKEN.name, APITOKEN.usr_id, USR.login, APITOKEN.prefix
+		, APITOKEN.rightlevel, APITOKEN.tags, APITOKEN.expires_at, APITOKEN.last_used_at, APITOKEN.created_at
+		FROM ` + tblPrefix + `APITOKEN APITOKEN
+		left join ` + tblPrefix + `USR USR on USR.id = APITOKEN.usr_id
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("APITokenList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id         int
+		name       sql.NullString
+		usrID      sql.NullInt64
+		login      sql.NullString
+		prefix     sql.NullString
+		rightlevel sql.NullInt64
+		tags       sql.NullString
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+		createdAt  sql.NullTime
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &name, &usrID, &login, &prefix, &rightlevel, &tags, &expiresAt, &lastUsedAt, &createdAt)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("APITokenList scan %w", err)
+		}
+		arr = append(arr, DbAPIToken{
+			ID:         id,
+			Name:       name.String,
+			UserID:     int(usrID.Int64),
+			Login:      login.String,
+			Prefix:     prefix.String,
+			RightLevel: int(rightlevel.Int64),
+			Tags:       splitIntFromStr(tags.String),
+			ExpiresAt:  expiresAt.Time,
+			LastUsedAt: lastUsedAt.Time,
+			CreatedAt:  createdAt.Time,
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("APITokenList err %w", err)
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// APITokenGet get d'un token d'api
+func APITokenGet(id int) (DbAPIToken, error) {
+	var ret DbAPIToken
+	arr, _, err := APITokenList(NewSearchQueryFromID("APITOKEN", id))
+	if err != nil {
+		return ret, err
+	}
+	if len(arr) > 0 {
+		ret = arr[0]
+	}
+	return ret, nil
+}
+
+// APITokenInsert création d'un token, la valeur en clair n'est disponible que dans elm.Token au retour
+func APITokenInsert(elm *DbAPIToken, usrUpdater int) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("APITokenInsert err %w", err)
+	}
+	token := APITokenPrefix + hex.EncodeToString(b)
+	elm.Prefix = token[:len(APITokenPrefix)+8]
+
+	q := `INSERT INTO ` + tblPrefix + `APITOKEN (name, usr_id, token_hash, prefix, rightlevel, tags
+		, expires_at, created_at, created_by) VALUES(?,?,?,?,?,?,?,?,?) `
+	id, err := TxInsert(nil, q, elm.Name, elm.UserID, apiTokenHash(token), elm.Prefix, elm.RightLevel,
+		mergeIntToStr(elm.Tags), nullTime(elm.ExpiresAt), time.Now(), usrUpdater)
+	if err != nil {
+		return fmt.Errorf("APITokenInsert err %w", err)
+	}
+	elm.ID = int(id)
+	elm.Token = token
+	return nil
+}
+
+// APITokenUpdate maj d'un token (la valeur du token est immuable)
+func APITokenUpdate(elm DbAPIToken) error {
+	q := `UPDATE ` + tblPrefix + `APITOKEN SET name = ?, rightlevel = ?, tags = ?, expires_at = ? where id = ? `
+	_, err := TxExec(nil, q, elm.Name, elm.RightLevel, mergeIntToStr(elm.Tags), nullTime(elm.ExpiresAt), elm.ID)
+	if err != nil {
+		return fmt.Errorf("APITokenUpdate err %w", err)
+	}
+	return nil
+}
+
+// APITokenDelete révocation d'un token
+func APITokenDelete(elmID int) error {
+	_, err := TxExec(nil, `DELETE FROM `+tblPrefix+`APITOKEN where id = ? `, elmID)
+	if err != nil {
+		return fmt.Errorf("APITokenDelete err %w", err)
+	}
+	return nil
+}
+
+// APITokenCheck authentification par token d'api : token et utilisateur porteur
+func APITokenCheck(token string) (DbAPIToken, DbUser, error) {
+	credErr := fmt.Errorf("invalid api token")
+	if !IsAPIToken(token) {
+		return DbAPIToken{}, DbUser{}, credErr
+	}
+
+	var id int
+	err := MainDB.QueryRow(`SELECT id FROM `+tblPrefix+`APITOKEN where token_hash = ? `, apiTokenHash(token)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return DbAPIToken{}, DbUser{}, credErr
+	}
+	if err != nil {
+		return DbAPIToken{}, DbUser{}, fmt.Errorf("APITokenCheck err %w", err)
+	}
+	tk, err := APITokenGet(id)
+	if err != nil {
+		return DbAPIToken{}, DbUser{}, err
+	}
+	if !tk.ExpiresAt.IsZero() && tk.ExpiresAt.Before(time.Now()) {
+		return DbAPIToken{}, DbUser{}, fmt.Errorf("api token expired")
+	}
+	usr, err := UserGet(tk.UserID)
+	if err != nil {
+		return DbAPIToken{}, DbUser{}, err
+	}
+	if usr.ID <= 0 || usr.Deleted {
+		return DbAPIToken{}, DbUser{}, credErr
+	}
+
+	//droits du token plafonnés à ceux de l'utilisateur
+	if usr.RightLevel < tk.RightLevel {
+		tk.RightLevel = usr.RightLevel
+	}
+
+	//trace d'utilisation, sans écriture à chaque appel
+	if time.Since(tk.LastUsedAt) > apiTokenUsedDelay {
+		tk.LastUsedAt = time.Now()
+		if _, err = TxExec(nil, `UPDATE `+tblPrefix+`APITOKEN SET last_used_at = ? where id = ? `, tk.LastUsedAt, tk.ID); err != nil {
+			return DbAPIToken{}, DbUser{}, fmt.Errorf("APITokenCheck err %w", err)
+		}
+	}
+	return tk, usr, nil
+}
@@ -0,0 +1,183 @@
+package dal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// champs non tracés dans les diff d'audit (calculés ou état d'exec)
+var auditIgnoredFields = map[string]bool{
+	"info":        true,
+	"last_start":  true,
+	"last_stop":   true,
+	"last_result": true,
+	"last_msg":    true,
+	"deleted":     true,
+}
+
+// champs sensibles : seul le changement est tracé, pas la valeur
+var auditSecretFields = map[string]bool{
+	"password": true,
+	"apikey":   true,
+	"hmac_key": true,
+}
+
+// AuditList liste des traces d'audit
+func AuditList(filter SearchQuery) ([]DbAudit, PagedResponse, error) {
+	var err error
+	arr := make([]DbAudit, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `AUDIT AUDIT ` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("AuditList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT AUDIT.id, AUDIT.created_at, AUDIT.usr_id, AUDIT.login
+		, AUDIT.entity, AUDIT.entity_id, AUDIT.action, AUDIT.diff
+		FROM ` + tblPrefix + `AUDIT AUDIT 
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("AuditList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id       int
+		at       sql.NullTime
+		usrID    sql.NullInt64
+		login    sql.NullString
+		entity   sql.NullString
+		entityID sql.NullString
+		action   sql.NullString
+		diff     sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &at, &usrID, &login, &entity, &entityID, &action, &diff)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("AuditList scan %w", err)
+		}
+		arr = append(arr, DbAudit{
+			ID:       id,
+			At:       at.Time,
+			UsrID:    int(usrID.Int64),
+			Login:    login.String,
+			Entity:   entity.String,
+			EntityID: entityID.String,
+			Action:   action.String,
+			Diff:     diff.String,
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("AuditList err %w", err)
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// AuditInsert ajout d'une trace d'audit
+func AuditInsert(elm *DbAudit) error {
+	if elm.At.IsZero() {
+		elm.At = time.Now()
+	}
+	q := `INSERT INTO ` + tblPrefix + `AUDIT (created_at, usr_id, login, entity, entity_id, action, diff) 
+		VALUES(?,?,?,?,?,?,?) `
+	id, err := TxInsert(nil, q, elm.At, elm.UsrID, elm.Login, elm.Entity, elm.EntityID, elm.Action, elm.Diff)
+	if err != nil {
+		return fmt.Errorf("AuditInsert err %w", err)
+	}
+	elm.ID = int(id)
+	return nil
+}
+
+// auditFields représentation json "à plat" d'une entité (nil : aucun champ)
+func auditFields(elm interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	if elm == nil || (reflect.ValueOf(elm).Kind() == reflect.Ptr && reflect.ValueOf(elm).IsNil()) {
+		return ret
+	}
+	b, err := json.Marshal(elm)
+	if err != nil {
+		return ret
+	}
+	json.Unmarshal(b, &ret)
+	return ret
+}
+
+// AuditDiff diff json entre deux états d'une entité (before nil : création, after nil : suppression)
+// seuls les champs modifiés sont retenus : {"champ": {"before": x, "after": y}}
+// secrets : champs sensibles en plus de ceux connus
+func AuditDiff(before, after interface{}, secrets ...string) string {
+	b := auditFields(before)
+	a := auditFields(after)
+
+	keys := make([]string, 0)
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, exists := b[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diff := make(map[string]map[string]interface{})
+	for _, k := range keys {
+		if auditIgnoredFields[strings.ToLower(k)] {
+			continue
+		}
+		vb, inB := b[k]
+		va, inA := a[k]
+		if reflect.DeepEqual(vb, va) {
+			continue
+		}
+		d := make(map[string]interface{})
+		if inB {
+			d["before"] = vb
+		}
+		if inA {
+			d["after"] = va
+		}
+		if auditSecretFields[strings.ToLower(k)] || inStrs(secrets, k) {
+			for dk, dv := range d {
+				if dv != nil && dv != "" {
+					d[dk] = SecretMask
+				}
+			}
+		}
+		diff[k] = d
+	}
+	if len(diff) == 0 {
+		return ""
+	}
+	ret, _ := json.Marshal(diff)
+	return string(ret)
+}
+
+// inStrs retourne vrai si s est dans la liste
+func inStrs(arr []string, s string) bool {
+	for _, e := range arr {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
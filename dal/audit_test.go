@@ -0,0 +1,33 @@
+package dal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := DbAgent{ID: 1, Host: "http://a:8080", APIKey: "k1", Info: "created"}
+	after := DbAgent{ID: 1, Host: "http://b:8080", APIKey: "k2", Info: "updated"}
+
+	var diff map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(AuditDiff(&before, &after)), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 2 || diff["host"]["before"] != "http://a:8080" || diff["host"]["after"] != "http://b:8080" {
+		t.Errorf("diff %v", diff)
+	}
+	if diff["apikey"]["before"] != SecretMask || diff["apikey"]["after"] != SecretMask {
+		t.Errorf("secret not masked %v", diff["apikey"])
+	}
+
+	//création : pas de before
+	diff = nil
+	json.Unmarshal([]byte(AuditDiff(nil, &KVJSON{Key: "k", Value: "pwd"}, "value")), &diff)
+	if _, exists := diff["key"]["before"]; exists || diff["value"]["after"] != SecretMask {
+		t.Errorf("create diff %v", diff)
+	}
+
+	if d := AuditDiff(&before, &before); d != "" {
+		t.Errorf("no change : %v", d)
+	}
+}
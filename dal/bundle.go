@@ -0,0 +1,987 @@
+package dal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Bundle : export/import déclaratif de la configuration (agents, queues, tags,
+// planifs, taches et taskflows), les références se font par nom et non par id
+
+// BundleFormatVersion version du format de bundle
+const BundleFormatVersion = 1
+
+// ErrInvalidBundle bundle refusé à la validation (erreur de saisie et non technique)
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// ErrManagedEntity modification d'une entité gérée par la synchro gitops
+var ErrManagedEntity = errors.New("read only")
+
+// Bundle configuration complète
+type Bundle struct {
+	Version   int              `json:"version" yaml:"version"`
+	Agents    []BundleAgent    `json:"agents,omitempty" yaml:"agents,omitempty"`
+	Queues    []BundleQueue    `json:"queues,omitempty" yaml:"queues,omitempty"`
+	Tags      []BundleTag      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Schedules []BundleSched    `json:"schedules,omitempty" yaml:"schedules,omitempty"`
+	Tasks     []BundleTask     `json:"tasks,omitempty" yaml:"tasks,omitempty"`
+	TaskFlows []BundleTaskFlow `json:"taskflows,omitempty" yaml:"taskflows,omitempty"`
+}
+
+// BundleAgent agent, nom : host
+// la clé d'api n'est jamais exportée, elle n'est requise qu'à la création
+type BundleAgent struct {
+	Host     string `json:"host" yaml:"host"`
+	APIKey   string `json:"apikey,omitempty" yaml:"apikey,omitempty"`
+	CertSign string `json:"certsign,omitempty" yaml:"certsign,omitempty"`
+	CABundle string `json:"ca_bundle,omitempty" yaml:"ca_bundle,omitempty"`
+}
+
+// BundleQueue queue, nom : lib
+type BundleQueue struct {
+	Lib         string   `json:"lib" yaml:"lib"`
+	Slot        int      `json:"slot" yaml:"slot"`
+	MaxSize     int      `json:"size" yaml:"size"`
+	MaxDuration int      `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	NoExecWhile []string `json:"no_exec_while_queues,omitempty" yaml:"no_exec_while_queues,omitempty"`
+}
+
+// BundleTag tag, nom : group/lib
+type BundleTag struct {
+	Lib    string   `json:"lib" yaml:"lib"`
+	Group  string   `json:"group" yaml:"group"`
+	Emails []string `json:"emails,omitempty" yaml:"emails,omitempty"`
+}
+
+// BundleSched planif ou période, nom : lib
+type BundleSched struct {
+	Lib      string              `json:"lib" yaml:"lib"`
+	IsPeriod bool                `json:"is_period,omitempty" yaml:"is_period,omitempty"`
+	TimeZone string              `json:"time_zone,omitempty" yaml:"time_zone,omitempty"`
+	Detail   []BundleSchedDetail `json:"detail" yaml:"detail"`
+}
+
+// BundleSchedDetail détail planif (cf DbSchedDetail)
+type BundleSchedDetail struct {
+	Interval      int    `json:"interval,omitempty" yaml:"interval,omitempty"`
+	IntervalHours string `json:"intervalhours,omitempty" yaml:"intervalhours,omitempty"`
+	Hours         string `json:"hours,omitempty" yaml:"hours,omitempty"`
+	Months        string `json:"months" yaml:"months"`
+	WeekDays      string `json:"weekdays" yaml:"weekdays"`
+	MonthDays     string `json:"monthdays" yaml:"monthdays"`
+}
+
+// BundleTask tache, nom : lib, exec_on : hosts des agents
+type BundleTask struct {
+	Lib      string   `json:"lib" yaml:"lib"`
+	Type     string   `json:"type" yaml:"type"`
+	Timeout  int      `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	LogStore string   `json:"log_store,omitempty" yaml:"log_store,omitempty"`
+	Cmd      string   `json:"cmd" yaml:"cmd"`
+	Args     []string `json:"args,omitempty" yaml:"args,omitempty"`
+	StartIn  string   `json:"start_in,omitempty" yaml:"start_in,omitempty"`
+	ExecOn   []string `json:"exec_on,omitempty" yaml:"exec_on,omitempty"`
+}
+
+// BundleTaskFlow taskflow, nom : lib
+// tags (group/lib), schedule, queue et taches du détail référencés par nom
+type BundleTaskFlow struct {
+	Lib            string                 `json:"lib" yaml:"lib"`
+	Tags           []string               `json:"tags,omitempty" yaml:"tags,omitempty"`
+	NamedArgs      map[string]string      `json:"named_args,omitempty" yaml:"named_args,omitempty"`
+	Activ          bool                   `json:"activ" yaml:"activ"`
+	ManualLaunch   bool                   `json:"manuallaunch" yaml:"manuallaunch"`
+	Schedule       string                 `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	ErrMngt        int                    `json:"err_management,omitempty" yaml:"err_management,omitempty"`
+	Queue          string                 `json:"queue,omitempty" yaml:"queue,omitempty"`
+	Emails         []string               `json:"emails,omitempty" yaml:"emails,omitempty"`
+	SLAStartDelay  int                    `json:"sla_start_delay,omitempty" yaml:"sla_start_delay,omitempty"`
+	SLAMaxDuration int                    `json:"sla_max_duration,omitempty" yaml:"sla_max_duration,omitempty"`
+	SLAFinishBy    string                 `json:"sla_finish_by,omitempty" yaml:"sla_finish_by,omitempty"`
+	Detail         []BundleTaskFlowDetail `json:"detail" yaml:"detail"`
+}
+
+// BundleTaskFlowDetail étape d'un taskflow, idx implicite (ordre de la liste)
+type BundleTaskFlowDetail struct {
+	Task           string `json:"task" yaml:"task"`
+	NextTaskIDOK   int    `json:"nexttaskid_ok" yaml:"nexttaskid_ok"`
+	NextTaskIDFail int    `json:"nexttaskid_fail" yaml:"nexttaskid_fail"`
+	RetryIfFail    int    `json:"retryif_fail,omitempty" yaml:"retryif_fail,omitempty"`
+}
+
+// BundlePlanItem action d'import sur une entité (AuditActCreate, AuditActUpdate, AuditActDelete)
+type BundlePlanItem struct {
+	Entity string          `json:"entity"` // code crud de l'entité
+	Name   string          `json:"name"`
+	Action string          `json:"action"`
+	ID     int             `json:"id,omitempty"`   // id en base, connu aprés application pour une création
+	Diff   json.RawMessage `json:"diff,omitempty"` // champs modifiés (maj)
+
+	Before interface{} `json:"-"`
+	After  interface{} `json:"-"`
+}
+
+// RestrictTaskFlows restreint le bundle aux taskflows listés (par nom) et aux taches qu'ils utilisent
+func (c *Bundle) RestrictTaskFlows(libs map[string]bool) {
+	tfs := make([]BundleTaskFlow, 0)
+	used := make(map[string]bool)
+	for _, e := range c.TaskFlows {
+		if libs[e.Lib] {
+			tfs = append(tfs, e)
+			for _, d := range e.Detail {
+				used[d.Task] = true
+			}
+		}
+	}
+	tasks := make([]BundleTask, 0)
+	for _, e := range c.Tasks {
+		if used[e.Lib] {
+			tasks = append(tasks, e)
+		}
+	}
+	c.TaskFlows, c.Tasks = tfs, tasks
+}
+
+// BundleImportOpt options d'import
+type BundleImportOpt struct {
+	Apply     bool            // application du plan, à défaut plan seul
+	Prune     bool            // suppression de l'existant absent du bundle (les agents sont désactivés)
+	PruneOnly map[string]bool // restriction des suppressions aux entity/name listés, nil : pas de restriction
+	Managed   *BundleSources  // non nil : remplacement des entités gérées (gitops) dans la transaction d'import
+	Protected bool            // application refusée si le plan modifie une entité gérée par gitops (import manuel)
+}
+
+// BundleSources fichier de définition de chaque élément d'un bundle, dans l'ordre du bundle
+type BundleSources struct {
+	Agents    []string
+	Tags      []string
+	Schedules []string
+	Queues    []string
+	Tasks     []string
+	TaskFlows []string
+}
+
+// pruned suppression prévue d'un élément en base absent du bundle
+func (c *BundleImportOpt) pruned(entity, name string) bool {
+	return c.Prune && (c.PruneOnly == nil || c.PruneOnly[entity+"/"+name])
+}
+
+// BundleTagName nom d'un tag dans le bundle
+func BundleTagName(group, lib string) string {
+	return group + "/" + lib
+}
+
+// bundleState configuration en base, au format bundle et par nom
+type bundleState struct {
+	bundle Bundle
+	agents map[string]DbAgent // supprimés inclus (host unique)
+	queues map[string]DbQueue
+	tags   map[string]DbTag
+	scheds map[string]DbSched
+	tasks  map[string]DbTask
+	tfs    map[string]DbTaskFlow
+}
+
+// loadBundleState lecture de la configuration en base
+func loadBundleState() (*bundleState, error) {
+	st := &bundleState{
+		bundle: Bundle{Version: BundleFormatVersion},
+		agents: make(map[string]DbAgent),
+		queues: make(map[string]DbQueue),
+		tags:   make(map[string]DbTag),
+		scheds: make(map[string]DbSched),
+		tasks:  make(map[string]DbTask),
+		tfs:    make(map[string]DbTaskFlow),
+	}
+	all := SearchQuery{}
+
+	agents, _, err := AgentList(all)
+	if err != nil {
+		return nil, err
+	}
+	agentNames := make(map[int]string)
+	for _, e := range agents {
+		st.agents[e.Host] = e
+		if e.Deleted {
+			continue
+		}
+		agentNames[e.ID] = e.Host
+		st.bundle.Agents = append(st.bundle.Agents, BundleAgent{
+			Host:     e.Host,
+			APIKey:   e.APIKey,
+			CertSign: e.CertSignAllowed,
+			CABundle: e.CABundle,
+		})
+	}
+
+	queues, _, err := QueueList(all)
+	if err != nil {
+		return nil, err
+	}
+	queueNames := make(map[int]string)
+	for _, e := range queues {
+		st.queues[e.Lib] = e
+		queueNames[e.ID] = e.Lib
+	}
+	for _, e := range queues {
+		st.bundle.Queues = append(st.bundle.Queues, BundleQueue{
+			Lib:         e.Lib,
+			Slot:        e.Slot,
+			MaxSize:     e.MaxSize,
+			MaxDuration: e.MaxDuration,
+			NoExecWhile: bundleNames(e.NoExecWhile, queueNames),
+		})
+	}
+
+	tags, _, err := TagList(all)
+	if err != nil {
+		return nil, err
+	}
+	tagNames := make(map[int]string)
+	for _, e := range tags {
+		name := BundleTagName(e.Group, e.Lib)
+		st.tags[name] = e
+		tagNames[e.ID] = name
+		st.bundle.Tags = append(st.bundle.Tags, BundleTag{
+			Lib:    e.Lib,
+			Group:  e.Group,
+			Emails: emptyStrsNil(e.Emails),
+		})
+	}
+
+	scheds, _, err := SchedList(all)
+	if err != nil {
+		return nil, err
+	}
+	schedNames := make(map[int]string)
+	for _, e := range scheds {
+		st.scheds[e.Lib] = e
+		schedNames[e.ID] = e.Lib
+		st.bundle.Schedules = append(st.bundle.Schedules, bundleSchedFrom(e))
+	}
+
+	tasks, _, err := TaskList(all)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	taskNames := make(map[int]string)
+	for _, e := range tasks {
+		name := bundleUniqueName(e.Lib, e.ID, func(n string) bool { _, exists := st.tasks[n]; return exists })
+		st.tasks[name] = e
+		taskNames[e.ID] = name
+		st.bundle.Tasks = append(st.bundle.Tasks, BundleTask{
+			Lib:      name,
+			Type:     e.Type,
+			Timeout:  e.Timeout,
+			LogStore: e.LogStore,
+			Cmd:      e.Cmd,
+			Args:     emptyStrsNil(e.Args),
+			StartIn:  e.StartIn,
+			ExecOn:   bundleNames(e.ExecOn, agentNames),
+		})
+	}
+
+	tfs, _, err := TaskFlowList(all)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tfs, func(i, j int) bool { return tfs[i].ID < tfs[j].ID })
+	for _, e := range tfs {
+		name := bundleUniqueName(e.Lib, e.ID, func(n string) bool { _, exists := st.tfs[n]; return exists })
+		st.tfs[name] = e
+		tf := BundleTaskFlow{
+			Lib:            name,
+			Tags:           bundleNames(e.Tags, tagNames),
+			Activ:          e.Activ,
+			ManualLaunch:   e.ManualLaunch,
+			Schedule:       schedNames[e.ScheduleID],
+			ErrMngt:        e.ErrMngt,
+			Queue:          queueNames[e.QueueID],
+			Emails:         emptyStrsNil(e.Emails),
+			SLAStartDelay:  e.SLAStartDelay,
+			SLAMaxDuration: e.SLAMaxDuration,
+			SLAFinishBy:    e.SLAFinishBy,
+		}
+		if len(e.NamedArgs) > 0 {
+			tf.NamedArgs = e.NamedArgs
+		}
+		for _, d := range e.Detail {
+			tf.Detail = append(tf.Detail, BundleTaskFlowDetail{
+				Task:           taskNames[d.TaskID],
+				NextTaskIDOK:   d.NextTaskIDOK,
+				NextTaskIDFail: d.NextTaskIDFail,
+				RetryIfFail:    d.RetryIfFail,
+			})
+		}
+		st.bundle.TaskFlows = append(st.bundle.TaskFlows, tf)
+	}
+
+	st.bundle.sort()
+	return st, nil
+}
+
+// bundleUniqueName nom d'une tache / d'un taskflow dans le bundle
+// lib en double en base : suffixée par l'id (le plus petit id garde la lib)
+func bundleUniqueName(lib string, id int, exists func(name string) bool) string {
+	name := lib
+	for exists(name) {
+		name = fmt.Sprintf("%v #%v", name, id)
+	}
+	return name
+}
+
+// bundleSchedFrom conversion planif
+func bundleSchedFrom(e DbSched) BundleSched {
+	ret := BundleSched{
+		Lib:      e.Lib,
+		IsPeriod: e.IsPeriod,
+		TimeZone: e.TimeZone,
+		Detail:   make([]BundleSchedDetail, 0),
+	}
+	for _, d := range e.Detail {
+		ret.Detail = append(ret.Detail, BundleSchedDetail{
+			Interval:      d.Interval,
+			IntervalHours: d.IntervalHours,
+			Hours:         d.Hours,
+			Months:        d.Months,
+			WeekDays:      d.WeekDays,
+			MonthDays:     d.MonthDays,
+		})
+	}
+	return ret
+}
+
+// bundleNames conversion d'une liste d'id en noms, les id inconnus sont ignorés
+func bundleNames(ids []int, names map[int]string) []string {
+	var ret []string
+	for _, id := range ids {
+		if n, exists := names[id]; exists {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+// emptyStrsNil liste vide à nil (omise à l'export)
+func emptyStrsNil(in []string) []string {
+	if len(in) == 0 {
+		return nil
+	}
+	return in
+}
+
+// sort tri par nom pour un export stable
+func (c *Bundle) sort() {
+	sort.Slice(c.Agents, func(i, j int) bool { return c.Agents[i].Host < c.Agents[j].Host })
+	sort.Slice(c.Queues, func(i, j int) bool { return c.Queues[i].Lib < c.Queues[j].Lib })
+	sort.Slice(c.Tags, func(i, j int) bool {
+		return BundleTagName(c.Tags[i].Group, c.Tags[i].Lib) < BundleTagName(c.Tags[j].Group, c.Tags[j].Lib)
+	})
+	sort.Slice(c.Schedules, func(i, j int) bool { return c.Schedules[i].Lib < c.Schedules[j].Lib })
+	sort.Slice(c.Tasks, func(i, j int) bool { return c.Tasks[i].Lib < c.Tasks[j].Lib })
+	sort.Slice(c.TaskFlows, func(i, j int) bool { return c.TaskFlows[i].Lib < c.TaskFlows[j].Lib })
+}
+
+// BundleExport export de la configuration (sans les clés d'api des agents)
+func BundleExport() (Bundle, error) {
+	st, err := loadBundleState()
+	if err != nil {
+		return Bundle{}, fmt.Errorf("BundleExport err %w", err)
+	}
+	for i := range st.bundle.Agents {
+		st.bundle.Agents[i].APIKey = ""
+	}
+	return st.bundle, nil
+}
+
+// bundleDb entités du bundle importé, validées, à l'index du bundle
+// les références par nom sont résolues à l'application
+type bundleDb struct {
+	agents []DbAgent
+	queues []DbQueue
+	tags   []DbTag
+	scheds []DbSched
+	tasks  []DbTask
+	tfs    []DbTaskFlow
+}
+
+// bundleCheck validation / normalisation du bundle importé
+// les références portent sur des éléments du bundle ou en base non supprimés
+func bundleCheck(in *Bundle, st *bundleState, opt BundleImportOpt) (*bundleDb, error) {
+	errs := make([]string, 0)
+	ko := func(kind, name string, err interface{}) {
+		errs = append(errs, fmt.Sprintf("%v %v : %v", kind, name, err))
+	}
+	dbs := &bundleDb{}
+
+	if in.Version != 0 && in.Version != BundleFormatVersion {
+		return nil, fmt.Errorf("%w : unsupported version %v", ErrInvalidBundle, in.Version)
+	}
+
+	//noms présents dans le bundle, ou à défaut en base
+	names := func(kind string, n int, name func(i int) string) map[string]bool {
+		ret := make(map[string]bool)
+		for i := 0; i < n; i++ {
+			if ret[name(i)] {
+				ko(kind, name(i), "duplicate name")
+			}
+			ret[name(i)] = true
+		}
+		return ret
+	}
+	known := func(entity string, set map[string]bool, dbHas bool, name string) bool {
+		return set[name] || (dbHas && !opt.pruned(entity, name))
+	}
+
+	// agents
+	for i := range in.Agents {
+		e := &in.Agents[i]
+		elm := DbAgent{Host: e.Host, APIKey: e.APIKey, CertSignAllowed: strings.TrimSpace(e.CertSign), CABundle: e.CABundle}
+		cur, exists := st.agents[strings.TrimSpace(e.Host)]
+		if elm.APIKey == "" && exists {
+			elm.APIKey = cur.APIKey //clé conservée
+		}
+		if err := elm.Validate(true); err != nil {
+			ko("agent", e.Host, err)
+		}
+		elm.ID = cur.ID
+		*e = BundleAgent{Host: elm.Host, APIKey: elm.APIKey, CertSign: elm.CertSignAllowed, CABundle: elm.CABundle}
+		dbs.agents = append(dbs.agents, elm)
+	}
+	agentSet := names("agent", len(in.Agents), func(i int) string { return in.Agents[i].Host })
+
+	// tags
+	for i := range in.Tags {
+		e := &in.Tags[i]
+		elm := DbTag{Lib: e.Lib, Group: e.Group, Emails: e.Emails}
+		if err := elm.Validate(true); err != nil {
+			ko("tag", BundleTagName(e.Group, e.Lib), err)
+		}
+		elm.ID = st.tags[BundleTagName(elm.Group, elm.Lib)].ID
+		*e = BundleTag{Lib: elm.Lib, Group: elm.Group, Emails: emptyStrsNil(elm.Emails)}
+		dbs.tags = append(dbs.tags, elm)
+	}
+	tagSet := names("tag", len(in.Tags), func(i int) string { return BundleTagName(in.Tags[i].Group, in.Tags[i].Lib) })
+
+	// planifs
+	for i := range in.Schedules {
+		e := &in.Schedules[i]
+		elm := DbSched{Lib: strings.TrimSpace(e.Lib), IsPeriod: e.IsPeriod, TimeZone: e.TimeZone}
+		for _, d := range e.Detail {
+			elm.Detail = append(elm.Detail, DbSchedDetail{
+				Interval:      d.Interval,
+				IntervalHours: d.IntervalHours,
+				Hours:         d.Hours,
+				Months:        d.Months,
+				WeekDays:      d.WeekDays,
+				MonthDays:     d.MonthDays,
+			})
+		}
+		if elm.Lib == "" {
+			ko("schedule", e.Lib, "invalid lib")
+		}
+		if err := elm.Validate(true); err != nil {
+			ko("schedule", e.Lib, err)
+		}
+		elm.ID = st.scheds[elm.Lib].ID
+		*e = bundleSchedFrom(elm)
+		dbs.scheds = append(dbs.scheds, elm)
+	}
+	schedSet := names("schedule", len(in.Schedules), func(i int) string { return in.Schedules[i].Lib })
+
+	// queues
+	for i := range in.Queues {
+		e := &in.Queues[i]
+		elm := DbQueue{Lib: e.Lib, Slot: e.Slot, MaxSize: e.MaxSize, MaxDuration: e.MaxDuration}
+		if err := elm.Validate(true); err != nil {
+			ko("queue", e.Lib, err)
+		}
+		cur := st.queues[elm.Lib]
+		elm.ID = cur.ID
+		elm.PausedManual = cur.PausedManual //état conservé
+		elm.PausedManualFrom = cur.PausedManualFrom
+		elm.OwnerGroup = cur.OwnerGroup //propriétaire hors bundle, conservé
+		e.Lib, e.Slot, e.MaxSize, e.MaxDuration = elm.Lib, elm.Slot, elm.MaxSize, elm.MaxDuration
+		e.NoExecWhile = emptyStrsNil(clearStrs(e.NoExecWhile))
+		dbs.queues = append(dbs.queues, elm)
+	}
+	queueSet := names("queue", len(in.Queues), func(i int) string { return in.Queues[i].Lib })
+	for _, e := range in.Queues {
+		for _, q := range e.NoExecWhile {
+			if _, dbHas := st.queues[q]; !known("QUEUE", queueSet, dbHas, q) {
+				ko("queue", e.Lib, "unknown queue "+q)
+			}
+		}
+	}
+
+	// taches
+	for i := range in.Tasks {
+		e := &in.Tasks[i]
+		elm := DbTask{Lib: e.Lib, Type: e.Type, Timeout: e.Timeout, LogStore: e.LogStore,
+			Cmd: e.Cmd, Args: e.Args, StartIn: e.StartIn}
+		if err := elm.Validate(true); err != nil {
+			ko("task", e.Lib, err)
+		}
+		elm.ID = st.tasks[elm.Lib].ID
+		elm.OwnerGroup = st.tasks[elm.Lib].OwnerGroup //propriétaire hors bundle, conservé
+		execOn := emptyStrsNil(clearStrs(e.ExecOn))
+		*e = BundleTask{Lib: elm.Lib, Type: elm.Type, Timeout: elm.Timeout, LogStore: elm.LogStore,
+			Cmd: elm.Cmd, Args: emptyStrsNil(elm.Args), StartIn: elm.StartIn, ExecOn: execOn}
+		for _, a := range e.ExecOn {
+			cur, dbHas := st.agents[a]
+			if !known("AGENT", agentSet, dbHas && !cur.Deleted, a) {
+				ko("task", e.Lib, "unknown agent "+a)
+			}
+		}
+		dbs.tasks = append(dbs.tasks, elm)
+	}
+	taskSet := names("task", len(in.Tasks), func(i int) string { return in.Tasks[i].Lib })
+
+	// taskflows
+	for i := range in.TaskFlows {
+		e := &in.TaskFlows[i]
+		elm := DbTaskFlow{Lib: e.Lib, NamedArgs: e.NamedArgs, Activ: e.Activ, ManualLaunch: e.ManualLaunch,
+			ErrMngt: e.ErrMngt, Emails: e.Emails, SLAStartDelay: e.SLAStartDelay,
+			SLAMaxDuration: e.SLAMaxDuration, SLAFinishBy: e.SLAFinishBy}
+		for j, d := range e.Detail {
+			elm.Detail = append(elm.Detail, DbTaskFlowDetail{
+				Idx:            j + 1,
+				NextTaskIDOK:   d.NextTaskIDOK,
+				NextTaskIDFail: d.NextTaskIDFail,
+				RetryIfFail:    d.RetryIfFail,
+			})
+			if _, dbHas := st.tasks[d.Task]; !known("TASK", taskSet, dbHas, d.Task) {
+				ko("taskflow", e.Lib, "unknown task "+d.Task)
+			}
+		}
+		if err := elm.validate(true, false); err != nil {
+			ko("taskflow", e.Lib, err)
+		}
+		elm.ID = st.tfs[elm.Lib].ID
+		elm.OwnerGroup = st.tfs[elm.Lib].OwnerGroup //propriétaire hors bundle, conservé
+
+		e.Lib, e.Emails, e.SLAFinishBy = elm.Lib, emptyStrsNil(elm.Emails), elm.SLAFinishBy
+		e.NamedArgs = nil
+		if len(elm.NamedArgs) > 0 {
+			e.NamedArgs = elm.NamedArgs
+		}
+		e.Tags = emptyStrsNil(clearStrs(e.Tags))
+		for _, t := range e.Tags {
+			if _, dbHas := st.tags[t]; !known("TAGS", tagSet, dbHas, t) {
+				ko("taskflow", e.Lib, "unknown tag "+t)
+			}
+		}
+		e.Schedule = strings.TrimSpace(e.Schedule)
+		if _, dbHas := st.scheds[e.Schedule]; e.Schedule != "" && !known("SCHED", schedSet, dbHas, e.Schedule) {
+			ko("taskflow", e.Lib, "unknown schedule "+e.Schedule)
+		}
+		e.Queue = strings.TrimSpace(e.Queue)
+		if _, dbHas := st.queues[e.Queue]; e.Queue != "" && !known("QUEUE", queueSet, dbHas, e.Queue) {
+			ko("taskflow", e.Lib, "unknown queue "+e.Queue)
+		}
+		dbs.tfs = append(dbs.tfs, elm)
+	}
+	names("taskflow", len(in.TaskFlows), func(i int) string { return in.TaskFlows[i].Lib })
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w : %v", ErrInvalidBundle, strings.Join(errs, ", "))
+	}
+	return dbs, nil
+}
+
+// bundlePlan calcul des actions à mener
+type bundlePlan struct {
+	items []BundlePlanItem
+	idx   map[string]int // entity/name -> index de l'item
+}
+
+// add ajout d'une création / maj selon l'existant
+func (c *bundlePlan) add(entity, name string, id int, exists bool, before, after interface{}) {
+	item := BundlePlanItem{Entity: entity, Name: name, ID: id, After: after}
+	switch {
+	case !exists:
+		item.Action = AuditActCreate
+	default:
+		diff := AuditDiff(before, after)
+		if diff == "" {
+			return
+		}
+		item.Action = AuditActUpdate
+		item.Diff = json.RawMessage(diff)
+		item.Before = before
+	}
+	c.idx[entity+"/"+name] = len(c.items)
+	c.items = append(c.items, item)
+}
+
+// del ajout d'une suppression
+func (c *bundlePlan) del(entity, name string, id int, before interface{}) {
+	c.idx[entity+"/"+name] = len(c.items)
+	c.items = append(c.items, BundlePlanItem{Entity: entity, Name: name, ID: id, Action: AuditActDelete, Before: before})
+}
+
+// get action prévue pour une entité, nil si aucune
+func (c *bundlePlan) get(entity, name string) *BundlePlanItem {
+	if i, exists := c.idx[entity+"/"+name]; exists {
+		return &c.items[i]
+	}
+	return nil
+}
+
+// BundleImport import d'un bundle : calcul du plan d'actions (create/update/delete)
+// et application éventuelle en une seule transaction, in est normalisé au passage
+func BundleImport(in *Bundle, opt BundleImportOpt, usrUpdater int) ([]BundlePlanItem, error) {
+	st, err := loadBundleState()
+	if err != nil {
+		return nil, fmt.Errorf("BundleImport err %w", err)
+	}
+	dbs, err := bundleCheck(in, st, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	//plan : existant au format bundle par nom
+	plan := &bundlePlan{items: make([]BundlePlanItem, 0), idx: make(map[string]int)}
+	cur := make(map[string]interface{})
+	for i := range st.bundle.Agents {
+		cur["AGENT/"+st.bundle.Agents[i].Host] = &st.bundle.Agents[i]
+	}
+	for i := range st.bundle.Queues {
+		cur["QUEUE/"+st.bundle.Queues[i].Lib] = &st.bundle.Queues[i]
+	}
+	for i := range st.bundle.Tags {
+		cur["TAGS/"+BundleTagName(st.bundle.Tags[i].Group, st.bundle.Tags[i].Lib)] = &st.bundle.Tags[i]
+	}
+	for i := range st.bundle.Schedules {
+		cur["SCHED/"+st.bundle.Schedules[i].Lib] = &st.bundle.Schedules[i]
+	}
+	for i := range st.bundle.Tasks {
+		cur["TASK/"+st.bundle.Tasks[i].Lib] = &st.bundle.Tasks[i]
+	}
+	for i := range st.bundle.TaskFlows {
+		cur["TASKFLOW/"+st.bundle.TaskFlows[i].Lib] = &st.bundle.TaskFlows[i]
+	}
+	seen := make(map[string]bool)
+	add := func(entity, name string, id int, after interface{}) {
+		before, exists := cur[entity+"/"+name]
+		seen[entity+"/"+name] = true
+		plan.add(entity, name, id, exists, before, after)
+	}
+	for i := range in.Agents {
+		add("AGENT", in.Agents[i].Host, dbs.agents[i].ID, &in.Agents[i])
+	}
+	for i := range in.Tags {
+		add("TAGS", BundleTagName(in.Tags[i].Group, in.Tags[i].Lib), dbs.tags[i].ID, &in.Tags[i])
+	}
+	for i := range in.Schedules {
+		add("SCHED", in.Schedules[i].Lib, dbs.scheds[i].ID, &in.Schedules[i])
+	}
+	for i := range in.Queues {
+		add("QUEUE", in.Queues[i].Lib, dbs.queues[i].ID, &in.Queues[i])
+	}
+	for i := range in.Tasks {
+		add("TASK", in.Tasks[i].Lib, dbs.tasks[i].ID, &in.Tasks[i])
+	}
+	for i := range in.TaskFlows {
+		add("TASKFLOW", in.TaskFlows[i].Lib, dbs.tfs[i].ID, &in.TaskFlows[i])
+	}
+	if opt.Prune {
+		//ordre inverse des dépendances
+		for _, e := range st.bundle.TaskFlows {
+			if !seen["TASKFLOW/"+e.Lib] && opt.pruned("TASKFLOW", e.Lib) {
+				plan.del("TASKFLOW", e.Lib, st.tfs[e.Lib].ID, cur["TASKFLOW/"+e.Lib])
+			}
+		}
+		for _, e := range st.bundle.Tasks {
+			if !seen["TASK/"+e.Lib] && opt.pruned("TASK", e.Lib) {
+				plan.del("TASK", e.Lib, st.tasks[e.Lib].ID, cur["TASK/"+e.Lib])
+			}
+		}
+		for _, e := range st.bundle.Queues {
+			if !seen["QUEUE/"+e.Lib] && opt.pruned("QUEUE", e.Lib) {
+				plan.del("QUEUE", e.Lib, st.queues[e.Lib].ID, cur["QUEUE/"+e.Lib])
+			}
+		}
+		for _, e := range st.bundle.Schedules {
+			if !seen["SCHED/"+e.Lib] && opt.pruned("SCHED", e.Lib) {
+				plan.del("SCHED", e.Lib, st.scheds[e.Lib].ID, cur["SCHED/"+e.Lib])
+			}
+		}
+		for _, e := range st.bundle.Tags {
+			name := BundleTagName(e.Group, e.Lib)
+			if !seen["TAGS/"+name] && opt.pruned("TAGS", name) {
+				plan.del("TAGS", name, st.tags[name].ID, cur["TAGS/"+name])
+			}
+		}
+		for _, e := range st.bundle.Agents {
+			if !seen["AGENT/"+e.Host] && opt.pruned("AGENT", e.Host) {
+				plan.del("AGENT", e.Host, st.agents[e.Host].ID, cur["AGENT/"+e.Host])
+			}
+		}
+
+		//taskflows conservés hors bundle : pas de référence vers un élément supprimé
+		errs := make([]string, 0)
+		for _, e := range st.bundle.TaskFlows {
+			if seen["TASKFLOW/"+e.Lib] || opt.pruned("TASKFLOW", e.Lib) {
+				continue
+			}
+			refs := [][3]string{{"QUEUE", "queue", e.Queue}, {"SCHED", "schedule", e.Schedule}}
+			for _, d := range e.Detail {
+				refs = append(refs, [3]string{"TASK", "task", d.Task})
+			}
+			for _, t := range e.Tags {
+				refs = append(refs, [3]string{"TAGS", "tag", t})
+			}
+			for _, rf := range refs {
+				if item := plan.get(rf[0], rf[2]); item != nil && item.Action == AuditActDelete {
+					errs = append(errs, fmt.Sprintf("taskflow %v : %v %v still used", e.Lib, rf[1], rf[2]))
+				}
+			}
+		}
+		if len(errs) > 0 {
+			sort.Strings(errs)
+			return nil, fmt.Errorf("%w : %v", ErrInvalidBundle, strings.Join(errs, ", "))
+		}
+	}
+
+	//import manuel : entités gérées non modifiables
+	if opt.Apply && opt.Protected && len(plan.items) > 0 {
+		managed, err := ManagedKeys()
+		if err != nil {
+			return nil, fmt.Errorf("BundleImport err %w", err)
+		}
+		for _, item := range plan.items {
+			if managed[item.Entity+"/"+item.Name] {
+				return nil, fmt.Errorf("%w, %v %v managed by gitops", ErrManagedEntity, item.Entity, item.Name)
+			}
+		}
+	}
+
+	//entités gérées remplacées même sans changement (sources)
+	if !opt.Apply || (len(plan.items) == 0 && opt.Managed == nil) {
+		return plan.items, nil
+	}
+	err = bundleApply(in, dbs, st, plan, opt, usrUpdater)
+	if err != nil {
+		return nil, err
+	}
+	return plan.items, nil
+}
+
+// bundleApply application du plan en une transaction
+// aucune lecture hors transaction ici (sqlite : connexion unique)
+func bundleApply(in *Bundle, dbs *bundleDb, st *bundleState, plan *bundlePlan, opt BundleImportOpt, usrUpdater int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("BundleImport err %w", err)
+	}
+	defer tx.Rollback()
+
+	//suppressions
+	for _, item := range plan.items {
+		if item.Action != AuditActDelete {
+			continue
+		}
+		switch item.Entity {
+		case "TASKFLOW":
+			err = TaskFlowDelete(item.ID, usrUpdater, tx)
+		case "TASK":
+			err = TaskDelete(item.ID, usrUpdater, tx)
+		case "QUEUE":
+			err = QueueDelete(item.ID, usrUpdater, tx)
+		case "SCHED":
+			err = SchedDelete(item.ID, usrUpdater, tx)
+		case "TAGS":
+			err = TagDelete(item.ID, usrUpdater, tx)
+		case "AGENT":
+			err = AgentDelete(item.ID, usrUpdater, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("BundleImport %v %v : %w", item.Entity, item.Name, err)
+		}
+	}
+
+	//résolution des noms : existant puis créations
+	ids := func(entity string) map[string]int {
+		ret := make(map[string]int)
+		for _, item := range plan.items {
+			if item.Entity == entity && item.Action != AuditActDelete {
+				ret[item.Name] = item.ID
+			}
+		}
+		return ret
+	}
+	agentIDs, tagIDs, schedIDs, queueIDs, taskIDs := ids("AGENT"), ids("TAGS"), ids("SCHED"), ids("QUEUE"), ids("TASK")
+	for k, e := range st.agents {
+		if _, exists := agentIDs[k]; !exists && !e.Deleted {
+			agentIDs[k] = e.ID
+		}
+	}
+	for k, e := range st.tags {
+		if _, exists := tagIDs[k]; !exists {
+			tagIDs[k] = e.ID
+		}
+	}
+	for k, e := range st.scheds {
+		if _, exists := schedIDs[k]; !exists {
+			schedIDs[k] = e.ID
+		}
+	}
+	for k, e := range st.queues {
+		if _, exists := queueIDs[k]; !exists {
+			queueIDs[k] = e.ID
+		}
+	}
+	for k, e := range st.tasks {
+		if _, exists := taskIDs[k]; !exists {
+			taskIDs[k] = e.ID
+		}
+	}
+	resolve := func(names []string, ids map[string]int) []int {
+		ret := make([]int, 0)
+		for _, n := range names {
+			ret = append(ret, ids[n])
+		}
+		return ret
+	}
+
+	//créations / maj par ordre de dépendance
+	for i := range in.Agents {
+		item := plan.get("AGENT", in.Agents[i].Host)
+		if item == nil {
+			continue
+		}
+		elm := dbs.agents[i]
+		if elm.ID > 0 {
+			//maj ou réactivation d'un agent supprimé
+			err = AgentUpdate(elm, usrUpdater, tx)
+		} else {
+			err = AgentInsert(&elm, usrUpdater, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("BundleImport agent %v : %w", item.Name, err)
+		}
+		item.ID, agentIDs[item.Name] = elm.ID, elm.ID
+	}
+	for i := range in.Tags {
+		item := plan.get("TAGS", BundleTagName(in.Tags[i].Group, in.Tags[i].Lib))
+		if item == nil {
+			continue
+		}
+		elm := dbs.tags[i]
+		if item.Action == AuditActUpdate {
+			err = TagUpdate(elm, usrUpdater, tx)
+		} else {
+			err = TagInsert(&elm, usrUpdater, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("BundleImport tag %v : %w", item.Name, err)
+		}
+		item.ID, tagIDs[item.Name] = elm.ID, elm.ID
+	}
+	for i := range in.Schedules {
+		item := plan.get("SCHED", in.Schedules[i].Lib)
+		if item == nil {
+			continue
+		}
+		elm := dbs.scheds[i]
+		if item.Action == AuditActUpdate {
+			err = SchedUpdate(elm, usrUpdater, false, tx)
+		} else {
+			err = SchedInsert(&elm, usrUpdater, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("BundleImport schedule %v : %w", item.Name, err)
+		}
+		item.ID, schedIDs[item.Name] = elm.ID, elm.ID
+	}
+	//queues : création puis maj des exclusions mutuelles
+	for i := range in.Queues {
+		item := plan.get("QUEUE", in.Queues[i].Lib)
+		if item == nil || item.Action != AuditActCreate {
+			continue
+		}
+		elm := dbs.queues[i]
+		if err = QueueInsert(&elm, usrUpdater, tx); err != nil {
+			return fmt.Errorf("BundleImport queue %v : %w", item.Name, err)
+		}
+		item.ID, queueIDs[item.Name] = elm.ID, elm.ID
+	}
+	for i := range in.Queues {
+		item := plan.get("QUEUE", in.Queues[i].Lib)
+		if item == nil {
+			continue
+		}
+		elm := dbs.queues[i]
+		elm.ID = item.ID
+		elm.NoExecWhile = resolve(in.Queues[i].NoExecWhile, queueIDs)
+		if err = QueueUpdate(elm, usrUpdater, true, tx); err != nil {
+			return fmt.Errorf("BundleImport queue %v : %w", item.Name, err)
+		}
+	}
+	for i := range in.Tasks {
+		item := plan.get("TASK", in.Tasks[i].Lib)
+		if item == nil {
+			continue
+		}
+		elm := dbs.tasks[i]
+		elm.ExecOn = resolve(in.Tasks[i].ExecOn, agentIDs)
+		if item.Action == AuditActUpdate {
+			err = TaskUpdate(elm, usrUpdater, tx)
+		} else {
+			err = TaskInsert(&elm, usrUpdater, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("BundleImport task %v : %w", item.Name, err)
+		}
+		item.ID, taskIDs[item.Name] = elm.ID, elm.ID
+	}
+	for i := range in.TaskFlows {
+		e := in.TaskFlows[i]
+		item := plan.get("TASKFLOW", e.Lib)
+		if item == nil {
+			continue
+		}
+		elm := dbs.tfs[i]
+		elm.Tags = resolve(e.Tags, tagIDs)
+		elm.ScheduleID = schedIDs[e.Schedule]
+		elm.QueueID = queueIDs[e.Queue]
+		for j := range elm.Detail {
+			elm.Detail[j].TaskID = taskIDs[e.Detail[j].Task]
+		}
+		if item.Action == AuditActUpdate {
+			err = TaskFlowUpdate(elm, usrUpdater, false, tx)
+		} else {
+			err = TaskFlowInsert(&elm, usrUpdater, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("BundleImport taskflow %v : %w", item.Name, err)
+		}
+		item.ID = elm.ID
+	}
+
+	if opt.Managed != nil {
+		tfIDs := ids("TASKFLOW")
+		for k, e := range st.tfs {
+			if _, exists := tfIDs[k]; !exists {
+				tfIDs[k] = e.ID
+			}
+		}
+		err = managedReplace(tx, in, opt.Managed, map[string]map[string]int{
+			"AGENT": agentIDs, "TAGS": tagIDs, "SCHED": schedIDs, "QUEUE": queueIDs, "TASK": taskIDs, "TASKFLOW": tfIDs,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("BundleImport err %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package dal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestBundle import / export de la configuration
+func TestBundle(t *testing.T) {
+	in := Bundle{
+		Version: BundleFormatVersion,
+		Queues:  []BundleQueue{{Lib: "bq", Slot: 1, MaxSize: 5}},
+		Tasks:   []BundleTask{{Lib: "bt", Type: "CmdTask", Cmd: "echo", Args: []string{"a"}}},
+		TaskFlows: []BundleTaskFlow{{Lib: "btf", Queue: "bq",
+			Detail: []BundleTaskFlowDetail{{Task: "bt"}}}},
+	}
+
+	//plan seul
+	plan, err := BundleImport(&in, BundleImportOpt{}, testUsr)
+	if err != nil || len(plan) != 3 || plan[0].Action != AuditActCreate || plan[0].ID != 0 {
+		t.Fatalf("dry run %+v %v", plan, err)
+	}
+	if tf, _, _ := TaskFlowList(SearchQuery{SQLFilter: "TASKFLOW.lib = ?", SQLParams: []interface{}{"btf"}}); len(tf) != 0 {
+		t.Errorf("dry run applied")
+	}
+
+	//application, références résolues
+	if plan, err = BundleImport(&in, BundleImportOpt{Apply: true}, testUsr); err != nil || len(plan) != 3 {
+		t.Fatalf("apply %+v %v", plan, err)
+	}
+	tf, err := TaskFlowGet(plan[2].ID)
+	if err != nil || tf.QueueID != plan[0].ID || len(tf.Detail) != 1 || tf.Detail[0].TaskID != plan[1].ID {
+		t.Errorf("taskflow %+v %v", tf, err)
+	}
+	defer func() {
+		TaskFlowDelete(plan[2].ID, testUsr, nil)
+		TaskDelete(plan[1].ID, testUsr, nil)
+		QueueDelete(plan[0].ID, testUsr, nil)
+	}()
+
+	//ré-import de l'export : rien à faire
+	out, err := BundleExport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan, err := BundleImport(&out, BundleImportOpt{}, testUsr); err != nil || len(plan) != 0 {
+		t.Errorf("export re-import %+v %v", plan, err)
+	}
+
+	//maj
+	in.Tasks[0].Args = []string{"b"}
+	if plan, err := BundleImport(&in, BundleImportOpt{}, testUsr); err != nil || len(plan) != 1 || plan[0].Action != AuditActUpdate {
+		t.Errorf("update %+v %v", plan, err)
+	}
+
+	//référence inconnue
+	in.TaskFlows[0].Queue = "unknown"
+	if _, err := BundleImport(&in, BundleImportOpt{}, testUsr); !errors.Is(err, ErrInvalidBundle) {
+		t.Errorf("unknown ref %v", err)
+	}
+}
+
+// TestBundleManaged entités gérées par gitops : remplacées à l'import, protégées de l'import manuel
+func TestBundleManaged(t *testing.T) {
+	in := Bundle{Queues: []BundleQueue{{Lib: "mq", Slot: 1}}}
+	plan, err := BundleImport(&in, BundleImportOpt{Apply: true, Managed: &BundleSources{Queues: []string{"q.yaml"}}}, testUsr)
+	if err != nil || len(plan) != 1 {
+		t.Fatalf("apply %+v %v", plan, err)
+	}
+	defer QueueDelete(plan[0].ID, testUsr, nil)
+	if m, err := ManagedGet("QUEUE", plan[0].ID); err != nil || m.Name != "mq" || m.Source != "q.yaml" {
+		t.Errorf("managed %+v %v", m, err)
+	}
+
+	//import manuel : plan possible, application refusée
+	in.Queues[0].Slot = 2
+	if _, err := BundleImport(&in, BundleImportOpt{Protected: true}, testUsr); err != nil {
+		t.Errorf("dry run %v", err)
+	}
+	if _, err := BundleImport(&in, BundleImportOpt{Apply: true, Protected: true}, testUsr); !errors.Is(err, ErrManagedEntity) {
+		t.Errorf("protected %v", err)
+	}
+
+	//plus d'entité gérée
+	if _, err := BundleImport(&Bundle{}, BundleImportOpt{Apply: true, Managed: &BundleSources{}}, testUsr); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := ManagedKeys(); len(keys) != 0 {
+		t.Errorf("managed keys %v", keys)
+	}
+}
+
+// TestBundleDuplicateLibs libs de taches en double en base : noms distincts à l'export
+func TestBundleDuplicateLibs(t *testing.T) {
+	ids := make([]int, 0)
+	for i := 0; i < 2; i++ {
+		task := DbTask{Lib: "dupt", Type: "CmdTask", Cmd: "echo"}
+		if err := TaskInsert(&task, testUsr, nil); err != nil {
+			t.Fatal(err)
+		}
+		defer TaskDelete(task.ID, testUsr, nil)
+		ids = append(ids, task.ID)
+	}
+	tf := DbTaskFlow{Lib: "duptf", Detail: []DbTaskFlowDetail{{Idx: 1, TaskID: ids[1]}}}
+	if err := TaskFlowInsert(&tf, testUsr, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer TaskFlowDelete(tf.ID, testUsr, nil)
+
+	out, err := BundleExport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup := fmt.Sprintf("dupt #%v", ids[1])
+	libs := make(map[string]bool)
+	for _, e := range out.Tasks {
+		libs[e.Lib] = true
+	}
+	if !libs["dupt"] || !libs[dup] {
+		t.Errorf("tasks %v", libs)
+	}
+	for _, e := range out.TaskFlows {
+		if e.Lib == "duptf" && (len(e.Detail) != 1 || e.Detail[0].Task != dup) {
+			t.Errorf("detail %+v", e.Detail)
+		}
+	}
+
+	//ré-import de l'export : rien à faire
+	if plan, err := BundleImport(&out, BundleImportOpt{}, testUsr); err != nil || len(plan) != 0 {
+		t.Errorf("export re-import %+v %v", plan, err)
+	}
+}
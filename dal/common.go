@@ -3,6 +3,7 @@ package dal
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +31,14 @@ var crudCodeList = map[string]bool{
 	"CONFIG":   true,
 	"TASKFLOW": true,
 	"SCHED":    true,
+	"SECRET":   true,
+	"VAR":      true,
+	"NOTIF":    true,
+	"AUDIT":    true,
+	"BUNDLE":   true,
+	"APITOKEN": true,
+	"ROLE":     true,
+	"GROUP":    true,
 }
 
 // RightView pour représentation json d'un droit sur un type de donnée
@@ -66,6 +75,22 @@ func IsAutorised(rightlevel RightLevel, crudcode string, edit bool) bool {
 		allowed = (!edit && (rightlevel >= RightLvlTaskRunner)) || (edit && (rightlevel >= RightLvlTaskBuilder))
 	case (crudcode == "SCHED"):
 		allowed = (!edit && (rightlevel >= RightLvlViewer)) || (edit && (rightlevel >= RightLvlTaskRunner))
+	case (crudcode == "SECRET"):
+		allowed = (!edit && (rightlevel >= RightLvlTaskBuilder)) || (edit && (rightlevel >= RightLvlAdmin))
+	case (crudcode == "VAR"):
+		allowed = (!edit && (rightlevel >= RightLvlTaskBuilder)) || (edit && (rightlevel >= RightLvlAdmin))
+	case (crudcode == "NOTIF"):
+		allowed = (!edit && (rightlevel >= RightLvlTaskBuilder)) || (edit && (rightlevel >= RightLvlAdmin))
+	case (crudcode == "AUDIT"):
+		allowed = (!edit && (rightlevel >= RightLvlAdmin)) //lecture seule
+	case (crudcode == "BUNDLE"):
+		allowed = (!edit && (rightlevel >= RightLvlTaskBuilder)) || (edit && (rightlevel >= RightLvlAdmin))
+	case (crudcode == "APITOKEN"):
+		allowed = (rightlevel >= RightLvlAdmin) //tokens de tous les utilisateurs, /my/apitokens pour les siens
+	case (crudcode == "ROLE"):
+		allowed = (rightlevel >= RightLvlAdmin)
+	case (crudcode == "GROUP"):
+		allowed = (!edit && (rightlevel >= RightLvlViewer)) || (edit && (rightlevel >= RightLvlAdmin))
 	}
 	return allowed
 }
@@ -97,6 +122,9 @@ func CfgKVGet(key string) (string, error) {
 	if err != nil && err != sql.ErrNoRows {
 		return "", err
 	}
+	if CfgKVIsSecret(key) {
+		return decryptSecret(val.String)
+	}
 
 	return val.String, nil
 }
@@ -115,6 +143,11 @@ func CfgKVSet(key string, val string) error {
 		return err
 	}
 
+	if CfgKVIsSecret(key) {
+		if val, err = encryptSecret(val); err != nil {
+			return err
+		}
+	}
 	if val == "" {
 		_, err = TxExec(nil, `DELETE FROM `+tblPrefix+`CFG WHERE KID = ?`, key)
 	} else {
@@ -141,6 +174,19 @@ type KVJSON struct {
 	Value string `json:"value"`
 }
 
+// Validate pour controle de validité d'une clé de config saisie
+func (c *KVJSON) Validate() error {
+	if c.Key == "" {
+		return fmt.Errorf("empty key forbidden")
+	}
+	if CfgKVIsSecret(c.Key) {
+		if err := checkSecretInput(c.Value, false); err != nil {
+			return fmt.Errorf("invalid value : %v", err)
+		}
+	}
+	return nil
+}
+
 // CfgKVList liste kv
 func CfgKVList() ([]KVJSON, error) {
 	arr := make([]KVJSON, 0)
@@ -156,9 +202,15 @@ func CfgKVList() ([]KVJSON, error) {
 		if err != nil {
 			return nil, err
 		}
+		val := v.String
+		if CfgKVIsSecret(k.String) {
+			if val, err = decryptSecret(val); err != nil {
+				return nil, err
+			}
+		}
 		arr = append(arr, KVJSON{
 			Key:   k.String,
-			Value: v.String,
+			Value: val,
 		})
 	}
 	err = rows.Err()
@@ -318,6 +370,22 @@ func TxExec(tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
 	return MainDB.Exec(query, args...)
 }
 
+// TxQuery query avec tx fourni ou main db a defaut
+func TxQuery(tx *sql.Tx, query string, args ...interface{}) (*sql.Rows, error) {
+	if tx != nil {
+		return tx.Query(query, args...)
+	}
+	return MainDB.Query(query, args...)
+}
+
+// TxQueryRow idem TxQuery pour une seule ligne
+func TxQueryRow(tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	if tx != nil {
+		return tx.QueryRow(query, args...)
+	}
+	return MainDB.QueryRow(query, args...)
+}
+
 // TxInsert idem TxExec mais avec recup se l'id autoinc
 func TxInsert(tx *sql.Tx, query string, args ...interface{}) (int64, error) {
 	var iID sql.NullInt64
@@ -1,5 +1,14 @@
 package dal
 
+import (
+	"CmdScheduler/slog"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
 // const pour le test
 const (
 	testUsr = 9
@@ -83,7 +92,7 @@ func TestAgent(t *testing.T) {
 	//inserts
 	for i, r := range arr {
 		agt := r.dataIn.(*DbAgent)
-		err := AgentInsert(agt, testUsr)
+		err := AgentInsert(agt, testUsr, nil)
 		resB := (err == nil)
 		if resB != r.WaitedResOK {
 			t.Errorf("resultat insert ok/ko inattendu l %v (%v)", i, err)
@@ -167,7 +176,7 @@ func TestQueue(t *testing.T) {
 	//inserts
 	for i, r := range arr {
 		q := r.dataIn.(*DbQueue)
-		err := QueueInsert(q, testUsr)
+		err := QueueInsert(q, testUsr, nil)
 		resB := (err == nil)
 		if resB != r.WaitedResOK {
 			t.Errorf("resultat insert ok/ko inattendu l %v (%v)", i, err)
@@ -239,7 +248,7 @@ func TestTask(t *testing.T) {
 	//inserts
 	for i, r := range arr {
 		q := r.dataIn.(*DbTag)
-		err := TagInsert(q, testUsr)
+		err := TagInsert(q, testUsr, nil)
 		resB := (err == nil)
 		if resB != r.WaitedResOK {
 			t.Errorf("resultat insert ok/ko inattendu l %v (%v)", i, err)
@@ -318,7 +327,7 @@ func TestTag(t *testing.T) {
 	//inserts
 	for i, r := range arr {
 		q := r.dataIn.(*DbTask)
-		err := TaskInsert(q, testUsr)
+		err := TaskInsert(q, testUsr, nil)
 		resB := (err == nil)
 		if resB != r.WaitedResOK {
 			t.Errorf("resultat insert ok/ko inattendu l %v (%v)", i, err)
@@ -495,6 +504,11 @@ func TestSched(t *testing.T) {
 	}
 }
 
+*/
+
+// testDir dossier de la bdd de test
+var testDir string
+
 // TestMain main test
 func TestMain(m *testing.M) {
 	err := setup()
@@ -509,13 +523,12 @@ func TestMain(m *testing.M) {
 
 // setup tearup
 func setup() error {
-	testfile := "test_data.db"
-	os.Remove(testfile)
-	_, err := os.Stat(testfile)
-	if !os.IsNotExist(err) {
-		return fmt.Errorf("bd test no supprimable")
+	slog.InitLogs("", 0, 0, false)
+	var err error
+	if testDir, err = ioutil.TempDir("", "dal"); err != nil {
+		return err
 	}
-	err = InitDb("sqlite3", "file:"+testfile, "TESTSCHEME")
+	err = InitDb("sqlite3", "file:"+filepath.Join(testDir, "test_data.db"), "TESTSCHEME")
 	if err == nil {
 		//relance initDbTables pour chech que ça fonctionne aux dem suivants
 		err = initDbTables()
@@ -525,6 +538,5 @@ func setup() error {
 
 // shutdown teardown
 func shutdown() {
-
+	os.RemoveAll(testDir)
 }
-*/
@@ -0,0 +1,303 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GroupList liste des groupes
+func GroupList(filter SearchQuery) ([]DbGroup, PagedResponse, error) {
+	var err error
+	arr := make([]DbGroup, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `GRP GRP ` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("GroupList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT GRP.id, GRP.name, GRP.description, GRP.emails, GRP.tags
+		, USERC.login as loginC, GRP.created_at
+		, USERU.login as loginU, GRP.updated_at
+		FROM ` + tblPrefix + `GRP GRP
+		left join  ` + tblPrefix + `USR USERC on USERC.id = GRP.created_by
+		left join  ` + tblPrefix + `USR USERU on USERU.id = GRP.updated_by
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("GroupList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id          int
+		name        sql.NullString
+		description sql.NullString
+		emails      sql.NullString
+		tags        sql.NullString
+		createdAt   sql.NullTime
+		updatedAt   sql.NullTime
+		loginC      sql.NullString
+		loginU      sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &name, &description, &emails, &tags, &loginC, &createdAt, &loginU, &updatedAt)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("GroupList scan %w", err)
+		}
+		arr = append(arr, DbGroup{
+			ID:          id,
+			Name:        name.String,
+			Description: description.String,
+			Emails:      splitStrFromStr(emails.String),
+			Tags:        splitIntFromStr(tags.String),
+			Members:     make([]int, 0),
+			Info:        stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("GroupList err %w", err)
+	}
+	rows.Close()
+
+	//membres
+	for i := range arr {
+		if arr[i].Members, err = groupMembers(arr[i].ID); err != nil {
+			return nil, pagedResp, err
+		}
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// groupMembers membres d'un groupe
+func groupMembers(groupID int) ([]int, error) {
+	ret := make([]int, 0)
+	rows, err := MainDB.Query(`SELECT usr_id FROM `+tblPrefix+`GRP_USR where grp_id = ? order by usr_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("groupMembers query %w", err)
+	}
+	defer rows.Close()
+	var id int
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("groupMembers scan %w", err)
+		}
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
+
+// GroupGet get d'un groupe
+func GroupGet(id int) (DbGroup, error) {
+	var ret DbGroup
+	filter := NewSearchQueryFromID("GRP", id)
+
+	arr, _, err := GroupList(filter)
+	if err != nil {
+		return ret, err
+	}
+	if len(arr) > 0 {
+		ret = arr[0]
+	}
+	return ret, nil
+}
+
+// GroupUpdate maj groupe et de ses membres, dans une transaction propre si tx nil
+func GroupUpdate(elm DbGroup, usrUpdater int, tx *sql.Tx) error {
+	if tx == nil {
+		tx, err := MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("GroupUpdate err %w", err)
+		}
+		defer tx.Rollback()
+		if err = GroupUpdate(elm, usrUpdater, tx); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("GroupUpdate err %w", err)
+		}
+		return nil
+	}
+	q := `UPDATE ` + tblPrefix + `GRP SET
+		updated_by = ?, updated_at = ?
+		, name = ?, description = ?, emails = ?, tags = ?
+		where id = ? `
+	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Name, elm.Description, mergeStrToStr(elm.Emails),
+		mergeIntToStr(elm.Tags), elm.ID)
+	if err != nil {
+		return fmt.Errorf("GroupUpdate err %w", err)
+	}
+
+	_, err = TxExec(tx, `DELETE FROM `+tblPrefix+`GRP_USR where grp_id = ? `, elm.ID)
+	if err != nil {
+		return fmt.Errorf("GroupUpdate err %w", err)
+	}
+	for _, u := range elm.Members {
+		_, err = TxExec(tx, `INSERT INTO `+tblPrefix+`GRP_USR (grp_id, usr_id) VALUES(?,?) `, elm.ID, u)
+		if err != nil {
+			return fmt.Errorf("GroupUpdate err %w", err)
+		}
+	}
+	return nil
+}
+
+// GroupDelete suppression groupe, de ses membres et des propriétés qu'il détient
+func GroupDelete(elmID int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("GroupDelete err %w", err)
+	}
+	defer tx.Rollback()
+	for _, tbl := range []string{"TASKFLOW", "TASK", "QUEUE"} {
+		if _, err = TxExec(tx, `UPDATE `+tblPrefix+tbl+` SET owner_grp = NULL where owner_grp = ? `, elmID); err != nil {
+			return fmt.Errorf("GroupDelete err %w", err)
+		}
+	}
+	if _, err = TxExec(tx, `DELETE FROM `+tblPrefix+`GRP_USR where grp_id = ? `, elmID); err != nil {
+		return fmt.Errorf("GroupDelete err %w", err)
+	}
+	if _, err = TxExec(tx, `DELETE FROM `+tblPrefix+`GRP where id = ? `, elmID); err != nil {
+		return fmt.Errorf("GroupDelete err %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("GroupDelete err %w", err)
+	}
+	return nil
+}
+
+// GroupInsert insertion groupe
+func GroupInsert(elm *DbGroup, usrUpdater int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("GroupInsert err %w", err)
+	}
+	defer tx.Rollback()
+
+	//insert base
+	q := `INSERT INTO ` + tblPrefix + `GRP (created_by, created_at) VALUES(?,?) `
+	id, err := TxInsert(tx, q, usrUpdater, time.Now())
+	if err != nil {
+		return fmt.Errorf("GroupInsert err %w", err)
+	}
+
+	//mj pour le reste des champs
+	elm.ID = int(id)
+	err = GroupUpdate(*elm, usrUpdater, tx)
+	if err != nil {
+		return fmt.Errorf("GroupInsert err %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("GroupInsert err %w", err)
+	}
+	return nil
+}
+
+// UserGroups groupes dont l'utilisateur est membre
+func UserGroups(userID int) ([]DbGroup, error) {
+	if userID <= 0 {
+		return []DbGroup{}, nil
+	}
+	arr, _, err := GroupList(SearchQuery{
+		SQLFilter: "GRP.id in (SELECT grp_id FROM " + tblPrefix + "GRP_USR where usr_id = ?)",
+		SQLParams: []interface{}{userID},
+	})
+	return arr, err
+}
+
+// usersGroups ids des groupes des utilisateurs, par utilisateur
+func usersGroups(userIDs []int) (map[int][]int, error) {
+	ret := make(map[int][]int)
+	if len(userIDs) == 0 {
+		return ret, nil
+	}
+	in := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		in = append(in, strconv.Itoa(id))
+		ret[id] = make([]int, 0)
+	}
+	rows, err := MainDB.Query(`SELECT usr_id, grp_id FROM ` + tblPrefix + `GRP_USR where usr_id in (` + strings.Join(in, ",") + `) order by usr_id, grp_id`)
+	if err != nil {
+		return nil, fmt.Errorf("usersGroups query %w", err)
+	}
+	defer rows.Close()
+	var usrID, grpID int
+	for rows.Next() {
+		if err = rows.Scan(&usrID, &grpID); err != nil {
+			return nil, fmt.Errorf("usersGroups scan %w", err)
+		}
+		ret[usrID] = append(ret[usrID], grpID)
+	}
+	return ret, nil
+}
+
+// userGroupsUpdate remplacement des groupes d'un utilisateur
+func userGroupsUpdate(userID int, groups []int, tx *sql.Tx) error {
+	_, err := TxExec(tx, `DELETE FROM `+tblPrefix+`GRP_USR where usr_id = ? `, userID)
+	if err != nil {
+		return fmt.Errorf("userGroupsUpdate err %w", err)
+	}
+	for _, g := range groups {
+		_, err = TxExec(tx, `INSERT INTO `+tblPrefix+`GRP_USR (grp_id, usr_id) VALUES(?,?) `, g, userID)
+		if err != nil {
+			return fmt.Errorf("userGroupsUpdate err %w", err)
+		}
+	}
+	return nil
+}
+
+// TaskFlowOwnerGroup groupe propriétaire d'un taskflow parmi les groupes fournis : explicite,
+// à défaut le premier groupe détenant un de ses tags (0 : aucun)
+func TaskFlowOwnerGroup(tf DbTaskFlow, groups []DbGroup) int {
+	if tf.OwnerGroup > 0 || len(tf.Tags) == 0 {
+		return tf.OwnerGroup
+	}
+	ret := 0
+	for _, g := range groups {
+		if (ret == 0 || g.ID < ret) && intersects(g.Tags, tf.Tags) {
+			ret = g.ID
+		}
+	}
+	return ret
+}
+
+// AndOwnedBy restreint une recherche aux éléments détenus par un des groupes : propriétaire explicite,
+// ou sans propriétaire et portant un des tags des groupes (tagsField vide si non applicable)
+func (c *SearchQuery) AndOwnedBy(groups []DbGroup, ownerField string, tagsField string) {
+	if len(groups) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(groups))
+	tags := make([]int, 0)
+	for _, g := range groups {
+		ids = append(ids, strconv.Itoa(g.ID))
+		tags = append(tags, g.Tags...)
+	}
+	filter := ownerField + " in (" + strings.Join(ids, ",") + ")"
+	if tagsField != "" && len(tags) > 0 {
+		cond, params := listContainsAnyCond(tagsField, clearInts(tags))
+		filter += " OR ((" + ownerField + " is null OR " + ownerField + " = 0) AND " + cond + ")"
+		c.SQLParams = append(c.SQLParams, params...)
+	}
+	filter = "(" + filter + ")"
+	if c.SQLFilter != "" {
+		filter = "(" + c.SQLFilter + ") AND " + filter
+	}
+	c.SQLFilter = filter
+}
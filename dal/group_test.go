@@ -0,0 +1,61 @@
+package dal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAndOwnedBy(t *testing.T) {
+	groups := []DbGroup{{ID: 2, Tags: []int{5}}, {ID: 7, Tags: []int{5, 6}}}
+	c := SearchQuery{SQLFilter: "TASKFLOW.lib like ?", SQLParams: []interface{}{"a%"}}
+	c.AndOwnedBy(groups, "TASKFLOW.owner_grp", "TASKFLOW.tags")
+	if !strings.HasPrefix(c.SQLFilter, "(TASKFLOW.lib like ?) AND (TASKFLOW.owner_grp in (2,7) OR ((TASKFLOW.owner_grp is null") || len(c.SQLParams) != 9 {
+		t.Errorf("filter %v %v", c.SQLFilter, c.SQLParams)
+	}
+
+	//sans tags : propriétaire seul
+	c = SearchQuery{}
+	c.AndOwnedBy(groups, "QUEUE.owner_grp", "")
+	if c.SQLFilter != "(QUEUE.owner_grp in (2,7))" || len(c.SQLParams) != 0 {
+		t.Errorf("owner only %v", c.SQLFilter)
+	}
+
+	//aucun groupe : pas de restriction
+	c = SearchQuery{}
+	c.AndOwnedBy(nil, "QUEUE.owner_grp", "")
+	if c.SQLFilter != "" {
+		t.Errorf("no group %v", c.SQLFilter)
+	}
+}
+
+// TestTaskFlowOwnerGroup propriétaire explicite, à défaut le plus petit groupe détenant un tag
+func TestTaskFlowOwnerGroup(t *testing.T) {
+	g1 := DbGroup{Name: "owner1", Tags: []int{901}}
+	g2 := DbGroup{Name: "owner2", Tags: []int{901, 902}}
+	for _, g := range []*DbGroup{&g1, &g2} {
+		if err := GroupInsert(g, testUsr); err != nil {
+			t.Fatal(err)
+		}
+		defer GroupDelete(g.ID)
+	}
+	groups, _, err := GroupList(SearchQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		tf   DbTaskFlow
+		want int
+	}{
+		{DbTaskFlow{OwnerGroup: g2.ID, Tags: []int{901}}, g2.ID},
+		{DbTaskFlow{Tags: []int{902}}, g2.ID},
+		{DbTaskFlow{Tags: []int{901}}, g1.ID},
+		{DbTaskFlow{Tags: []int{903}}, 0},
+		{DbTaskFlow{}, 0},
+	}
+	for _, c := range cases {
+		if got := TaskFlowOwnerGroup(c.tf, groups); got != c.want {
+			t.Errorf("%+v : %v, want %v", c.tf, got, c.want)
+		}
+	}
+}
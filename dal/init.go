@@ -38,7 +38,12 @@ func InitDb(driver string, datasource string, prefix string) error {
 	if strings.EqualFold(dbDriver, "sqlite3") {
 		MainDB.SetMaxOpenConns(1)
 	}
-	return initDbTables()
+	err = initDbTables()
+	if err != nil {
+		return err
+	}
+	//données sensibles encore en clair (clé de chiffrement nouvellement paramétrée)
+	return encryptClearSecrets()
 }
 
 // updDbVersion init/set table version
@@ -103,12 +108,14 @@ func initDbTables() error {
 	}
 
 	dttype := "datetime"
+	texttype := "TEXT"
 	autoinc := "INTEGER NOT NULL IDENTITY"
 	if strings.EqualFold(dbDriver, "sqlite3") {
 		autoinc = "INTEGER PRIMARY KEY"
 	}
 	if strings.EqualFold(dbDriver, "mssql") {
 		dttype = "datetime2"
+		texttype = "VARCHAR(MAX)"
 	}
 
 	// note : protection des nom de colonne non portable `` pour mysql, [] pour mssql
@@ -142,20 +149,6 @@ func initDbTables() error {
 		return fmt.Errorf("initDbTables %v %w", iv, err)
 	}
 
-	// 1ere init, on insere un user admin par defaut
-	usr, _, _ := UserList(SearchQuery{
-		Limit: 1,
-	})
-	if len(usr) == 0 {
-		UserInsert(&DbUser{
-			Name:       "Admin",
-			Login:      "admin",
-			RightLevel: RightLvlAdmin,
-			Password:   "admin",
-			Deleted:    false,
-		}, 1)
-	}
-
 	// agents d'exec
 	sql = `CREATE TABLE ` + tblPrefix + `AGENT (
 		id ` + autoinc + `,
@@ -314,6 +307,271 @@ func initDbTables() error {
 		return fmt.Errorf("initDbTables %v %w", iv, err)
 	}
 
+	//CA spécifique à un agent (validation certificat agent)
+	sql = `ALTER TABLE ` + tblPrefix + `AGENT ADD ca_bundle VARCHAR(8000)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//coffre des secrets utilisés dans les arguments des taches
+	sql = `CREATE TABLE ` + tblPrefix + `SECRET (
+		id ` + autoinc + `,
+		name VARCHAR(100),
+		value VARCHAR(1000),
+		created_at ` + dttype + `, created_by int,
+		updated_at ` + dttype + `, updated_by int
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `CREATE UNIQUE INDEX IDX_SECRET_NAME ON ` + tblPrefix + `SECRET (name)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//canaux de notification et régles d'abonnement
+	sql = `CREATE TABLE ` + tblPrefix + `NOTIFICATION (
+		id ` + autoinc + `,
+		lib VARCHAR(100),
+		type VARCHAR(20),
+		activ int,
+		url VARCHAR(1000),
+		headers VARCHAR(4000),
+		payload VARCHAR(8000),
+		hmac_key VARCHAR(500),
+		created_at ` + dttype + `, created_by int,
+		updated_at ` + dttype + `, updated_by int
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `CREATE TABLE ` + tblPrefix + `NOTIFRULE (
+		notificationid int, idx int,
+		taskflowid int,
+		tagid int,
+		queueid int,
+		events VARCHAR(200),
+		long_running int,
+		primary key(notificationid, idx)
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//destinataires des mails d'échec
+	sql = `ALTER TABLE ` + tblPrefix + `TASKFLOW ADD emails VARCHAR(2000)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `ALTER TABLE ` + tblPrefix + `TAG ADD emails VARCHAR(2000)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//sla des taskflows et historique des dépassements
+	sql = `ALTER TABLE ` + tblPrefix + `TASKFLOW ADD sla_start_delay int`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `ALTER TABLE ` + tblPrefix + `TASKFLOW ADD sla_max_duration int`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `ALTER TABLE ` + tblPrefix + `TASKFLOW ADD sla_finish_by VARCHAR(5)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `CREATE TABLE ` + tblPrefix + `SLABREACH (
+		id ` + autoinc + `,
+		taskflowid int,
+		run_id VARCHAR(50),
+		kind VARCHAR(20),
+		dt_ref ` + dttype + `,
+		detected_at ` + dttype + `,
+		info VARCHAR(500)
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//audit des modifications
+	sql = `CREATE TABLE ` + tblPrefix + `AUDIT (
+		id ` + autoinc + `,
+		created_at ` + dttype + `,
+		usr_id int,
+		login VARCHAR(100),
+		entity VARCHAR(20),
+		entity_id VARCHAR(100),
+		action VARCHAR(20),
+		diff ` + texttype + `
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//versions des taskflows et historique des exec
+	sql = `ALTER TABLE ` + tblPrefix + `TASKFLOW ADD version int`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `CREATE TABLE ` + tblPrefix + `TFVERSION (
+		taskflowid int, version int,
+		definition ` + texttype + `,
+		created_at ` + dttype + `, created_by int,
+		primary key(taskflowid, version)
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `CREATE TABLE ` + tblPrefix + `TFRUN (
+		id ` + autoinc + `,
+		run_id VARCHAR(50),
+		taskflowid int,
+		version int,
+		launch_source VARCHAR(200),
+		dt_ref ` + dttype + `,
+		start_at ` + dttype + `,
+		stop_at ` + dttype + `,
+		result int,
+		msg ` + texttype + `
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//entités gérées par la synchro gitops (lecture seule via l'api)
+	sql = `CREATE TABLE ` + tblPrefix + `MANAGED (
+		entity VARCHAR(20), name VARCHAR(200),
+		entity_id int, source VARCHAR(300),
+		primary key(entity, name)
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//tokens d'api longue durée (comptes de service), seul le hash du token est conservé
+	sql = `CREATE TABLE ` + tblPrefix + `APITOKEN (
+		id ` + autoinc + `,
+		name VARCHAR(100),
+		usr_id int,
+		token_hash VARCHAR(64),
+		prefix VARCHAR(20),
+		rightlevel int,
+		tags VARCHAR(200),
+		expires_at ` + dttype + `,
+		last_used_at ` + dttype + `,
+		created_at ` + dttype + `, created_by int
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//sessions persistées (store "db"), id : hash du token
+	sql = `CREATE TABLE ` + tblPrefix + `SESSION (
+		id VARCHAR(64),
+		usr_id int,
+		login VARCHAR(100),
+		rightlevel int,
+		created_at ` + dttype + `,
+		last_activity ` + dttype + `,
+		primary key(id)
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//origine des comptes : local, ou fournisseur d'authentification ayant provisionné le compte (ldap...)
+	sql = `ALTER TABLE ` + tblPrefix + `USR ADD auth_source VARCHAR(20)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//rôles : permissions "ressource:action", restreintes à des tags / queues
+	sql = `CREATE TABLE ` + tblPrefix + `ROLE (
+		id ` + autoinc + `,
+		name VARCHAR(100),
+		description VARCHAR(500),
+		permissions VARCHAR(2000),
+		tags VARCHAR(500),
+		queues VARCHAR(500),
+		created_at ` + dttype + `, created_by int,
+		updated_at ` + dttype + `, updated_by int
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `CREATE TABLE ` + tblPrefix + `USER_ROLE (
+		usr_id int NOT NULL,
+		role_id int NOT NULL,
+		PRIMARY KEY (usr_id, role_id)
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	//groupes (équipes) propriétaires de taskflows, taches et queues
+	sql = `CREATE TABLE ` + tblPrefix + `GRP (
+		id ` + autoinc + `,
+		name VARCHAR(100),
+		description VARCHAR(500),
+		emails VARCHAR(2000),
+		tags VARCHAR(500),
+		created_at ` + dttype + `, created_by int,
+		updated_at ` + dttype + `, updated_by int
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	sql = `CREATE TABLE ` + tblPrefix + `GRP_USR (
+		grp_id int NOT NULL,
+		usr_id int NOT NULL,
+		PRIMARY KEY (grp_id, usr_id)
+		)`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	for _, tbl := range []string{"TASKFLOW", "TASK", "QUEUE"} {
+		sql = `ALTER TABLE ` + tblPrefix + tbl + ` ADD owner_grp int`
+		if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+			return fmt.Errorf("initDbTables %v %w", iv, err)
+		}
+	}
+
+	sql = `ALTER TABLE ` + tblPrefix + `NOTIFRULE ADD grp_id int`
+	if iv, err = (iv + 1), versionedDML(iv, &curVersion, sql); err != nil {
+		return fmt.Errorf("initDbTables %v %w", iv, err)
+	}
+
+	// 1ere init (schéma à jour), on insere un user admin par defaut
+	usr, _, _ := UserList(SearchQuery{
+		Limit: 1,
+	})
+	if len(usr) == 0 {
+		UserInsert(&DbUser{
+			Name:       "Admin",
+			Login:      "admin",
+			RightLevel: RightLvlAdmin,
+			Password:   "admin",
+			Deleted:    false,
+		}, 1)
+	}
+
+	//taskflows antérieurs à l'historisation des versions : version 1
+	if err = taskFlowVersionBackfill(); err != nil {
+		return fmt.Errorf("initDbTables %w", err)
+	}
+
 	//tache en cours
 	sql = `CREATE TABLE ` + tblPrefix + `WIP (
 		id INTEGER PRIMARY KEY,
@@ -0,0 +1,394 @@
+package dal
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversion de planifs externes (crontab, taches planifiées windows) en bundle
+// les constructions non reprises sont listées dans un rapport, jamais ignorées en silence
+
+// LegacyImportOpt options de conversion
+type LegacyImportOpt struct {
+	Agent    string // host de l'agent d'exécution des taches (requis)
+	Queue    string // queue des taskflows générés (optionnelle)
+	Prefix   string // préfixe des libellés générés
+	Activ    bool   // taskflows actifs dés l'import
+	TimeZone string // tz des planifs, locale à défaut
+	System   bool   // crontab systéme (/etc/crontab) : champ utilisateur aprés la planif
+}
+
+// LegacyUnsupported construction non reprise ou reprise par approximation
+type LegacyUnsupported struct {
+	Source    string `json:"source"` // ligne ou tache d'origine
+	Construct string `json:"construct"`
+	Detail    string `json:"detail"`
+	Skipped   bool   `json:"skipped"` // élément ignoré, à défaut importé avec approximation
+}
+
+// legacyLibMax longueur max des libellés (lib VARCHAR(100))
+const legacyLibMax = 100
+
+// legacyMaxHours nombre max d'heures d'exec fixes d'un détail (hours varchar(500))
+const legacyMaxHours = 48
+
+// legacyLib libellé préfixé et tronqué
+func legacyLib(prefix, name string) string {
+	lib := strings.TrimSpace(strings.TrimSpace(prefix) + " " + strings.TrimSpace(name))
+	if r := []rune(lib); len(r) > legacyLibMax {
+		lib = string(r[:legacyLibMax])
+	}
+	return lib
+}
+
+// legacyJob ajout au bundle d'un taskflow enchainant les taches, planifié par sched si détail
+func legacyJob(b *Bundle, opt LegacyImportOpt, lib string, sched []BundleSchedDetail, tasks []BundleTask, emails []string) {
+	tf := BundleTaskFlow{
+		Lib:          lib,
+		Activ:        opt.Activ,
+		ManualLaunch: true,
+		Queue:        opt.Queue,
+		Emails:       emails,
+		Detail:       make([]BundleTaskFlowDetail, 0),
+	}
+	if len(sched) > 0 {
+		b.Schedules = append(b.Schedules, BundleSched{Lib: lib, TimeZone: opt.TimeZone, Detail: sched})
+		tf.Schedule = lib
+	}
+	for i, t := range tasks {
+		if len(tasks) > 1 {
+			t.Lib = legacyLib("", fmt.Sprintf("%v #%v", lib, i+1))
+		} else {
+			t.Lib = lib
+		}
+		t.Type = "CmdTask"
+		if opt.Agent != "" {
+			t.ExecOn = []string{opt.Agent}
+		}
+		b.Tasks = append(b.Tasks, t)
+		//enchainement séquentiel, arret au 1er échec
+		next := i + 2
+		if i == len(tasks)-1 {
+			next = 0
+		}
+		tf.Detail = append(tf.Detail, BundleTaskFlowDetail{Task: t.Lib, NextTaskIDOK: next, NextTaskIDFail: -1})
+	}
+	b.TaskFlows = append(b.TaskFlows, tf)
+}
+
+// legacyWeekDays format LMMJVSD depuis les jours (0=lundi), "*" si tous
+func legacyWeekDays(days [7]bool) string {
+	s := ""
+	for _, d := range days {
+		if d {
+			s += "1"
+		} else {
+			s += "0"
+		}
+	}
+	if s == "1111111" {
+		return "*"
+	}
+	return s
+}
+
+// legacyMonths format JFMAMJJASOND depuis les mois (0=janvier), "*" si tous
+func legacyMonths(months [12]bool) string {
+	s := ""
+	for _, m := range months {
+		if m {
+			s += "1"
+		} else {
+			s += "0"
+		}
+	}
+	if s == "111111111111" {
+		return "*"
+	}
+	return s
+}
+
+// legacyIntervalHours plages horaires couvrant les heures données, à partir de la minute min
+// heures consécutives regroupées : 08:05:00-10:59:59
+func legacyIntervalHours(hours []int, min int) string {
+	ranges := make([]string, 0)
+	for i := 0; i < len(hours); {
+		j := i
+		for j+1 < len(hours) && hours[j+1] == hours[j]+1 {
+			j++
+		}
+		ranges = append(ranges, fmt.Sprintf("%02d:%02d:00-%02d:59:59", hours[i], min, hours[j]))
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// rexpCronEnv affectation de variable d'environnement dans une crontab
+var rexpCronEnv = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(.*)$`)
+
+// cronSpecials raccourcis de planif
+var cronSpecials = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}
+var cronDayNames = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+
+// cronField valeurs d'un champ de planif (listes, plages, pas, noms)
+func cronField(field string, min, max int, names map[string]int) ([]int, error) {
+	set := make(map[int]bool)
+	value := func(s string) (int, error) {
+		if v, ok := names[strings.ToUpper(s)]; ok {
+			return v, nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < min || v > max {
+			return 0, fmt.Errorf("invalid value %v", s)
+		}
+		return v, nil
+	}
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %v", part)
+			}
+		}
+		from, to := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if from, err = value(bounds[0]); err != nil {
+				return nil, err
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = value(bounds[1]); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				to = max //n/pas : de n à la fin
+			}
+			if to < from {
+				return nil, fmt.Errorf("invalid range %v", rng)
+			}
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	ret := make([]int, 0, len(set))
+	for v := range set {
+		ret = append(ret, v)
+	}
+	sort.Ints(ret)
+	return ret, nil
+}
+
+// cronToSched conversion d'une planif cron (5 champs) en détails de planif
+func cronToSched(fields []string) ([]BundleSchedDetail, error) {
+	mins, err := cronField(fields[0], 0, 59, nil)
+	if err != nil {
+		return nil, fmt.Errorf("minute : %v", err)
+	}
+	hours, err := cronField(fields[1], 0, 23, nil)
+	if err != nil {
+		return nil, fmt.Errorf("hour : %v", err)
+	}
+	mdays, err := cronField(fields[2], 1, 31, nil)
+	if err != nil {
+		return nil, fmt.Errorf("day of month : %v", err)
+	}
+	months, err := cronField(fields[3], 1, 12, cronMonthNames)
+	if err != nil {
+		return nil, fmt.Errorf("month : %v", err)
+	}
+	wdays, err := cronField(fields[4], 0, 7, cronDayNames)
+	if err != nil {
+		return nil, fmt.Errorf("day of week : %v", err)
+	}
+
+	var base BundleSchedDetail
+	if len(mins)*len(hours) <= legacyMaxHours {
+		//heures fixes
+		lst := make([]string, 0)
+		for _, h := range hours {
+			for _, m := range mins {
+				lst = append(lst, fmt.Sprintf("%02d:%02d:00", h, m))
+			}
+		}
+		base.Hours = strings.Join(lst, ",")
+	} else {
+		//intervalle : minutes régulières sur toute l'heure
+		step := 60
+		if len(mins) > 1 {
+			step = mins[1] - mins[0]
+		}
+		for i := range mins {
+			if 60%step != 0 || mins[i] != mins[0]+i*step || len(mins) != 60/step {
+				return nil, fmt.Errorf("too many execution times (%v), minutes not evenly spaced", len(mins)*len(hours))
+			}
+		}
+		base.Interval = step * 60
+		if len(hours) < 24 || mins[0] > 0 {
+			base.IntervalHours = legacyIntervalHours(hours, mins[0])
+		}
+	}
+
+	var m [12]bool
+	for _, v := range months {
+		m[v-1] = true
+	}
+	base.Months = legacyMonths(m)
+	var wd [7]bool
+	for _, v := range wdays {
+		wd[(v+6)%7] = true //0 et 7 : dimanche
+	}
+	weekDays := legacyWeekDays(wd)
+	monthDays := "*"
+	if len(mdays) < 31 {
+		strs := make([]string, len(mdays))
+		for i, v := range mdays {
+			strs[i] = strconv.Itoa(v)
+		}
+		monthDays = strings.Join(strs, ",")
+	}
+
+	//jour du mois et jour de semaine restreints : cron lance si l'un ou l'autre correspond
+	if weekDays != "*" && monthDays != "*" {
+		d1, d2 := base, base
+		d1.WeekDays, d1.MonthDays = "*", monthDays
+		d2.WeekDays, d2.MonthDays = weekDays, "*"
+		return []BundleSchedDetail{d1, d2}, nil
+	}
+	base.WeekDays, base.MonthDays = weekDays, monthDays
+	return []BundleSchedDetail{base}, nil
+}
+
+// cronCmd tache depuis une commande crontab : commande simple découpée, via sh -c à défaut
+func cronCmd(cmd string) BundleTask {
+	if strings.ContainsAny(cmd, "|&;<>$`()*?[]{}~'\"\\#=") {
+		return BundleTask{Cmd: "/bin/sh", Args: []string{"-c", cmd}}
+	}
+	f := strings.Fields(cmd)
+	return BundleTask{Cmd: f[0], Args: emptyStrsNil(f[1:])}
+}
+
+// cronSkipFields reste de la ligne aprés n champs
+func cronSkipFields(line string, n int) string {
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeft(line, " \t")
+		if j := strings.IndexAny(line, " \t"); j >= 0 {
+			line = line[j:]
+		} else {
+			line = ""
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+// CrontabToBundle conversion d'une crontab : un taskflow, une tache et une planif par ligne
+// libellés : <préfixe> <n° de ligne> <commande>
+func CrontabToBundle(src string, opt LegacyImportOpt) (Bundle, []LegacyUnsupported) {
+	b := Bundle{Version: BundleFormatVersion}
+	report := make([]LegacyUnsupported, 0)
+	if opt.Prefix == "" {
+		opt.Prefix = "cron"
+	}
+	var emails []string
+	for n, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		source := fmt.Sprintf("line %v", n+1)
+		unsupported := func(construct, detail string, skipped bool) {
+			report = append(report, LegacyUnsupported{Source: source, Construct: construct, Detail: detail, Skipped: skipped})
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		//variables d'environnement
+		if m := rexpCronEnv.FindStringSubmatch(line); m != nil {
+			val := strings.Trim(strings.TrimSpace(m[2]), `"'`)
+			switch m[1] {
+			case "CRON_TZ", "TZ":
+				if _, err := time.LoadLocation(val); err != nil {
+					unsupported(m[1], "unknown time zone "+val, true)
+				} else {
+					opt.TimeZone = val
+				}
+			case "MAILTO":
+				emails = nil
+				if val != "" {
+					emails, _ = checkEmails(strings.Split(val, ","))
+					unsupported(m[1], "mails are only sent on failure", false)
+				}
+			default:
+				unsupported(m[1], "environment variable not applied, set it on the agent", true)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		var spec []string
+		nSpec := 5
+		if strings.HasPrefix(fields[0], "@") {
+			exp, ok := cronSpecials[strings.ToLower(fields[0])]
+			if !ok {
+				unsupported(fields[0], "no equivalent schedule", true)
+				continue
+			}
+			spec, nSpec = strings.Fields(exp), 1
+		} else if len(fields) > 5 {
+			spec = fields[:5]
+		} else {
+			unsupported("syntax", "invalid line", true)
+			continue
+		}
+		user := ""
+		if opt.System && len(fields) > nSpec {
+			user = fields[nSpec]
+			nSpec++
+		}
+		if len(fields) <= nSpec {
+			unsupported("syntax", "missing command", true)
+			continue
+		}
+		//reprise de la commande telle quelle (espaces inclus)
+		cmd := cronSkipFields(line, nSpec)
+		if strings.Contains(strings.ReplaceAll(cmd, `\%`, ""), "%") {
+			unsupported("%", "standard input in command not supported", true)
+			continue
+		}
+		cmd = strings.ReplaceAll(cmd, `\%`, "%")
+
+		sched, err := cronToSched(spec)
+		if err != nil {
+			unsupported(strings.Join(spec, " "), err.Error(), true)
+			continue
+		}
+		if user != "" {
+			unsupported("user", "runs as the agent user instead of "+user, false)
+		}
+		task := cronCmd(cmd)
+		lib := legacyLib(opt.Prefix, fmt.Sprintf("%v %v", n+1, path.Base(task.Cmd)))
+		if task.Cmd == "/bin/sh" {
+			lib = legacyLib(opt.Prefix, fmt.Sprintf("%v %v", n+1, cmd))
+		}
+		legacyJob(&b, opt, lib, sched, []BundleTask{task}, emails)
+	}
+	return b, report
+}
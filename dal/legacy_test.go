@@ -0,0 +1,139 @@
+package dal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestCronToSched(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []BundleSchedDetail
+	}{
+		{"30 8,12 * * 1-5", []BundleSchedDetail{{Hours: "08:30:00,12:30:00", Months: "*", WeekDays: "1111100", MonthDays: "*"}}},
+		{"*/15 * * * *", []BundleSchedDetail{{Interval: 900, Months: "*", WeekDays: "*", MonthDays: "*"}}},
+		{"5-59/10 8-17,20 * jan,jul sun", []BundleSchedDetail{{Interval: 600, IntervalHours: "08:05:00-17:59:59,20:05:00-20:59:59",
+			Months: "100000100000", WeekDays: "0000001", MonthDays: "*"}}},
+		//jour du mois ou jour de semaine
+		{"0 0 1,15 * 6", []BundleSchedDetail{
+			{Hours: "00:00:00", Months: "*", WeekDays: "*", MonthDays: "1,15"},
+			{Hours: "00:00:00", Months: "*", WeekDays: "0000010", MonthDays: "*"}}},
+	}
+	for _, tt := range tests {
+		got, err := cronToSched(strings.Fields(tt.spec))
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v : %+v %v", tt.spec, got, err)
+		}
+	}
+	for _, spec := range []string{"1-59 * * * *", "61 * * * *", "* * * 13 *"} {
+		if _, err := cronToSched(strings.Fields(spec)); err == nil {
+			t.Errorf("%v : no error", spec)
+		}
+	}
+}
+
+func TestCrontabToBundle(t *testing.T) {
+	src := `# sauvegardes
+MAILTO=ops@example.com
+CRON_TZ=Europe/Paris
+PATH=/usr/bin
+0 2 * * * root /opt/backup.sh --full
+@hourly root cd /tmp && ./clean.sh > /dev/null 2>&1
+@reboot root /opt/start.sh
+0 1 * * * root echo 50% done
+`
+	b, report := CrontabToBundle(src, LegacyImportOpt{Agent: "srv1", System: true})
+	if len(b.TaskFlows) != 2 || len(b.Tasks) != 2 || len(b.Schedules) != 2 {
+		t.Fatalf("bundle %+v", b)
+	}
+	task := b.Tasks[0]
+	if task.Lib != "cron 5 backup.sh" || task.Cmd != "/opt/backup.sh" || !reflect.DeepEqual(task.Args, []string{"--full"}) ||
+		!reflect.DeepEqual(task.ExecOn, []string{"srv1"}) || task.Type != "CmdTask" {
+		t.Errorf("task %+v", task)
+	}
+	if b.Tasks[1].Cmd != "/bin/sh" || b.Tasks[1].Args[1] != "cd /tmp && ./clean.sh > /dev/null 2>&1" {
+		t.Errorf("shell task %+v", b.Tasks[1])
+	}
+	tf := b.TaskFlows[0]
+	if tf.Schedule != task.Lib || tf.Activ || len(tf.Detail) != 1 || tf.Detail[0].Task != task.Lib ||
+		!reflect.DeepEqual(tf.Emails, []string{"ops@example.com"}) {
+		t.Errorf("taskflow %+v", tf)
+	}
+	if b.Schedules[0].TimeZone != "Europe/Paris" || b.Schedules[0].Detail[0].Hours != "02:00:00" {
+		t.Errorf("sched %+v", b.Schedules[0])
+	}
+
+	//MAILTO, PATH, user x2 (lignes importées), @reboot, %
+	skipped := map[string]bool{}
+	for _, e := range report {
+		skipped[e.Construct] = e.Skipped
+	}
+	if len(report) != 6 || !skipped["PATH"] || !skipped["@reboot"] || !skipped["%"] || skipped["user"] || skipped["MAILTO"] {
+		t.Errorf("report %+v", report)
+	}
+}
+
+const schTaskTest = `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo><URI>\Compta\Export</URI></RegistrationInfo>
+  <Triggers>
+    <CalendarTrigger>
+      <StartBoundary>2020-01-06T08:00:00</StartBoundary>
+      <Repetition><Interval>PT30M</Interval><Duration>PT10H</Duration></Repetition>
+      <ScheduleByWeek><WeeksInterval>1</WeeksInterval><DaysOfWeek><Monday /><Friday /></DaysOfWeek></ScheduleByWeek>
+    </CalendarTrigger>
+    <CalendarTrigger>
+      <StartBoundary>2020-01-01T23:00:00</StartBoundary>
+      <ScheduleByMonth><DaysOfMonth><Day>1</Day><Day>Last</Day></DaysOfMonth><Months><March /></Months></ScheduleByMonth>
+    </CalendarTrigger>
+    <LogonTrigger><Enabled>true</Enabled></LogonTrigger>
+  </Triggers>
+  <Settings><Enabled>true</Enabled><ExecutionTimeLimit>PT1H</ExecutionTimeLimit></Settings>
+  <Actions Context="Author">
+    <Exec><Command>"C:\Program Files\export.exe"</Command><Arguments>-o "C:\out dir" -v</Arguments><WorkingDirectory>C:\work</WorkingDirectory></Exec>
+    <Exec><Command>cleanup.bat</Command></Exec>
+    <SendEmail />
+  </Actions>
+</Task>`
+
+func TestSchTasksToBundle(t *testing.T) {
+	//export windows : utf-16 avec bom
+	u := utf16.Encode([]rune(schTaskTest))
+	data := []byte{0xFF, 0xFE}
+	for _, r := range u {
+		data = append(data, byte(r), byte(r>>8))
+	}
+
+	b, report, err := SchTasksToBundle("", data, LegacyImportOpt{Agent: "win1", Prefix: "win", Activ: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.TaskFlows) != 1 || len(b.Tasks) != 2 || len(b.Schedules) != 1 {
+		t.Fatalf("bundle %+v", b)
+	}
+	want := BundleTask{Lib: "win Export #1", Type: "CmdTask", Timeout: 3600000, Cmd: `C:\Program Files\export.exe`,
+		Args: []string{"-o", `C:\out dir`, "-v"}, StartIn: `C:\work`, ExecOn: []string{"win1"}}
+	if !reflect.DeepEqual(b.Tasks[0], want) {
+		t.Errorf("task %+v", b.Tasks[0])
+	}
+	tf := b.TaskFlows[0]
+	if tf.Lib != "win Export" || !tf.Activ || len(tf.Detail) != 2 || tf.Detail[0].NextTaskIDOK != 2 || tf.Detail[1].NextTaskIDOK != 0 {
+		t.Errorf("taskflow %+v", tf)
+	}
+	wantSched := []BundleSchedDetail{
+		{Interval: 1800, IntervalHours: "08:00:00-18:00:00", Months: "*", WeekDays: "1000100", MonthDays: "*"},
+		{Hours: "23:00:00", Months: "001000000000", WeekDays: "*", MonthDays: "1,LAST"},
+	}
+	if !reflect.DeepEqual(b.Schedules[0].Detail, wantSched) {
+		t.Errorf("sched %+v", b.Schedules[0].Detail)
+	}
+	if len(report) != 2 || report[0].Construct != "LogonTrigger" || report[1].Construct != "SendEmail" {
+		t.Errorf("report %+v", report)
+	}
+
+	if _, _, err := SchTasksToBundle("x", []byte("<Task"), LegacyImportOpt{}); err == nil {
+		t.Errorf("invalid xml accepted")
+	}
+}
@@ -0,0 +1,139 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Entités gérées par la synchro gitops : définies par fichier, elles ne sont
+// modifiables que par la synchro
+
+// ManagedList liste des entités gérées
+func ManagedList(filter SearchQuery) ([]DbManaged, PagedResponse, error) {
+	var err error
+	arr := make([]DbManaged, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `MANAGED MANAGED ` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("ManagedList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT MANAGED.entity, MANAGED.name, MANAGED.entity_id, MANAGED.source
+		FROM ` + tblPrefix + `MANAGED MANAGED ` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("ManagedList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		entity   string
+		name     string
+		entityID sql.NullInt64
+		source   sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&entity, &name, &entityID, &source)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("ManagedList scan %w", err)
+		}
+		arr = append(arr, DbManaged{
+			Entity:   entity,
+			Name:     name,
+			EntityID: int(entityID.Int64),
+			Source:   source.String,
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("ManagedList err %w", err)
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// ManagedGet entité gérée par son id, Entity vide si non gérée
+func ManagedGet(entity string, id int) (DbManaged, error) {
+	var ret DbManaged
+	filter := SearchQuery{
+		Limit:     1,
+		SQLFilter: "MANAGED.entity = ? AND MANAGED.entity_id = ?",
+		SQLParams: []interface{}{entity, id},
+	}
+	arr, _, err := ManagedList(filter)
+	if err != nil {
+		return ret, err
+	}
+	if len(arr) > 0 {
+		ret = arr[0]
+	}
+	return ret, nil
+}
+
+// ManagedKeys entités gérées par clé entity/name
+func ManagedKeys() (map[string]bool, error) {
+	arr, _, err := ManagedList(SearchQuery{})
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool)
+	for _, e := range arr {
+		ret[e.Entity+"/"+e.Name] = true
+	}
+	return ret, nil
+}
+
+// managedReplace remplacement des entités gérées par celles du bundle, dans la transaction d'import
+// ids : id en base par entity puis name
+func managedReplace(tx *sql.Tx, b *Bundle, src *BundleSources, ids map[string]map[string]int) error {
+	arr := make([]DbManaged, 0)
+	add := func(entity, name string, sources []string, i int) {
+		source := ""
+		if i < len(sources) {
+			source = sources[i]
+		}
+		arr = append(arr, DbManaged{Entity: entity, Name: name, EntityID: ids[entity][name], Source: source})
+	}
+	for i, e := range b.Agents {
+		add("AGENT", e.Host, src.Agents, i)
+	}
+	for i, e := range b.Tags {
+		add("TAGS", BundleTagName(e.Group, e.Lib), src.Tags, i)
+	}
+	for i, e := range b.Schedules {
+		add("SCHED", e.Lib, src.Schedules, i)
+	}
+	for i, e := range b.Queues {
+		add("QUEUE", e.Lib, src.Queues, i)
+	}
+	for i, e := range b.Tasks {
+		add("TASK", e.Lib, src.Tasks, i)
+	}
+	for i, e := range b.TaskFlows {
+		add("TASKFLOW", e.Lib, src.TaskFlows, i)
+	}
+
+	_, err := TxExec(tx, `DELETE FROM `+tblPrefix+`MANAGED`)
+	if err != nil {
+		return fmt.Errorf("managedReplace err %w", err)
+	}
+	q := `INSERT INTO ` + tblPrefix + `MANAGED (entity, name, entity_id, source) VALUES(?,?,?,?) `
+	for _, e := range arr {
+		_, err = TxExec(tx, q, e.Entity, e.Name, e.EntityID, e.Source)
+		if err != nil {
+			return fmt.Errorf("managedReplace err %w", err)
+		}
+	}
+	return nil
+}
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -27,6 +30,8 @@ type DbUser struct {
 	Password     string `json:"password,omitempty"`
 	PasswordHash string `json:"-"` //non publié, usage interne auth
 	Deleted      bool   `json:"deleted" apiuse:"search,sort" dbfield:"USR.deleted_at"`
+	Source       string `json:"source" apiuse:"search,sort" dbfield:"USR.auth_source"` // vide : compte local, sinon fournisseur d'authentification (ldap...)
+	Groups       []int  `json:"groups"`                                                // groupes dont l'user est membre, absent en maj : inchangés
 	Info         string `json:"info"`
 }
 
@@ -92,6 +97,9 @@ func (c *DbUser) Validate(Create bool) error {
 	if strings.TrimSpace(c.Name) == "" {
 		return fmt.Errorf("invalid name")
 	}
+	if c.Groups != nil {
+		c.Groups = clearInts(c.Groups)
+	}
 	return nil
 }
 
@@ -100,12 +108,14 @@ type DbAgent struct {
 	ID                 int    `json:"id" apiuse:"search,sort" dbfield:"AGENT.id"`
 	Host               string `json:"host" apiuse:"search,sort" dbfield:"AGENT.host"` // format http(s)://ip::port
 	APIKey             string `json:"apikey" dbfield:"AGENT.apikey"`
-	CertSignAllowed    string `json:"certsign" apiuse:"search,sort" dbfield:"AGENT.certsignallowed"` // signature de certificat autorisé (cert non valide car autosigné)
+	CertSignAllowed    string `json:"certsign" apiuse:"search,sort" dbfield:"AGENT.certsignallowed"` // signature de certificat autorisé (cert non valide car autosigné), ou hash SPKI "sha256/<base64>"
+	CABundle           string `json:"ca_bundle" dbfield:"AGENT.ca_bundle"`                           // CA (PEM) validant le certificat de l'agent, à defaut CA système
 	CertSignEval       string `json:"certsigneval"`                                                  // signature de certificat constaté en eval
 	Tls                bool   `json:"tls"`                                                           //info calculé selon host
 	EvalResultAccessOK bool   `json:"evalresultaccess"`                                              //info res eval du host
 	EvalResultAuthOK   bool   `json:"evalresultauth"`                                                //info res eval du host
 	EvalResultCertOK   bool   `json:"evalresultcert"`                                                //info res eval du host
+	EvalResultClientOK bool   `json:"evalresultclientcert"`                                          //info res eval du host : certificat client accepté par l'agent
 	EvalResultInfo     string `json:"evalresultinfo"`                                                //info res eval du host
 	Info               string `json:"info"`
 	Deleted            bool   `json:"deleted" apiuse:"search,sort" dbfield:"AGENT.deleted_at"`
@@ -128,6 +138,18 @@ func (c *DbAgent) Validate(Create bool) error {
 	if strings.TrimSpace(c.APIKey) == "" {
 		return fmt.Errorf("invalid APIKey")
 	}
+	if len(c.APIKey) > 150 { //stockée chiffrée en base64 dans 260 car.
+		return fmt.Errorf("APIKey too long")
+	}
+	if err := checkSecretInput(c.APIKey, Create); err != nil {
+		return fmt.Errorf("invalid APIKey : %v", err)
+	}
+	c.CABundle = strings.TrimSpace(c.CABundle)
+	if c.CABundle != "" {
+		if _, err := agent.CertPoolFromPEM(c.CABundle); err != nil {
+			return fmt.Errorf("invalid CA bundle : %v", err)
+		}
+	}
 
 	return nil
 }
@@ -140,6 +162,7 @@ func (c *DbAgent) Evaluate() error {
 	c.EvalResultAccessOK = false
 	c.EvalResultAuthOK = false
 	c.EvalResultCertOK = false
+	c.EvalResultClientOK = false
 
 	//interro...
 	pingurl := c.Host + "/task/ping"
@@ -151,12 +174,28 @@ func (c *DbAgent) Evaluate() error {
 
 	if !evalStop {
 		req.Header.Add("X-Api-Key", c.APIKey)
-		resp, err := agent.DoHttpRequest(req, agent.AgentQueryTimeout, true, "")
+		resp, tlsInfo, err := agent.DoEvalHttpRequest(req, agent.AgentQueryTimeout)
 		if err != nil {
 			evalInfo = append(evalInfo, fmt.Sprintf("request error : %v", err.Error()))
 			evalStop = true
+		} else {
+			defer resp.Body.Close()
+		}
+
+		//certificat client (mTLS)
+		switch {
+		case !tlsInfo.ClientCertRequested:
+			if tlsInfo.ClientCertConfigured && !evalStop && resp.TLS != nil {
+				evalInfo = append(evalInfo, "Client certificate not requested by the agent")
+			}
+		case !tlsInfo.ClientCertConfigured:
+			evalInfo = append(evalInfo, "Client certificate requested by the agent, but none configured")
+		case evalStop:
+			evalInfo = append(evalInfo, "Client certificate refused by the agent")
+		default:
+			evalInfo = append(evalInfo, "Client certificate accepted by the agent")
+			c.EvalResultClientOK = true
 		}
-		defer resp.Body.Close()
 
 		//auth agent ok ?
 		if !evalStop {
@@ -186,10 +225,21 @@ func (c *DbAgent) Evaluate() error {
 
 				evalInfo = append(evalInfo, "Certificate : "+secInfo)
 				c.CertSignEval = hex.EncodeToString(cert.Signature)
+				evalInfo = append(evalInfo, "Public key pin : "+agent.CertSPKIPin(cert))
 
-				_, err = cert.Verify(x509.VerifyOptions{})
+				//chaine validé sur les CA de l'agent, ou à defaut ceux du systeme
+				opts := x509.VerifyOptions{
+					Intermediates: x509.NewCertPool(),
+				}
+				for _, ic := range resp.TLS.PeerCertificates[1:] {
+					opts.Intermediates.AddCert(ic)
+				}
+				if c.CABundle != "" {
+					opts.Roots, _ = agent.CertPoolFromPEM(c.CABundle)
+				}
+				_, err = cert.Verify(opts)
 				if c.CertSignAllowed != "" {
-					if c.CertSignEval == c.CertSignAllowed {
+					if agent.CertMatchPin(cert, c.CertSignAllowed) {
 						evalInfo = append(evalInfo, "Certificate signature approuved.")
 						c.EvalResultCertOK = true
 					} else {
@@ -214,16 +264,17 @@ func (c *DbAgent) Evaluate() error {
 
 // DbTask task
 type DbTask struct {
-	ID       int      `json:"id" apiuse:"search,sort" dbfield:"TASK.id"`
-	Lib      string   `json:"lib" apiuse:"search,sort" dbfield:"TASK.lib"`
-	Type     string   `json:"type" apiuse:"search,sort" dbfield:"TASK.type"`
-	Timeout  int      `json:"timeout" dbfield:"TASK.timeout"`
-	LogStore string   `json:"log_store" apiuse:"search,sort" dbfield:"TASK.log_store"`
-	Cmd      string   `json:"cmd" apiuse:"search,sort" dbfield:"TASK.cmd"`
-	Args     []string `json:"args" dbfield:"TASK.args"`
-	StartIn  string   `json:"start_in" dbfield:"TASK.start_in"`
-	ExecOn   []int    `json:"exec_on" dbfield:"TASK.exec_on"` // liste agent d'execution prenant en charge la cmd
-	Info     string   `json:"info"`
+	ID         int      `json:"id" apiuse:"search,sort" dbfield:"TASK.id"`
+	Lib        string   `json:"lib" apiuse:"search,sort" dbfield:"TASK.lib"`
+	Type       string   `json:"type" apiuse:"search,sort" dbfield:"TASK.type"`
+	Timeout    int      `json:"timeout" dbfield:"TASK.timeout"`
+	LogStore   string   `json:"log_store" apiuse:"search,sort" dbfield:"TASK.log_store"`
+	Cmd        string   `json:"cmd" apiuse:"search,sort" dbfield:"TASK.cmd"`
+	Args       []string `json:"args" dbfield:"TASK.args"`
+	StartIn    string   `json:"start_in" dbfield:"TASK.start_in"`
+	ExecOn     []int    `json:"exec_on" dbfield:"TASK.exec_on"`                                             // liste agent d'execution prenant en charge la cmd
+	OwnerGroup int      `json:"owner_group" apiuse:"search" apiname:"owner_group" dbfield:"TASK.owner_grp"` // groupe propriétaire
+	Info       string   `json:"info"`
 }
 
 // Validate pour controle de validité
@@ -266,10 +317,11 @@ func (c *DbTask) Validate(Create bool) error {
 
 // DbTag tag
 type DbTag struct {
-	ID    int    `json:"id" apiuse:"search,sort" dbfield:"TAG.id"`
-	Lib   string `json:"lib" apiuse:"search,sort" dbfield:"TAG.lib"`
-	Group string `json:"group" apiuse:"search,sort" dbfield:"TAG.tgroup"` //libellé du groupe
-	Info  string `json:"info"`
+	ID     int      `json:"id" apiuse:"search,sort" dbfield:"TAG.id"`
+	Lib    string   `json:"lib" apiuse:"search,sort" dbfield:"TAG.lib"`
+	Group  string   `json:"group" apiuse:"search,sort" dbfield:"TAG.tgroup"` //libellé du groupe
+	Emails []string `json:"emails" dbfield:"TAG.emails"`                     //destinataires des mails d'échec des tf taggués
+	Info   string   `json:"info"`
 }
 
 // Validate pour controle de validité
@@ -304,10 +356,30 @@ func (c *DbTag) Validate(Create bool) error {
 	if c.Group == "" {
 		return fmt.Errorf("invalid group")
 	}
+	if c.Emails, err = checkEmails(c.Emails); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// checkEmails controle/nettoyage d'une liste d'adresses mail
+func checkEmails(in []string) ([]string, error) {
+	out := make([]string, 0)
+	for _, e := range in {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		a, err := mail.ParseAddress(e)
+		if err != nil || strings.Contains(a.Address, ",") {
+			return nil, fmt.Errorf("invalid email %v", e)
+		}
+		out = append(out, a.Address)
+	}
+	return out, nil
+}
+
 // DbQueue queue
 type DbQueue struct {
 	ID          int    `json:"id" apiuse:"search,sort" dbfield:"QUEUE.id"`
@@ -321,6 +393,8 @@ type DbQueue struct {
 
 	NoExecWhile []int `json:"no_exec_while_queues"` //execution simultannée avec autres queue interdite
 
+	OwnerGroup int `json:"owner_group" apiuse:"search" apiname:"owner_group" dbfield:"QUEUE.owner_grp"` // groupe propriétaire
+
 	Info string `json:"info"`
 }
 
@@ -352,6 +426,160 @@ func (c *DbQueue) Validate(Create bool) error {
 	return nil
 }
 
+// DbSecret secret (mot de passe...) utilisable dans les arguments de tache via <%secret:NAME%>
+// la valeur est en écriture seule : jamais restituée par l'api
+type DbSecret struct {
+	ID    int    `json:"id" apiuse:"search,sort" dbfield:"SECRET.id"`
+	Name  string `json:"name" apiuse:"search,sort" dbfield:"SECRET.name"`
+	Value string `json:"value,omitempty"`
+	Info  string `json:"info"`
+}
+
+// Validate pour controle de validité
+func (c *DbSecret) Validate(Create bool) error {
+	if Create && c.ID > 0 {
+		return fmt.Errorf("invalid create")
+	} else if !Create && c.ID <= 0 {
+		return fmt.Errorf("invalid id")
+	}
+
+	rexpName, err := regexp.Compile("^[A-Z0-9_-]+$")
+	if err != nil {
+		return fmt.Errorf("regexp %v", err)
+	}
+	c.Name = strings.ToUpper(strings.TrimSpace(c.Name))
+	if !rexpName.MatchString(c.Name) {
+		return fmt.Errorf("invalid name (A-Z, 0-9, _ and - allowed)")
+	}
+	if !SecretNameAvailable(c.Name, c.ID) {
+		return fmt.Errorf("name not available")
+	}
+	if Create && c.Value == "" {
+		return fmt.Errorf("empty value")
+	}
+	if len(c.Value) > 500 { //stockée chiffrée en base64 dans 1000 car.
+		return fmt.Errorf("value too long")
+	}
+	if err := checkSecretInput(c.Value, Create); err != nil {
+		return fmt.Errorf("invalid value : %v", err)
+	}
+
+	return nil
+}
+
+// évènements d'exec des taskflows pouvant faire l'objet d'une notification
+const (
+	NotifEvtStart       = "start"
+	NotifEvtSuccess     = "success"
+	NotifEvtFailure     = "failure"
+	NotifEvtRecovery    = "recovery" // succès aprés un échec (inclus dans success)
+	NotifEvtLongRunning = "longrunning"
+	NotifEvtSLABreach   = "sla_breach"
+)
+
+// DbNotification canal de notification (webhook http)
+type DbNotification struct {
+	ID      int               `json:"id" apiuse:"search,sort" dbfield:"NOTIFICATION.id"`
+	Lib     string            `json:"lib" apiuse:"search,sort" dbfield:"NOTIFICATION.lib"`
+	Type    string            `json:"type" apiuse:"search,sort" dbfield:"NOTIFICATION.type"`
+	Activ   bool              `json:"activ" apiuse:"search,sort" dbfield:"NOTIFICATION.activ"`
+	URL     string            `json:"url" apiuse:"search" dbfield:"NOTIFICATION.url"`
+	Headers map[string]string `json:"headers" dbfield:"NOTIFICATION.headers"`
+	Payload string            `json:"payload" dbfield:"NOTIFICATION.payload"`   // modéle text/template du corps json, vide : évènement brut
+	HMACKey string            `json:"hmac_key" dbfield:"NOTIFICATION.hmac_key"` // clé de signature (header X-Signature-256), stockée chiffrée
+
+	Rules []DbNotifRule `json:"rules"`
+
+	Info string `json:"info"`
+}
+
+// DbNotifRule régle d'abonnement d'un canal de notification
+// critères à 0 : tous
+type DbNotifRule struct {
+	TaskFlowID  int      `json:"taskflowid" dbfield:"NOTIFRULE.taskflowid"`
+	TagID       int      `json:"tagid" dbfield:"NOTIFRULE.tagid"`
+	QueueID     int      `json:"queueid" dbfield:"NOTIFRULE.queueid"`
+	GroupID     int      `json:"groupid" dbfield:"NOTIFRULE.grp_id"` // groupe propriétaire du taskflow
+	Events      []string `json:"events" dbfield:"NOTIFRULE.events"`
+	LongRunning int      `json:"long_running" dbfield:"NOTIFRULE.long_running"` // en minutes, pour l'évènement longrunning
+}
+
+// Validate pour controle de validité
+func (c *DbNotification) Validate(Create bool) error {
+	if Create && c.ID > 0 {
+		return fmt.Errorf("invalid create")
+	} else if !Create && c.ID <= 0 {
+		return fmt.Errorf("invalid id")
+	}
+
+	c.Lib = strings.TrimSpace(c.Lib)
+	if c.Lib == "" {
+		return fmt.Errorf("invalid lib")
+	}
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	if c.Type == "" {
+		c.Type = "webhook"
+	}
+	if c.Type != "webhook" {
+		return fmt.Errorf("invalid type")
+	}
+	c.URL = strings.TrimSpace(c.URL)
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url")
+	}
+	headers := make(map[string]string)
+	for k, v := range c.Headers {
+		if v == SecretMask {
+			return fmt.Errorf("header %v : masked value not allowed", k)
+		}
+		if k = strings.TrimSpace(k); k != "" {
+			headers[k] = v
+		}
+	}
+	c.Headers = headers
+	if c.Payload != "" {
+		fn := template.FuncMap{"json": func(v interface{}) (string, error) { return "", nil }}
+		if _, err := template.New("payload").Funcs(fn).Parse(c.Payload); err != nil {
+			return fmt.Errorf("invalid payload template : %v", err)
+		}
+	}
+	if len(c.HMACKey) > 200 {
+		return fmt.Errorf("hmac key too long")
+	}
+	if err := checkSecretInput(c.HMACKey, Create); err != nil {
+		return fmt.Errorf("invalid hmac key : %v", err)
+	}
+
+	for i := range c.Rules {
+		if e := c.Rules[i].Validate(); e != nil {
+			return fmt.Errorf("rule %v : %v", (i + 1), e)
+		}
+	}
+	return nil
+}
+
+// Validate pour controle de validité
+func (c *DbNotifRule) Validate() error {
+	evts := make([]string, 0)
+	for _, e := range c.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		switch e {
+		case NotifEvtStart, NotifEvtSuccess, NotifEvtFailure, NotifEvtRecovery, NotifEvtLongRunning, NotifEvtSLABreach:
+			evts = append(evts, e)
+		default:
+			return fmt.Errorf("invalid event %v", e)
+		}
+		if e == NotifEvtLongRunning && c.LongRunning <= 0 {
+			return fmt.Errorf("long running duration required")
+		}
+	}
+	if len(evts) == 0 {
+		return fmt.Errorf("no event")
+	}
+	c.Events = evts
+	return nil
+}
+
 const (
 	// SchedResUN DbTaskFlow.LastResult non connu
 	SchedResUN = 0
@@ -372,6 +600,14 @@ type DbTaskFlow struct {
 	ScheduleID   int               `json:"scheduleid" apiuse:"search" dbfield:"TASKFLOW.scheduleid"`
 	ErrMngt      int               `json:"err_management" apiuse:"search" dbfield:"TASKFLOW.err_management"`
 	QueueID      int               `json:"queueid" apiuse:"search" dbfield:"TASKFLOW.queueid"`
+	Emails       []string          `json:"emails" dbfield:"TASKFLOW.emails"`                                               // destinataires des mails d'échec
+	OwnerGroup   int               `json:"owner_group" apiuse:"search" apiname:"owner_group" dbfield:"TASKFLOW.owner_grp"` // groupe propriétaire, à défaut celui d'un des tags
+
+	SLAStartDelay  int    `json:"sla_start_delay" dbfield:"TASKFLOW.sla_start_delay"`   // délai max de démarrage aprés la date de référence (minutes)
+	SLAMaxDuration int    `json:"sla_max_duration" dbfield:"TASKFLOW.sla_max_duration"` // durée max d'exec (minutes)
+	SLAFinishBy    string `json:"sla_finish_by" dbfield:"TASKFLOW.sla_finish_by"`       // heure de fin au plus tard (HH:MM)
+
+	Version int `json:"version" apiuse:"search,sort" dbfield:"TASKFLOW.version"` // version en cours de la définition (lecture seule)
 
 	LastStart  time.Time `json:"last_start" apiuse:"search" dbfield:"TASKFLOW.last_start"`
 	LastStop   time.Time `json:"last_stop" apiuse:"search" dbfield:"TASKFLOW.last_stop"`
@@ -394,6 +630,11 @@ type DbTaskFlowDetail struct {
 
 // Validate pour controle de validité
 func (c *DbTaskFlow) Validate(Create bool) error {
+	return c.validate(Create, true)
+}
+
+// validate controle de validité, checkTasks : existence en base des taches du détail
+func (c *DbTaskFlow) validate(Create bool, checkTasks bool) error {
 	if Create && c.ID > 0 {
 		return fmt.Errorf("invalid create")
 	} else if !Create && c.ID <= 0 {
@@ -404,15 +645,33 @@ func (c *DbTaskFlow) Validate(Create bool) error {
 	if strings.TrimSpace(c.Lib) == "" {
 		return fmt.Errorf("invalid lib")
 	}
+	var err error
 	c.Tags = clearInts(c.Tags)
 	c.NamedArgs = clearMap(c.NamedArgs)
+	if c.Emails, err = checkEmails(c.Emails); err != nil {
+		return err
+	}
+	if c.SLAStartDelay < 0 || c.SLAMaxDuration < 0 {
+		return fmt.Errorf("invalid sla duration")
+	}
+	c.SLAFinishBy = strings.TrimSpace(c.SLAFinishBy)
+	if c.SLAFinishBy != "" {
+		if _, err = time.Parse(SLAFinishByFormat, c.SLAFinishBy); err != nil {
+			return fmt.Errorf("invalid sla finish by (HH:MM expected)")
+		}
+	}
 
 	// check détail
 	if len(c.Detail) == 0 {
 		return fmt.Errorf("empty task not allowed")
 	}
 	for i := range c.Detail {
-		e := c.Detail[i].Validate(Create, len(c.Detail))
+		var e error
+		if checkTasks {
+			e = c.Detail[i].Validate(Create, len(c.Detail))
+		} else {
+			e = c.Detail[i].validateNext(len(c.Detail))
+		}
 		if e != nil {
 			return fmt.Errorf("detail %v : %v", (i + 1), e)
 		}
@@ -424,12 +683,32 @@ func (c *DbTaskFlow) Validate(Create bool) error {
 	return nil
 }
 
+// ValidateLaunchArgs controle des arguments nommés surchargés au lancement manuel :
+// seuls les arguments déclarés, sans tags (<%...%>, secrets inclus), retourne les arguments normalisés
+func (c *DbTaskFlow) ValidateLaunchArgs(args map[string]string) (map[string]string, error) {
+	args = clearMap(args)
+	for k, v := range args {
+		if _, declared := c.NamedArgs[k]; !declared {
+			return nil, fmt.Errorf("unknown named arg %v", k)
+		}
+		if strings.Contains(v, "<%") {
+			return nil, fmt.Errorf("named arg %v : tags not allowed", k)
+		}
+	}
+	return args, nil
+}
+
 // Validate pour controle de validité
 func (c *DbTaskFlowDetail) Validate(Create bool, DetailListSize int) error {
 	task, _ := TaskGet(c.TaskID)
 	if task.ID == 0 {
 		return fmt.Errorf("invalid task id")
 	}
+	return c.validateNext(DetailListSize)
+}
+
+// validateNext controle des enchainements
+func (c *DbTaskFlowDetail) validateNext(DetailListSize int) error {
 	if c.NextTaskIDOK < -1 || c.NextTaskIDOK > DetailListSize {
 		return fmt.Errorf("invalid next task idx")
 	}
@@ -946,3 +1225,208 @@ func (c *DbSchedDetail) CalcNextLaunch(dtRef time.Time) time.Time {
 
 	return time.Time{}
 }
+
+// types de dépassement de SLA
+const (
+	SLAKindStartDelay = "start_delay" // démarrage trop tardif
+	SLAKindDuration   = "duration"    // durée d'exec dépassée
+	SLAKindFinishBy   = "finish_by"   // heure de fin dépassée
+
+	// SLAFinishByFormat format de l'heure de fin au plus tard
+	SLAFinishByFormat = "15:04"
+)
+
+// DbSLABreach historique des dépassements de SLA
+type DbSLABreach struct {
+	ID          int       `json:"id" apiuse:"search,sort" dbfield:"SLABREACH.id"`
+	TaskFlowID  int       `json:"taskflow_id" apiuse:"search,sort" dbfield:"SLABREACH.taskflowid"`
+	TaskFlowLib string    `json:"taskflow_lib" apiuse:"search,sort" dbfield:"TASKFLOW.lib"`
+	RunID       string    `json:"run_id" apiuse:"search" dbfield:"SLABREACH.run_id"`
+	Kind        string    `json:"kind" apiuse:"search,sort" dbfield:"SLABREACH.kind"`
+	DtRef       time.Time `json:"dt_ref" apiuse:"search,sort" dbfield:"SLABREACH.dt_ref"`
+	DetectedAt  time.Time `json:"detected_at" apiuse:"search,sort" dbfield:"SLABREACH.detected_at"`
+	Info        string    `json:"info" apiuse:"search" dbfield:"SLABREACH.info"`
+}
+
+// actions tracées dans l'audit
+const (
+	AuditActCreate = "create"
+	AuditActUpdate = "update"
+	AuditActDelete = "delete"
+	AuditActLaunch = "launch"
+)
+
+// DbAudit trace d'une modification de config ou d'une action manuelle
+type DbAudit struct {
+	ID       int       `json:"id" apiuse:"search,sort" dbfield:"AUDIT.id"`
+	At       time.Time `json:"at" apiuse:"search,sort" dbfield:"AUDIT.created_at"`
+	UsrID    int       `json:"usr_id" apiuse:"search,sort" dbfield:"AUDIT.usr_id"`
+	Login    string    `json:"login" apiuse:"search,sort" dbfield:"AUDIT.login"`
+	Entity   string    `json:"entity" apiuse:"search,sort" dbfield:"AUDIT.entity"`
+	EntityID string    `json:"entity_id" apiuse:"search,sort" dbfield:"AUDIT.entity_id"`
+	Action   string    `json:"action" apiuse:"search,sort" dbfield:"AUDIT.action"`
+	Diff     string    `json:"diff" dbfield:"AUDIT.diff"` //json {champ: {"before": x, "after": y}}
+}
+
+// DbTaskFlowVersionDef définition figée d'un taskflow et des taches référencées
+type DbTaskFlowVersionDef struct {
+	TaskFlow DbTaskFlow `json:"taskflow"`
+	Tasks    []DbTask   `json:"tasks"`
+}
+
+// DbTaskFlowVersion version (immuable) d'un taskflow
+type DbTaskFlowVersion struct {
+	TaskFlowID int                   `json:"taskflow_id" dbfield:"TFVERSION.taskflowid"`
+	Version    int                   `json:"version" apiuse:"search,sort" dbfield:"TFVERSION.version"`
+	CreatedAt  time.Time             `json:"created_at" apiuse:"search,sort" dbfield:"TFVERSION.created_at"`
+	CreatedBy  string                `json:"created_by" apiuse:"search,sort" dbfield:"USERC.login"`
+	Definition *DbTaskFlowVersionDef `json:"definition,omitempty"`
+}
+
+// DbTaskFlowRun historique d'exec d'un taskflow
+type DbTaskFlowRun struct {
+	ID           int       `json:"id" apiuse:"search,sort" dbfield:"TFRUN.id"`
+	RunID        string    `json:"run_id" apiuse:"search" dbfield:"TFRUN.run_id"`
+	TaskFlowID   int       `json:"taskflow_id" apiuse:"search,sort" dbfield:"TFRUN.taskflowid"`
+	TaskFlowLib  string    `json:"taskflow_lib" apiuse:"search,sort" dbfield:"TASKFLOW.lib"`
+	Version      int       `json:"version" apiuse:"search,sort" dbfield:"TFRUN.version"`
+	LaunchSource string    `json:"launch_source" apiuse:"search" dbfield:"TFRUN.launch_source"`
+	DtRef        time.Time `json:"dt_ref" apiuse:"search,sort" dbfield:"TFRUN.dt_ref"`
+	StartAt      time.Time `json:"start_at" apiuse:"search,sort" dbfield:"TFRUN.start_at"`
+	StopAt       time.Time `json:"stop_at" apiuse:"search,sort" dbfield:"TFRUN.stop_at"`
+	Result       int       `json:"result" apiuse:"search,sort" dbfield:"TFRUN.result"`
+	Msg          string    `json:"msg" dbfield:"TFRUN.msg"`
+}
+
+// DbManaged entité gérée par la synchro gitops, en lecture seule via l'api
+type DbManaged struct {
+	Entity   string `json:"entity" apiuse:"search,sort" dbfield:"MANAGED.entity"` // code crud de l'entité
+	Name     string `json:"name" apiuse:"search,sort" dbfield:"MANAGED.name"`     // nom dans le bundle
+	EntityID int    `json:"entity_id" apiuse:"search,sort" dbfield:"MANAGED.entity_id"`
+	Source   string `json:"source" apiuse:"search,sort" dbfield:"MANAGED.source"` // fichier de définition
+}
+
+// DbAPIToken token d'api longue durée d'un compte de service, table APITOKEN
+type DbAPIToken struct {
+	ID         int       `json:"id" apiuse:"search,sort" dbfield:"APITOKEN.id"`
+	Name       string    `json:"name" apiuse:"search,sort" dbfield:"APITOKEN.name"`
+	UserID     int       `json:"usr_id" apiuse:"search,sort" dbfield:"APITOKEN.usr_id"`
+	Login      string    `json:"login" apiuse:"search,sort" dbfield:"USR.login"`
+	Prefix     string    `json:"prefix" apiuse:"search" dbfield:"APITOKEN.prefix"`              // début du token, pour identification
+	Token      string    `json:"token,omitempty"`                                               // valeur en clair, retournée uniquement à la création
+	RightLevel int       `json:"rightlevel" apiuse:"search,sort" dbfield:"APITOKEN.rightlevel"` // plafonné au niveau de l'utilisateur
+	Tags       []int     `json:"tags" dbfield:"APITOKEN.tags"`                                  // restriction aux taskflows portant un de ces tags, vide : aucune
+	ExpiresAt  time.Time `json:"expires_at" apiuse:"search,sort" dbfield:"APITOKEN.expires_at"` // zéro : sans expiration
+	LastUsedAt time.Time `json:"last_used_at" apiuse:"search,sort" dbfield:"APITOKEN.last_used_at"`
+	CreatedAt  time.Time `json:"created_at" apiuse:"search,sort" dbfield:"APITOKEN.created_at"`
+}
+
+// Validate pour controle de validité
+func (c *DbAPIToken) Validate(Create bool) error {
+	if Create && c.ID > 0 {
+		return fmt.Errorf("invalid create")
+	} else if !Create && c.ID <= 0 {
+		return fmt.Errorf("invalid id")
+	}
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("invalid name")
+	}
+	if c.UserID <= 0 {
+		return fmt.Errorf("invalid user")
+	}
+	if c.RightLevel <= 0 {
+		return fmt.Errorf("invalid rightlevel")
+	}
+	if Create && !c.ExpiresAt.IsZero() && c.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("invalid expiration, already expired")
+	}
+	c.Tags = clearInts(c.Tags)
+	return nil
+}
+
+// DbRole rôle : permissions "ressource:action" accordées aux membres en plus de leur niveau de droits,
+// restreintes aux taskflows portant un des tags ou rattachés à une des queues du rôle (vide : sans restriction)
+type DbRole struct {
+	ID          int      `json:"id" apiuse:"search,sort" dbfield:"ROLE.id"`
+	Name        string   `json:"name" apiuse:"search,sort" dbfield:"ROLE.name"`
+	Description string   `json:"description" dbfield:"ROLE.description"`
+	Permissions []string `json:"permissions" dbfield:"ROLE.permissions"` // ex taskflow:launch, queue:pause, agent:edit, taskflow:*
+	Tags        []int    `json:"tags" dbfield:"ROLE.tags"`
+	Queues      []int    `json:"queues" dbfield:"ROLE.queues"`
+	Users       []int    `json:"users"` // membres
+	Info        string   `json:"info"`
+}
+
+// Validate pour controle de validité
+func (c *DbRole) Validate(Create bool) error {
+	if Create && c.ID > 0 {
+		return fmt.Errorf("invalid create")
+	} else if !Create && c.ID <= 0 {
+		return fmt.Errorf("invalid id")
+	}
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("invalid name")
+	}
+	perms := make([]string, 0, len(c.Permissions))
+	dbl := make(map[string]bool)
+	for _, p := range c.Permissions {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if !ValidPermission(p) {
+			return fmt.Errorf("invalid permission %v", p)
+		}
+		if !dbl[p] {
+			dbl[p] = true
+			perms = append(perms, p)
+		}
+	}
+	if len(perms) == 0 {
+		return fmt.Errorf("invalid permissions, at least one expected")
+	}
+	c.Permissions = perms
+	c.Tags = clearInts(c.Tags)
+	c.Queues = clearInts(c.Queues)
+	c.Users = clearInts(c.Users)
+	//restriction par tags / queues appliquée aux seuls taskflows et queues
+	if len(c.Tags) > 0 || len(c.Queues) > 0 {
+		for _, p := range c.Permissions {
+			if !ScopedPermission(p) {
+				return fmt.Errorf("permission %v cannot be restricted to tags or queues", p)
+			}
+		}
+	}
+	return nil
+}
+
+// DbGroup groupe (équipe) d'utilisateurs propriétaire de taskflows, taches et queues
+// les taskflows sans propriétaire explicite appartiennent au groupe d'un de leurs tags
+type DbGroup struct {
+	ID          int      `json:"id" apiuse:"search,sort" dbfield:"GRP.id"`
+	Name        string   `json:"name" apiuse:"search,sort" dbfield:"GRP.name"`
+	Description string   `json:"description" dbfield:"GRP.description"`
+	Emails      []string `json:"emails" dbfield:"GRP.emails"` // destinataires des mails d'échec des taskflows du groupe
+	Tags        []int    `json:"tags" dbfield:"GRP.tags"`
+	Members     []int    `json:"members"`
+	Info        string   `json:"info"`
+}
+
+// Validate pour controle de validité
+func (c *DbGroup) Validate(Create bool) error {
+	if Create && c.ID > 0 {
+		return fmt.Errorf("invalid create")
+	} else if !Create && c.ID <= 0 {
+		return fmt.Errorf("invalid id")
+	}
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("invalid name")
+	}
+	var err error
+	if c.Emails, err = checkEmails(c.Emails); err != nil {
+		return err
+	}
+	c.Tags = clearInts(c.Tags)
+	c.Members = clearInts(c.Members)
+	return nil
+}
@@ -0,0 +1,257 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NotificationList liste des canaux de notification
+func NotificationList(filter SearchQuery) ([]DbNotification, PagedResponse, error) {
+	var err error
+	arr := make([]DbNotification, 0)
+	arrMp := make(map[int]int) // id notification=idx arr
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `NOTIFICATION NOTIFICATION ` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("NotificationList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT NOTIFICATION.id, NOTIFICATION.lib, NOTIFICATION.type, NOTIFICATION.activ
+		, NOTIFICATION.url, NOTIFICATION.headers, NOTIFICATION.payload, NOTIFICATION.hmac_key
+		, USERC.login as loginC, NOTIFICATION.created_at
+		, USERU.login as loginU, NOTIFICATION.updated_at
+		FROM ` + tblPrefix + `NOTIFICATION NOTIFICATION 
+		left join  ` + tblPrefix + `USR USERC on USERC.id = NOTIFICATION.created_by
+		left join  ` + tblPrefix + `USR USERU on USERU.id = NOTIFICATION.updated_by
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("NotificationList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id        int
+		lib       sql.NullString
+		ntype     sql.NullString
+		activ     sql.NullInt64
+		nurl      sql.NullString
+		headers   sql.NullString
+		payload   sql.NullString
+		hmacKey   sql.NullString
+		createdAt sql.NullTime
+		updatedAt sql.NullTime
+		loginC    sql.NullString
+		loginU    sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &lib, &ntype, &activ, &nurl, &headers, &payload, &hmacKey,
+			&loginC, &createdAt, &loginU, &updatedAt)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("NotificationList scan %w", err)
+		}
+		key, err := decryptSecret(hmacKey.String)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("NotificationList hmac_key %v %w", id, err)
+		}
+		arr = append(arr, DbNotification{
+			ID:      id,
+			Lib:     lib.String,
+			Type:    ntype.String,
+			Activ:   (activ.Int64 == 1),
+			URL:     nurl.String,
+			Headers: mapFromJSON(headers.String),
+			Payload: payload.String,
+			HMACKey: key,
+			Rules:   []DbNotifRule{},
+			Info:    stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
+		})
+		arrMp[id] = len(arr) - 1
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("NotificationList err %w", err)
+	}
+
+	//regles
+	if len(arr) > 0 {
+		idarr := make([]interface{}, len(arr))
+		q = ` SELECT NOTIFRULE.notificationid, NOTIFRULE.taskflowid, NOTIFRULE.tagid, NOTIFRULE.queueid
+			, NOTIFRULE.grp_id, NOTIFRULE.events, NOTIFRULE.long_running
+			FROM ` + tblPrefix + `NOTIFRULE NOTIFRULE where NOTIFRULE.notificationid in (0`
+		for i := 0; i < len(arr); i++ {
+			q += `,?`
+			idarr[i] = arr[i].ID
+		}
+		q += `) order by NOTIFRULE.notificationid, NOTIFRULE.idx`
+
+		rowsDet, err := MainDB.Query(q, idarr...)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("NotificationList rule query %w", err)
+		}
+		defer rowsDet.Close()
+		var (
+			notificationid int
+			taskflowID     sql.NullInt64
+			tagID          sql.NullInt64
+			queueID        sql.NullInt64
+			groupID        sql.NullInt64
+			events         sql.NullString
+			longRunning    sql.NullInt64
+		)
+		for rowsDet.Next() {
+			err = rowsDet.Scan(&notificationid, &taskflowID, &tagID, &queueID, &groupID, &events, &longRunning)
+			if err != nil {
+				return nil, pagedResp, fmt.Errorf("NotificationList rule scan %w", err)
+			}
+			arr[arrMp[notificationid]].Rules = append(arr[arrMp[notificationid]].Rules, DbNotifRule{
+				TaskFlowID:  int(taskflowID.Int64),
+				TagID:       int(tagID.Int64),
+				QueueID:     int(queueID.Int64),
+				GroupID:     int(groupID.Int64),
+				Events:      splitStrFromStr(events.String),
+				LongRunning: int(longRunning.Int64),
+			})
+		}
+		if rowsDet.Err() != nil && rowsDet.Err() != sql.ErrNoRows {
+			return nil, pagedResp, fmt.Errorf("NotificationList rule err %w", err)
+		}
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// NotificationGet get d'un canal de notification
+func NotificationGet(id int) (DbNotification, error) {
+	var ret DbNotification
+	filter := NewSearchQueryFromID("NOTIFICATION", id)
+
+	arr, _, err := NotificationList(filter)
+	if err != nil {
+		return ret, err
+	}
+	if len(arr) > 0 {
+		ret = arr[0]
+	}
+	return ret, nil
+}
+
+// NotificationUpdate maj canal de notification
+func NotificationUpdate(elm DbNotification, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("NotificationUpdate err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
+	}
+
+	hmacKey, err := encryptSecret(elm.HMACKey)
+	if err != nil {
+		return fmt.Errorf("NotificationUpdate hmac_key %w", err)
+	}
+	q := `UPDATE ` + tblPrefix + `NOTIFICATION SET updated_by = ?, updated_at = ? 
+		, lib = ?, type = ?, activ = ?, url = ?, headers = ?, payload = ?, hmac_key = ?
+		where id = ? `
+	_, err = TxExec(tx, q, usrUpdater, time.Now(), elm.Lib, elm.Type, elm.Activ, elm.URL,
+		mapToJSON(&elm.Headers), elm.Payload, hmacKey, elm.ID)
+	if err != nil {
+		return fmt.Errorf("NotificationUpdate err %w", err)
+	}
+
+	//regles par delete/insert
+	q = `DELETE FROM ` + tblPrefix + `NOTIFRULE where notificationid = ? `
+	_, err = TxExec(tx, q, elm.ID)
+	if err != nil {
+		return fmt.Errorf("NotificationUpdate err %w", err)
+	}
+
+	q = `INSERT INTO ` + tblPrefix + `NOTIFRULE(notificationid, idx, taskflowid, tagid, queueid
+		, grp_id, events, long_running) VALUES (?,?,?,?,?,?,?,?)`
+	for i, rule := range elm.Rules {
+		_, err = TxExec(tx, q, elm.ID, i+1, rule.TaskFlowID, rule.TagID, rule.QueueID,
+			rule.GroupID, mergeStrToStr(rule.Events), rule.LongRunning)
+		if err != nil {
+			return fmt.Errorf("NotificationUpdate err %w", err)
+		}
+	}
+
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("NotificationUpdate err %w", err)
+		}
+	}
+	return nil
+}
+
+// NotificationDelete suppression canal de notification
+func NotificationDelete(elmID int, usrUpdater int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("NotificationDelete err %w", err)
+	}
+	defer tx.Rollback()
+
+	q := `DELETE FROM ` + tblPrefix + `NOTIFRULE where notificationid = ? `
+	_, err = TxExec(tx, q, elmID)
+	if err != nil {
+		return fmt.Errorf("NotificationDelete err %w", err)
+	}
+
+	q = `DELETE FROM ` + tblPrefix + `NOTIFICATION where id = ? `
+	_, err = TxExec(tx, q, elmID)
+	if err != nil {
+		return fmt.Errorf("NotificationDelete err %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("NotificationDelete err %w", err)
+	}
+	return nil
+}
+
+// NotificationInsert insertion canal de notification
+func NotificationInsert(elm *DbNotification, usrUpdater int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("NotificationInsert err %w", err)
+	}
+	defer tx.Rollback()
+
+	//insert base
+	q := `INSERT INTO ` + tblPrefix + `NOTIFICATION (created_by, created_at) VALUES(?,?) `
+	id, err := TxInsert(tx, q, usrUpdater, time.Now())
+	if err != nil {
+		return fmt.Errorf("NotificationInsert err %w", err)
+	}
+
+	//mj pour le reste des champs
+	elm.ID = int(id)
+	err = NotificationUpdate(*elm, usrUpdater, tx)
+	if err != nil {
+		return fmt.Errorf("NotificationInsert err %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("NotificationInsert err %w", err)
+	}
+	return nil
+}
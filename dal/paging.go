@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -111,6 +112,31 @@ func (c SearchQuery) AppendPaging(sql string, rowcount int64) string {
 	return sqlReturn
 }
 
+//AndListContainsAny restreint aux lignes dont le champ liste (format "1,5,48") contient une des valeurs
+func (c *SearchQuery) AndListContainsAny(dbfield string, values []int) {
+	if len(values) == 0 {
+		return
+	}
+	filter, params := listContainsAnyCond(dbfield, values)
+	c.SQLParams = append(c.SQLParams, params...)
+	if c.SQLFilter != "" {
+		filter = "(" + c.SQLFilter + ") AND " + filter
+	}
+	c.SQLFilter = filter
+}
+
+//listContainsAnyCond condition sql : champ liste (format "1,5,48") contenant une des valeurs
+func listContainsAnyCond(dbfield string, values []int) (string, []interface{}) {
+	conds := make([]string, 0, len(values))
+	params := make([]interface{}, 0, 4*len(values))
+	for _, v := range values {
+		vs := strconv.Itoa(v)
+		conds = append(conds, "("+dbfield+" = ? OR "+dbfield+" like ? OR "+dbfield+" like ? OR "+dbfield+" like ?)")
+		params = append(params, vs, vs+",%", "%,"+vs, "%,"+vs+",%")
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", params
+}
+
 //NewSearchQueryFromID filtre id unique
 func NewSearchQueryFromID(prefix string, id int) SearchQuery {
 	sq := SearchQuery{
@@ -351,7 +377,7 @@ func NewSearchQueryFromRequest(r *http.Request, structInfo interface{}, FromForm
 		if sort != "" {
 			sort += ", "
 		}
-		sort += ", " + s
+		sort += s
 		if qSortFieldE[s] {
 			sort += " DESC"
 		} else {
@@ -401,6 +427,25 @@ func NewSearchQueryFromRequest(r *http.Request, structInfo interface{}, FromForm
 	}
 }
 
+// SearchField capacités d'un champ d'entité dans les filtres et tris (documentation de l'api)
+type SearchField struct {
+	Name       string // nom du paramétre get
+	Type       string // int, float, bool, string, date, time, datetime...
+	Searchable bool
+	Sortable   bool
+}
+
+// SearchFields champs utilisables par NewSearchQueryFromRequest pour une entité, triés par nom
+func SearchFields(structInfo interface{}) []SearchField {
+	fields := extractSearchInfo(structInfo)
+	ret := make([]SearchField, 0, len(fields))
+	for _, f := range fields {
+		ret = append(ret, SearchField{Name: f.APIName, Type: f.Type, Searchable: f.Searchable, Sortable: f.Sortable})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
 // paramSearchQuery reprsente les infos d'un parametre acceptable pour la recherche
 type paramSearchQuery struct {
 	Searchable bool
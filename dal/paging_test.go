@@ -0,0 +1,14 @@
+package dal
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSearchQuerySort tri construit depuis les paramétres de la requete
+func TestSearchQuerySort(t *testing.T) {
+	r := httptest.NewRequest("GET", "/tags?sort=desc:lib,id", nil)
+	if q := NewSearchQueryFromRequest(r, &DbTag{}, false); q.SQLSort != "TAG.lib DESC, TAG.id ASC" {
+		t.Errorf("sort %q", q.SQLSort)
+	}
+}
@@ -27,7 +27,7 @@ func QueueList(filter SearchQuery) ([]DbQueue, PagedResponse, error) {
 
 	// listing
 	q := ` SELECT QUEUE.id, QUEUE.lib, QUEUE.size, QUEUE.slot, QUEUE.timeout, QUEUE.pausedfrom 
-		, QUEUE.noexecwhile_queuelist
+		, QUEUE.noexecwhile_queuelist, QUEUE.owner_grp
 		, USERC.login as loginC, QUEUE.created_at
 		, USERU.login as loginU, QUEUE.updated_at
 		FROM ` + tblPrefix + `QUEUE QUEUE 
@@ -49,13 +49,14 @@ func QueueList(filter SearchQuery) ([]DbQueue, PagedResponse, error) {
 		timeout    sql.NullInt64
 		pausedFrom sql.NullTime
 		noexecQL   sql.NullString
+		ownerGrp   sql.NullInt64
 		createdAt  sql.NullTime
 		updatedAt  sql.NullTime
 		loginC     sql.NullString
 		loginU     sql.NullString
 	)
 	for rows.Next() {
-		err = rows.Scan(&id, &lib, &size, &slot, &timeout, &pausedFrom, &noexecQL, &loginC, &createdAt, &loginU, &updatedAt)
+		err = rows.Scan(&id, &lib, &size, &slot, &timeout, &pausedFrom, &noexecQL, &ownerGrp, &loginC, &createdAt, &loginU, &updatedAt)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("QueueList scan %w", err)
 		}
@@ -71,6 +72,7 @@ func QueueList(filter SearchQuery) ([]DbQueue, PagedResponse, error) {
 			PausedManual:     pausedFrom.Valid && !pausedFrom.Time.IsZero(),
 			PausedManualFrom: pausedFrom.Time,
 			NoExecWhile:      splitIntFromStr(noexecQL.String),
+			OwnerGroup:       int(ownerGrp.Int64),
 			Info:             stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
 		})
 	}
@@ -110,9 +112,10 @@ func QueueUpdate(elm DbQueue, usrUpdater int, admin bool, tx *sql.Tx) error {
 	q := `UPDATE ` + tblPrefix + `QUEUE SET
 		updated_by = ?, updated_at = ? 
 		, lib = ?, size = ?, slot = ?, timeout = ?, pausedfrom= ?, noexecwhile_queuelist = ?
+		, owner_grp = ?
 		where id = ? `
 	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Lib, elm.MaxSize, elm.Slot, elm.MaxDuration,
-		pausedfrom, mergeIntToStr(elm.NoExecWhile), elm.ID)
+		pausedfrom, mergeIntToStr(elm.NoExecWhile), elm.OwnerGroup, elm.ID)
 	if err != nil {
 		return fmt.Errorf("QueueUpdate err %w", err)
 	}
@@ -121,9 +124,9 @@ func QueueUpdate(elm DbQueue, usrUpdater int, admin bool, tx *sql.Tx) error {
 }
 
 // QueueDelete suppression
-func QueueDelete(elmID int, usrUpdater int) error {
+func QueueDelete(elmID int, usrUpdater int, tx *sql.Tx) error {
 	q := `DELETE FROM ` + tblPrefix + `QUEUE where id = ? `
-	_, err := TxExec(nil, q, elmID)
+	_, err := TxExec(tx, q, elmID)
 	if err != nil {
 		return fmt.Errorf("QueueDelete err %w", err)
 	}
@@ -131,12 +134,17 @@ func QueueDelete(elmID int, usrUpdater int) error {
 }
 
 // QueueInsert insertion queue
-func QueueInsert(elm *DbQueue, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("QueueInsert err %w", err)
+func QueueInsert(elm *DbQueue, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("QueueInsert err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	//insert base
 	q := `INSERT INTO ` + tblPrefix + `QUEUE (created_by, created_at) VALUES(?,?) `
@@ -152,9 +160,11 @@ func QueueInsert(elm *DbQueue, usrUpdater int) error {
 		return fmt.Errorf("QueueInsert err %w", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("QueueInsert err %w", err)
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("QueueInsert err %w", err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,481 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// actions des permissions "ressource:action", la ressource étant un crud code en minuscule (taskflow, queue, agent...)
+const (
+	ActView   = "view"
+	ActEdit   = "edit" // implique view
+	ActLaunch = "launch"
+	ActPause  = "pause"
+)
+
+// actions spécifiques à une ressource, en plus de view et edit
+var resourceActions = map[string][]string{
+	"taskflow": {ActLaunch},
+	"queue":    {ActPause},
+}
+
+// ValidPermission contrôle du format d'une permission : *, ressource:*, ressource:action
+func ValidPermission(perm string) bool {
+	if perm == "*" {
+		return true
+	}
+	sp := strings.SplitN(perm, ":", 2)
+	if len(sp) != 2 {
+		return false
+	}
+	if _, exists := crudCodeList[strings.ToUpper(sp[0])]; !exists || sp[0] != strings.ToLower(sp[0]) {
+		return false
+	}
+	if sp[1] == "*" || sp[1] == ActView || sp[1] == ActEdit {
+		return true
+	}
+	for _, a := range resourceActions[sp[0]] {
+		if sp[1] == a {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopedPermission vrai si la permission porte sur une ressource dont l'accés est restreint par tags / queues
+func ScopedPermission(perm string) bool {
+	return strings.HasPrefix(perm, "taskflow:") || strings.HasPrefix(perm, "queue:")
+}
+
+// Grant permission accordée par un rôle, restreinte à ses tags / queues (vide : sans restriction)
+type Grant struct {
+	Permission string
+	Tags       []int
+	Queues     []int
+}
+
+// match vrai si la permission couvre l'action sur la ressource
+func (g Grant) match(resource string, action string) bool {
+	p := g.Permission
+	return p == "*" || p == resource+":*" || p == resource+":"+action ||
+		(action == ActView && p == resource+":"+ActEdit)
+}
+
+// Permissions droits effectifs : niveau de droits fixe, complété par les permissions des rôles
+type Permissions struct {
+	Level     RightLevel
+	Grants    []Grant
+	Resources []string // restriction aux ressources listées (token d'api limité à des tags), vide : aucune
+}
+
+// excluded ressource hors de la restriction de ressources
+func (p Permissions) excluded(resource string) bool {
+	if len(p.Resources) == 0 {
+		return false
+	}
+	for _, r := range p.Resources {
+		if r == resource {
+			return false
+		}
+	}
+	return true
+}
+
+// levelAllows action couverte par le niveau de droits fixe (IsAutorised)
+func (p Permissions) levelAllows(resource string, action string) bool {
+	switch {
+	case resource == "taskflow" && action == ActLaunch:
+		return p.Level >= RightLvlTaskRunner
+	case resource == "queue" && action == ActPause:
+		return IsAutorised(p.Level, "QUEUE", true)
+	case action == ActView || action == ActEdit:
+		return IsAutorised(p.Level, strings.ToUpper(resource), action == ActEdit)
+	}
+	return false
+}
+
+// Allowed action autorisée sur au moins une partie de la ressource
+func (p Permissions) Allowed(resource string, action string) bool {
+	if p.excluded(resource) {
+		return false
+	}
+	if p.levelAllows(resource, action) {
+		return true
+	}
+	for _, g := range p.Grants {
+		if g.match(resource, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope périmétre d'une action : tout, ou taskflows / queues des rôles qui l'accordent
+func (p Permissions) Scope(resource string, action string) Scope {
+	if p.excluded(resource) {
+		return Scope{}
+	}
+	if p.levelAllows(resource, action) {
+		return Scope{All: true}
+	}
+	var sc Scope
+	for _, g := range p.Grants {
+		if !g.match(resource, action) {
+			continue
+		}
+		if len(g.Tags) == 0 && len(g.Queues) == 0 {
+			return Scope{All: true}
+		}
+		sc.Tags = append(sc.Tags, g.Tags...)
+		sc.Queues = append(sc.Queues, g.Queues...)
+	}
+	sc.Tags = clearInts(sc.Tags)
+	sc.Queues = clearInts(sc.Queues)
+	return sc
+}
+
+// RightList représentation json des droits par crud code (même format que GetRigthList)
+func (p Permissions) RightList() map[string]RightView {
+	ret := make(map[string]RightView)
+	for k := range crudCodeList {
+		res := strings.ToLower(k)
+		r := p.Allowed(res, ActView)
+		ret[k] = RightView{
+			Allowed:  r,
+			ReadOnly: !(r && p.Allowed(res, ActEdit)),
+		}
+	}
+	return ret
+}
+
+// Scope périmétre d'accés : tout, ou éléments portant un des tags / rattachés à une des queues
+// RequiredTags restriction supplémentaire (token d'api) : un de ces tags est exigé dans tous les cas
+type Scope struct {
+	All          bool
+	Tags         []int
+	Queues       []int
+	RequiredTags []int
+}
+
+// Unrestricted vrai si aucune restriction
+func (s Scope) Unrestricted() bool {
+	return s.All && len(s.RequiredTags) == 0
+}
+
+// TaskFlow vrai si le taskflow (tags, queue) est dans le périmétre
+func (s Scope) TaskFlow(tags []int, queueID int) bool {
+	if len(s.RequiredTags) > 0 && !intersects(tags, s.RequiredTags) {
+		return false
+	}
+	return s.All || intersects(tags, s.Tags) || intersects([]int{queueID}, s.Queues)
+}
+
+// Queue vrai si la queue est dans le périmétre
+func (s Scope) Queue(queueID int) bool {
+	return s.All || intersects([]int{queueID}, s.Queues)
+}
+
+// Filter restreint une recherche au périmétre, champ liste de tags et champ queue (vide si non applicable)
+func (s Scope) Filter(c *SearchQuery, tagsField string, queueField string) {
+	if !s.All {
+		conds := make([]string, 0)
+		if tagsField != "" && len(s.Tags) > 0 {
+			cond, params := listContainsAnyCond(tagsField, s.Tags)
+			conds = append(conds, cond)
+			c.SQLParams = append(c.SQLParams, params...)
+		}
+		if queueField != "" && len(s.Queues) > 0 {
+			in := make([]string, 0, len(s.Queues))
+			for _, q := range s.Queues {
+				in = append(in, strconv.Itoa(q))
+			}
+			conds = append(conds, queueField+" in ("+strings.Join(in, ",")+")")
+		}
+		filter := "1 = 0"
+		if len(conds) > 0 {
+			filter = "(" + strings.Join(conds, " OR ") + ")"
+		}
+		if c.SQLFilter != "" {
+			filter = "(" + c.SQLFilter + ") AND " + filter
+		}
+		c.SQLFilter = filter
+	}
+	if tagsField != "" {
+		c.AndListContainsAny(tagsField, s.RequiredTags)
+	}
+}
+
+func intersects(a []int, b []int) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cache des permissions de rôles par utilisateur, vidé à chaque modification de rôle
+// durée limitée pour prise en compte des modifications faites par une autre instance
+const grantsCacheDuration = 30 * time.Second
+
+var grantsCache = struct {
+	mu sync.Mutex
+	m  map[int]grantsCacheEntry
+}{m: make(map[int]grantsCacheEntry)}
+
+type grantsCacheEntry struct {
+	grants   []Grant
+	loadedAt time.Time
+}
+
+func grantsCacheClear() {
+	grantsCache.mu.Lock()
+	defer grantsCache.mu.Unlock()
+	grantsCache.m = make(map[int]grantsCacheEntry)
+}
+
+// UserPermissions droits effectifs d'un utilisateur : niveau fourni (session) et rôles dont il est membre
+func UserPermissions(userID int, level RightLevel) (Permissions, error) {
+	ret := Permissions{Level: level}
+	if userID <= 0 {
+		return ret, nil
+	}
+	grantsCache.mu.Lock()
+	e, exists := grantsCache.m[userID]
+	grantsCache.mu.Unlock()
+	if exists && time.Since(e.loadedAt) < grantsCacheDuration {
+		ret.Grants = e.grants
+		return ret, nil
+	}
+
+	q := `SELECT ROLE.permissions, ROLE.tags, ROLE.queues FROM ` + tblPrefix + `ROLE ROLE
+		inner join ` + tblPrefix + `USER_ROLE UR on UR.role_id = ROLE.id
+		where UR.usr_id = ? `
+	rows, err := MainDB.Query(q, userID)
+	if err != nil {
+		return ret, fmt.Errorf("UserPermissions query %w", err)
+	}
+	defer rows.Close()
+	var perms, tags, queues sql.NullString
+	for rows.Next() {
+		if err = rows.Scan(&perms, &tags, &queues); err != nil {
+			return ret, fmt.Errorf("UserPermissions scan %w", err)
+		}
+		for _, p := range splitStrFromStr(perms.String) {
+			ret.Grants = append(ret.Grants, Grant{Permission: p, Tags: splitIntFromStr(tags.String), Queues: splitIntFromStr(queues.String)})
+		}
+	}
+
+	grantsCache.mu.Lock()
+	grantsCache.m[userID] = grantsCacheEntry{grants: ret.Grants, loadedAt: time.Now()}
+	grantsCache.mu.Unlock()
+	return ret, nil
+}
+
+// RoleList liste des rôles
+func RoleList(filter SearchQuery) ([]DbRole, PagedResponse, error) {
+	var err error
+	arr := make([]DbRole, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `ROLE ROLE ` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("RoleList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT ROLE.id, ROLE.name, ROLE.description, ROLE.permissions, ROLE.tags, ROLE.queues
+		, USERC.login as loginC, ROLE.created_at
+		, USERU.login as loginU, ROLE.updated_at
+		FROM ` + tblPrefix + `ROLE ROLE
+		left join  ` + tblPrefix + `USR USERC on USERC.id = ROLE.created_by
+		left join  ` + tblPrefix + `USR USERU on USERU.id = ROLE.updated_by
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("RoleList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id          int
+		name        sql.NullString
+		description sql.NullString
+		permissions sql.NullString
+		tags        sql.NullString
+		queues      sql.NullString
+		createdAt   sql.NullTime
+		updatedAt   sql.NullTime
+		loginC      sql.NullString
+		loginU      sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &name, &description, &permissions, &tags, &queues, &loginC, &createdAt, &loginU, &updatedAt)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("RoleList scan %w", err)
+		}
+		arr = append(arr, DbRole{
+			ID:          id,
+			Name:        name.String,
+			Description: description.String,
+			Permissions: splitStrFromStr(permissions.String),
+			Tags:        splitIntFromStr(tags.String),
+			Queues:      splitIntFromStr(queues.String),
+			Users:       make([]int, 0),
+			Info:        stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("RoleList err %w", err)
+	}
+	rows.Close()
+
+	//membres
+	for i := range arr {
+		if arr[i].Users, err = roleUsers(arr[i].ID); err != nil {
+			return nil, pagedResp, err
+		}
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// roleUsers membres d'un rôle
+func roleUsers(roleID int) ([]int, error) {
+	ret := make([]int, 0)
+	rows, err := MainDB.Query(`SELECT usr_id FROM `+tblPrefix+`USER_ROLE where role_id = ? order by usr_id`, roleID)
+	if err != nil {
+		return nil, fmt.Errorf("roleUsers query %w", err)
+	}
+	defer rows.Close()
+	var id int
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("roleUsers scan %w", err)
+		}
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
+
+// RoleGet get d'un rôle
+func RoleGet(id int) (DbRole, error) {
+	var ret DbRole
+	filter := NewSearchQueryFromID("ROLE", id)
+
+	arr, _, err := RoleList(filter)
+	if err != nil {
+		return ret, err
+	}
+	if len(arr) > 0 {
+		ret = arr[0]
+	}
+	return ret, nil
+}
+
+// RoleUpdate maj rôle et de ses membres, dans une transaction propre si tx nil
+// tx fourni : cache des droits à vider par l'appelant aprés commit
+func RoleUpdate(elm DbRole, usrUpdater int, tx *sql.Tx) error {
+	if tx == nil {
+		tx, err := MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("RoleUpdate err %w", err)
+		}
+		defer tx.Rollback()
+		if err = RoleUpdate(elm, usrUpdater, tx); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("RoleUpdate err %w", err)
+		}
+		grantsCacheClear()
+		return nil
+	}
+	q := `UPDATE ` + tblPrefix + `ROLE SET
+		updated_by = ?, updated_at = ?
+		, name = ?, description = ?, permissions = ?, tags = ?, queues = ?
+		where id = ? `
+	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Name, elm.Description, mergeStrToStr(elm.Permissions),
+		mergeIntToStr(elm.Tags), mergeIntToStr(elm.Queues), elm.ID)
+	if err != nil {
+		return fmt.Errorf("RoleUpdate err %w", err)
+	}
+
+	_, err = TxExec(tx, `DELETE FROM `+tblPrefix+`USER_ROLE where role_id = ? `, elm.ID)
+	if err != nil {
+		return fmt.Errorf("RoleUpdate err %w", err)
+	}
+	for _, u := range elm.Users {
+		_, err = TxExec(tx, `INSERT INTO `+tblPrefix+`USER_ROLE (usr_id, role_id) VALUES(?,?) `, u, elm.ID)
+		if err != nil {
+			return fmt.Errorf("RoleUpdate err %w", err)
+		}
+	}
+	return nil
+}
+
+// RoleDelete suppression rôle et affectations
+func RoleDelete(elmID int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("RoleDelete err %w", err)
+	}
+	defer tx.Rollback()
+	if _, err = TxExec(tx, `DELETE FROM `+tblPrefix+`USER_ROLE where role_id = ? `, elmID); err != nil {
+		return fmt.Errorf("RoleDelete err %w", err)
+	}
+	if _, err = TxExec(tx, `DELETE FROM `+tblPrefix+`ROLE where id = ? `, elmID); err != nil {
+		return fmt.Errorf("RoleDelete err %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("RoleDelete err %w", err)
+	}
+	grantsCacheClear()
+	return nil
+}
+
+// RoleInsert insertion rôle
+func RoleInsert(elm *DbRole, usrUpdater int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("RoleInsert err %w", err)
+	}
+	defer tx.Rollback()
+
+	//insert base
+	q := `INSERT INTO ` + tblPrefix + `ROLE (created_by, created_at) VALUES(?,?) `
+	id, err := TxInsert(tx, q, usrUpdater, time.Now())
+	if err != nil {
+		return fmt.Errorf("RoleInsert err %w", err)
+	}
+
+	//mj pour le reste des champs
+	elm.ID = int(id)
+	err = RoleUpdate(*elm, usrUpdater, tx)
+	if err != nil {
+		return fmt.Errorf("RoleInsert err %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("RoleInsert err %w", err)
+	}
+	grantsCacheClear()
+	return nil
+}
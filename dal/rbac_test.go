@@ -0,0 +1,155 @@
+package dal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidPermission(t *testing.T) {
+	for _, p := range []string{"*", "taskflow:*", "taskflow:view", "taskflow:launch", "queue:pause", "agent:edit"} {
+		if !ValidPermission(p) {
+			t.Errorf("%v refused", p)
+		}
+	}
+	for _, p := range []string{"", "taskflow", "Taskflow:view", "taskflow:pause", "agent:launch", "unknown:view", "queue:"} {
+		if ValidPermission(p) {
+			t.Errorf("%v accepted", p)
+		}
+	}
+
+	r := DbRole{ID: 1, Name: " ops ", Permissions: []string{"TaskFlow:Launch ", "taskflow:launch"}, Tags: []int{2, 2}}
+	if err := r.Validate(false); err != nil || r.Name != "ops" || len(r.Permissions) != 1 || r.Permissions[0] != "taskflow:launch" || len(r.Tags) != 1 {
+		t.Errorf("validate %+v %v", r, err)
+	}
+	r.Permissions = nil
+	if err := r.Validate(false); err == nil {
+		t.Error("no permission accepted")
+	}
+	//restriction sans effet sur les autres ressources : refusée
+	for _, p := range []string{"*", "task:edit", "agent:edit", "bundle:view"} {
+		r.Permissions = []string{"taskflow:view", p}
+		if err := r.Validate(false); err == nil {
+			t.Errorf("scoped %v accepted", p)
+		}
+	}
+	r.Permissions, r.Tags, r.Queues = []string{"task:edit"}, nil, nil
+	if err := r.Validate(false); err != nil {
+		t.Errorf("unscoped task:edit %v", err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	p := Permissions{Level: RightLvlViewer, Grants: []Grant{
+		{Permission: "taskflow:edit", Tags: []int{1}},
+		{Permission: "taskflow:launch", Queues: []int{5}},
+		{Permission: "queue:pause", Queues: []int{5}},
+		{Permission: "agent:*"},
+	}}
+
+	//niveau de droits seul
+	if !p.Allowed("queue", ActView) || p.Allowed("queue", ActEdit) || p.Allowed("user", ActView) {
+		t.Error("level rights")
+	}
+	//rôles
+	if !p.Allowed("taskflow", ActView) || !p.Allowed("taskflow", ActLaunch) || !p.Allowed("queue", ActPause) || !p.Allowed("agent", ActEdit) {
+		t.Error("grants")
+	}
+	if !p.Scope("agent", ActView).All || !p.Scope("queue", ActView).All {
+		t.Error("unrestricted scope")
+	}
+
+	//edit implique view, périmétres cumulés
+	view := p.Scope("taskflow", ActView)
+	if view.All || !view.TaskFlow([]int{3, 1}, 0) || view.TaskFlow([]int{3}, 5) {
+		t.Errorf("view scope %+v", view)
+	}
+	launch := p.Scope("taskflow", ActLaunch)
+	if !launch.TaskFlow(nil, 5) || launch.TaskFlow([]int{1}, 4) {
+		t.Errorf("launch scope %+v", launch)
+	}
+	if pause := p.Scope("queue", ActPause); !pause.Queue(5) || pause.Queue(4) {
+		t.Errorf("pause scope %+v", pause)
+	}
+
+	//restriction de tags d'un token : exigée même sans restriction de rôle
+	all := Scope{All: true, RequiredTags: []int{7}}
+	if all.Unrestricted() || all.TaskFlow([]int{1}, 5) || !all.TaskFlow([]int{7}, 0) {
+		t.Errorf("required tags %+v", all)
+	}
+
+	rl := p.RightList()
+	if !rl["TASKFLOW"].Allowed || rl["TASKFLOW"].ReadOnly || rl["USER"].Allowed || !rl["QUEUE"].ReadOnly {
+		t.Errorf("right list %v", rl)
+	}
+	if len(rl) != len(GetRigthList(RightLvlAdmin)) {
+		t.Error("right list codes")
+	}
+
+	//restriction de ressources : niveau admin sans effet hors des ressources listées
+	adm := Permissions{Level: RightLvlAdmin, Resources: []string{"taskflow", "task"}}
+	if !adm.Allowed("task", ActEdit) || adm.Allowed("user", ActEdit) || adm.Allowed("bundle", ActView) {
+		t.Error("resources")
+	}
+	if sc := adm.Scope("agent", ActView); sc.All || sc.Queue(0) {
+		t.Errorf("resources scope %+v", sc)
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	c := SearchQuery{SQLFilter: "TASKFLOW.lib like ?", SQLParams: []interface{}{"a%"}}
+	Scope{Tags: []int{1}, Queues: []int{2, 3}}.Filter(&c, "TASKFLOW.tags", "TASKFLOW.queueid")
+	if !strings.HasPrefix(c.SQLFilter, "(TASKFLOW.lib like ?) AND (") || !strings.Contains(c.SQLFilter, " OR TASKFLOW.queueid in (2,3))") || len(c.SQLParams) != 5 {
+		t.Errorf("filter %v %v", c.SQLFilter, c.SQLParams)
+	}
+
+	//aucun périmétre : rien
+	c = SearchQuery{}
+	Scope{}.Filter(&c, "", "QUEUE.id")
+	if c.SQLFilter != "1 = 0" {
+		t.Errorf("empty scope %v", c.SQLFilter)
+	}
+
+	//tout : seulement la restriction de tags
+	c = SearchQuery{}
+	Scope{All: true}.Filter(&c, "TASKFLOW.tags", "")
+	if c.SQLFilter != "" {
+		t.Errorf("all %v", c.SQLFilter)
+	}
+	Scope{All: true, RequiredTags: []int{4}}.Filter(&c, "TASKFLOW.tags", "")
+	if c.SQLFilter == "" || len(c.SQLParams) != 4 {
+		t.Errorf("required tags %v", c.SQLFilter)
+	}
+}
+
+// TestRoleGrantsCache droits en cache rechargés aprés chaque modification de rôle
+func TestRoleGrantsCache(t *testing.T) {
+	grants := func() []Grant {
+		p, err := UserPermissions(testUsr, RightLvlViewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Grants
+	}
+	before := len(grants())
+
+	role := DbRole{Name: "cache", Permissions: []string{"agent:view"}, Users: []int{testUsr}}
+	if err := RoleInsert(&role, testUsr); err != nil {
+		t.Fatal(err)
+	}
+	if g := grants(); len(g) != before+1 {
+		t.Errorf("insert %+v", g)
+	}
+	role.Permissions = []string{"agent:view", "sched:view"}
+	if err := RoleUpdate(role, testUsr, nil); err != nil {
+		t.Fatal(err)
+	}
+	if g := grants(); len(g) != before+2 {
+		t.Errorf("update %+v", g)
+	}
+	if err := RoleDelete(role.ID); err != nil {
+		t.Fatal(err)
+	}
+	if g := grants(); len(g) != before {
+		t.Errorf("delete %+v", g)
+	}
+}
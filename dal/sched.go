@@ -195,12 +195,17 @@ func SchedUpdate(elm DbSched, usrUpdater int, transaction bool, tx *sql.Tx) erro
 }
 
 // SchedDelete flag sched suppression
-func SchedDelete(elmID int, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("SchedDelete err %w", err)
+func SchedDelete(elmID int, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("SchedDelete err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	q := `DELETE FROM ` + tblPrefix + `PERIODDETAIL where periodid = ? `
 	_, err = TxExec(tx, q, elmID)
@@ -214,20 +219,27 @@ func SchedDelete(elmID int, usrUpdater int) error {
 		return fmt.Errorf("SchedDelete err %w", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("SchedDelete err %w", err)
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("SchedDelete err %w", err)
+		}
 	}
 	return nil
 }
 
 // SchedInsert insertion sched
-func SchedInsert(elm *DbSched, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("SchedInsert err %w", err)
+func SchedInsert(elm *DbSched, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("SchedInsert err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	//insert base
 	q := `INSERT INTO ` + tblPrefix + `PERIOD (created_by, created_at) VALUES(?,?) `
@@ -243,9 +255,11 @@ func SchedInsert(elm *DbSched, usrUpdater int) error {
 		return fmt.Errorf("SchedInsert err %w", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("SchedInsert err %w", err)
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("SchedInsert err %w", err)
+		}
 	}
 
 	return nil
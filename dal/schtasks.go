@@ -0,0 +1,387 @@
+package dal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Conversion des exports xml du planificateur de taches windows (schtasks /query /xml)
+
+// schTaskXML tache planifiée windows, éléments non gérés collectés dans Other
+type schTaskXML struct {
+	XMLName          xml.Name `xml:"Task"`
+	RegistrationInfo struct {
+		URI string `xml:"URI"`
+	} `xml:"RegistrationInfo"`
+	Triggers struct {
+		Calendar []schTriggerXML `xml:"CalendarTrigger"`
+		Time     []schTriggerXML `xml:"TimeTrigger"`
+		Other    []schAnyXML     `xml:",any"`
+	} `xml:"Triggers"`
+	Principals struct {
+		Principal []struct {
+			UserID   string `xml:"UserId"`
+			RunLevel string `xml:"RunLevel"`
+		} `xml:"Principal"`
+	} `xml:"Principals"`
+	Settings struct {
+		Enabled            string `xml:"Enabled"`
+		ExecutionTimeLimit string `xml:"ExecutionTimeLimit"`
+	} `xml:"Settings"`
+	Actions struct {
+		Exec []struct {
+			Command          string `xml:"Command"`
+			Arguments        string `xml:"Arguments"`
+			WorkingDirectory string `xml:"WorkingDirectory"`
+		} `xml:"Exec"`
+		Other []schAnyXML `xml:",any"`
+	} `xml:"Actions"`
+}
+
+type schAnyXML struct {
+	XMLName xml.Name
+}
+
+// schDaysXML liste de jours ou de mois sous forme d'éléments vides (<Monday/>, <January/>)
+type schDaysXML struct {
+	Items []schAnyXML `xml:",any"`
+}
+
+type schTriggerXML struct {
+	StartBoundary string `xml:"StartBoundary"`
+	EndBoundary   string `xml:"EndBoundary"`
+	Enabled       string `xml:"Enabled"`
+	RandomDelay   string `xml:"RandomDelay"`
+	Repetition    *struct {
+		Interval string `xml:"Interval"`
+		Duration string `xml:"Duration"`
+	} `xml:"Repetition"`
+	ScheduleByDay *struct {
+		DaysInterval int `xml:"DaysInterval"`
+	} `xml:"ScheduleByDay"`
+	ScheduleByWeek *struct {
+		WeeksInterval int        `xml:"WeeksInterval"`
+		DaysOfWeek    schDaysXML `xml:"DaysOfWeek"`
+	} `xml:"ScheduleByWeek"`
+	ScheduleByMonth *struct {
+		DaysOfMonth struct {
+			Day []string `xml:"Day"`
+		} `xml:"DaysOfMonth"`
+		Months schDaysXML `xml:"Months"`
+	} `xml:"ScheduleByMonth"`
+	ScheduleByMonthDayOfWeek *struct {
+		Weeks struct {
+			Week []string `xml:"Week"`
+		} `xml:"Weeks"`
+		DaysOfWeek schDaysXML `xml:"DaysOfWeek"`
+		Months     schDaysXML `xml:"Months"`
+	} `xml:"ScheduleByMonthDayOfWeek"`
+}
+
+var schDayNames = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+var schMonthNames = []string{"January", "February", "March", "April", "May", "June", "July",
+	"August", "September", "October", "November", "December"}
+
+// weekDays jours (0=lundi)
+func (c *schDaysXML) weekDays() [7]bool {
+	var ret [7]bool
+	for _, e := range c.Items {
+		for i, n := range schDayNames {
+			if e.XMLName.Local == n {
+				ret[i] = true
+			}
+		}
+	}
+	return ret
+}
+
+// months mois (0=janvier), tous si aucun
+func (c *schDaysXML) months() [12]bool {
+	var ret [12]bool
+	for _, e := range c.Items {
+		for i, n := range schMonthNames {
+			if e.XMLName.Local == n {
+				ret[i] = true
+			}
+		}
+	}
+	if len(c.Items) == 0 {
+		for i := range ret {
+			ret[i] = true
+		}
+	}
+	return ret
+}
+
+// rexpISODuration durée xml : P1DT2H30M15S
+var rexpISODuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// schDuration conversion d'une durée xml, 0 si vide
+func schDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m := rexpISODuration.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %v", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		n, _ := strconv.Atoi(m[i+1])
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// schArgs découpage d'une ligne d'arguments windows (guillemets regroupant les espaces)
+func schArgs(s string) []string {
+	ret := make([]string, 0)
+	var cur strings.Builder
+	quoted, inArg := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inArg {
+				ret = append(ret, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		ret = append(ret, cur.String())
+	}
+	return ret
+}
+
+// schUTF8 conversion d'un export utf-16 (format par défaut de windows) en utf-8
+func schUTF8(data []byte) []byte {
+	if len(data) < 2 || !((data[0] == 0xFF && data[1] == 0xFE) || (data[0] == 0xFE && data[1] == 0xFF)) {
+		return bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+	}
+	le := data[0] == 0xFF
+	u := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		if le {
+			u = append(u, uint16(data[i])|uint16(data[i+1])<<8)
+		} else {
+			u = append(u, uint16(data[i])<<8|uint16(data[i+1]))
+		}
+	}
+	return []byte(string(utf16.Decode(u)))
+}
+
+// schTrigger conversion d'un déclencheur en détail de planif, nil si non repris
+func schTrigger(tr schTriggerXML, oneShot bool, unsupported func(construct, detail string, skipped bool)) *BundleSchedDetail {
+	if strings.EqualFold(tr.Enabled, "false") {
+		unsupported("Trigger", "disabled trigger", true)
+		return nil
+	}
+	//heure de départ, date et fuseau ignorés
+	start := tr.StartBoundary
+	if i := strings.Index(start, "T"); i >= 0 {
+		start = start[i+1:]
+	}
+	if len(start) < 8 {
+		unsupported("StartBoundary", "invalid start "+tr.StartBoundary, true)
+		return nil
+	}
+	if len(start) > 8 {
+		unsupported("StartBoundary", "time zone offset ignored "+tr.StartBoundary, false)
+	}
+	start = start[:8]
+	startAt, err := time.Parse("15:04:05", start)
+	if err != nil {
+		unsupported("StartBoundary", "invalid start "+tr.StartBoundary, true)
+		return nil
+	}
+	if tr.EndBoundary != "" {
+		unsupported("EndBoundary", "expiration ignored "+tr.EndBoundary, false)
+	}
+	if tr.RandomDelay != "" {
+		unsupported("RandomDelay", "random delay ignored", false)
+	}
+	if oneShot && tr.Repetition == nil {
+		unsupported("TimeTrigger", "one time trigger", true)
+		return nil
+	}
+
+	d := BundleSchedDetail{Hours: start, Months: "*", WeekDays: "*", MonthDays: "*"}
+	//répétition : intervalle sur la durée à partir de l'heure de départ
+	if tr.Repetition != nil {
+		interval, err1 := schDuration(tr.Repetition.Interval)
+		duration, err2 := schDuration(tr.Repetition.Duration)
+		if err1 != nil || err2 != nil || interval < time.Second {
+			unsupported("Repetition", "invalid repetition "+tr.Repetition.Interval+" "+tr.Repetition.Duration, true)
+			return nil
+		}
+		d.Hours = ""
+		d.Interval = int(interval.Seconds())
+		if duration > 0 && duration < 24*time.Hour {
+			end := startAt.Add(duration)
+			if end.Day() != startAt.Day() {
+				unsupported("Repetition", "repetition after midnight ignored", false)
+				end = time.Date(startAt.Year(), startAt.Month(), startAt.Day(), 23, 59, 59, 0, startAt.Location())
+			}
+			d.IntervalHours = start + "-" + end.Format("15:04:05")
+		} else if startAt.Hour()+startAt.Minute()+startAt.Second() > 0 {
+			unsupported("Repetition", "indefinite repetition runs all day from midnight", false)
+		}
+	}
+	if oneShot {
+		unsupported("TimeTrigger", "start date ignored, repeated every day", false)
+		return &d
+	}
+
+	switch {
+	case tr.ScheduleByDay != nil:
+		if tr.ScheduleByDay.DaysInterval > 1 {
+			unsupported("DaysInterval", fmt.Sprintf("every %v days run every day", tr.ScheduleByDay.DaysInterval), false)
+		}
+	case tr.ScheduleByWeek != nil:
+		if tr.ScheduleByWeek.WeeksInterval > 1 {
+			unsupported("WeeksInterval", fmt.Sprintf("every %v weeks run every week", tr.ScheduleByWeek.WeeksInterval), false)
+		}
+		d.WeekDays = legacyWeekDays(tr.ScheduleByWeek.DaysOfWeek.weekDays())
+	case tr.ScheduleByMonth != nil:
+		days := make([]string, 0)
+		for _, e := range tr.ScheduleByMonth.DaysOfMonth.Day {
+			if strings.EqualFold(e, "Last") {
+				days = append(days, "LAST")
+			} else if n, err := strconv.Atoi(e); err == nil && n > 0 && n < 32 {
+				days = append(days, e)
+			} else {
+				unsupported("DaysOfMonth", "invalid day "+e, false)
+			}
+		}
+		if len(days) > 0 {
+			d.MonthDays = strings.Join(days, ",")
+		}
+		d.Months = legacyMonths(tr.ScheduleByMonth.Months.months())
+	case tr.ScheduleByMonthDayOfWeek != nil:
+		//<n><jour> : 1MON, 2TUE...
+		s := tr.ScheduleByMonthDayOfWeek
+		days := s.DaysOfWeek.weekDays()
+		codes := make([]string, 0)
+		for _, w := range s.Weeks.Week {
+			n, err := strconv.Atoi(w)
+			if err != nil || n < 1 || n > 4 {
+				unsupported("Weeks", "week "+w+" of the month ignored", false)
+				continue
+			}
+			for i, ok := range days {
+				if ok {
+					codes = append(codes, w+strings.ToUpper(schDayNames[i][:3]))
+				}
+			}
+		}
+		if len(codes) == 0 {
+			unsupported("ScheduleByMonthDayOfWeek", "no supported week day", true)
+			return nil
+		}
+		d.MonthDays = strings.Join(codes, ",")
+		d.Months = legacyMonths(s.Months.months())
+	default:
+		unsupported("CalendarTrigger", "unknown schedule", true)
+		return nil
+	}
+	return &d
+}
+
+// SchTasksToBundle conversion d'un export xml de tache planifiée windows :
+// un taskflow enchainant les actions Exec, planifié par les déclencheurs repris
+// name : nom de la tache, à défaut repris de l'URI de l'export
+func SchTasksToBundle(name string, data []byte, opt LegacyImportOpt) (Bundle, []LegacyUnsupported, error) {
+	b := Bundle{Version: BundleFormatVersion}
+	report := make([]LegacyUnsupported, 0)
+
+	var t schTaskXML
+	dec := xml.NewDecoder(bytes.NewReader(schUTF8(data)))
+	dec.CharsetReader = func(label string, in io.Reader) (io.Reader, error) {
+		return in, nil //déjà converti en utf-8
+	}
+	if err := dec.Decode(&t); err != nil {
+		return b, report, fmt.Errorf("SchTasksToBundle err %w", err)
+	}
+	if name == "" {
+		uri := strings.Trim(t.RegistrationInfo.URI, `\`)
+		name = uri[strings.LastIndex(uri, `\`)+1:]
+	}
+	if name == "" {
+		return b, report, fmt.Errorf("SchTasksToBundle err missing task name")
+	}
+	unsupported := func(construct, detail string, skipped bool) {
+		report = append(report, LegacyUnsupported{Source: name, Construct: construct, Detail: detail, Skipped: skipped})
+	}
+
+	for _, p := range t.Principals.Principal {
+		if p.UserID != "" {
+			unsupported("Principal", "runs as the agent user instead of "+p.UserID, false)
+		}
+		if p.RunLevel == "HighestAvailable" {
+			unsupported("RunLevel", "elevated privileges not supported", false)
+		}
+	}
+	if strings.EqualFold(t.Settings.Enabled, "false") {
+		opt.Activ = false
+	}
+	timeout, err := schDuration(t.Settings.ExecutionTimeLimit)
+	if err != nil {
+		unsupported("ExecutionTimeLimit", err.Error(), false)
+	}
+
+	sched := make([]BundleSchedDetail, 0)
+	for _, tr := range t.Triggers.Calendar {
+		if d := schTrigger(tr, false, unsupported); d != nil {
+			sched = append(sched, *d)
+		}
+	}
+	for _, tr := range t.Triggers.Time {
+		if d := schTrigger(tr, true, unsupported); d != nil {
+			sched = append(sched, *d)
+		}
+	}
+	for _, tr := range t.Triggers.Other {
+		unsupported(tr.XMLName.Local, "trigger not supported", true)
+	}
+
+	tasks := make([]BundleTask, 0)
+	for _, e := range t.Actions.Exec {
+		cmd := strings.Trim(strings.TrimSpace(e.Command), `"`)
+		if cmd == "" {
+			unsupported("Exec", "empty command", true)
+			continue
+		}
+		tasks = append(tasks, BundleTask{
+			Timeout: int(timeout / time.Millisecond),
+			Cmd:     cmd,
+			Args:    emptyStrsNil(schArgs(e.Arguments)),
+			StartIn: strings.Trim(strings.TrimSpace(e.WorkingDirectory), `"`),
+		})
+	}
+	for _, e := range t.Actions.Other {
+		unsupported(e.XMLName.Local, "action not supported", true)
+	}
+	if len(tasks) == 0 {
+		unsupported("Actions", "no command to run, task not imported", true)
+		return b, report, nil
+	}
+	if len(sched) == 0 {
+		unsupported("Triggers", "no supported trigger, imported for manual launch only", false)
+	}
+	legacyJob(&b, opt, legacyLib(opt.Prefix, name), sched, tasks, nil)
+	return b, report, nil
+}
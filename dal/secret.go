@@ -0,0 +1,308 @@
+package dal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Chiffrement des données sensibles (clé api agent...) stockées en bdd
+// AES-GCM, clé de 32 octets fournie en hex par la config ou un fichier clé
+// valeur stockée : "enc:" + base64(nonce + données chiffrées)
+// sans clé paramétrée, les valeurs restent en clair
+
+const (
+	secretPrefix = "enc:"
+	// SecretMask valeur retournée par l'api à la place d'une donnée sensible
+	SecretMask = "********"
+	// SecretKeySize taille de clé attendue (AES-256)
+	SecretKeySize = 32
+)
+
+var (
+	secretKey   []byte
+	secretKeyMu sync.RWMutex
+)
+
+// secretColumn colonne contenant une donnée chiffrée
+type secretColumn struct {
+	table  string
+	id     string
+	column string
+	where  string //filtre optionnel des lignes concernées
+}
+
+// secretColumns liste des colonnes chiffrées (pour migration et rotation de clé)
+var secretColumns = []secretColumn{
+	{table: "AGENT", id: "id", column: "apikey"},
+	{table: "SECRET", id: "id", column: "value"},
+	{table: "NOTIFICATION", id: "id", column: "hmac_key"},
+	{table: "CFG", id: "KID", column: "KVAL", where: "KID in ('" + strings.Join(cfgSecretKeys, "','") + "')"},
+}
+
+// cfgSecretKeys clés de la table de config dont la valeur est chiffrée
+var cfgSecretKeys = []string{"mail.smtp_password"}
+
+// CfgKVIsSecret retourne vrai pour les clés de config dont la valeur est sensible
+func CfgKVIsSecret(key string) bool {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for _, k := range cfgSecretKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSecretKey défini la clé de chiffrement (nil : pas de chiffrement)
+func SetSecretKey(key []byte) error {
+	if key != nil && len(key) != SecretKeySize {
+		return fmt.Errorf("invalid secret key size %v, %v expected", len(key), SecretKeySize)
+	}
+	secretKeyMu.Lock()
+	secretKey = key
+	secretKeyMu.Unlock()
+	return nil
+}
+
+// ParseSecretKey décode une clé au format hex
+func ParseSecretKey(hexKey string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key : %w", err)
+	}
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("invalid secret key size %v, %v expected", len(key), SecretKeySize)
+	}
+	return key, nil
+}
+
+// GenerateSecretKey génére une nouvelle clé aléatoire
+func GenerateSecretKey() ([]byte, error) {
+	key := make([]byte, SecretKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LoadSecretKeyFile lit la clé (hex) du fichier fourni, le fichier est crée avec une nouvelle clé s'il n'existe pas
+func LoadSecretKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := GenerateSecretKey()
+		if err != nil {
+			return nil, err
+		}
+		err = WriteSecretKeyFile(path, key)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read secret key file : %w", err)
+	}
+	return ParseSecretKey(string(b))
+}
+
+// WriteSecretKeyFile ecrit la clé (hex) dans le fichier fourni
+func WriteSecretKeyFile(path string, key []byte) error {
+	err := ioutil.WriteFile(path, []byte(hex.EncodeToString(key)), 0600)
+	if err != nil {
+		return fmt.Errorf("write secret key file : %w", err)
+	}
+	return nil
+}
+
+// checkSecretInput controle d'une valeur sensible saisie : préfixe de chiffrement réservé,
+// masque renvoyé par le client refusé en création (pas de valeur existante à conserver)
+func checkSecretInput(val string, create bool) error {
+	if strings.HasPrefix(val, secretPrefix) {
+		return fmt.Errorf("%v prefix not allowed", secretPrefix)
+	}
+	if create && val == SecretMask {
+		return fmt.Errorf("masked value not allowed")
+	}
+	return nil
+}
+
+// encryptWith chiffre une valeur avec la clé fournie
+func encryptWith(key []byte, val string) (string, error) {
+	if key == nil || val == "" {
+		return val, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	enc := gcm.Seal(nonce, nonce, []byte(val), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(enc), nil
+}
+
+// decryptWith déchiffre une valeur avec la clé fournie (valeur en clair retournée telle quelle)
+func decryptWith(key []byte, val string) (string, error) {
+	if !strings.HasPrefix(val, secretPrefix) {
+		return val, nil
+	}
+	if key == nil {
+		return "", fmt.Errorf("encrypted value but no secret key")
+	}
+	enc, err := base64.StdEncoding.DecodeString(val[len(secretPrefix):])
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(enc) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	dec, err := gcm.Open(nil, enc[:gcm.NonceSize()], enc[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt fail (invalid secret key ?)")
+	}
+	return string(dec), nil
+}
+
+// encryptSecret chiffre une valeur avec la clé en cours
+func encryptSecret(val string) (string, error) {
+	secretKeyMu.RLock()
+	defer secretKeyMu.RUnlock()
+	return encryptWith(secretKey, val)
+}
+
+// decryptSecret déchiffre une valeur avec la clé en cours
+func decryptSecret(val string) (string, error) {
+	secretKeyMu.RLock()
+	defer secretKeyMu.RUnlock()
+	return decryptWith(secretKey, val)
+}
+
+// reencryptColumns déchiffre (oldKey) puis chiffre (newKey) toutes les colonnes sensibles
+func reencryptColumns(tx *sql.Tx, oldKey, newKey []byte) error {
+	for _, sc := range secretColumns {
+		q := `SELECT ` + sc.id + `, ` + sc.column + ` FROM ` + tblPrefix + sc.table
+		if sc.where != "" {
+			q += ` WHERE ` + sc.where
+		}
+		rows, err := tx.Query(q)
+		if err != nil {
+			return fmt.Errorf("reencrypt %v.%v : %w", sc.table, sc.column, err)
+		}
+		vals := make(map[interface{}]string)
+		var (
+			id  interface{}
+			val sql.NullString
+		)
+		for rows.Next() {
+			err = rows.Scan(&id, &val)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("reencrypt %v.%v : %w", sc.table, sc.column, err)
+			}
+			if val.String != "" {
+				vals[id] = val.String
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("reencrypt %v.%v : %w", sc.table, sc.column, err)
+		}
+
+		for id, v := range vals {
+			//déjà chiffrée avec la clé en cours (migration)
+			if bytes.Equal(oldKey, newKey) && strings.HasPrefix(v, secretPrefix) {
+				continue
+			}
+			dec, err := decryptWith(oldKey, v)
+			if err != nil {
+				return fmt.Errorf("reencrypt %v.%v %v : %w", sc.table, sc.column, id, err)
+			}
+			enc, err := encryptWith(newKey, dec)
+			if err != nil {
+				return fmt.Errorf("reencrypt %v.%v %v : %w", sc.table, sc.column, id, err)
+			}
+			if enc == v {
+				continue
+			}
+			_, err = TxExec(tx, `UPDATE `+tblPrefix+sc.table+` SET `+sc.column+` = ? WHERE `+sc.id+` = ?`, enc, id)
+			if err != nil {
+				return fmt.Errorf("reencrypt %v.%v %v : %w", sc.table, sc.column, id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// encryptClearSecrets chiffre les valeurs sensibles encore en clair (migration)
+func encryptClearSecrets() error {
+	secretKeyMu.RLock()
+	key := secretKey
+	secretKeyMu.RUnlock()
+	if key == nil {
+		return nil
+	}
+
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("encryptClearSecrets err %w", err)
+	}
+	defer tx.Rollback()
+
+	err = reencryptColumns(tx, key, key)
+	if err != nil {
+		return fmt.Errorf("encryptClearSecrets err %w", err)
+	}
+	return tx.Commit()
+}
+
+// RotateSecretKey rechiffre toutes les données sensibles avec la nouvelle clé, qui devient la clé en cours
+func RotateSecretKey(newKey []byte) error {
+	if len(newKey) != SecretKeySize {
+		return fmt.Errorf("invalid secret key size %v, %v expected", len(newKey), SecretKeySize)
+	}
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("RotateSecretKey err %w", err)
+	}
+	defer tx.Rollback()
+
+	err = reencryptColumns(tx, secretKey, newKey)
+	if err != nil {
+		return fmt.Errorf("RotateSecretKey err %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("RotateSecretKey err %w", err)
+	}
+	secretKey = newKey
+	return nil
+}
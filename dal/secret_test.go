@@ -0,0 +1,61 @@
+package dal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecretEncrypt(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := encryptWith(key, "my-api-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enc, secretPrefix) || strings.Contains(enc, "my-api-key") {
+		t.Errorf("value not encrypted : %v", enc)
+	}
+	dec, err := decryptWith(key, enc)
+	if err != nil || dec != "my-api-key" {
+		t.Errorf("decrypt : %v %v", dec, err)
+	}
+
+	//autre clé : échec
+	key2, _ := GenerateSecretKey()
+	if _, err = decryptWith(key2, enc); err == nil {
+		t.Errorf("decrypt with another key : error expected")
+	}
+
+	//valeur saisie avec le préfixe : chiffrée comme les autres
+	if enc, err = encryptWith(key, "enc:x"); err != nil || enc == "enc:x" {
+		t.Errorf("prefixed value not encrypted : %v %v", enc, err)
+	}
+
+	//valeur en clair (avant chiffrement) restituée telle quelle
+	dec, err = decryptWith(key, "clear")
+	if err != nil || dec != "clear" {
+		t.Errorf("clear value : %v %v", dec, err)
+	}
+}
+
+// TestSecretInput préfixe de chiffrement et masque refusés à la saisie
+func TestSecretInput(t *testing.T) {
+	agt := DbAgent{Host: "h:8443", APIKey: "enc:x"}
+	if err := agt.Validate(true); err == nil {
+		t.Error("agent prefixed key : error expected")
+	}
+	agt.APIKey = SecretMask
+	if err := agt.Validate(true); err == nil {
+		t.Error("agent masked key : error expected")
+	}
+	notif := DbNotification{Lib: "n", URL: "http://h/hook", HMACKey: SecretMask}
+	if err := notif.Validate(true); err == nil {
+		t.Error("notification masked key : error expected")
+	}
+	kv := KVJSON{Key: "mail.smtp_password", Value: "enc:x"}
+	if err := kv.Validate(); err == nil {
+		t.Error("cfg prefixed value : error expected")
+	}
+}
@@ -0,0 +1,129 @@
+package dal
+
+import (
+	"CmdScheduler/sessions"
+	"CmdScheduler/slog"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// sessionActivityDelay intervalle min entre deux maj de la derniére activité d'une session
+const sessionActivityDelay = 30 * time.Second
+
+// SessionStore sessions persistées en base (table SESSION), conservées au redémarrage
+// seul le hash du token est stocké, les données attachées (Session.Data) ne sont pas conservées
+type SessionStore struct {
+	sessionDuration time.Duration
+}
+
+// NewSessionStore store en base
+func NewSessionStore(sessionDuration time.Duration) *SessionStore {
+	return &SessionStore{sessionDuration: sessionDuration}
+}
+
+func sessionHash(sessionID string) string {
+	h := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(h[:])
+}
+
+// Get session valide, derniére activité mise à jour
+func (c *SessionStore) Get(sessionID string) *sessions.Session {
+	if !sessions.IsValidID(sessionID) {
+		return nil
+	}
+	var (
+		usrID        sql.NullInt64
+		login        sql.NullString
+		rightlevel   sql.NullInt64
+		lastActivity sql.NullTime
+	)
+	q := `SELECT usr_id, login, rightlevel, last_activity FROM ` + tblPrefix + `SESSION where id = ? `
+	err := MainDB.QueryRow(q, sessionHash(sessionID)).Scan(&usrID, &login, &rightlevel, &lastActivity)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Warning("dal", "SessionStore get %v", err)
+		}
+		return nil
+	}
+	if time.Since(lastActivity.Time) >= c.sessionDuration {
+		return nil
+	}
+
+	s := &sessions.Session{
+		Login:        login.String,
+		RightLevel:   int(rightlevel.Int64),
+		UserID:       int(usrID.Int64),
+		SessionId:    sessionID,
+		Data:         make(map[string]interface{}),
+		LastActivity: lastActivity.Time,
+	}
+	//activité tracée, sans écriture à chaque appel
+	if time.Since(s.LastActivity) > sessionActivityDelay {
+		s.LastActivity = time.Now()
+		if _, err = TxExec(nil, `UPDATE `+tblPrefix+`SESSION SET last_activity = ? where id = ? `, s.LastActivity, sessionHash(sessionID)); err != nil {
+			slog.Warning("dal", "SessionStore activity %v", err)
+		}
+	}
+	return s
+}
+
+// Add enregistrement d'une nouvelle session
+func (c *SessionStore) Add(s *sessions.Session) error {
+	q := `INSERT INTO ` + tblPrefix + `SESSION (id, usr_id, login, rightlevel, created_at, last_activity) VALUES(?,?,?,?,?,?) `
+	_, err := TxExec(nil, q, sessionHash(s.SessionId), s.UserID, s.Login, s.RightLevel, time.Now(), s.LastActivity)
+	return err
+}
+
+// Remove supprime une session donnée
+func (c *SessionStore) Remove(sessionID string) {
+	if _, err := TxExec(nil, `DELETE FROM `+tblPrefix+`SESSION where id = ? `, sessionHash(sessionID)); err != nil {
+		slog.Warning("dal", "SessionStore remove %v", err)
+	}
+}
+
+// RemoveUser supprime les sessions d'un utilisateur
+func (c *SessionStore) RemoveUser(userID int) {
+	if _, err := TxExec(nil, `DELETE FROM `+tblPrefix+`SESSION where usr_id = ? `, userID); err != nil {
+		slog.Warning("dal", "SessionStore remove user %v", err)
+	}
+}
+
+// Purge supprime les sessions expirées
+func (c *SessionStore) Purge() {
+	if _, err := TxExec(nil, `DELETE FROM `+tblPrefix+`SESSION where last_activity < ? `, time.Now().Add(-c.sessionDuration)); err != nil {
+		slog.Warning("dal", "SessionStore purge %v", err)
+	}
+}
+
+// List sessions valides, sans leur token (SessionId vide)
+func (c *SessionStore) List() []sessions.Session {
+	ret := make([]sessions.Session, 0)
+	q := `SELECT usr_id, login, rightlevel, last_activity FROM ` + tblPrefix + `SESSION where last_activity >= ? `
+	rows, err := MainDB.Query(q, time.Now().Add(-c.sessionDuration))
+	if err != nil {
+		slog.Warning("dal", "SessionStore list %v", err)
+		return ret
+	}
+	defer rows.Close()
+	var (
+		usrID        sql.NullInt64
+		login        sql.NullString
+		rightlevel   sql.NullInt64
+		lastActivity sql.NullTime
+	)
+	for rows.Next() {
+		if err = rows.Scan(&usrID, &login, &rightlevel, &lastActivity); err != nil {
+			slog.Warning("dal", "SessionStore list %v", err)
+			return ret
+		}
+		ret = append(ret, sessions.Session{
+			Login:        login.String,
+			RightLevel:   int(rightlevel.Int64),
+			UserID:       int(usrID.Int64),
+			LastActivity: lastActivity.Time,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,109 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SLABreachList historique des dépassements de SLA
+func SLABreachList(filter SearchQuery) ([]DbSLABreach, PagedResponse, error) {
+	var err error
+	arr := make([]DbSLABreach, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `SLABREACH SLABREACH 
+		left join ` + tblPrefix + `TASKFLOW TASKFLOW on TASKFLOW.id = SLABREACH.taskflowid
+		` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("SLABreachList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT SLABREACH.id, SLABREACH.taskflowid, TASKFLOW.lib, SLABREACH.run_id
+		, SLABREACH.kind, SLABREACH.dt_ref, SLABREACH.detected_at, SLABREACH.info
+		FROM ` + tblPrefix + `SLABREACH SLABREACH 
+		left join ` + tblPrefix + `TASKFLOW TASKFLOW on TASKFLOW.id = SLABREACH.taskflowid
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("SLABreachList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id         int
+		taskflowID sql.NullInt64
+		tfLib      sql.NullString
+		runID      sql.NullString
+		kind       sql.NullString
+		dtRef      sql.NullTime
+		detectedAt sql.NullTime
+		info       sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &taskflowID, &tfLib, &runID, &kind, &dtRef, &detectedAt, &info)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("SLABreachList scan %w", err)
+		}
+		arr = append(arr, DbSLABreach{
+			ID:          id,
+			TaskFlowID:  int(taskflowID.Int64),
+			TaskFlowLib: tfLib.String,
+			RunID:       runID.String,
+			Kind:        kind.String,
+			DtRef:       dtRef.Time,
+			DetectedAt:  detectedAt.Time,
+			Info:        info.String,
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("SLABreachList err %w", err)
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// SLABreachInsert trace d'un dépassement de SLA
+func SLABreachInsert(elm *DbSLABreach) error {
+	if elm.DetectedAt.IsZero() {
+		elm.DetectedAt = time.Now()
+	}
+	info := elm.Info
+	if len(info) > 500 {
+		info = info[:500]
+	}
+	q := `INSERT INTO ` + tblPrefix + `SLABREACH (taskflowid, run_id, kind, dt_ref, detected_at, info) 
+		VALUES(?,?,?,?,?,?) `
+	id, err := TxInsert(nil, q, elm.TaskFlowID, elm.RunID, elm.Kind, elm.DtRef, elm.DetectedAt, info)
+	if err != nil {
+		return fmt.Errorf("SLABreachInsert err %w", err)
+	}
+	elm.ID = int(id)
+	return nil
+}
+
+// SLADeadline heure de fin au plus tard d'une exec de date de référence dtRef
+// (le jour suivant si l'heure est antérieure à dtRef)
+func SLADeadline(finishBy string, dtRef time.Time) (time.Time, bool) {
+	hm, err := time.Parse(SLAFinishByFormat, strings.TrimSpace(finishBy))
+	if err != nil || dtRef.IsZero() {
+		return time.Time{}, false
+	}
+	d := time.Date(dtRef.Year(), dtRef.Month(), dtRef.Day(), hm.Hour(), hm.Minute(), 0, 0, dtRef.Location())
+	if d.Before(dtRef) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d, true
+}
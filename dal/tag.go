@@ -26,7 +26,7 @@ func TagList(filter SearchQuery) ([]DbTag, PagedResponse, error) {
 	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
 
 	// listing
-	q := ` SELECT TAG.id, TAG.lib, TAG.tgroup
+	q := ` SELECT TAG.id, TAG.lib, TAG.tgroup, TAG.emails
 		, USERC.login as loginC, TAG.created_at
 		, USERU.login as loginU, TAG.updated_at
 		FROM ` + tblPrefix + `TAG TAG 
@@ -44,21 +44,23 @@ func TagList(filter SearchQuery) ([]DbTag, PagedResponse, error) {
 		id        int
 		lib       sql.NullString
 		group     sql.NullString
+		emails    sql.NullString
 		createdAt sql.NullTime
 		updatedAt sql.NullTime
 		loginC    sql.NullString
 		loginU    sql.NullString
 	)
 	for rows.Next() {
-		err = rows.Scan(&id, &lib, &group, &loginC, &createdAt, &loginU, &updatedAt)
+		err = rows.Scan(&id, &lib, &group, &emails, &loginC, &createdAt, &loginU, &updatedAt)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("TagList scan %w", err)
 		}
 		arr = append(arr, DbTag{
-			ID:    id,
-			Lib:   lib.String,
-			Group: group.String,
-			Info:  stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
+			ID:     id,
+			Lib:    lib.String,
+			Group:  group.String,
+			Emails: splitStrFromStr(emails.String),
+			Info:   stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
 		})
 	}
 	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
@@ -88,9 +90,9 @@ func TagGet(id int) (DbTag, error) {
 func TagUpdate(elm DbTag, usrUpdater int, tx *sql.Tx) error {
 	q := `UPDATE ` + tblPrefix + `TAG SET
 		updated_by = ?, updated_at = ? 
-		, lib = ?, tgroup = ?
+		, lib = ?, tgroup = ?, emails = ?
 		where id = ? `
-	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Lib, elm.Group, elm.ID)
+	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Lib, elm.Group, mergeStrToStr(elm.Emails), elm.ID)
 	if err != nil {
 		return fmt.Errorf("TagUpdate err %w", err)
 	}
@@ -99,9 +101,9 @@ func TagUpdate(elm DbTag, usrUpdater int, tx *sql.Tx) error {
 }
 
 // TagDelete flag tag suppression
-func TagDelete(elmID int, usrUpdater int) error {
+func TagDelete(elmID int, usrUpdater int, tx *sql.Tx) error {
 	q := `DELETE FROM ` + tblPrefix + `TAG where id = ? `
-	_, err := TxExec(nil, q, elmID)
+	_, err := TxExec(tx, q, elmID)
 	if err != nil {
 		return fmt.Errorf("TagDelete err %w", err)
 	}
@@ -109,12 +111,17 @@ func TagDelete(elmID int, usrUpdater int) error {
 }
 
 // TagInsert insertion tag
-func TagInsert(elm *DbTag, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("TagInsert err %w", err)
+func TagInsert(elm *DbTag, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("TagInsert err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	//insert base
 	q := `INSERT INTO ` + tblPrefix + `TAG (created_by, created_at) VALUES(?,?) `
@@ -130,9 +137,11 @@ func TagInsert(elm *DbTag, usrUpdater int) error {
 		return fmt.Errorf("TagInsert err %w", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("TagInsert err %w", err)
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("TagInsert err %w", err)
+		}
 	}
 	return nil
 }
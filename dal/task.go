@@ -8,6 +8,11 @@ import (
 
 // TaskList liste des tasks
 func TaskList(filter SearchQuery) ([]DbTask, PagedResponse, error) {
+	return taskList(filter, nil)
+}
+
+// taskList idem TaskList, lecture dans la transaction fournie
+func taskList(filter SearchQuery, tx *sql.Tx) ([]DbTask, PagedResponse, error) {
 	var err error
 	arr := make([]DbTask, 0)
 	var pagedResp PagedResponse
@@ -16,7 +21,7 @@ func TaskList(filter SearchQuery) ([]DbTask, PagedResponse, error) {
 	var nbRow sql.NullInt64
 	if filter.Limit > 1 {
 		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `TASK TASK ` + filter.GetSQLWhere()
-		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		err = TxQueryRow(tx, q, filter.SQLParams...).Scan(&nbRow)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("TaskList NbRow %w", err)
 		}
@@ -26,7 +31,7 @@ func TaskList(filter SearchQuery) ([]DbTask, PagedResponse, error) {
 	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
 
 	// listing
-	q := ` SELECT TASK.id, TASK.lib, TASK.type, TASK.timeout, TASK.log_store, TASK.cmd, TASK.args, TASK.start_in, TASK.exec_on
+	q := ` SELECT TASK.id, TASK.lib, TASK.type, TASK.timeout, TASK.log_store, TASK.cmd, TASK.args, TASK.start_in, TASK.exec_on, TASK.owner_grp
 		, USERC.login as loginC, TASK.created_at
 		, USERU.login as loginU, TASK.updated_at
 		FROM ` + tblPrefix + `TASK TASK 
@@ -35,7 +40,7 @@ func TaskList(filter SearchQuery) ([]DbTask, PagedResponse, error) {
 		` + filter.GetSQLWhere()
 	q = filter.AppendPaging(q, nbRow.Int64)
 
-	rows, err := MainDB.Query(q, filter.SQLParams...)
+	rows, err := TxQuery(tx, q, filter.SQLParams...)
 	if err != nil {
 		return nil, pagedResp, fmt.Errorf("TaskList query %w", err)
 	}
@@ -50,27 +55,29 @@ func TaskList(filter SearchQuery) ([]DbTask, PagedResponse, error) {
 		args      sql.NullString
 		startIn   sql.NullString
 		execOn    sql.NullString
+		ownerGrp  sql.NullInt64
 		createdAt sql.NullTime
 		updatedAt sql.NullTime
 		loginC    sql.NullString
 		loginU    sql.NullString
 	)
 	for rows.Next() {
-		err = rows.Scan(&id, &lib, &ttype, &timeout, &logStore, &cmd, &args, &startIn, &execOn, &loginC, &createdAt, &loginU, &updatedAt)
+		err = rows.Scan(&id, &lib, &ttype, &timeout, &logStore, &cmd, &args, &startIn, &execOn, &ownerGrp, &loginC, &createdAt, &loginU, &updatedAt)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("TaskList scan %w", err)
 		}
 		arr = append(arr, DbTask{
-			ID:       id,
-			Lib:      lib.String,
-			Type:     ttype.String,
-			Timeout:  int(timeout.Int64),
-			LogStore: logStore.String,
-			Cmd:      cmd.String,
-			Args:     strsFromJSON(args.String),
-			StartIn:  startIn.String,
-			ExecOn:   splitIntFromStr(execOn.String),
-			Info:     stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
+			ID:         id,
+			Lib:        lib.String,
+			Type:       ttype.String,
+			Timeout:    int(timeout.Int64),
+			LogStore:   logStore.String,
+			Cmd:        cmd.String,
+			Args:       strsFromJSON(args.String),
+			StartIn:    startIn.String,
+			ExecOn:     splitIntFromStr(execOn.String),
+			OwnerGroup: int(ownerGrp.Int64),
+			Info:       stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
 		})
 	}
 	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
@@ -101,10 +108,10 @@ func TaskUpdate(elm DbTask, usrUpdater int, tx *sql.Tx) error {
 	q := `UPDATE ` + tblPrefix + `TASK SET
 		updated_by = ?, updated_at = ?
 		, lib = ?, type = ?, timeout = ?, log_store = ?, cmd = ?, args = ?
-		, start_in = ?, exec_on = ?
+		, start_in = ?, exec_on = ?, owner_grp = ?
 		where id = ? `
 	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Lib, elm.Type, elm.Timeout, elm.LogStore,
-		elm.Cmd, strsToJSON(&elm.Args), elm.StartIn, mergeIntToStr(elm.ExecOn), elm.ID)
+		elm.Cmd, strsToJSON(&elm.Args), elm.StartIn, mergeIntToStr(elm.ExecOn), elm.OwnerGroup, elm.ID)
 	if err != nil {
 		return fmt.Errorf("TaskUpdate err %w", err)
 	}
@@ -113,9 +120,9 @@ func TaskUpdate(elm DbTask, usrUpdater int, tx *sql.Tx) error {
 }
 
 // TaskDelete flag task suppression
-func TaskDelete(elmID int, usrUpdater int) error {
+func TaskDelete(elmID int, usrUpdater int, tx *sql.Tx) error {
 	q := `DELETE FROM ` + tblPrefix + `TASK where id = ? `
-	_, err := TxExec(nil, q, elmID)
+	_, err := TxExec(tx, q, elmID)
 	if err != nil {
 		return fmt.Errorf("TaskDelete err %w", err)
 	}
@@ -123,12 +130,17 @@ func TaskDelete(elmID int, usrUpdater int) error {
 }
 
 // TaskInsert insertion task
-func TaskInsert(elm *DbTask, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("TaskInsert err %w", err)
+func TaskInsert(elm *DbTask, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("TaskInsert err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	//insert base
 	q := `INSERT INTO ` + tblPrefix + `TASK (created_by, created_at) VALUES(?,?) `
@@ -144,9 +156,11 @@ func TaskInsert(elm *DbTask, usrUpdater int) error {
 		return fmt.Errorf("TaskInsert err %w", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("TaskInsert err %w", err)
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("TaskInsert err %w", err)
+		}
 	}
 	return nil
 }
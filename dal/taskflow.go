@@ -8,6 +8,11 @@ import (
 
 // TaskFlowList liste des taskflows
 func TaskFlowList(filter SearchQuery) ([]DbTaskFlow, PagedResponse, error) {
+	return taskFlowList(filter, nil)
+}
+
+// taskFlowList idem TaskFlowList, lecture dans la transaction fournie
+func taskFlowList(filter SearchQuery, tx *sql.Tx) ([]DbTaskFlow, PagedResponse, error) {
 	var err error
 	arr := make([]DbTaskFlow, 0)
 	arrMp := make(map[int]int) // id taskflow=idx arr
@@ -17,7 +22,7 @@ func TaskFlowList(filter SearchQuery) ([]DbTaskFlow, PagedResponse, error) {
 	var nbRow sql.NullInt64
 	if filter.Limit > 1 {
 		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `TASKFLOW TASKFLOW ` + filter.GetSQLWhere()
-		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		err = TxQueryRow(tx, q, filter.SQLParams...).Scan(&nbRow)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("TaskFlowList NbRow %w", err)
 		}
@@ -31,7 +36,9 @@ func TaskFlowList(filter SearchQuery) ([]DbTaskFlow, PagedResponse, error) {
 	, TASKFLOW.activ, TASKFLOW.manuallaunch, TASKFLOW.scheduleid
 	, TASKFLOW.err_management, TASKFLOW.queueid, TASKFLOW.last_start
 	, TASKFLOW.last_stop, TASKFLOW.last_result, TASKFLOW.last_msg
-	, TASKFLOW.named_args
+	, TASKFLOW.named_args, TASKFLOW.emails
+	, TASKFLOW.sla_start_delay, TASKFLOW.sla_max_duration, TASKFLOW.sla_finish_by
+	, TASKFLOW.version, TASKFLOW.owner_grp
 	, USERC.login as loginC, TASKFLOW.created_at
 	, USERU.login as loginU, TASKFLOW.updated_at	
 	FROM ` + tblPrefix + `TASKFLOW TASKFLOW 
@@ -40,7 +47,7 @@ func TaskFlowList(filter SearchQuery) ([]DbTaskFlow, PagedResponse, error) {
 	` + filter.GetSQLWhere()
 	q = filter.AppendPaging(q, nbRow.Int64)
 
-	rows, err := MainDB.Query(q, filter.SQLParams...)
+	rows, err := TxQuery(tx, q, filter.SQLParams...)
 	if err != nil {
 		return nil, pagedResp, fmt.Errorf("TaskFlowList query %w", err)
 	}
@@ -59,6 +66,12 @@ func TaskFlowList(filter SearchQuery) ([]DbTaskFlow, PagedResponse, error) {
 		lastResult    sql.NullInt64
 		lastMsg       sql.NullString
 		namedArgs     sql.NullString
+		emails        sql.NullString
+		slaStartDelay sql.NullInt64
+		slaMaxDur     sql.NullInt64
+		slaFinishBy   sql.NullString
+		version       sql.NullInt64
+		ownerGrp      sql.NullInt64
 		createdAt     sql.NullTime
 		updatedAt     sql.NullTime
 		loginC        sql.NullString
@@ -67,27 +80,34 @@ func TaskFlowList(filter SearchQuery) ([]DbTaskFlow, PagedResponse, error) {
 
 	for rows.Next() {
 		err = rows.Scan(&id, &lib, &tags, &activ, &manuallaunch, &scheduleID, &errManagement,
-			&queueID, &lastStart, &lastStop, &lastResult, &lastMsg, &namedArgs,
+			&queueID, &lastStart, &lastStop, &lastResult, &lastMsg, &namedArgs, &emails,
+			&slaStartDelay, &slaMaxDur, &slaFinishBy, &version, &ownerGrp,
 			&loginC, &createdAt, &loginU, &updatedAt)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("TaskFlowList scan %w", err)
 		}
 		arr = append(arr, DbTaskFlow{
-			ID:           id,
-			Lib:          lib.String,
-			Tags:         splitIntFromStr(tags.String),
-			Activ:        (activ.Int64 == 1),
-			NamedArgs:    mapFromJSON(namedArgs.String),
-			ManualLaunch: (manuallaunch.Int64 == 1),
-			ScheduleID:   int(scheduleID.Int64),
-			ErrMngt:      int(errManagement.Int64),
-			QueueID:      int(queueID.Int64),
-			LastStart:    lastStart.Time,
-			LastStop:     lastStop.Time,
-			LastResult:   int(lastResult.Int64),
-			LastMsg:      lastMsg.String,
-			Detail:       []DbTaskFlowDetail{},
-			Info:         stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
+			ID:             id,
+			Lib:            lib.String,
+			Tags:           splitIntFromStr(tags.String),
+			Activ:          (activ.Int64 == 1),
+			NamedArgs:      mapFromJSON(namedArgs.String),
+			ManualLaunch:   (manuallaunch.Int64 == 1),
+			ScheduleID:     int(scheduleID.Int64),
+			ErrMngt:        int(errManagement.Int64),
+			QueueID:        int(queueID.Int64),
+			LastStart:      lastStart.Time,
+			LastStop:       lastStop.Time,
+			LastResult:     int(lastResult.Int64),
+			LastMsg:        lastMsg.String,
+			Emails:         splitStrFromStr(emails.String),
+			SLAStartDelay:  int(slaStartDelay.Int64),
+			SLAMaxDuration: int(slaMaxDur.Int64),
+			SLAFinishBy:    slaFinishBy.String,
+			Version:        int(version.Int64),
+			OwnerGroup:     int(ownerGrp.Int64),
+			Detail:         []DbTaskFlowDetail{},
+			Info:           stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
 		})
 		arrMp[id] = len(arr) - 1
 	}
@@ -107,7 +127,7 @@ func TaskFlowList(filter SearchQuery) ([]DbTaskFlow, PagedResponse, error) {
 		}
 		q += `) order by TASKFLOWDETAIL.taskflowid, TASKFLOWDETAIL.idx`
 
-		rowsDet, err := MainDB.Query(q, idarr...)
+		rowsDet, err := TxQuery(tx, q, idarr...)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("TaskFlowList det query %w", err)
 		}
@@ -172,11 +192,14 @@ func TaskFlowUpdate(elm DbTaskFlow, usrUpdater int, transaction bool, tx *sql.Tx
 
 	q := `UPDATE ` + tblPrefix + `TASKFLOW SET updated_by = ?, updated_at = ? 
 		, lib = ?, tags = ? , activ = ?, manuallaunch = ?
-		, scheduleid = ?, err_management = ?, queueid = ?, named_args = ?	
+		, scheduleid = ?, err_management = ?, queueid = ?, named_args = ?
+		, emails = ?, sla_start_delay = ?, sla_max_duration = ?, sla_finish_by = ?
+		, owner_grp = ?
 		where id = ? `
 	_, err = TxExec(tx, q, usrUpdater, time.Now(), elm.Lib, mergeIntToStr(elm.Tags),
 		elm.Activ, elm.ManualLaunch, elm.ScheduleID, elm.ErrMngt, elm.QueueID,
-		mapToJSON(&elm.NamedArgs), elm.ID)
+		mapToJSON(&elm.NamedArgs), mergeStrToStr(elm.Emails),
+		elm.SLAStartDelay, elm.SLAMaxDuration, elm.SLAFinishBy, elm.OwnerGroup, elm.ID)
 	if err != nil {
 		return fmt.Errorf("TaskFlowUpdate err %w", err)
 	}
@@ -198,6 +221,12 @@ func TaskFlowUpdate(elm DbTaskFlow, usrUpdater int, transaction bool, tx *sql.Tx
 		}
 	}
 
+	//nouvelle version dans la meme transaction
+	_, err = TaskFlowVersionSave(elm.ID, usrUpdater, tx)
+	if err != nil {
+		return fmt.Errorf("TaskFlowUpdate err %w", err)
+	}
+
 	if innertx {
 		err = tx.Commit()
 		if err != nil {
@@ -209,12 +238,17 @@ func TaskFlowUpdate(elm DbTaskFlow, usrUpdater int, transaction bool, tx *sql.Tx
 }
 
 // TaskFlowDelete flag taskflow suppression
-func TaskFlowDelete(elmID int, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("TaskFlowDelete err %w", err)
+func TaskFlowDelete(elmID int, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("TaskFlowDelete err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	q := `DELETE FROM ` + tblPrefix + `TASKFLOWDETAIL where taskflowid = ? `
 	_, err = TxExec(tx, q, elmID)
@@ -222,27 +256,41 @@ func TaskFlowDelete(elmID int, usrUpdater int) error {
 		return fmt.Errorf("TaskFlowDelete err %w", err)
 	}
 
-	q = `DELETE FROM ` + tblPrefix + `TASKFLOW where id = ? `
+	//versions : id réutilisable après suppression
+	q = `DELETE FROM ` + tblPrefix + `TFVERSION where taskflowid = ? `
 	_, err = TxExec(tx, q, elmID)
 	if err != nil {
 		return fmt.Errorf("TaskFlowDelete err %w", err)
 	}
 
-	err = tx.Commit()
+	q = `DELETE FROM ` + tblPrefix + `TASKFLOW where id = ? `
+	_, err = TxExec(tx, q, elmID)
 	if err != nil {
 		return fmt.Errorf("TaskFlowDelete err %w", err)
 	}
 
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("TaskFlowDelete err %w", err)
+		}
+	}
+
 	return nil
 }
 
 // TaskFlowInsert insertion taskflow
-func TaskFlowInsert(elm *DbTaskFlow, usrUpdater int) error {
-	tx, err := MainDB.Begin()
-	if err != nil {
-		return fmt.Errorf("TaskFlowInsert err %w", err)
+func TaskFlowInsert(elm *DbTaskFlow, usrUpdater int, tx *sql.Tx) error {
+	var err error
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return fmt.Errorf("TaskFlowInsert err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
 	}
-	defer tx.Rollback()
 
 	//insert base
 	q := `INSERT INTO ` + tblPrefix + `TASKFLOW (created_by, created_at) VALUES(?,?) `
@@ -258,9 +306,11 @@ func TaskFlowInsert(elm *DbTaskFlow, usrUpdater int) error {
 		return fmt.Errorf("TaskFlowInsert err %w", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("TaskFlowInsert err %w", err)
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("TaskFlowInsert err %w", err)
+		}
 	}
 	return nil
 }
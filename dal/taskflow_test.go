@@ -0,0 +1,31 @@
+package dal
+
+import "testing"
+
+// TestTaskFlowSLA persistance des paramétres de SLA
+func TestTaskFlowSLA(t *testing.T) {
+	def := DbTaskFlow{Lib: "sla", SLAStartDelay: 15, SLAMaxDuration: 30, SLAFinishBy: "07:00",
+		Detail: []DbTaskFlowDetail{{Idx: 1, TaskID: 1}}}
+	if err := TaskFlowInsert(&def, testUsr, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer TaskFlowDelete(def.ID, testUsr, nil)
+
+	got, err := TaskFlowGet(def.ID)
+	if err != nil || got.SLAStartDelay != 15 || got.SLAMaxDuration != 30 || got.SLAFinishBy != "07:00" {
+		t.Errorf("TaskFlowGet %+v %v", got, err)
+	}
+}
+
+// TestTaskFlowLaunchArgs arguments de lancement manuel : déclarés et sans tags
+func TestTaskFlowLaunchArgs(t *testing.T) {
+	def := DbTaskFlow{NamedArgs: map[string]string{"DAY": "0"}}
+	if args, err := def.ValidateLaunchArgs(map[string]string{" day ": "1"}); err != nil || args["DAY"] != "1" {
+		t.Errorf("declared %v %v", args, err)
+	}
+	for _, args := range []map[string]string{{"other": "1"}, {"day": "<%secret:db%>"}} {
+		if _, err := def.ValidateLaunchArgs(args); err == nil {
+			t.Errorf("%v : error expected", args)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// TaskFlowRunList historique des exec
+func TaskFlowRunList(filter SearchQuery) ([]DbTaskFlowRun, PagedResponse, error) {
+	var err error
+	arr := make([]DbTaskFlowRun, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `TFRUN TFRUN 
+		left join ` + tblPrefix + `TASKFLOW TASKFLOW on TASKFLOW.id = TFRUN.taskflowid
+		` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("TaskFlowRunList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT TFRUN.id, TFRUN.run_id, TFRUN.taskflowid, TASKFLOW.lib, TFRUN.version
+		, TFRUN.launch_source, TFRUN.dt_ref, TFRUN.start_at, TFRUN.stop_at
+		, TFRUN.result, TFRUN.msg
+		FROM ` + tblPrefix + `TFRUN TFRUN 
+		left join ` + tblPrefix + `TASKFLOW TASKFLOW on TASKFLOW.id = TFRUN.taskflowid
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("TaskFlowRunList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id           int
+		runID        sql.NullString
+		taskflowID   sql.NullInt64
+		tfLib        sql.NullString
+		version      sql.NullInt64
+		launchSource sql.NullString
+		dtRef        sql.NullTime
+		startAt      sql.NullTime
+		stopAt       sql.NullTime
+		result       sql.NullInt64
+		msg          sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &runID, &taskflowID, &tfLib, &version, &launchSource,
+			&dtRef, &startAt, &stopAt, &result, &msg)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("TaskFlowRunList scan %w", err)
+		}
+		arr = append(arr, DbTaskFlowRun{
+			ID:           id,
+			RunID:        runID.String,
+			TaskFlowID:   int(taskflowID.Int64),
+			TaskFlowLib:  tfLib.String,
+			Version:      int(version.Int64),
+			LaunchSource: launchSource.String,
+			DtRef:        dtRef.Time,
+			StartAt:      startAt.Time,
+			StopAt:       stopAt.Time,
+			Result:       int(result.Int64),
+			Msg:          msg.String,
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("TaskFlowRunList err %w", err)
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// TaskFlowRunInsert trace d'une exec terminée
+func TaskFlowRunInsert(elm *DbTaskFlowRun) error {
+	q := `INSERT INTO ` + tblPrefix + `TFRUN (run_id, taskflowid, version, launch_source
+		, dt_ref, start_at, stop_at, result, msg) VALUES(?,?,?,?,?,?,?,?,?) `
+	id, err := TxInsert(nil, q, elm.RunID, elm.TaskFlowID, elm.Version, elm.LaunchSource,
+		elm.DtRef, elm.StartAt, elm.StopAt, elm.Result, elm.Msg)
+	if err != nil {
+		return fmt.Errorf("TaskFlowRunInsert err %w", err)
+	}
+	elm.ID = int(id)
+	return nil
+}
@@ -0,0 +1,301 @@
+package dal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Versions des taskflows : chaque modification de la définition d'un taskflow
+// (ou d'une tache qu'il référence) produit une nouvelle version immuable
+
+// TaskFlowVersionList liste des versions d'un taskflow (définition incluse sur demande)
+func TaskFlowVersionList(tfID int, filter SearchQuery, withDef bool) ([]DbTaskFlowVersion, PagedResponse, error) {
+	return taskFlowVersionList(tfID, filter, withDef, nil)
+}
+
+// taskFlowVersionList idem TaskFlowVersionList, lecture dans la transaction fournie
+func taskFlowVersionList(tfID int, filter SearchQuery, withDef bool, tx *sql.Tx) ([]DbTaskFlowVersion, PagedResponse, error) {
+	var err error
+	arr := make([]DbTaskFlowVersion, 0)
+	var pagedResp PagedResponse
+
+	//restriction au taskflow
+	if filter.SQLFilter != "" {
+		filter.SQLFilter = "(" + filter.SQLFilter + ") AND "
+	}
+	filter.SQLFilter += "TFVERSION.taskflowid = ?"
+	filter.SQLParams = append(filter.SQLParams, tfID)
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `TFVERSION TFVERSION 
+		left join  ` + tblPrefix + `USR USERC on USERC.id = TFVERSION.created_by
+		` + filter.GetSQLWhere()
+		err = TxQueryRow(tx, q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("TaskFlowVersionList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT TFVERSION.taskflowid, TFVERSION.version, TFVERSION.definition
+		, USERC.login as loginC, TFVERSION.created_at
+		FROM ` + tblPrefix + `TFVERSION TFVERSION 
+		left join  ` + tblPrefix + `USR USERC on USERC.id = TFVERSION.created_by
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := TxQuery(tx, q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("TaskFlowVersionList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		taskflowID int
+		version    int
+		definition sql.NullString
+		loginC     sql.NullString
+		createdAt  sql.NullTime
+	)
+	for rows.Next() {
+		err = rows.Scan(&taskflowID, &version, &definition, &loginC, &createdAt)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("TaskFlowVersionList scan %w", err)
+		}
+		elm := DbTaskFlowVersion{
+			TaskFlowID: taskflowID,
+			Version:    version,
+			CreatedAt:  createdAt.Time,
+			CreatedBy:  loginC.String,
+		}
+		if withDef {
+			elm.Definition = &DbTaskFlowVersionDef{}
+			if err = json.Unmarshal([]byte(definition.String), elm.Definition); err != nil {
+				return nil, pagedResp, fmt.Errorf("TaskFlowVersionList definition %w", err)
+			}
+		}
+		arr = append(arr, elm)
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("TaskFlowVersionList err %w", err)
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// TaskFlowVersionGet get d'une version (0 : derniére version)
+func TaskFlowVersionGet(tfID int, version int) (DbTaskFlowVersion, error) {
+	return taskFlowVersionGet(tfID, version, nil)
+}
+
+// taskFlowVersionGet idem TaskFlowVersionGet, lecture dans la transaction fournie
+func taskFlowVersionGet(tfID int, version int, tx *sql.Tx) (DbTaskFlowVersion, error) {
+	var ret DbTaskFlowVersion
+	//pas de tri sans paging : derniére version par sous requete
+	filter := SearchQuery{
+		Limit:     1,
+		SQLFilter: "TFVERSION.version = (SELECT max(version) FROM " + tblPrefix + "TFVERSION where taskflowid = ?)",
+		SQLParams: []interface{}{tfID},
+	}
+	if version > 0 {
+		filter.SQLFilter = "TFVERSION.version = ?"
+		filter.SQLParams = []interface{}{version}
+	}
+
+	arr, _, err := taskFlowVersionList(tfID, filter, true, tx)
+	if err != nil {
+		return ret, err
+	}
+	if len(arr) > 0 {
+		ret = arr[0]
+	}
+	return ret, nil
+}
+
+// taskFlowVersionDef définition en cours d'un taskflow (hors champs d'état)
+func taskFlowVersionDef(tfID int, tx *sql.Tx) (*DbTaskFlowVersionDef, error) {
+	tfs, _, err := taskFlowList(NewSearchQueryFromID("TASKFLOW", tfID), tx)
+	if err != nil || len(tfs) == 0 {
+		return nil, err
+	}
+	tf := tfs[0]
+	tf.Info = ""
+	tf.Version = 0
+	tf.LastStart = time.Time{}
+	tf.LastStop = time.Time{}
+	tf.LastResult = 0
+	tf.LastMsg = ""
+
+	def := &DbTaskFlowVersionDef{
+		TaskFlow: tf,
+		Tasks:    make([]DbTask, 0),
+	}
+	done := make(map[int]bool)
+	for _, d := range tf.Detail {
+		if done[d.TaskID] {
+			continue
+		}
+		done[d.TaskID] = true
+		ts, _, err := taskList(NewSearchQueryFromID("TASK", d.TaskID), tx)
+		if err != nil {
+			return nil, err
+		}
+		if len(ts) > 0 {
+			t := ts[0]
+			t.Info = ""
+			def.Tasks = append(def.Tasks, t)
+		}
+	}
+	sort.Slice(def.Tasks, func(i, j int) bool { return def.Tasks[i].ID < def.Tasks[j].ID })
+	return def, nil
+}
+
+// TaskFlowVersionSave enregistre la définition en cours du taskflow
+// si elle différe de la derniére version, retourne le n° de version en cours
+// tx fourni : lecture et enregistrement dans la transaction
+func TaskFlowVersionSave(tfID int, usrUpdater int, tx *sql.Tx) (int, error) {
+	def, err := taskFlowVersionDef(tfID, tx)
+	if err != nil {
+		return 0, fmt.Errorf("TaskFlowVersionSave err %w", err)
+	}
+	if def == nil {
+		return 0, nil
+	}
+	b, err := json.Marshal(def)
+	if err != nil {
+		return 0, fmt.Errorf("TaskFlowVersionSave err %w", err)
+	}
+
+	//derniére version identique : rien à faire
+	last, err := taskFlowVersionGet(tfID, 0, tx)
+	if err != nil {
+		return 0, fmt.Errorf("TaskFlowVersionSave err %w", err)
+	}
+	if last.Definition != nil {
+		lb, _ := json.Marshal(last.Definition)
+		if string(lb) == string(b) {
+			return last.Version, nil
+		}
+	}
+
+	innertx := false
+	if tx == nil {
+		tx, err = MainDB.Begin()
+		if err != nil {
+			return 0, fmt.Errorf("TaskFlowVersionSave err %w", err)
+		}
+		defer tx.Rollback()
+		innertx = true
+	}
+
+	version := last.Version + 1
+	q := `INSERT INTO ` + tblPrefix + `TFVERSION (taskflowid, version, definition, created_at, created_by) 
+		VALUES(?,?,?,?,?) `
+	_, err = TxExec(tx, q, tfID, version, string(b), time.Now(), usrUpdater)
+	if err != nil {
+		return 0, fmt.Errorf("TaskFlowVersionSave err %w", err)
+	}
+	_, err = TxExec(tx, `UPDATE `+tblPrefix+`TASKFLOW SET version = ? where id = ? `, version, tfID)
+	if err != nil {
+		return 0, fmt.Errorf("TaskFlowVersionSave err %w", err)
+	}
+	if innertx {
+		err = tx.Commit()
+		if err != nil {
+			return 0, fmt.Errorf("TaskFlowVersionSave err %w", err)
+		}
+	}
+	return version, nil
+}
+
+// taskFlowVersionBackfill enregistre une 1ere version pour les taskflows qui n'en ont pas
+func taskFlowVersionBackfill() error {
+	rows, err := MainDB.Query(`SELECT id FROM ` + tblPrefix + `TASKFLOW 
+		where id not in (SELECT taskflowid FROM ` + tblPrefix + `TFVERSION) `)
+	if err != nil {
+		return fmt.Errorf("taskFlowVersionBackfill err %w", err)
+	}
+	ids := make([]int, 0)
+	var id int
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("taskFlowVersionBackfill err %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, err = TaskFlowVersionSave(id, 0, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TaskFlowIDsUsingTask liste des taskflows référençant une tache
+func TaskFlowIDsUsingTask(taskID int) ([]int, error) {
+	ret := make([]int, 0)
+	rows, err := MainDB.Query(`SELECT DISTINCT taskflowid FROM `+tblPrefix+`TASKFLOWDETAIL where taskid = ? `, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("TaskFlowIDsUsingTask err %w", err)
+	}
+	defer rows.Close()
+	var id int
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("TaskFlowIDsUsingTask err %w", err)
+		}
+		ret = append(ret, id)
+	}
+	return ret, rows.Err()
+}
+
+// TaskFlowVersionDiff diff entre deux définitions : champs du taskflow et des taches modifiés
+func TaskFlowVersionDiff(from, to *DbTaskFlowVersionDef) map[string]interface{} {
+	ret := map[string]interface{}{
+		"taskflow": json.RawMessage(jsonOrNull(AuditDiff(&from.TaskFlow, &to.TaskFlow))),
+	}
+
+	tasks := make(map[string]json.RawMessage)
+	fromTasks := make(map[int]*DbTask)
+	for i := range from.Tasks {
+		fromTasks[from.Tasks[i].ID] = &from.Tasks[i]
+	}
+	for i := range to.Tasks {
+		id := to.Tasks[i].ID
+		var before interface{}
+		if t, exists := fromTasks[id]; exists {
+			before = t
+			delete(fromTasks, id)
+		}
+		if d := AuditDiff(before, &to.Tasks[i]); d != "" {
+			tasks[strconv.Itoa(id)] = json.RawMessage(d)
+		}
+	}
+	for id, t := range fromTasks {
+		if d := AuditDiff(t, nil); d != "" {
+			tasks[strconv.Itoa(id)] = json.RawMessage(d)
+		}
+	}
+	ret["tasks"] = tasks
+	return ret
+}
+
+// jsonOrNull chaine json vide remplacée par null
+func jsonOrNull(js string) string {
+	if js == "" {
+		return "null"
+	}
+	return js
+}
@@ -0,0 +1,107 @@
+package dal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTaskFlowVersionDiff(t *testing.T) {
+	from := &DbTaskFlowVersionDef{
+		TaskFlow: DbTaskFlow{ID: 1, Lib: "tf"},
+		Tasks: []DbTask{
+			{ID: 1, Lib: "t1", Cmd: "echo"},
+			{ID: 2, Lib: "t2", Cmd: "ls"},
+		},
+	}
+	to := &DbTaskFlowVersionDef{
+		TaskFlow: DbTaskFlow{ID: 1, Lib: "tf"},
+		Tasks: []DbTask{
+			{ID: 1, Lib: "t1", Cmd: "printf"},
+			{ID: 3, Lib: "t3", Cmd: "pwd"},
+		},
+	}
+
+	b, _ := json.Marshal(TaskFlowVersionDiff(from, to))
+	var diff struct {
+		TaskFlow map[string]interface{}                       `json:"taskflow"`
+		Tasks    map[string]map[string]map[string]interface{} `json:"tasks"`
+	}
+	if err := json.Unmarshal(b, &diff); err != nil {
+		t.Fatal(err)
+	}
+	if diff.TaskFlow != nil {
+		t.Errorf("taskflow unchanged : %v", diff.TaskFlow)
+	}
+	if len(diff.Tasks) != 3 || diff.Tasks["1"]["cmd"]["after"] != "printf" {
+		t.Errorf("tasks diff %v", diff.Tasks)
+	}
+	//tache retirée / ajoutée
+	if _, exists := diff.Tasks["2"]["cmd"]["after"]; exists || diff.Tasks["2"]["cmd"]["before"] != "ls" {
+		t.Errorf("removed task %v", diff.Tasks["2"])
+	}
+	if _, exists := diff.Tasks["3"]["cmd"]["before"]; exists {
+		t.Errorf("added task %v", diff.Tasks["3"])
+	}
+}
+
+// TestTaskFlowVersionBackfill version 1 des taskflows sans version
+func TestTaskFlowVersionBackfill(t *testing.T) {
+	def := DbTaskFlow{Lib: "backfill"}
+	if err := TaskFlowInsert(&def, testUsr, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer TaskFlowDelete(def.ID, testUsr, nil)
+	//taskflow antérieur aux versions
+	if _, err := MainDB.Exec(`DELETE FROM `+tblPrefix+`TFVERSION where taskflowid = ?`, def.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	//deux passages : une seule version
+	for i := 0; i < 2; i++ {
+		if err := taskFlowVersionBackfill(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	arr, _, err := TaskFlowVersionList(def.ID, SearchQuery{}, false)
+	if err != nil || len(arr) != 1 || arr[0].Version != 1 {
+		t.Errorf("versions %+v %v", arr, err)
+	}
+	if tf, _ := TaskFlowGet(def.ID); tf.Version != 1 {
+		t.Errorf("taskflow version %v", tf.Version)
+	}
+}
+
+// TestTaskFlowVersionTx version enregistrée dans la transaction de maj
+func TestTaskFlowVersionTx(t *testing.T) {
+	def := DbTaskFlow{Lib: "versiontx"}
+	if err := TaskFlowInsert(&def, testUsr, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer TaskFlowDelete(def.ID, testUsr, nil)
+	if tf, _ := TaskFlowGet(def.ID); tf.Version != 1 {
+		t.Fatalf("insert version %v", tf.Version)
+	}
+
+	//maj annulée : pas de nouvelle version
+	tx, err := MainDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.Lib = "versiontx rollback"
+	if err = TaskFlowUpdate(def, testUsr, true, tx); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if last, _ := TaskFlowVersionGet(def.ID, 0); last.Version != 1 {
+		t.Errorf("rollback version %v", last.Version)
+	}
+
+	def.Lib = "versiontx update"
+	if err = TaskFlowUpdate(def, testUsr, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	last, _ := TaskFlowVersionGet(def.ID, 0)
+	if last.Version != 2 || last.Definition.TaskFlow.Lib != "versiontx update" {
+		t.Errorf("update version %+v", last)
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidCredentials authentification refusée
+var ErrInvalidCredentials = fmt.Errorf("invalid user/password")
+
 // UserList liste des users
 func UserList(filter SearchQuery) ([]DbUser, PagedResponse, error) {
 	var err error
@@ -29,7 +32,7 @@ func UserList(filter SearchQuery) ([]DbUser, PagedResponse, error) {
 	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
 
 	// listing
-	q := ` SELECT USR.id, USR.name, USR.login, USR.password, USR.rightlevel
+	q := ` SELECT USR.id, USR.name, USR.login, USR.password, USR.rightlevel, USR.auth_source
 		, USERC.login as loginC, USR.created_at
 		, USERU.login as loginU, USR.updated_at
 		, USERD.login as loginD, USR.deleted_at
@@ -54,12 +57,13 @@ func UserList(filter SearchQuery) ([]DbUser, PagedResponse, error) {
 		loginU     sql.NullString
 		loginD     sql.NullString
 		rightlevel sql.NullInt64
+		source     sql.NullString
 		createdAt  sql.NullTime
 		updatedAt  sql.NullTime
 		deletedAt  sql.NullTime
 	)
 	for rows.Next() {
-		err = rows.Scan(&id, &name, &login, &pwd, &rightlevel, &loginC, &createdAt, &loginU, &updatedAt, &loginD, &deletedAt)
+		err = rows.Scan(&id, &name, &login, &pwd, &rightlevel, &source, &loginC, &createdAt, &loginU, &updatedAt, &loginD, &deletedAt)
 		if err != nil {
 			return nil, pagedResp, fmt.Errorf("UserList scan %w", err)
 		}
@@ -70,12 +74,27 @@ func UserList(filter SearchQuery) ([]DbUser, PagedResponse, error) {
 			PasswordHash: pwd.String,
 			RightLevel:   int(rightlevel.Int64),
 			Deleted:      deletedAt.Valid,
+			Source:       source.String,
 			Info:         stdInfo(&loginC, &loginU, &loginD, &createdAt, &updatedAt, &deletedAt),
 		})
 	}
 	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
 		return nil, pagedResp, fmt.Errorf("UserList err %w", err)
 	}
+	rows.Close()
+
+	//groupes
+	ids := make([]int, 0, len(arr))
+	for _, u := range arr {
+		ids = append(ids, u.ID)
+	}
+	groups, err := usersGroups(ids)
+	if err != nil {
+		return nil, pagedResp, err
+	}
+	for i := range arr {
+		arr[i].Groups = groups[arr[i].ID]
+	}
 	pagedResp.Data = arr
 
 	return arr, pagedResp, nil
@@ -103,11 +122,8 @@ func UserGet(id int) (DbUser, error) {
 	return ret, nil
 }
 
-// UserCheckAuth authentification user
-func UserCheckAuth(login string, password string) (DbUser, error) {
-	credErr := fmt.Errorf("invalid user/password")
-
-	//interro user de par le login
+// UserGetByLogin get d'un user de par son login, ID à 0 si inconnu
+func UserGetByLogin(login string) (DbUser, error) {
 	sq := SearchQuery{
 		Offset:    0,
 		Limit:     1,
@@ -115,21 +131,32 @@ func UserCheckAuth(login string, password string) (DbUser, error) {
 		SQLParams: []interface{}{login},
 	}
 	arr, _, err := UserList(sq)
+	if err != nil || len(arr) == 0 {
+		return DbUser{}, err
+	}
+	return arr[0], nil
+}
+
+// UserCheckAuth authentification user
+func UserCheckAuth(login string, password string) (DbUser, error) {
+	credErr := ErrInvalidCredentials
 
+	//interro user de par le login
+	usr, err := UserGetByLogin(login)
 	if err != nil {
 		return DbUser{}, err
 	}
-	if len(arr) != 1 {
+	if usr.ID == 0 {
 		return DbUser{}, credErr
 	}
 
 	//ctrl password
-	err = bcrypt.CompareHashAndPassword([]byte(arr[0].PasswordHash), []byte(password))
+	err = bcrypt.CompareHashAndPassword([]byte(usr.PasswordHash), []byte(password))
 	if err != nil {
 		return DbUser{}, credErr
 	}
 
-	return arr[0], nil
+	return usr, nil
 }
 
 // UserUpdate maj user
@@ -150,6 +177,13 @@ func UserUpdate(elm DbUser, usrUpdater int, tx *sql.Tx) error {
 		return fmt.Errorf("UserUpdate err %w", err)
 	}
 
+	//groupes, non fournis : inchangés
+	if elm.Groups != nil {
+		if err = userGroupsUpdate(elm.ID, elm.Groups, tx); err != nil {
+			return fmt.Errorf("UserUpdate err %w", err)
+		}
+	}
+
 	//maj password
 	if elm.Password != "" {
 		hash, err := bcrypt.GenerateFromPassword([]byte(elm.Password), bcrypt.DefaultCost) //bcrypt inclus déja un salt
@@ -184,8 +218,8 @@ func UserInsert(elm *DbUser, usrUpdater int) error {
 	defer tx.Rollback()
 
 	//insert base
-	q := `INSERT INTO ` + tblPrefix + `USR (login, created_by, created_at) VALUES(?,?,?) `
-	id, err := TxInsert(tx, q, elm.Login, usrUpdater, time.Now())
+	q := `INSERT INTO ` + tblPrefix + `USR (login, auth_source, created_by, created_at) VALUES(?,?,?,?) `
+	id, err := TxInsert(tx, q, elm.Login, elm.Source, usrUpdater, time.Now())
 	if err != nil {
 		return fmt.Errorf("UserInsert err %w", err)
 	}
@@ -0,0 +1,223 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Variables globales : stockées dans la table de config kv sous le préfixe var.
+//  var.NAME           : valeur par défaut
+//  var.PROFILE.NAME   : valeur spécifique à un profil d'environnement
+// utilisables dans les taches et taskflows via <%var:NAME%>
+
+// VarPrefix préfixe des clés de variables globales dans la table de config
+const VarPrefix = "var."
+
+var (
+	varProfile      string
+	varProfileMutex sync.RWMutex
+
+	rexpVarName = regexp.MustCompile(`^[A-Z0-9_-]+$`)
+	// RexpVarTag tag de référence à une variable globale : <%var:NAME%>
+	RexpVarTag = regexp.MustCompile(`(?i)<%var:([A-Za-z0-9_\-]+)%>`)
+)
+
+// DbVar variable globale
+type DbVar struct {
+	Name    string `json:"name"`
+	Profile string `json:"profile"` //vide : valeur par défaut
+	Value   string `json:"value"`
+}
+
+// VarUsage utilisation d'une variable globale
+type VarUsage struct {
+	Name      string `json:"name"`
+	Tasks     []int  `json:"tasks"`
+	TaskFlows []int  `json:"taskflows"`
+}
+
+// SetVarProfile profil d'environnement actif pour la résolution des variables
+func SetVarProfile(profile string) {
+	varProfileMutex.Lock()
+	defer varProfileMutex.Unlock()
+	varProfile = strings.ToLower(strings.TrimSpace(profile))
+}
+
+// GetVarProfile profil d'environnement actif
+func GetVarProfile() string {
+	varProfileMutex.RLock()
+	defer varProfileMutex.RUnlock()
+	return varProfile
+}
+
+// Validate pour controle de validité
+func (c *DbVar) Validate() error {
+	c.Name = strings.ToUpper(strings.TrimSpace(c.Name))
+	if !rexpVarName.MatchString(c.Name) {
+		return fmt.Errorf("invalid name (A-Z, 0-9, _ and - allowed)")
+	}
+	c.Profile = strings.ToLower(strings.TrimSpace(c.Profile))
+	if c.Profile != "" && !rexpVarName.MatchString(strings.ToUpper(c.Profile)) {
+		return fmt.Errorf("invalid profile (a-z, 0-9, _ and - allowed)")
+	}
+	return nil
+}
+
+// CfgKey clé dans la table de config
+func (c *DbVar) CfgKey() string {
+	if c.Profile == "" {
+		return VarPrefix + strings.ToLower(c.Name)
+	}
+	return VarPrefix + c.Profile + "." + strings.ToLower(c.Name)
+}
+
+// VarList liste des variables globales (tous profils)
+func VarList() ([]DbVar, error) {
+	arr := make([]DbVar, 0)
+
+	var k, v sql.NullString
+	rows, err := MainDB.Query("SELECT KID, KVAL FROM "+tblPrefix+"CFG where KID like ? ORDER BY KID", VarPrefix+"%")
+	if err != nil {
+		return nil, fmt.Errorf("VarList query %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = rows.Scan(&k, &v)
+		if err != nil {
+			return nil, fmt.Errorf("VarList scan %w", err)
+		}
+		elm := DbVar{Value: v.String}
+		parts := strings.Split(strings.TrimPrefix(k.String, VarPrefix), ".")
+		elm.Name = strings.ToUpper(parts[len(parts)-1])
+		if len(parts) > 1 {
+			elm.Profile = strings.Join(parts[:len(parts)-1], ".")
+		}
+		arr = append(arr, elm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("VarList err %w", err)
+	}
+
+	sort.SliceStable(arr, func(i, j int) bool {
+		if arr[i].Name != arr[j].Name {
+			return arr[i].Name < arr[j].Name
+		}
+		return arr[i].Profile < arr[j].Profile
+	})
+	return arr, nil
+}
+
+// VarSet maj d'une variable (valeur vide : suppression)
+func VarSet(elm DbVar) error {
+	return CfgKVSet(elm.CfgKey(), elm.Value)
+}
+
+// VarValues valeurs des variables pour le profil actif (valeur du profil prioritaire sur le défaut)
+func VarValues() (map[string]string, error) {
+	arr, err := VarList()
+	if err != nil {
+		return nil, err
+	}
+	profile := GetVarProfile()
+	ret := make(map[string]string)
+	for _, v := range arr {
+		if v.Profile == "" {
+			if _, exists := ret[v.Name]; !exists {
+				ret[v.Name] = v.Value
+			}
+		}
+	}
+	for _, v := range arr {
+		if profile != "" && v.Profile == profile {
+			ret[v.Name] = v.Value
+		}
+	}
+	return ret, nil
+}
+
+// ReplaceVars remplace les tags <%var:NAME%>, erreur si variable inconnue
+func ReplaceVars(in string, vals map[string]string) (string, error) {
+	var errVar error
+	out := RexpVarTag.ReplaceAllStringFunc(in, func(tag string) string {
+		name := strings.ToUpper(RexpVarTag.FindStringSubmatch(tag)[1])
+		val, exists := vals[name]
+		if !exists {
+			if errVar == nil {
+				errVar = fmt.Errorf("variable %v not found", name)
+			}
+			return tag
+		}
+		return val
+	})
+	return out, errVar
+}
+
+// varNames noms des variables référencées
+func varNames(in string, names map[string]bool) {
+	for _, m := range RexpVarTag.FindAllStringSubmatch(in, -1) {
+		names[strings.ToUpper(m[1])] = true
+	}
+}
+
+// VarUsages liste des taches et taskflows utilisant chaque variable
+func VarUsages() ([]VarUsage, error) {
+	usages := make(map[string]*VarUsage)
+	get := func(name string) *VarUsage {
+		if _, exists := usages[name]; !exists {
+			usages[name] = &VarUsage{Name: name, Tasks: []int{}, TaskFlows: []int{}}
+		}
+		return usages[name]
+	}
+
+	//variables déclarées, même inutilisées
+	vars, err := VarList()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vars {
+		get(v.Name)
+	}
+
+	tasks, _, err := TaskList(SearchQuery{})
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		names := make(map[string]bool)
+		varNames(t.Cmd, names)
+		varNames(t.StartIn, names)
+		for _, a := range t.Args {
+			varNames(a, names)
+		}
+		for n := range names {
+			u := get(n)
+			u.Tasks = append(u.Tasks, t.ID)
+		}
+	}
+
+	tfs, _, err := TaskFlowList(SearchQuery{})
+	if err != nil {
+		return nil, err
+	}
+	for _, tf := range tfs {
+		names := make(map[string]bool)
+		for _, a := range tf.NamedArgs {
+			varNames(a, names)
+		}
+		for n := range names {
+			u := get(n)
+			u.TaskFlows = append(u.TaskFlows, tf.ID)
+		}
+	}
+
+	arr := make([]VarUsage, 0, len(usages))
+	for _, u := range usages {
+		arr = append(arr, *u)
+	}
+	sort.Slice(arr, func(i, j int) bool { return arr[i].Name < arr[j].Name })
+	return arr, nil
+}
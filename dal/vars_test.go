@@ -0,0 +1,14 @@
+package dal
+
+import "testing"
+
+func TestReplaceVars(t *testing.T) {
+	vals := map[string]string{"ROOT": "/data", "DB": "srv01"}
+	out, err := ReplaceVars("<%var:root%>/in -s <%VAR:DB%> <%DT_YYYY%>", vals)
+	if err != nil || out != "/data/in -s srv01 <%DT_YYYY%>" {
+		t.Errorf("ReplaceVars : %v %v", out, err)
+	}
+	if _, err = ReplaceVars("<%var:UNKNOWN%>", vals); err == nil {
+		t.Errorf("unknown var : error expected")
+	}
+}
@@ -0,0 +1,175 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Secret : coffre des données sensibles (mot de passe...) utilisés dans les arguments des taches
+// la valeur est stockée chiffrée et n'est jamais restituée par les listes
+
+// SecretList liste des secrets (sans leur valeur)
+func SecretList(filter SearchQuery) ([]DbSecret, PagedResponse, error) {
+	var err error
+	arr := make([]DbSecret, 0)
+	var pagedResp PagedResponse
+
+	//nb rows
+	var nbRow sql.NullInt64
+	if filter.Limit > 1 {
+		q := ` SELECT count(*) as Nb FROM ` + tblPrefix + `SECRET SECRET ` + filter.GetSQLWhere()
+		err = MainDB.QueryRow(q, filter.SQLParams...).Scan(&nbRow)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("SecretList NbRow %w", err)
+		}
+	}
+
+	//pour retour d'info avec info paging
+	pagedResp = NewPagedResponse(arr, filter, int(nbRow.Int64))
+
+	// listing
+	q := ` SELECT SECRET.id, SECRET.name
+		, USERC.login as loginC, SECRET.created_at
+		, USERU.login as loginU, SECRET.updated_at
+		FROM ` + tblPrefix + `SECRET SECRET 
+		left join  ` + tblPrefix + `USR USERC on USERC.id = SECRET.created_by
+		left join  ` + tblPrefix + `USR USERU on USERU.id = SECRET.updated_by
+		` + filter.GetSQLWhere()
+	q = filter.AppendPaging(q, nbRow.Int64)
+
+	rows, err := MainDB.Query(q, filter.SQLParams...)
+	if err != nil {
+		return nil, pagedResp, fmt.Errorf("SecretList query %w", err)
+	}
+	defer rows.Close()
+	var (
+		id        int
+		name      sql.NullString
+		createdAt sql.NullTime
+		updatedAt sql.NullTime
+		loginC    sql.NullString
+		loginU    sql.NullString
+	)
+	for rows.Next() {
+		err = rows.Scan(&id, &name, &loginC, &createdAt, &loginU, &updatedAt)
+		if err != nil {
+			return nil, pagedResp, fmt.Errorf("SecretList scan %w", err)
+		}
+		arr = append(arr, DbSecret{
+			ID:   id,
+			Name: name.String,
+			Info: stdInfo(&loginC, &loginU, nil, &createdAt, &updatedAt, nil),
+		})
+	}
+	if rows.Err() != nil && rows.Err() != sql.ErrNoRows {
+		return nil, pagedResp, fmt.Errorf("SecretList err %w", err)
+	}
+	pagedResp.Data = arr
+
+	return arr, pagedResp, nil
+}
+
+// SecretGet get d'un secret (sans sa valeur)
+func SecretGet(id int) (DbSecret, error) {
+	var ret DbSecret
+	filter := NewSearchQueryFromID("SECRET", id)
+
+	arr, _, err := SecretList(filter)
+	if err != nil {
+		return ret, err
+	}
+	if len(arr) > 0 {
+		ret = arr[0]
+	}
+	return ret, nil
+}
+
+// SecretNameAvailable retourne vrai si le nom n'est pas utilisé par un autre secret
+func SecretNameAvailable(name string, id int) bool {
+	q := ` SELECT 1 FROM ` + tblPrefix + `SECRET SECRET where SECRET.name = ? and SECRET.id <> ? `
+	var n sql.NullInt64
+	err := MainDB.QueryRow(q, name, id).Scan(&n)
+	return err == sql.ErrNoRows
+}
+
+// SecretGetValue valeur déchiffrée d'un secret (usage interne au lancement des taches)
+func SecretGetValue(name string) (string, error) {
+	var val sql.NullString
+	q := ` SELECT SECRET.value FROM ` + tblPrefix + `SECRET SECRET where SECRET.name = ? `
+	err := MainDB.QueryRow(q, strings.ToUpper(strings.TrimSpace(name))).Scan(&val)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("secret %v not found", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("SecretGetValue err %w", err)
+	}
+	dec, err := decryptSecret(val.String)
+	if err != nil {
+		return "", fmt.Errorf("SecretGetValue %v %w", name, err)
+	}
+	return dec, nil
+}
+
+// SecretUpdate maj secret (valeur vide : valeur existante conservée)
+func SecretUpdate(elm DbSecret, usrUpdater int, tx *sql.Tx) error {
+	q := `UPDATE ` + tblPrefix + `SECRET SET
+		updated_by = ?, updated_at = ?, name = ?
+		where id = ? `
+	_, err := TxExec(tx, q, usrUpdater, time.Now(), elm.Name, elm.ID)
+	if err != nil {
+		return fmt.Errorf("SecretUpdate err %w", err)
+	}
+
+	if elm.Value != "" {
+		enc, err := encryptSecret(elm.Value)
+		if err != nil {
+			return fmt.Errorf("SecretUpdate value %w", err)
+		}
+		_, err = TxExec(tx, `UPDATE `+tblPrefix+`SECRET SET value = ? where id = ? `, enc, elm.ID)
+		if err != nil {
+			return fmt.Errorf("SecretUpdate err %w", err)
+		}
+	}
+	return nil
+}
+
+// SecretDelete suppression
+func SecretDelete(elmID int, usrUpdater int) error {
+	q := `DELETE FROM ` + tblPrefix + `SECRET where id = ? `
+	_, err := TxExec(nil, q, elmID)
+	if err != nil {
+		return fmt.Errorf("SecretDelete err %w", err)
+	}
+	return nil
+}
+
+// SecretInsert insertion secret
+func SecretInsert(elm *DbSecret, usrUpdater int) error {
+	tx, err := MainDB.Begin()
+	if err != nil {
+		return fmt.Errorf("SecretInsert err %w", err)
+	}
+	defer tx.Rollback()
+
+	//insert base
+	q := `INSERT INTO ` + tblPrefix + `SECRET (created_by, created_at) VALUES(?,?) `
+	id, err := TxInsert(tx, q, usrUpdater, time.Now())
+	if err != nil {
+		return fmt.Errorf("SecretInsert err %w", err)
+	}
+
+	//mj pour le reste des champs
+	elm.ID = int(id)
+	err = SecretUpdate(*elm, usrUpdater, tx)
+	if err != nil {
+		return fmt.Errorf("SecretInsert err %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("SecretInsert err %w", err)
+	}
+	return nil
+}
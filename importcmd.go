@@ -0,0 +1,126 @@
+package main
+
+import (
+	"CmdScheduler/dal"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// runImport commande import : conversion de crontabs ou de taches planifiées windows
+// import crontab|schtasks -agent host [options] fichiers...
+// sans -apply, le bundle généré est écrit en yaml (pour /import ou gitops), sinon il est appliqué à la base :
+// les entités gérées par gitops ne sont pas modifiables, et le scheduleur doit être redémarré pour prendre en compte l'import
+func runImport(args []string) error {
+	if len(args) == 0 || (args[0] != "crontab" && args[0] != "schtasks") {
+		return fmt.Errorf("usage : import crontab|schtasks -agent host [options] files...")
+	}
+	kind := args[0]
+	var opt dal.LegacyImportOpt
+	fs := flag.NewFlagSet("import "+kind, flag.ContinueOnError)
+	fs.StringVar(&opt.Agent, "agent", "", "host of the agent running the tasks (required)")
+	fs.StringVar(&opt.Queue, "queue", "", "queue of the taskflows")
+	fs.StringVar(&opt.Prefix, "prefix", "", "prefix of the generated names")
+	fs.BoolVar(&opt.Activ, "activ", false, "activate the taskflows")
+	fs.StringVar(&opt.TimeZone, "tz", "", "time zone of the schedules")
+	fs.BoolVar(&opt.System, "system", false, "system crontab, with a user field")
+	apply := fs.Bool("apply", false, "apply to the database instead of printing the bundle")
+	dryRun := fs.Bool("dryrun", false, "with -apply, print the plan only")
+	cfgArg := fs.String("config", "", "config file (with -apply)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if opt.Agent == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("agent and files required")
+	}
+
+	//conversion et fusion des fichiers
+	b := dal.Bundle{Version: dal.BundleFormatVersion}
+	skipped := 0
+	for _, f := range fs.Args() {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var fb dal.Bundle
+		var report []dal.LegacyUnsupported
+		if kind == "crontab" {
+			fb, report = dal.CrontabToBundle(string(data), opt)
+		} else {
+			name := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+			if fb, report, err = dal.SchTasksToBundle(name, data, opt); err != nil {
+				return fmt.Errorf("%v : %w", f, err)
+			}
+		}
+		for _, e := range report {
+			state := "approximated"
+			if e.Skipped {
+				state = "skipped"
+				skipped++
+			}
+			fmt.Fprintf(os.Stderr, "%v %v : %v, %v (%v)\n", f, e.Source, e.Construct, e.Detail, state)
+		}
+		b.Schedules = append(b.Schedules, fb.Schedules...)
+		b.Tasks = append(b.Tasks, fb.Tasks...)
+		b.TaskFlows = append(b.TaskFlows, fb.TaskFlows...)
+	}
+	fmt.Fprintf(os.Stderr, "%v taskflow(s), %v construct(s) skipped\n", len(b.TaskFlows), skipped)
+
+	if !*apply {
+		out, err := yaml.Marshal(&b)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	//application directe en base
+	if err := readConfig(*cfgArg); err != nil {
+		return err
+	}
+	if err := initSecretKey(); err != nil {
+		return err
+	}
+	if err := dal.InitDb(viper.GetString("db_driver"), viper.GetString("db_datasource"), viper.GetString("db_prefix")); err != nil {
+		return err
+	}
+	plan, err := dal.BundleImport(&b, dal.BundleImportOpt{Apply: !*dryRun, Protected: true}, 0)
+	if err != nil {
+		return err
+	}
+	for _, item := range plan {
+		fmt.Printf("%v %v %v\n", item.Action, item.Entity, item.Name)
+		if *dryRun {
+			continue
+		}
+		err = dal.AuditInsert(&dal.DbAudit{Login: "import", Entity: item.Entity, EntityID: fmt.Sprint(item.ID),
+			Action: item.Action, Diff: dal.AuditDiff(item.Before, item.After)})
+		if err != nil {
+			return err
+		}
+	}
+	if *dryRun || len(plan) == 0 {
+		return nil
+	}
+	//versions des taskflows (taches modifiées incluses)
+	tfs, _, err := dal.TaskFlowList(dal.SearchQuery{})
+	if err != nil {
+		return err
+	}
+	for _, tf := range tfs {
+		if _, err = dal.TaskFlowVersionSave(tf.ID, 0, nil); err != nil {
+			return err
+		}
+	}
+	//base modifiée hors du process du scheduleur : pas de notification possible
+	fmt.Fprintln(os.Stderr, "applied, restart the scheduler to load the changes")
+	return nil
+}
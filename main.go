@@ -1,12 +1,16 @@
 package main
 
 import (
+	"CmdScheduler/agent"
+	"CmdScheduler/auth"
+	"CmdScheduler/ctl"
 	"CmdScheduler/ctrl"
 	"CmdScheduler/dal"
 	"CmdScheduler/schd"
 	"CmdScheduler/sessions"
 	"CmdScheduler/slog"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -25,12 +29,53 @@ func main() {
 	flog = filepath.Join(flog, "CmdScheduler.txt")
 	slog.InitLogs(flog, 20, 3, false)
 
+	//commande éventuelle puis fichier de config
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "ctl" {
+		if err := ctl.Run(args[1:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "import" {
+		if err := runImport(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	cmd := ""
+	if len(args) > 0 && args[0] == "rotate-key" {
+		cmd = args[0]
+		args = args[1:]
+	}
+	cfgArg := ""
+	if len(args) > 0 {
+		cfgArg = args[0]
+	}
+
 	//lecture config
-	err := readConfig()
+	err := readConfig(cfgArg)
 	if err != nil {
 		slog.Fatal("main", "readConfig %v", err)
 	}
 
+	//clé de chiffrement des données sensibles
+	err = initSecretKey()
+	if err != nil {
+		slog.Fatal("main", "initSecretKey %v", err)
+	}
+
+	//certificat client présenté aux agents (mTLS)
+	err = agent.SetClientCertificate(viper.GetString("agent_client_cert"), viper.GetString("agent_client_key"))
+	if err != nil {
+		slog.Fatal("main", "SetClientCertificate %v", err)
+	}
+
+	//profil d'environnement des variables globales
+	dal.SetVarProfile(viper.GetString("var_profile"))
+
 	//prepa db
 	slog.Trace("main", "Starting...")
 	err = dal.InitDb(viper.GetString("db_driver"), viper.GetString("db_datasource"), viper.GetString("db_prefix"))
@@ -38,6 +83,16 @@ func main() {
 		slog.Fatal("main", "InitDb %v", err)
 	}
 
+	//rotation de la clé de chiffrement (scheduleur arrêté)
+	if cmd == "rotate-key" {
+		err = rotateSecretKey()
+		if err != nil {
+			slog.Fatal("main", "rotateSecretKey %v", err)
+		}
+		slog.Trace("main", "Secret key rotated")
+		return
+	}
+
 	//init session key
 	err = initSessionKey()
 	if err != nil {
@@ -50,7 +105,21 @@ func main() {
 	if sesDuration.Minutes() <= 0 || sesDuration.Hours() > 9999 {
 		sesDuration = time.Minute * 20
 	}
-	sessions.InitSessionStore(sesDuration)
+	switch viper.GetString("session_store") {
+	case "db":
+		//sessions conservées au redémarrage
+		sessions.InitSessionStore(dal.NewSessionStore(sesDuration))
+	case "memory":
+		sessions.InitSessionStore(sessions.NewMemoryStore(sesDuration))
+	default:
+		slog.Fatal("main", "invalid session_store %v (memory or db)", viper.GetString("session_store"))
+	}
+
+	//init fournisseurs d'authentification
+	err = initAuthProviders()
+	if err != nil {
+		slog.Fatal("main", "initAuthProviders %v", err)
+	}
 
 	//goroutine de maintenance
 	tickerCache := time.NewTicker(time.Duration(10) * time.Minute)
@@ -66,6 +135,13 @@ func main() {
 	schd.Start()
 	defer schd.Stop()
 
+	//synchro gitops de la config depuis un répertoire
+	schd.StartGitOps(viper.GetString("gitops_dir"), time.Duration(viper.GetInt("gitops_poll"))*time.Second,
+		time.Duration(viper.GetInt("gitops_resync"))*time.Minute)
+
+	//token de scrape prometheus de /metrics
+	ctrl.MetricsToken = viper.GetString("metrics_token")
+
 	//Mise en écoute de l'interface REST
 	restPort := viper.GetInt("http_port")
 	strListenOn := ":" + strconv.Itoa(restPort)
@@ -73,6 +149,47 @@ func main() {
 	log.Fatal(ctrl.ListenAndServe(strListenOn))
 }
 
+// initAuthProviders chaine des fournisseurs d'authentification (auth_providers) et connexion oidc
+func initAuthProviders() error {
+	var providers []auth.Provider
+	for _, name := range viper.GetStringSlice("auth_providers") {
+		switch name {
+		case "local":
+			providers = append(providers, auth.LocalProvider{})
+		case "ldap":
+			var cfg auth.LDAPConfig
+			if err := viper.UnmarshalKey("ldap", &cfg); err != nil {
+				return fmt.Errorf("ldap config %w", err)
+			}
+			p, err := auth.NewLDAPProvider(cfg)
+			if err != nil {
+				return err
+			}
+			providers = append(providers, p)
+		default:
+			return fmt.Errorf("invalid auth provider %v (local or ldap)", name)
+		}
+	}
+	if len(providers) == 0 {
+		return fmt.Errorf("no auth provider")
+	}
+	auth.Init(providers...)
+
+	//connexion openid connect (navigateur), hors chaine login / mot de passe
+	if viper.GetString("oidc.issuer") != "" {
+		var cfg auth.OIDCConfig
+		if err := viper.UnmarshalKey("oidc", &cfg); err != nil {
+			return fmt.Errorf("oidc config %w", err)
+		}
+		p, err := auth.NewOIDCProvider(cfg)
+		if err != nil {
+			return err
+		}
+		ctrl.OIDC = p
+	}
+	return nil
+}
+
 // initSessionKey SESSION_KEY (pour cookie sécurisé)
 func initSessionKey() error {
 	sk, err := dal.CfgKVGet("web.session_key")
@@ -96,3 +213,54 @@ func initSessionKey() error {
 
 	return nil
 }
+
+// initSecretKey clé de chiffrement des données sensibles stockées en bdd
+// fournie en hex par secret_key, ou à defaut lue depuis secret_key_file (crée si absent)
+func initSecretKey() error {
+	var key []byte
+	var err error
+	if k := viper.GetString("secret_key"); k != "" {
+		key, err = dal.ParseSecretKey(k)
+	} else {
+		key, err = dal.LoadSecretKeyFile(viper.GetString("secret_key_file"))
+	}
+	if err != nil {
+		return err
+	}
+	return dal.SetSecretKey(key)
+}
+
+// rotateSecretKey génére une nouvelle clé et rechiffre les données sensibles
+func rotateSecretKey() error {
+	newKey, err := dal.GenerateSecretKey()
+	if err != nil {
+		return err
+	}
+
+	//clé fournie directement dans la config : à reporter manuellement
+	if viper.GetString("secret_key") != "" {
+		err = dal.RotateSecretKey(newKey)
+		if err != nil {
+			return err
+		}
+		fmt.Println("New secret_key (update the config file) : " + hex.EncodeToString(newKey))
+		return nil
+	}
+
+	//fichier clé : nouvelle clé écrite avant rechiffrement pour ne pas la perdre en cas d'incident
+	keyFile := viper.GetString("secret_key_file")
+	err = dal.WriteSecretKeyFile(keyFile+".new", newKey)
+	if err != nil {
+		return err
+	}
+	err = dal.RotateSecretKey(newKey)
+	if err != nil {
+		os.Remove(keyFile + ".new")
+		return err
+	}
+	err = os.Rename(keyFile, keyFile+".old")
+	if err != nil {
+		return err
+	}
+	return os.Rename(keyFile+".new", keyFile)
+}
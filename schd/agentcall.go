@@ -2,12 +2,14 @@ package schd
 
 import (
 	"CmdScheduler/agent"
+	"CmdScheduler/dal"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +18,13 @@ import (
 // proceedTaskFlow execute le task flows
 // et la tache en cours d'exec devrait pouvoir notifier chacune leur avancement)
 func (c *PreparedTF) proceedTaskFlow(feedback chan<- wipInfo) {
+	//lancement impossible : tf en échec direct
+	if c.CantLaunch != "" {
+		c.Result = -1
+		c.ResultMsg = c.CantLaunch
+		return
+	}
+
 	transcript := make([]string, 0)
 
 	nextIdxToExec := 1 //idx commence à 1 en bdd
@@ -29,6 +38,7 @@ func (c *PreparedTF) proceedTaskFlow(feedback chan<- wipInfo) {
 			nextIdxToExec = -1 //0: terminé ok, -1: terminé avec erreur
 		} else {
 			iTryCpt := c.Detail[nextIdxB0].RetryIfFail + 1 //nombre deressai + essai initiale
+			stepStart := time.Now()
 
 			//appel ws et gestion réponse
 			waitFor := true
@@ -89,6 +99,7 @@ func (c *PreparedTF) proceedTaskFlow(feedback chan<- wipInfo) {
 				//if (maxDuration>0) && (time.Since(tstart) > maxDuration) {
 				//}
 			} // for wait for tache
+			metricStepDur.observe(time.Since(stepStart).Seconds(), "result", metricResult(currentExecErr == nil))
 
 			//suivant...
 			if currentExecErr == nil {
@@ -105,19 +116,55 @@ func (c *PreparedTF) proceedTaskFlow(feedback chan<- wipInfo) {
 	} else {
 		c.Result = -1
 	}
-	c.ResultMsg = strings.Join(transcript, "\n")
+	c.ResultMsg = c.redactSecrets(strings.Join(transcript, "\n"))
 }
 
+// rexpSecretTag tag de référence à un secret du coffre : <%secret:NAME%>
+var rexpSecretTag = regexp.MustCompile(`(?i)<%secret:([A-Za-z0-9_\-]+)%>`)
+
+// secretRedactMinLen taille minimale d'une valeur de secret masquée dans le résultat
+// (en deçà, le remplacement rendrait le transcript illisible sans rien protéger)
+const secretRedactMinLen = 4
+
 // calcArgs calcule les args de la tache en prenant en compte les eventuels arguments nommés de la tf
-func (c *PreparedDetail) calcArgs(tf *PreparedTF) []string {
+// les secrets ne sont résolus qu'ici, juste avant l'appel agent
+func (c *PreparedDetail) calcArgs(tf *PreparedTF) ([]string, error) {
 	out := make([]string, 0)
 	for _, a := range c.Task.Args {
 		for tag, val := range tf.NamedArgs {
 			a = strings.ReplaceAll(a, "<%"+tag+"%>", val)
 		}
+		a = replaceArgsTags(a, tf)
+
+		var errSecret error
+		a = rexpSecretTag.ReplaceAllStringFunc(a, func(tag string) string {
+			name := rexpSecretTag.FindStringSubmatch(tag)[1]
+			val, err := dal.SecretGetValue(name)
+			if err != nil {
+				if errSecret == nil {
+					errSecret = err
+				}
+				return tag
+			}
+			if len(val) >= secretRedactMinLen {
+				tf.secretVals = append(tf.secretVals, val)
+			}
+			return val
+		})
+		if errSecret != nil {
+			return nil, errSecret
+		}
 		out = append(out, a)
 	}
-	return out
+	return out, nil
+}
+
+// redactSecrets masque les valeurs des secrets utilisés
+func (c *PreparedTF) redactSecrets(msg string) string {
+	for _, val := range c.secretVals {
+		msg = strings.ReplaceAll(msg, val, dal.SecretMask)
+	}
+	return msg
 }
 
 //agentQueryExec execute a tache concerné
@@ -126,12 +173,16 @@ func (c *PreparedDetail) agentQueryExec(parent *PreparedTF) error {
 
 	var tf *agent.TaskView
 	if c.Task.Type == "CmdTask" {
+		args, err := c.calcArgs(parent)
+		if err != nil {
+			return err
+		}
 		tf = &agent.TaskView{
 			Type:    c.Task.Type,
 			Timeout: int64(c.Task.Timeout),
 			LogCfg:  c.Task.LogStore,
 			Cmd:     c.Task.Cmd,
-			Args:    c.calcArgs(parent),
+			Args:    args,
 			StartIn: c.Task.StartIn,
 		}
 	} else if c.Task.Type == "URLCheckTask" {
@@ -167,7 +218,9 @@ func (c *PreparedDetail) agentQueryExec(parent *PreparedTF) error {
 		if iTry > 0 {
 			time.Sleep(time.Second)
 		}
-		resp, err = agent.DoHttpRequest(req, agent.AgentQueryTimeout, false, c.Agent.CertSignAllowed)
+		callStart := time.Now()
+		resp, err = agent.DoHttpRequest(req, agent.AgentQueryTimeout, c.Agent.ID, false, c.Agent.CertSignAllowed, c.Agent.CABundle)
+		observeAgentCall("exec", callStart, err)
 		if err == nil {
 			defer resp.Body.Close()
 		}
@@ -183,6 +236,7 @@ func (c *PreparedDetail) agentQueryExec(parent *PreparedTF) error {
 	rb, _ := ioutil.ReadAll(resp.Body)
 	json.Unmarshal(rb, &aresp)
 	if resp.StatusCode != 202 {
+		metricAgentErrors.inc("call", "exec")
 		return fmt.Errorf("agent return code = %v %v", resp.StatusCode, aresp.ErrMessage)
 	} else if aresp.ID <= 0 {
 		return fmt.Errorf("agent return invalid execution id")
@@ -215,7 +269,9 @@ func (c *PreparedDetail) agentQueryState(parent *PreparedTF) (agent.TaskReponse,
 		if iTry > 0 {
 			time.Sleep(time.Second)
 		}
-		resp, err = agent.DoHttpRequest(req, agent.AgentQueryTimeout, false, c.Agent.CertSignAllowed)
+		callStart := time.Now()
+		resp, err = agent.DoHttpRequest(req, agent.AgentQueryTimeout, c.Agent.ID, false, c.Agent.CertSignAllowed, c.Agent.CABundle)
+		observeAgentCall("state", callStart, err)
 		if err == nil {
 			defer resp.Body.Close()
 		}
@@ -229,6 +285,9 @@ func (c *PreparedDetail) agentQueryState(parent *PreparedTF) (agent.TaskReponse,
 	//retour attendu : 200 avec corp json
 	rb, _ := ioutil.ReadAll(resp.Body)
 	json.Unmarshal(rb, &aresp)
+	if resp.StatusCode != 200 {
+		metricAgentErrors.inc("call", "state")
+	}
 	if resp.StatusCode != 200 && aresp.ErrMessage == "" {
 		aresp.ErrMessage = fmt.Sprintf("agent response : %v", resp.StatusCode)
 	}
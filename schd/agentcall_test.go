@@ -0,0 +1,80 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCalcArgsSecret résolution et masquage des secrets
+func TestCalcArgsSecret(t *testing.T) {
+	InitWorker(t)
+
+	sec := dal.DbSecret{Name: "TEST_PWD", Value: "s3cr3t!"}
+	if err := sec.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.SecretInsert(&sec, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer dal.SecretDelete(sec.ID, 0)
+
+	tf := &PreparedTF{NamedArgs: map[string]string{"USR": "bob"}}
+	d := PreparedDetail{Task: dal.DbTask{Args: []string{"-u", "<%USR%>", "-p=<%secret:test_pwd%>"}}}
+	args, err := d.calcArgs(tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "-u bob -p=s3cr3t!" {
+		t.Errorf("calcArgs : %v", args)
+	}
+	if msg := tf.redactSecrets("login -p=s3cr3t! failed"); strings.Contains(msg, "s3cr3t!") {
+		t.Errorf("secret not redacted : %v", msg)
+	}
+
+	//valeur trop courte : pas de masquage
+	short := dal.DbSecret{Name: "TEST_SHORT", Value: "ab"}
+	if err := dal.SecretInsert(&short, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer dal.SecretDelete(short.ID, 0)
+	tf.secretVals = nil
+	d.Task.Args = []string{"<%secret:test_short%>"}
+	if args, err = d.calcArgs(tf); err != nil || args[0] != "ab" {
+		t.Fatalf("short secret %v %v", args, err)
+	}
+	if msg := tf.redactSecrets("table abc"); msg != "table abc" {
+		t.Errorf("short secret redacted : %v", msg)
+	}
+
+	//secret inconnu : erreur
+	d.Task.Args = []string{"<%secret:UNKNOWN_SECRET%>"}
+	if _, err = d.calcArgs(tf); err == nil {
+		t.Errorf("unknown secret : error expected")
+	}
+}
+
+// TestCantLaunch un tf non lançable est en échec sans appel d'agent
+func TestCantLaunch(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+
+	tf := &PreparedTF{
+		NamedArgs:  map[string]string{},
+		CantLaunch: "Variables : unknown variable",
+		Detail: []PreparedDetail{{
+			DbTaskFlowDetail: dal.DbTaskFlowDetail{Idx: 1},
+			Agent:            dal.DbAgent{ID: 1, Host: srv.URL},
+			Task:             dal.DbTask{Lib: "t", Type: "CmdTask", Cmd: "echo"},
+		}},
+	}
+	tf.proceedTaskFlow(make(chan wipInfo, 10))
+	if calls != 0 || tf.Result != -1 || tf.ResultMsg != tf.CantLaunch {
+		t.Errorf("cant launch : %v calls, result %v %v", calls, tf.Result, tf.ResultMsg)
+	}
+}
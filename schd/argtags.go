@@ -0,0 +1,210 @@
+package schd
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// tags gérés dans les arguments :
+//  <%DT_format%>                      date de référence formatée
+//  <%DT-1D_YYYYMMDD%>                 date de référence décalée (D jour, W semaine, M mois, Y année, B jour ouvré, H heure, N minute)
+//  <%DT_FIRSTDAYOFMONTH-1M_YYYY-MM%>  date ancrée (FIRSTDAYOFMONTH, LASTDAYOFMONTH, FIRSTDAYOFWEEK, FIRSTDAYOFYEAR, LASTDAYOFYEAR) puis décalée
+//  format : YYYY YY MM DD HH NN SS, WW (n° semaine iso), EPOCH (secondes unix), autres caractères repris tels quels
+//  <%TF_ID%> <%RUN_ID%> <%HOSTNAME%>
+// les tags inconnus sont conservés tels quels
+
+var (
+	rexpDateTag = regexp.MustCompile(`^DT((?:[+-]\d+[DWMYBHN])*)(?:_(FIRSTDAYOFMONTH|LASTDAYOFMONTH|FIRSTDAYOFWEEK|FIRSTDAYOFYEAR|LASTDAYOFYEAR)((?:[+-]\d+[DWMYBHN])*))?_(.+)$`)
+	rexpDateOffset = regexp.MustCompile(`([+-]\d+)([DWMYBHN])`)
+
+	runSeq int64 = time.Now().Unix()
+)
+
+// newRunID id unique d'execution d'une tf
+func newRunID() string {
+	return strconv.FormatInt(atomic.AddInt64(&runSeq, 1), 36)
+}
+
+// RenderArgsTags rendu d'un modéle d'argument pour une date de référence (validation des modéles)
+// retourne aussi les tags non reconnus
+func RenderArgsTags(in string, dt time.Time, tfID int) (string, []string) {
+	tf := &PreparedTF{TFID: tfID, DtRef: dt, RunID: "RUNID"}
+	unknown := make([]string, 0)
+	out := replaceArgsTagsFunc(in, func(tag string) (string, bool) {
+		val, ok := tf.argTagValue(tag)
+		if !ok {
+			unknown = append(unknown, tag)
+		}
+		return val, ok
+	})
+	return out, unknown
+}
+
+// replaceArgsTags replace les eventuels tags <%xxx%> dans l'argument
+func replaceArgsTags(in string, tf *PreparedTF) string {
+	return replaceArgsTagsFunc(in, tf.argTagValue)
+}
+
+// replaceArgsTagsFunc parcours des tags <%xxx%>, tag conservé si non géré par valFn
+func replaceArgsTagsFunc(in string, valFn func(tag string) (string, bool)) string {
+	out := ""
+	for in != "" {
+		iTag := strings.Index(in, "<%")
+		if iTag < 0 {
+			//pas/plus de tag
+			out += in
+			break
+		}
+		//recup elements pre tag
+		out += in[0:iTag]
+		in = in[iTag:]
+
+		//traitement tag si présence balise de fin
+		iTag2 := strings.Index(in, "%>")
+		if iTag2 < 0 {
+			out += in
+			break
+		}
+		tag := strings.ToUpper(strings.TrimSpace(in[2:iTag2]))
+		if val, ok := valFn(tag); ok {
+			out += val
+		} else {
+			out += in[0 : iTag2+2] //tag non traité conservé
+		}
+		in = in[iTag2+2:]
+	}
+	return out
+}
+
+// argTagValue valeur d'un tag (faux si non géré)
+func (c *PreparedTF) argTagValue(tag string) (string, bool) {
+	switch tag {
+	case "TF_ID":
+		return strconv.Itoa(c.TFID), true
+	case "RUN_ID":
+		return c.RunID, true
+	case "HOSTNAME":
+		h, err := os.Hostname()
+		if err != nil {
+			return "", false
+		}
+		return h, true
+	}
+
+	m := rexpDateTag.FindStringSubmatch(tag)
+	if m == nil {
+		return "", false
+	}
+	dt := applyDateOffsets(c.DtRef, m[1])
+	switch m[2] {
+	case "FIRSTDAYOFMONTH":
+		dt = time.Date(dt.Year(), dt.Month(), 1, dt.Hour(), dt.Minute(), dt.Second(), 0, dt.Location())
+	case "LASTDAYOFMONTH":
+		dt = time.Date(dt.Year(), dt.Month()+1, 0, dt.Hour(), dt.Minute(), dt.Second(), 0, dt.Location())
+	case "FIRSTDAYOFWEEK":
+		dt = dt.AddDate(0, 0, -((int(dt.Weekday()) + 6) % 7)) //lundi
+	case "FIRSTDAYOFYEAR":
+		dt = time.Date(dt.Year(), 1, 1, dt.Hour(), dt.Minute(), dt.Second(), 0, dt.Location())
+	case "LASTDAYOFYEAR":
+		dt = time.Date(dt.Year(), 12, 31, dt.Hour(), dt.Minute(), dt.Second(), 0, dt.Location())
+	}
+	dt = applyDateOffsets(dt, m[3])
+	return formatDateTag(dt, m[4]), true
+}
+
+// applyDateOffsets applique les décalages type -1D+2H
+func applyDateOffsets(dt time.Time, offsets string) time.Time {
+	for _, o := range rexpDateOffset.FindAllStringSubmatch(offsets, -1) {
+		n, _ := strconv.Atoi(o[1])
+		switch o[2] {
+		case "D":
+			dt = dt.AddDate(0, 0, n)
+		case "W":
+			dt = dt.AddDate(0, 0, 7*n)
+		case "M":
+			dt = addMonths(dt, n)
+		case "Y":
+			dt = addMonths(dt, 12*n)
+		case "B":
+			dt = addBusinessDays(dt, n)
+		case "H":
+			dt = dt.Add(time.Duration(n) * time.Hour)
+		case "N":
+			dt = dt.Add(time.Duration(n) * time.Minute)
+		}
+	}
+	return dt
+}
+
+// addMonths ajout de mois, jour ramené au dernier jour du mois si besoin (31/03 -1M = 28/02)
+func addMonths(dt time.Time, n int) time.Time {
+	first := time.Date(dt.Year(), dt.Month()+time.Month(n), 1, dt.Hour(), dt.Minute(), dt.Second(), dt.Nanosecond(), dt.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := dt.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// addBusinessDays ajout de jours ouvrés (hors samedi/dimanche)
+func addBusinessDays(dt time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step = -1
+		n = -n
+	}
+	for n > 0 {
+		dt = dt.AddDate(0, 0, step)
+		if dt.Weekday() != time.Saturday && dt.Weekday() != time.Sunday {
+			n--
+		}
+	}
+	return dt
+}
+
+// formatDateTag formatage selon le format du tag (YYYY YY MM DD HH NN SS WW EPOCH)
+func formatDateTag(dt time.Time, format string) string {
+	tokens := []string{"EPOCH", "YYYY", "YY", "MM", "DD", "HH", "NN", "SS", "WW"}
+	out := ""
+	for format != "" {
+		found := false
+		for _, t := range tokens {
+			if strings.HasPrefix(format, t) {
+				switch t {
+				case "EPOCH":
+					out += strconv.FormatInt(dt.Unix(), 10)
+				case "YYYY":
+					out += dt.Format("2006")
+				case "YY":
+					out += dt.Format("06")
+				case "MM":
+					out += dt.Format("01")
+				case "DD":
+					out += dt.Format("02")
+				case "HH":
+					out += dt.Format("15")
+				case "NN":
+					out += dt.Format("04")
+				case "SS":
+					out += dt.Format("05")
+				case "WW":
+					_, w := dt.ISOWeek()
+					out += strconv.FormatInt(int64(100+w), 10)[1:]
+				}
+				format = format[len(t):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			out += format[0:1]
+			format = format[1:]
+		}
+	}
+	return out
+}
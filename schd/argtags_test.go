@@ -0,0 +1,47 @@
+package schd
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestReplaceArgsTags tags date et tags divers
+func TestReplaceArgsTags(t *testing.T) {
+	host, _ := os.Hostname()
+	tf := &PreparedTF{
+		TFID:  12,
+		RunID: "R1",
+		DtRef: time.Date(2021, 3, 31, 14, 5, 9, 0, time.UTC), //mercredi
+	}
+	arr := []struct {
+		in  string
+		out string
+	}{
+		{"f_<%DT_YYYYMMDD%>.txt", "f_20210331.txt"},
+		{"<%DT-1D_YYYYMMDD%>", "20210330"},
+		{"<%DT-1M_YYYY-MM-DD%>", "2021-02-28"},
+		{"<%DT_FIRSTDAYOFMONTH-1M_YYYY-MM%>", "2021-02"},
+		{"<%DT_LASTDAYOFMONTH-1M_DD%>", "28"},
+		{"<%DT_FIRSTDAYOFWEEK_DD/MM%>", "29/03"},
+		{"<%DT+2B_YYYYMMDD%>", "20210402"},
+		{"<%DT+3B_YYYYMMDD%>", "20210405"},
+		{"<%DT-3B_YYYYMMDD%>", "20210326"},
+		{"<%DT-1Y+2H_YYYYMMDDHHNNSS%>", "20200331160509"},
+		{"W<%DT_WW%>", "W13"},
+		{"<%DT_EPOCH%>", "1617199509"},
+		{"<%TF_ID%>-<%RUN_ID%>@<%HOSTNAME%>", "12-R1@" + host},
+		{"<%unknown%> and <%DT_YYYY%>", "<%unknown%> and 2021"},
+		{"<%secret:PWD%> <%A%> <%DT_YY", "<%secret:PWD%> <%A%> <%DT_YY"},
+	}
+	for _, a := range arr {
+		if out := replaceArgsTags(a.in, tf); out != a.out {
+			t.Errorf("replaceArgsTags %v : %v, waited %v", a.in, out, a.out)
+		}
+	}
+
+	out, unknown := RenderArgsTags("<%DT_YYYY%><%XX%>", tf.DtRef, 1)
+	if out != "2021<%XX%>" || len(unknown) != 1 || unknown[0] != "XX" {
+		t.Errorf("RenderArgsTags : %v %v", out, unknown)
+	}
+}
@@ -0,0 +1,127 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"sync"
+	"time"
+)
+
+// types d'évènements diffusés en direct (sse)
+const (
+	EvtQueueState   = "queue_state"
+	EvtTaskStart    = "task_start"
+	EvtTaskEnd      = "task_end"
+	EvtConfigReload = "config_reload"
+	EvtSLABreach    = "sla_breach"
+)
+
+// taille du buffer par abonné, évènements perdus au delà (client trop lent)
+const eventSubBuffer = 100
+
+// SchedEvent évènement diffusé aux abonnés
+// CrudCode : droit de lecture requis pour le recevoir
+type SchedEvent struct {
+	Type     string      `json:"type"`
+	At       time.Time   `json:"at"`
+	CrudCode string      `json:"-"`
+	Data     interface{} `json:"data"`
+}
+
+// ConfigReloadInfo données d'un évènement config_reload
+type ConfigReloadInfo struct {
+	Entity string `json:"entity"`
+	ID     int    `json:"id"` //0 : tous
+}
+
+// Restrict évènement restreint aux queues et taskflows accessibles (prédicats par id)
+// faux si l'évènement ne doit pas être transmis
+func (c SchedEvent) Restrict(queue func(int) bool, taskflow func(int) bool) (SchedEvent, bool) {
+	switch d := c.Data.(type) {
+	case []qState:
+		c.Data = restrictQueues(d, queue)
+	case TState:
+		return c, taskflow(d.TFID)
+	case dal.DbSLABreach:
+		return c, taskflow(d.TaskFlowID)
+	case ConfigReloadInfo:
+		if d.ID != 0 && d.Entity == "DbTaskFlow" {
+			return c, taskflow(d.ID)
+		}
+		if d.ID != 0 && d.Entity == "DbQueue" {
+			return c, queue(d.ID)
+		}
+	}
+	return c, true
+}
+
+// eventBroker diffusion des évènements aux abonnés
+type eventBroker struct {
+	mutex sync.RWMutex
+	subs  map[chan SchedEvent]bool
+}
+
+// instance globale
+var appEvents = &eventBroker{
+	subs: make(map[chan SchedEvent]bool),
+}
+
+// SubscribeEvents abonnement aux évènements, à libérer par UnsubscribeEvents
+func SubscribeEvents() chan SchedEvent {
+	ch := make(chan SchedEvent, eventSubBuffer)
+	appEvents.mutex.Lock()
+	appEvents.subs[ch] = true
+	appEvents.mutex.Unlock()
+	return ch
+}
+
+// UnsubscribeEvents fin d'abonnement
+func UnsubscribeEvents(ch chan SchedEvent) {
+	appEvents.mutex.Lock()
+	if _, exists := appEvents.subs[ch]; exists {
+		delete(appEvents.subs, ch)
+		close(ch)
+	}
+	appEvents.mutex.Unlock()
+}
+
+// publish diffusion sans blocage
+func (c *eventBroker) publish(evtType string, crudCode string, data interface{}) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if len(c.subs) == 0 {
+		return
+	}
+	evt := SchedEvent{
+		Type:     evtType,
+		At:       time.Now(),
+		CrudCode: crudCode,
+		Data:     data,
+	}
+	for ch := range c.subs {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+// entityCrudCode code droit associé à un type d'entité rechargé
+func entityCrudCode(entName string) string {
+	switch entName {
+	case "DbTask":
+		return "TASK"
+	case "DbTaskFlow":
+		return "TASKFLOW"
+	case "DbAgent":
+		return "AGENT"
+	case "DbQueue":
+		return "QUEUE"
+	case "DbSched":
+		return "SCHED"
+	case "DbNotification":
+		return "NOTIF"
+	case "DbGroup":
+		return "GROUP"
+	}
+	return "QUEUE" //rechargement global
+}
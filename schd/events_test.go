@@ -0,0 +1,70 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"testing"
+)
+
+// TestEventBroker diffusion aux abonnés
+func TestEventBroker(t *testing.T) {
+	ch := SubscribeEvents()
+	appEvents.publish(EvtConfigReload, "TASK", ConfigReloadInfo{Entity: "DbTask", ID: 3})
+	evt := <-ch
+	if evt.Type != EvtConfigReload || evt.CrudCode != "TASK" || evt.Data.(ConfigReloadInfo).ID != 3 {
+		t.Errorf("event %+v", evt)
+	}
+
+	//abonné lent : pas de blocage, évènements perdus
+	for i := 0; i < eventSubBuffer+10; i++ {
+		appEvents.publish(EvtQueueState, "QUEUE", nil)
+	}
+	if len(ch) != eventSubBuffer {
+		t.Errorf("buffer %v", len(ch))
+	}
+
+	UnsubscribeEvents(ch)
+	appEvents.publish(EvtQueueState, "QUEUE", nil) //plus d'abonné : sans effet
+}
+
+// TestRestrict restriction des états et évènements au périmétre
+func TestRestrict(t *testing.T) {
+	queue := func(id int) bool { return id == 1 }
+	taskflow := func(id int) bool { return id == 10 }
+
+	state := WipView{
+		WState: WState{
+			QueueState:  []qState{{DbQueue: dal.DbQueue{ID: 1}}, {DbQueue: dal.DbQueue{ID: 2}}},
+			Tasks:       []TState{{TFID: 10}, {TFID: 11}},
+			SLABreaches: []dal.DbSLABreach{{TaskFlowID: 11}},
+		},
+		NextTask: []TState{{TFID: 11}, {TFID: 10}},
+	}
+	r := state.Restrict(queue, taskflow)
+	if len(r.QueueState) != 1 || len(r.Tasks) != 1 || r.Tasks[0].TFID != 10 || len(r.SLABreaches) != 0 ||
+		len(r.NextTask) != 1 || r.NextTask[0].TFID != 10 {
+		t.Errorf("restricted state %+v", r)
+	}
+	if len(state.Tasks) != 2 || len(state.QueueState) != 2 {
+		t.Errorf("source state modified %+v", state)
+	}
+
+	for _, c := range []struct {
+		evt SchedEvent
+		ok  bool
+	}{
+		{SchedEvent{Type: EvtTaskStart, Data: TState{TFID: 10}}, true},
+		{SchedEvent{Type: EvtTaskEnd, Data: TState{TFID: 11}}, false},
+		{SchedEvent{Type: EvtSLABreach, Data: dal.DbSLABreach{TaskFlowID: 11}}, false},
+		{SchedEvent{Type: EvtConfigReload, Data: ConfigReloadInfo{Entity: "DbTaskFlow", ID: 11}}, false},
+		{SchedEvent{Type: EvtConfigReload, Data: ConfigReloadInfo{Entity: "DbQueue", ID: 1}}, true},
+		{SchedEvent{Type: EvtConfigReload, Data: ConfigReloadInfo{Entity: "*"}}, true},
+	} {
+		if _, ok := c.evt.Restrict(queue, taskflow); ok != c.ok {
+			t.Errorf("event %+v : %v", c.evt, ok)
+		}
+	}
+	evt, ok := SchedEvent{Type: EvtQueueState, Data: state.QueueState}.Restrict(queue, taskflow)
+	if qs, _ := evt.Data.([]qState); !ok || len(qs) != 1 || qs[0].ID != 1 {
+		t.Errorf("queue state event %+v", evt)
+	}
+}
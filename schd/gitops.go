@@ -0,0 +1,301 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/slog"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Synchro gitops : réconciliation de la config en base avec les bundles (cf dal.Bundle)
+// d'un répertoire (fichiers *.yaml, *.yml, *.json), contrôlé périodiquement.
+// Les entités définies par fichier sont gérées (table MANAGED) : lecture seule via l'api,
+// supprimées de la base quand elles disparaissent des fichiers.
+
+// GitOpsStatus état de la synchro gitops
+type GitOpsStatus struct {
+	Enabled     bool                 `json:"enabled"`
+	Dir         string               `json:"dir"`
+	Revision    string               `json:"revision,omitempty"` // commit courant si le répertoire est un dépot git
+	Digest      string               `json:"digest"`             // empreinte des fichiers lors de la derniére synchro
+	Files       []string             `json:"files"`
+	LastCheck   time.Time            `json:"last_check"`
+	LastAttempt time.Time            `json:"last_attempt"`
+	LastSync    time.Time            `json:"last_sync"` // derniére synchro réussie
+	Result      string               `json:"result"`    // ok, error
+	Error       string               `json:"error,omitempty"`
+	Plan        []dal.BundlePlanItem `json:"plan"` // modifications appliquées par la derniére synchro
+}
+
+var appGitOps = struct {
+	mutex     sync.Mutex
+	syncMutex sync.Mutex //une synchro à la fois
+	status    GitOpsStatus
+	resync    time.Duration
+}{}
+
+// GetGitOpsStatus état de la synchro gitops
+func GetGitOpsStatus() GitOpsStatus {
+	appGitOps.mutex.Lock()
+	defer appGitOps.mutex.Unlock()
+	return appGitOps.status
+}
+
+// StartGitOps lancement de la synchro du répertoire dir (ignoré si vide)
+// contrôle des fichiers toutes les poll, réconciliation forcée toutes les resync
+func StartGitOps(dir string, poll time.Duration, resync time.Duration) {
+	if dir == "" {
+		return
+	}
+	appGitOps.mutex.Lock()
+	appGitOps.status = GitOpsStatus{Enabled: true, Dir: dir}
+	appGitOps.resync = resync
+	appGitOps.mutex.Unlock()
+
+	slog.Trace("gitops", "Sync from %v every %v", dir, poll)
+	go func() {
+		SyncGitOps(false)
+		tick := time.NewTicker(poll)
+		for range tick.C {
+			SyncGitOps(false)
+		}
+	}()
+}
+
+// SyncGitOps synchro de la base avec le répertoire
+// sans force, ignorée si les fichiers n'ont pas changé depuis la derniére synchro (sauf resync échue)
+func SyncGitOps(force bool) error {
+	appGitOps.syncMutex.Lock()
+	defer appGitOps.syncMutex.Unlock()
+
+	st := GetGitOpsStatus()
+	if !st.Enabled {
+		return fmt.Errorf("gitops sync disabled")
+	}
+	now := time.Now()
+	files, digest, err := gitOpsFiles(st.Dir)
+	if err == nil && !force && digest == st.Digest && now.Sub(st.LastAttempt) < appGitOps.resync {
+		appGitOps.mutex.Lock()
+		appGitOps.status.LastCheck = now
+		appGitOps.mutex.Unlock()
+		return nil
+	}
+
+	var plan []dal.BundlePlanItem
+	if err == nil {
+		plan, err = gitOpsApply(st.Dir, files)
+	}
+
+	appGitOps.mutex.Lock()
+	defer appGitOps.mutex.Unlock()
+	s := &appGitOps.status
+	s.LastCheck = now
+	s.LastAttempt = now
+	s.Digest = digest
+	s.Files = files
+	s.Revision = gitRevision(st.Dir)
+	if err != nil {
+		s.Result = "error"
+		s.Error = err.Error()
+		slog.Error("gitops", "Sync %v fail %v", st.Dir, err)
+		return err
+	}
+	s.Result = "ok"
+	s.Error = ""
+	s.LastSync = now
+	if len(plan) > 0 || s.Plan == nil {
+		s.Plan = plan
+	}
+	if len(plan) > 0 {
+		slog.Trace("gitops", "Sync %v : %v change(s)", st.Dir, len(plan))
+	}
+	return nil
+}
+
+// gitOpsFiles fichiers bundle du répertoire (chemins relatifs triés, répertoires cachés ignorés) et leur empreinte
+func gitOpsFiles(dir string) ([]string, string, error) {
+	files := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("gitOpsFiles err %w", err)
+	}
+	//répertoire vide (checkout en cours ?) : pas de synchro, sinon tout serait supprimé
+	if len(files) == 0 {
+		return files, "", fmt.Errorf("gitOpsFiles no bundle file in %v", dir)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, "", fmt.Errorf("gitOpsFiles err %w", err)
+		}
+		h.Write([]byte(f))
+		h.Write([]byte{0})
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+	return files, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// gitOpsLoad lecture stricte d'un fichier bundle
+func gitOpsLoad(path string) (dal.Bundle, error) {
+	var b dal.Bundle
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return b, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&b)
+	} else {
+		err = yaml.UnmarshalStrict(data, &b)
+	}
+	if err == nil && b.Version != 0 && b.Version != dal.BundleFormatVersion {
+		err = fmt.Errorf("unsupported bundle version %v", b.Version)
+	}
+	return b, err
+}
+
+// gitOpsApply fusion des fichiers en un bundle et application à la base
+func gitOpsApply(dir string, files []string) ([]dal.BundlePlanItem, error) {
+	//fichier d'origine de chaque élément du bundle fusionné
+	var merged dal.Bundle
+	var src dal.BundleSources
+	for _, f := range files {
+		b, err := gitOpsLoad(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, fmt.Errorf("%v : %w", f, err)
+		}
+		merged.Agents = append(merged.Agents, b.Agents...)
+		merged.Tags = append(merged.Tags, b.Tags...)
+		merged.Schedules = append(merged.Schedules, b.Schedules...)
+		merged.Queues = append(merged.Queues, b.Queues...)
+		merged.Tasks = append(merged.Tasks, b.Tasks...)
+		merged.TaskFlows = append(merged.TaskFlows, b.TaskFlows...)
+		for i := 0; i < len(b.Agents); i++ {
+			src.Agents = append(src.Agents, f)
+		}
+		for i := 0; i < len(b.Tags); i++ {
+			src.Tags = append(src.Tags, f)
+		}
+		for i := 0; i < len(b.Schedules); i++ {
+			src.Schedules = append(src.Schedules, f)
+		}
+		for i := 0; i < len(b.Queues); i++ {
+			src.Queues = append(src.Queues, f)
+		}
+		for i := 0; i < len(b.Tasks); i++ {
+			src.Tasks = append(src.Tasks, f)
+		}
+		for i := 0; i < len(b.TaskFlows); i++ {
+			src.TaskFlows = append(src.TaskFlows, f)
+		}
+	}
+	merged.Version = dal.BundleFormatVersion
+
+	//seules les entités précédemment gérées sont supprimées si absentes des fichiers
+	managed, err := dal.ManagedKeys()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := dal.BundleImport(&merged, dal.BundleImportOpt{Apply: true, Prune: true, PruneOnly: managed, Managed: &src}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan) == 0 {
+		return plan, nil
+	}
+
+	for _, item := range plan {
+		err = dal.AuditInsert(&dal.DbAudit{
+			Login:    "gitops",
+			Entity:   item.Entity,
+			EntityID: fmt.Sprint(item.ID),
+			Action:   item.Action,
+			Diff:     dal.AuditDiff(item.Before, item.After),
+		})
+		if err != nil {
+			slog.Error("gitops", "AuditInsert fail %v", err)
+		}
+	}
+	//versions des taskflows (taches modifiées incluses)
+	tfs, _, err := dal.TaskFlowList(dal.SearchQuery{})
+	if err != nil {
+		return plan, err
+	}
+	for _, tf := range tfs {
+		if _, err := dal.TaskFlowVersionSave(tf.ID, 0, nil); err != nil {
+			slog.Error("gitops", "TaskFlowVersionSave fail %v", err)
+		}
+	}
+	//rechargement complet du scheduleur
+	UpdateSchedFromDb("*", 0)
+
+	return plan, nil
+}
+
+// gitRevision commit courant (HEAD) si dir est la racine d'un dépot git, vide à défaut
+func gitRevision(dir string) string {
+	gitDir := filepath.Join(dir, ".git")
+	b, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(head, "ref: ") {
+		return head //detached
+	}
+	ref := strings.TrimPrefix(head, "ref: ")
+	if b, err = ioutil.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	//ref compactée
+	f, err := os.Open(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == ref {
+			return fields[0]
+		}
+	}
+	return ""
+}
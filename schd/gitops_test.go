@@ -0,0 +1,101 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestGitOps synchro de la config depuis un répertoire
+func TestGitOps(t *testing.T) {
+	InitWorker(t)
+
+	dir, err := ioutil.TempDir("", "gitops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	appGitOps.mutex.Lock()
+	appGitOps.status = GitOpsStatus{Enabled: true, Dir: dir}
+	appGitOps.resync = time.Hour
+	appGitOps.mutex.Unlock()
+	defer func() { appGitOps.status = GitOpsStatus{} }()
+
+	//répertoire vide : pas de synchro
+	if err := SyncGitOps(false); err == nil || GetGitOpsStatus().Result != "error" {
+		t.Errorf("empty dir %v", err)
+	}
+
+	id := newRunID()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("queues.yaml", "queues:\n- lib: gq"+id+"\n  slot: 1\n")
+	write("flows.yaml", `tasks:
+- lib: gt`+id+`
+  type: CmdTask
+  cmd: echo
+taskflows:
+- lib: gtf`+id+`
+  queue: gq`+id+`
+  detail:
+  - task: gt`+id+`
+`)
+	write(".hidden.txt", "ignored")
+
+	if err := SyncGitOps(false); err != nil {
+		t.Fatal(err)
+	}
+	st := GetGitOpsStatus()
+	if st.Result != "ok" || len(st.Files) != 2 || len(st.Plan) != 3 {
+		t.Errorf("status %+v", st)
+	}
+	m, _, err := dal.ManagedList(dal.SearchQuery{SQLFilter: "MANAGED.name = ?", SQLParams: []interface{}{"gq" + id}})
+	if err != nil || len(m) != 1 || m[0].Entity != "QUEUE" || m[0].Source != "queues.yaml" || m[0].EntityID == 0 {
+		t.Fatalf("managed %+v %v", m, err)
+	}
+	queueID := m[0].EntityID
+
+	//fichiers inchangés : rien à faire
+	if err := SyncGitOps(false); err != nil || !GetGitOpsStatus().LastAttempt.Equal(st.LastAttempt) {
+		t.Errorf("unchanged %v", err)
+	}
+
+	//fichier invalide : erreur, base inchangée
+	write("bad.yaml", "unknown: 1\n")
+	if err := SyncGitOps(false); err == nil || GetGitOpsStatus().Error == "" {
+		t.Errorf("invalid file %v", err)
+	}
+	os.Remove(filepath.Join(dir, "bad.yaml"))
+
+	//maj et suppression d'une entité gérée retirée des fichiers
+	write("queues.yaml", "queues:\n- lib: gq"+id+"\n  slot: 2\n")
+	write("flows.yaml", "tasks:\n- lib: gt"+id+"\n  type: CmdTask\n  cmd: echo\n")
+	if err := SyncGitOps(false); err != nil {
+		t.Fatal(err)
+	}
+	if q, err := dal.QueueGet(queueID); err != nil || q.Slot != 2 {
+		t.Errorf("queue %+v %v", q, err)
+	}
+	if tf, _, _ := dal.TaskFlowList(dal.SearchQuery{SQLFilter: "TASKFLOW.lib = ?", SQLParams: []interface{}{"gtf" + id}}); len(tf) != 0 {
+		t.Errorf("taskflow not pruned %+v", tf)
+	}
+	if keys, err := dal.ManagedKeys(); err != nil || keys["TASKFLOW/gtf"+id] || !keys["TASK/gt"+id] {
+		t.Errorf("managed keys %v %v", keys, err)
+	}
+
+	//suppression de tout : plus d'entité gérée
+	write("queues.yaml", "version: 1\n")
+	os.Remove(filepath.Join(dir, "flows.yaml"))
+	if err := SyncGitOps(true); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := dal.ManagedKeys(); len(keys) != 0 {
+		t.Errorf("managed keys %v", keys)
+	}
+}
@@ -0,0 +1,292 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/slog"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// config smtp dans la table de config kv :
+//  mail.smtp_host, mail.smtp_port (25 par défaut), mail.smtp_user, mail.smtp_password
+//  mail.starttls (1/true), mail.from, mail.digest_minutes (0 : envoi immédiat)
+// les mails d'échec sont envoyés aux adresses de la taskflow et de ses tags
+
+// smtpConfig config d'envoi
+type smtpConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	StartTLS bool
+	From     string
+	Digest   time.Duration
+}
+
+// loadSmtpConfig lecture config (host vide : mails désactivés)
+func loadSmtpConfig() (smtpConfig, error) {
+	var cfg smtpConfig
+	var err error
+	get := func(k string) string {
+		v, e := dal.CfgKVGet(k)
+		if e != nil && err == nil {
+			err = e
+		}
+		return strings.TrimSpace(v)
+	}
+	cfg.Host = get("mail.smtp_host")
+	cfg.Port, _ = strconv.Atoi(get("mail.smtp_port"))
+	if cfg.Port <= 0 {
+		cfg.Port = 25
+	}
+	cfg.User = get("mail.smtp_user")
+	cfg.Password = get("mail.smtp_password")
+	tlsv := strings.ToLower(get("mail.starttls"))
+	cfg.StartTLS = tlsv == "1" || tlsv == "true"
+	cfg.From = get("mail.from")
+	if cfg.From == "" {
+		cfg.From = "cmdscheduler@localhost"
+	}
+	digest, _ := strconv.Atoi(get("mail.digest_minutes"))
+	cfg.Digest = time.Duration(digest) * time.Minute
+	return cfg, err
+}
+
+// mailer envoi des mails d'échec, en direct ou groupés (digest)
+type mailer struct {
+	mutex        sync.Mutex
+	pending      map[string][]NotifEvent //échecs en attente par destinataire
+	pendingSince time.Time
+}
+
+// instance globale
+var appMailer = &mailer{
+	pending: make(map[string][]NotifEvent),
+}
+
+// failure prise en charge d'un échec de tf (appelé hors boucle worker)
+func (c *mailer) failure(evt NotifEvent) {
+	cfg, err := loadSmtpConfig()
+	if err != nil {
+		slog.Warning("mail", "Smtp config : %v", err)
+		return
+	}
+	if cfg.Host == "" {
+		return
+	}
+	to, err := failureRecipients(evt)
+	if err != nil {
+		slog.Warning("mail", "Recipients %v : %v", evt.TFLib, err)
+		return
+	}
+	if len(to) == 0 {
+		return
+	}
+
+	if cfg.Digest > 0 {
+		c.queue(to, evt)
+		return
+	}
+	subject := "Taskflow failed : " + evt.TFLib
+	if evt.Event == dal.NotifEvtSLABreach {
+		subject = "Taskflow SLA breach : " + evt.TFLib
+	}
+	err = sendMail(cfg, to, subject, mailFailureBody(evt))
+	if err != nil {
+		slog.Warning("mail", "Mail %v failed : %v", evt.TFLib, err)
+	}
+}
+
+// queue mise en attente pour envoi groupé
+func (c *mailer) queue(to []string, evt NotifEvent) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.pending) == 0 {
+		c.pendingSince = time.Now()
+	}
+	for _, a := range to {
+		c.pending[a] = append(c.pending[a], evt)
+	}
+}
+
+// flushDigest envoi des mails groupés si le délai est atteint (ou force)
+func (c *mailer) flushDigest(cfg smtpConfig, force bool) {
+	c.mutex.Lock()
+	if len(c.pending) == 0 || (!force && cfg.Digest > 0 && time.Since(c.pendingSince) < cfg.Digest) {
+		c.mutex.Unlock()
+		return
+	}
+	pending := c.pending
+	c.pending = make(map[string][]NotifEvent)
+	c.mutex.Unlock()
+
+	if cfg.Host == "" {
+		return
+	}
+	for to, evts := range pending {
+		subject := fmt.Sprintf("%v taskflow(s) failed", len(evts))
+		for _, evt := range evts {
+			if evt.Event == dal.NotifEvtSLABreach {
+				subject = fmt.Sprintf("%v taskflow alert(s)", len(evts))
+				break
+			}
+		}
+		body := ""
+		for i, evt := range evts {
+			if i > 0 {
+				body += "\r\n" + strings.Repeat("-", 60) + "\r\n\r\n"
+			}
+			body += mailFailureBody(evt)
+		}
+		err := sendMail(cfg, []string{to}, subject, body)
+		if err != nil {
+			slog.Warning("mail", "Digest mail to %v failed : %v", to, err)
+		}
+	}
+}
+
+// loopDigest controle régulier des mails groupés à envoyer
+func (c *mailer) loopDigest() {
+	tick := time.NewTicker(30 * time.Second)
+	for range tick.C {
+		cfg, err := loadSmtpConfig()
+		if err != nil {
+			slog.Warning("mail", "Smtp config : %v", err)
+			continue
+		}
+		c.flushDigest(cfg, false)
+	}
+}
+
+// failureRecipients adresses de la taskflow, de ses tags et de son groupe propriétaire
+func failureRecipients(evt NotifEvent) ([]string, error) {
+	dbl := make(map[string]bool)
+	if evt.TFID > 0 {
+		tf, err := dal.TaskFlowGet(evt.TFID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range tf.Emails {
+			dbl[strings.ToLower(a)] = true
+		}
+	}
+	for _, tagID := range evt.Tags {
+		tag, err := dal.TagGet(tagID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range tag.Emails {
+			dbl[strings.ToLower(a)] = true
+		}
+	}
+	if evt.GroupID > 0 {
+		//groupe en erreur : mail maintenu pour les autres destinataires
+		grp, err := dal.GroupGet(evt.GroupID)
+		if err != nil {
+			slog.Warning("mail", "Recipients %v, group %v : %v", evt.TFLib, evt.GroupID, err)
+		}
+		for _, a := range grp.Emails {
+			dbl[strings.ToLower(a)] = true
+		}
+	}
+	to := make([]string, 0, len(dbl))
+	for a := range dbl {
+		to = append(to, a)
+	}
+	sort.Strings(to)
+	return to, nil
+}
+
+// mailFailureBody résumé texte d'un échec
+func mailFailureBody(evt NotifEvent) string {
+	const dtFormat = "2006-01-02 15:04:05"
+	queue := evt.QueueLib
+	if queue == "" {
+		queue = "[Direct]"
+	}
+	lines := []string{
+		fmt.Sprintf("Taskflow      : %v (id %v)", evt.TFLib, evt.TFID),
+		fmt.Sprintf("Run id        : %v", evt.RunID),
+		fmt.Sprintf("Reference date: %v", evt.DtRef.Format(dtFormat)),
+		fmt.Sprintf("Launch source : %v", evt.LaunchSource),
+		fmt.Sprintf("Queue         : %v", queue),
+		fmt.Sprintf("Start         : %v", evt.StartAt.Format(dtFormat)),
+		fmt.Sprintf("Stop          : %v", evt.StopAt.Format(dtFormat)),
+		fmt.Sprintf("Duration      : %v", evt.Duration),
+	}
+	if evt.Event == dal.NotifEvtSLABreach {
+		lines = append(lines, fmt.Sprintf("SLA breach    : %v, %v", evt.SLAKind, evt.SLAInfo))
+	} else {
+		lines = append(lines, "", "Transcript :", strings.ReplaceAll(evt.ResultMsg, "\n", "\r\n"))
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// sendMail envoi d'un mail texte
+func sendMail(cfg smtpConfig, to []string, subject, body string) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, notifTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(2 * notifTimeout))
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.StartTLS {
+		if err = c.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return fmt.Errorf("starttls %w", err)
+		}
+	}
+	if cfg.User != "" {
+		if err = c.Auth(smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("auth %w", err)
+		}
+	}
+	if err = c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, a := range to {
+		if err = c.Rcpt(a); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + cfg.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", "[CmdScheduler] "+subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(body))
+	qp.Close()
+
+	if _, err = w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
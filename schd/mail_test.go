@@ -0,0 +1,183 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP serveur smtp minimal pour les tests
+type fakeSMTP struct {
+	ln    net.Listener
+	mutex sync.Mutex
+	auth  []string
+	rcpt  []string
+	msgs  []string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	write := func(l string) { conn.Write([]byte(l + "\r\n")) }
+	write("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mutex.Lock()
+		switch cmd {
+		case "EHLO", "HELO":
+			write("250-localhost")
+			write("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = append(s.auth, line)
+			write("235 2.7.0 Authentication successful")
+		case "MAIL":
+			write("250 OK")
+		case "RCPT":
+			s.rcpt = append(s.rcpt, line)
+			write("250 OK")
+		case "DATA":
+			write("354 End data with <CR><LF>.<CR><LF>")
+			msg := ""
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				msg += l
+			}
+			s.msgs = append(s.msgs, msg)
+			write("250 OK")
+		case "QUIT":
+			write("221 Bye")
+			s.mutex.Unlock()
+			return
+		default:
+			write("250 OK")
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func (s *fakeSMTP) config() smtpConfig {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return smtpConfig{Host: "127.0.0.1", Port: addr.Port, User: "usr", Password: "pwd", From: "sched@test"}
+}
+
+// TestSendMail envoi d'un résumé d'échec
+func TestSendMail(t *testing.T) {
+	srv := newFakeSMTP(t)
+	defer srv.ln.Close()
+
+	evt := NotifEvent{
+		Event:        "failure",
+		TFID:         4,
+		TFLib:        "Daily export",
+		LaunchSource: "Schedule ID 2",
+		DtRef:        time.Date(2021, 3, 31, 6, 0, 0, 0, time.UTC),
+		ResultMsg:    "Start idx 1 : export\nTask idx 1 failed, duration : 12",
+	}
+	err := sendMail(srv.config(), []string{"ops@test", "dba@test"}, "Taskflow failed : "+evt.TFLib, mailFailureBody(evt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if len(srv.auth) != 1 || len(srv.rcpt) != 2 || len(srv.msgs) != 1 {
+		t.Fatalf("auth %v, rcpt %v, msgs %v", srv.auth, srv.rcpt, len(srv.msgs))
+	}
+	msg := srv.msgs[0]
+	for _, waited := range []string{"Subject: [CmdScheduler] Taskflow failed : Daily export", "Daily export (id 4)",
+		"2021-03-31 06:00:00", "Schedule ID 2", "Task idx 1 failed"} {
+		if !strings.Contains(msg, waited) {
+			t.Errorf("%v not found in %v", waited, msg)
+		}
+	}
+}
+
+// TestMailDigest regroupement des échecs par destinataire
+func TestMailDigest(t *testing.T) {
+	m := &mailer{pending: make(map[string][]NotifEvent)}
+	m.queue([]string{"a@test", "b@test"}, NotifEvent{TFLib: "TF1"})
+	m.queue([]string{"a@test"}, NotifEvent{TFLib: "TF2"})
+	if len(m.pending["a@test"]) != 2 || len(m.pending["b@test"]) != 1 {
+		t.Errorf("pending %v", m.pending)
+	}
+
+	srv := newFakeSMTP(t)
+	defer srv.ln.Close()
+	cfg := srv.config()
+	cfg.Digest = time.Hour
+
+	//délai non atteint : rien
+	m.flushDigest(cfg, false)
+	if len(m.pending) != 2 {
+		t.Fatalf("digest sent before delay")
+	}
+	m.flushDigest(cfg, true)
+	if len(m.pending) != 0 {
+		t.Errorf("pending not cleared")
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if len(srv.msgs) != 2 {
+		t.Fatalf("%v mails sent, 2 waited", len(srv.msgs))
+	}
+	found := false
+	for _, msg := range srv.msgs {
+		if strings.Contains(msg, "2 taskflow(s) failed") && strings.Contains(msg, "TF1") && strings.Contains(msg, "TF2") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("digest mail not found : %v", srv.msgs)
+	}
+}
+
+// TestFailureRecipients adresses du taskflow et de son groupe propriétaire, dédoublonnées
+func TestFailureRecipients(t *testing.T) {
+	InitWorker(t)
+	grp := dal.DbGroup{Name: "mailgrp", Emails: []string{"Team@test", "ops@test"}}
+	if err := dal.GroupInsert(&grp, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer dal.GroupDelete(grp.ID)
+	tf := dal.DbTaskFlow{Lib: "mailtf", Emails: []string{"ops@test"}}
+	if err := dal.TaskFlowInsert(&tf, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer dal.TaskFlowDelete(tf.ID, 1, nil)
+
+	to, err := failureRecipients(NotifEvent{TFID: tf.ID, GroupID: grp.ID})
+	if err != nil || strings.Join(to, ",") != "ops@test,team@test" {
+		t.Errorf("recipients %v %v", to, err)
+	}
+}
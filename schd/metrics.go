@@ -0,0 +1,202 @@
+package schd
+
+import (
+	"CmdScheduler/sessions"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// métriques au format texte prometheus, alimentées par les évènements du worker et des appels agents
+
+// buckets des histogrammes (secondes)
+var (
+	durationBuckets = []float64{1, 5, 15, 60, 300, 900, 1800, 3600, 7200}
+	latencyBuckets  = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	lagBuckets      = []float64{0.5, 1, 2, 5, 15, 60, 300, 900}
+)
+
+// metricLabels couples label/valeur
+type metricLabels []string
+
+// String rendu {k="v",...}
+func (c metricLabels) String() string {
+	if len(c) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(c)/2)
+	for i := 0; i+1 < len(c); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(c[i+1])
+		parts = append(parts, c[i]+`="`+v+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// metricCounter compteur par jeu de labels
+type metricCounter struct {
+	name string
+	help string
+	mu   sync.Mutex
+	vals map[string]float64
+}
+
+func newCounter(name, help string) *metricCounter {
+	return &metricCounter{name: name, help: help, vals: make(map[string]float64)}
+}
+
+// inc incrément
+func (c *metricCounter) inc(labels ...string) {
+	c.mu.Lock()
+	c.vals[metricLabels(labels).String()]++
+	c.mu.Unlock()
+}
+
+// write rendu texte
+func (c *metricCounter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, k := range sortedKeys(c.vals) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, k, formatFloat(c.vals[k]))
+	}
+}
+
+// metricHisto histogramme par jeu de labels
+type metricHisto struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	labels  map[string]metricLabels
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+func newHisto(name, help string, buckets []float64) *metricHisto {
+	return &metricHisto{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		labels:  make(map[string]metricLabels),
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+		totals:  make(map[string]uint64),
+	}
+}
+
+// observe ajout d'une mesure
+func (c *metricHisto) observe(v float64, labels ...string) {
+	k := metricLabels(labels).String()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.counts[k]; !exists {
+		c.labels[k] = labels
+		c.counts[k] = make([]uint64, len(c.buckets))
+	}
+	for i, b := range c.buckets {
+		if v <= b {
+			c.counts[k][i]++
+		}
+	}
+	c.sums[k] += v
+	c.totals[k]++
+}
+
+// write rendu texte
+func (c *metricHisto) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", c.name, c.help, c.name)
+	for _, k := range sortedKeys(c.sums) {
+		for i, b := range c.buckets {
+			l := append(append(metricLabels{}, c.labels[k]...), "le", formatFloat(b))
+			fmt.Fprintf(w, "%s_bucket%s %v\n", c.name, l, c.counts[k][i])
+		}
+		l := append(append(metricLabels{}, c.labels[k]...), "le", "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %v\n", c.name, l, c.totals[k])
+		fmt.Fprintf(w, "%s_sum%s %s\n", c.name, k, formatFloat(c.sums[k]))
+		fmt.Fprintf(w, "%s_count%s %v\n", c.name, k, c.totals[k])
+	}
+}
+
+// writeGauge rendu d'une jauge
+func writeGauge(w io.Writer, name, help string, vals map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, k := range sortedKeys(vals) {
+		fmt.Fprintf(w, "%s%s %s\n", name, k, formatFloat(vals[k]))
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// métriques de l'appli
+var (
+	metricRuns        = newCounter("cmdscheduler_taskflow_runs_total", "Taskflow runs by result and queue.")
+	metricStepDur     = newHisto("cmdscheduler_step_duration_seconds", "Taskflow step (task) duration.", durationBuckets)
+	metricAgentLat    = newHisto("cmdscheduler_agent_call_duration_seconds", "Agent call latency.", latencyBuckets)
+	metricAgentErrors = newCounter("cmdscheduler_agent_call_errors_total", "Agent call errors.")
+	metricSchedLag    = newHisto("cmdscheduler_schedule_lag_seconds", "Delay between planned reference date and actual start.", lagBuckets)
+)
+
+// metricQueueLib libellé queue pour les labels
+func metricQueueLib(queueLib string) string {
+	if queueLib == "" {
+		return "[Direct]"
+	}
+	return queueLib
+}
+
+// metricResult libellé d'un résultat
+func metricResult(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "ko"
+}
+
+// observeAgentCall mesure d'un appel agent
+func observeAgentCall(call string, start time.Time, err error) {
+	metricAgentLat.observe(time.Since(start).Seconds(), "call", call)
+	if err != nil {
+		metricAgentErrors.inc("call", call)
+	}
+}
+
+// WriteMetrics rendu des métriques au format texte prometheus
+func WriteMetrics(w io.Writer) {
+	metricRuns.write(w)
+	metricStepDur.write(w)
+	metricAgentLat.write(w)
+	metricAgentErrors.write(w)
+	metricSchedLag.write(w)
+
+	//état des queues
+	state := GetViewState()
+	processing := make(map[string]float64)
+	waiting := make(map[string]float64)
+	for _, q := range state.QueueState {
+		k := metricLabels{"queue", metricQueueLib(q.Lib)}.String()
+		processing[k] = float64(q.Processing)
+		waiting[k] = float64(q.Waiting)
+	}
+	writeGauge(w, "cmdscheduler_queue_processing", "Taskflows in progress by queue.", processing)
+	writeGauge(w, "cmdscheduler_queue_waiting", "Taskflows waiting by queue.", waiting)
+
+	writeGauge(w, "cmdscheduler_sessions", "Active API sessions.", map[string]float64{"": float64(sessions.Count())})
+}
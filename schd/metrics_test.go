@@ -0,0 +1,45 @@
+package schd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestMetrics rendu texte prometheus
+func TestMetrics(t *testing.T) {
+	c := newCounter("test_total", "Test counter.")
+	c.inc("result", "ok")
+	c.inc("result", "ok")
+	c.inc("result", `k"o`)
+	h := newHisto("test_seconds", "Test histo.", []float64{1, 5})
+	h.observe(0.5, "call", "exec")
+	h.observe(3, "call", "exec")
+
+	var b bytes.Buffer
+	c.write(&b)
+	h.write(&b)
+	out := b.String()
+	for _, l := range []string{
+		"# TYPE test_total counter",
+		`test_total{result="ok"} 2`,
+		`test_total{result="k\"o"} 1`,
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{call="exec",le="1"} 1`,
+		`test_seconds_bucket{call="exec",le="5"} 2`,
+		`test_seconds_bucket{call="exec",le="+Inf"} 2`,
+		`test_seconds_sum{call="exec"} 3.5`,
+		`test_seconds_count{call="exec"} 2`,
+	} {
+		if !strings.Contains(out, l+"\n") {
+			t.Errorf("missing %q in\n%s", l, out)
+		}
+	}
+
+	b.Reset()
+	WriteMetrics(&b)
+	if !strings.Contains(b.String(), "# TYPE cmdscheduler_taskflow_runs_total counter") ||
+		!strings.Contains(b.String(), "cmdscheduler_sessions ") {
+		t.Errorf("WriteMetrics\n%s", b.String())
+	}
+}
@@ -0,0 +1,321 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/slog"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	notifTimeout  = 10 * time.Second // délai max d'un appel webhook
+	notifMaxTry   = 3                // nombre d'essais d'envoi
+	notifQueueLen = 200              // évènements en attente d'envoi max
+)
+
+// délai d'attente entre deux essais (var pour les tests)
+var notifRetryDelay = 5 * time.Second
+
+// NotifEvent évènement d'exec d'une tf transmis aux canaux de notification
+type NotifEvent struct {
+	Event        string    `json:"event"`
+	TFID         int       `json:"taskflow_id"`
+	TFLib        string    `json:"taskflow_lib"`
+	RunID        string    `json:"run_id"`
+	Version      int       `json:"version"`
+	Tags         []int     `json:"tags"`
+	QueueID      int       `json:"queue_id"`
+	GroupID      int       `json:"group_id"`
+	QueueLib     string    `json:"queue_lib"`
+	LaunchSource string    `json:"launch_source"`
+	DtRef        time.Time `json:"dt_ref"`
+	StartAt      time.Time `json:"start_at"`
+	StopAt       time.Time `json:"stop_at"`
+	Duration     string    `json:"duration"`
+	Result       int       `json:"result"`
+	ResultMsg    string    `json:"result_msg"`
+	SLAKind      string    `json:"sla_kind,omitempty"`
+	SLAInfo      string    `json:"sla_info,omitempty"`
+}
+
+// notifier gestion des canaux de notification, envoi asynchrone
+// le worker ne fait que pousser les évènements, sans jamais attendre
+type notifier struct {
+	mutex    sync.RWMutex
+	channels map[int]*dal.DbNotification
+	eventCh  chan NotifEvent
+	sentLong map[string]bool //évènements longrunning déjà envoyés (runid/canal)
+	once     sync.Once
+}
+
+// instance globale
+var appNotifier = &notifier{
+	channels: make(map[int]*dal.DbNotification),
+	eventCh:  make(chan NotifEvent, notifQueueLen),
+	sentLong: make(map[string]bool),
+}
+
+// start lancement de la boucle d'envoi
+func (c *notifier) start() {
+	c.once.Do(func() {
+		go c.loop()
+		go appMailer.loopDigest()
+	})
+}
+
+// setChannel maj d'un canal (nil : suppression)
+func (c *notifier) setChannel(id int, n *dal.DbNotification) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if n == nil {
+		delete(c.channels, id)
+	} else {
+		c.channels[id] = n
+	}
+}
+
+// channelIDs liste des canaux connus
+func (c *notifier) channelIDs() []int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	ret := make([]int, 0, len(c.channels))
+	for id := range c.channels {
+		ret = append(ret, id)
+	}
+	return ret
+}
+
+// push transmission d'un évènement, sans blocage (évènement perdu si file pleine)
+func (c *notifier) push(evt NotifEvent) {
+	select {
+	case c.eventCh <- evt:
+	default:
+		slog.Warning("notify", "Event %v %v dropped (queue full)", evt.Event, evt.TFLib)
+	}
+}
+
+// loop traitement des évènements
+func (c *notifier) loop() {
+	for evt := range c.eventCh {
+		//mail d'échec aux adresses de la tf et de ses tags
+		if evt.Event == dal.NotifEvtFailure || evt.Event == dal.NotifEvtSLABreach {
+			go appMailer.failure(evt)
+		}
+		for _, n := range c.matchChannels(&evt) {
+			go func(n dal.DbNotification, evt NotifEvent) {
+				if err := sendNotification(n, evt, notifMaxTry); err != nil {
+					slog.Warning("notify", "Notification %v, event %v %v failed : %v", n.Lib, evt.Event, evt.TFLib, err)
+				}
+			}(n, evt)
+		}
+	}
+}
+
+// matchChannels canaux concernés par l'évènement (un seul envoi par canal)
+func (c *notifier) matchChannels(evt *NotifEvent) []dal.DbNotification {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ret := make([]dal.DbNotification, 0)
+	for _, n := range c.channels {
+		if !n.Activ {
+			continue
+		}
+		for _, rule := range n.Rules {
+			if ruleMatch(&rule, evt) {
+				if evt.Event == dal.NotifEvtLongRunning {
+					k := fmt.Sprintf("%v/%v", evt.RunID, n.ID)
+					if c.sentLong[k] {
+						break
+					}
+					c.sentLong[k] = true
+				}
+				ret = append(ret, *n)
+				break
+			}
+		}
+	}
+
+	//fin de tf : purge des longrunning envoyés
+	if evt.Event != dal.NotifEvtStart && evt.Event != dal.NotifEvtLongRunning && evt.Event != dal.NotifEvtSLABreach {
+		for _, n := range c.channels {
+			delete(c.sentLong, fmt.Sprintf("%v/%v", evt.RunID, n.ID))
+		}
+	}
+	return ret
+}
+
+// ruleMatch retourne vrai si la régle s'applique à l'évènement
+func ruleMatch(rule *dal.DbNotifRule, evt *NotifEvent) bool {
+	if rule.TaskFlowID != 0 && rule.TaskFlowID != evt.TFID {
+		return false
+	}
+	if rule.QueueID != 0 && rule.QueueID != evt.QueueID {
+		return false
+	}
+	if rule.GroupID != 0 && rule.GroupID != evt.GroupID {
+		return false
+	}
+	if rule.TagID != 0 {
+		found := false
+		for _, t := range evt.Tags {
+			if t == rule.TagID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, e := range rule.Events {
+		switch {
+		case e == evt.Event && e != dal.NotifEvtLongRunning:
+			return true
+		case e == dal.NotifEvtSuccess && evt.Event == dal.NotifEvtRecovery:
+			return true
+		case e == dal.NotifEvtLongRunning && evt.Event == dal.NotifEvtLongRunning:
+			d, err := time.ParseDuration(evt.Duration)
+			if err == nil && d >= time.Duration(rule.LongRunning)*time.Minute {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newNotifEvent évènement pour une tf
+func newNotifEvent(tf *PreparedTF, event string) NotifEvent {
+	evt := NotifEvent{
+		Event:        event,
+		TFID:         tf.TFID,
+		TFLib:        tf.TFLib,
+		RunID:        tf.RunID,
+		Version:      tf.Version,
+		Tags:         tf.Tags,
+		QueueID:      tf.QueueID,
+		QueueLib:     tf.QueueLib,
+		GroupID:      tf.GroupID,
+		LaunchSource: tf.LaunchSource,
+		DtRef:        tf.DtRef,
+		StartAt:      tf.StartAt,
+		StopAt:       tf.StopAt,
+	}
+	//résultat connu seulement en fin d'exec
+	if event != dal.NotifEvtStart && event != dal.NotifEvtLongRunning && event != dal.NotifEvtSLABreach {
+		evt.Result = tf.Result
+		evt.ResultMsg = tf.ResultMsg
+	}
+	if !tf.StartAt.IsZero() {
+		if tf.StopAt.IsZero() {
+			evt.Duration = time.Since(tf.StartAt).Round(time.Second).String()
+		} else {
+			evt.Duration = tf.StopAt.Sub(tf.StartAt).Round(time.Second).String()
+		}
+	}
+	return evt
+}
+
+// TestNotification envoi d'un évènement de test (synchrone, sans réessai)
+func TestNotification(n dal.DbNotification) error {
+	now := time.Now()
+	return sendNotification(n, NotifEvent{
+		Event:        dal.NotifEvtSuccess,
+		TFLib:        "Test notification",
+		RunID:        "test",
+		Tags:         []int{},
+		LaunchSource: "test",
+		DtRef:        now,
+		StartAt:      now,
+		StopAt:       now,
+		Duration:     "0s",
+		Result:       1,
+	}, 1)
+}
+
+// sendNotification envoi webhook avec réessais
+func sendNotification(n dal.DbNotification, evt NotifEvent, maxTry int) error {
+	body, err := notifPayload(n.Payload, evt)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: notifTimeout}
+	for iTry := 0; iTry < maxTry; iTry++ {
+		if iTry > 0 {
+			time.Sleep(notifRetryDelay * time.Duration(iTry))
+		}
+		err = postWebhook(client, n, body)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// postWebhook appel http du webhook
+func postWebhook(client *http.Client, n dal.DbNotification, body []byte) error {
+	req, err := http.NewRequest("POST", n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CmdScheduler")
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+	if n.HMACKey != "" {
+		req.Header.Set("X-Signature-256", "sha256="+hmacSign(n.HMACKey, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook return code = %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// hmacSign signature hmac sha256 en hex
+func hmacSign(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifPayload corps de l'appel : modéle text/template appliqué à l'évènement, ou évènement en json
+// fonction json dispo dans le modéle pour l'échappement des valeurs : {"text": {{json .ResultMsg}}}
+func notifPayload(tpl string, evt NotifEvent) ([]byte, error) {
+	if tpl == "" {
+		return json.Marshal(evt)
+	}
+	t, err := template.New("payload").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(tpl)
+	if err != nil {
+		return nil, fmt.Errorf("payload template : %w", err)
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, evt)
+	if err != nil {
+		return nil, fmt.Errorf("payload template : %w", err)
+	}
+	return buf.Bytes(), nil
+}
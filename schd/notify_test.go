@@ -0,0 +1,93 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSendNotification envoi webhook : modéle, entêtes, signature et réessai
+func TestSendNotification(t *testing.T) {
+	defer func(d time.Duration) { notifRetryDelay = d }(notifRetryDelay)
+	notifRetryDelay = 10 * time.Millisecond
+
+	calls := 0
+	var body []byte
+	var sign, custom string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway) //1er appel en échec : réessai
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		sign = r.Header.Get("X-Signature-256")
+		custom = r.Header.Get("X-Custom")
+	}))
+	defer srv.Close()
+
+	n := dal.DbNotification{
+		ID:      1,
+		Lib:     "test",
+		Type:    "webhook",
+		Activ:   true,
+		URL:     srv.URL,
+		Headers: map[string]string{"X-Custom": "abc"},
+		Payload: `{"text": {{json .TFLib}}, "event": "{{.Event}}"}`,
+		HMACKey: "key",
+	}
+	if err := n.Validate(false); err != nil {
+		t.Fatal(err)
+	}
+	evt := NotifEvent{Event: dal.NotifEvtFailure, TFLib: `TF "1"`}
+	if err := sendNotification(n, evt, 3); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %v, waited 2", calls)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(body, &payload); err != nil || payload["text"] != `TF "1"` || payload["event"] != "failure" {
+		t.Errorf("payload %s : %v", body, err)
+	}
+	if sign != "sha256="+hmacSign("key", body) || custom != "abc" {
+		t.Errorf("headers : %v %v", sign, custom)
+	}
+}
+
+// TestRuleMatch régles d'abonnement
+func TestRuleMatch(t *testing.T) {
+	evt := &NotifEvent{Event: dal.NotifEvtRecovery, TFID: 3, Tags: []int{5, 6}, QueueID: 2, GroupID: 8, Duration: "12m0s"}
+	arr := []struct {
+		rule  dal.DbNotifRule
+		match bool
+	}{
+		{dal.DbNotifRule{Events: []string{"recovery"}}, true},
+		{dal.DbNotifRule{Events: []string{"success"}}, true},
+		{dal.DbNotifRule{Events: []string{"failure"}}, false},
+		{dal.DbNotifRule{TaskFlowID: 3, Events: []string{"recovery"}}, true},
+		{dal.DbNotifRule{TaskFlowID: 4, Events: []string{"recovery"}}, false},
+		{dal.DbNotifRule{TagID: 6, Events: []string{"recovery"}}, true},
+		{dal.DbNotifRule{TagID: 7, Events: []string{"recovery"}}, false},
+		{dal.DbNotifRule{QueueID: 1, Events: []string{"recovery"}}, false},
+		{dal.DbNotifRule{GroupID: 8, Events: []string{"recovery"}}, true},
+		{dal.DbNotifRule{GroupID: 9, Events: []string{"recovery"}}, false},
+	}
+	for i, a := range arr {
+		if ruleMatch(&a.rule, evt) != a.match {
+			t.Errorf("rule %v : waited %v", i, a.match)
+		}
+	}
+
+	evt.Event = dal.NotifEvtLongRunning
+	if !ruleMatch(&dal.DbNotifRule{Events: []string{"longrunning"}, LongRunning: 10}, evt) {
+		t.Errorf("longrunning 10m : match waited")
+	}
+	if ruleMatch(&dal.DbNotifRule{Events: []string{"longrunning"}, LongRunning: 15}, evt) {
+		t.Errorf("longrunning 15m : no match waited")
+	}
+}
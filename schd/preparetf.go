@@ -4,7 +4,6 @@ import (
 	"CmdScheduler/dal"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -22,6 +21,8 @@ type PreparedTF struct {
 	TFID      int
 	TFLib     string
 	Ident     string
+	RunID     string //id unique de l'execution
+	Version   int    //version de la définition du taskflow
 	DtRef     time.Time
 	Detail    []PreparedDetail
 	NamedArgs map[string]string
@@ -39,6 +40,18 @@ type PreparedTF struct {
 	CantLaunch string //info tracé si lancement impossible
 
 	State WorkState
+
+	Tags       []int //tags de la tf (régles de notification)
+	GroupID    int   //groupe propriétaire de la tf (régles de notification, mails d'échec)
+	prevResult int   //résultat de la précédente exec connu au lancement
+
+	secretVals []string //valeurs des secrets résolues, masquées dans le resultat
+	longRunMin int      //dernier palier (minutes) de durée d'exec notifié
+
+	slaStartDelay time.Duration //délai max de démarrage aprés DtRef
+	slaMaxDur     time.Duration //durée max d'exec
+	slaDeadline   time.Time     //heure de fin au plus tard
+	slaBreaches   []string      //dépassements constatés (un seul par type)
 }
 
 //prepareTF prepa/qualif une taskflow avant lancement
@@ -47,6 +60,8 @@ func prepareTF(tf *dal.DbTaskFlow, launchInfo string, dtRef time.Time, manualLau
 		TFID:         tf.ID,
 		TFLib:        tf.Lib,
 		Ident:        "",
+		RunID:        newRunID(),
+		Version:      tf.Version,
 		DtRef:        dtRef,
 		Detail:       make([]PreparedDetail, len(tf.Detail)),
 		NamedArgs:    make(map[string]string),
@@ -60,12 +75,31 @@ func prepareTF(tf *dal.DbTaskFlow, launchInfo string, dtRef time.Time, manualLau
 		ResultMsg:    "",
 		CantLaunch:   "",
 		State:        StateUndefined,
+		Tags:         tf.Tags,
+		prevResult:   tf.LastResult,
+
+		slaStartDelay: time.Duration(tf.SLAStartDelay) * time.Minute,
+		slaMaxDur:     time.Duration(tf.SLAMaxDuration) * time.Minute,
+	}
+	ptf.slaDeadline, _ = dal.SLADeadline(tf.SLAFinishBy, dtRef)
+
+	//groupe propriétaire résolu au chargement, sans incidence sur le lancement
+	ptf.GroupID = appSched.ownerGroups[tf.ID]
+
+	//variables globales du profil actif
+	cantLaunch := ""
+	vars, err := dal.VarValues()
+	if err != nil {
+		cantLaunch = fmt.Sprintf("Variables : %v", err)
 	}
 
 	//prepa argument nommée
 	ident := "TF" + strconv.FormatInt(int64(ptf.TFID), 10)
 	for k, v := range tf.NamedArgs {
-		v = replaceArgsTags(v, ptf.DtRef)
+		if v, err = dal.ReplaceVars(v, vars); err != nil && cantLaunch == "" {
+			cantLaunch = fmt.Sprintf("Named arg %v : %v", k, err)
+		}
+		v = replaceArgsTags(v, ptf)
 		ptf.NamedArgs[k] = v
 		ident += " [" + k + "=" + v + "]"
 	}
@@ -76,8 +110,7 @@ func prepareTF(tf *dal.DbTaskFlow, launchInfo string, dtRef time.Time, manualLau
 	ptf.Ident = ident
 
 	//pré validation de certains composants
-	cantLaunch := ""
-	if manualLaunch && !tf.ManualLaunch {
+	if cantLaunch == "" && manualLaunch && !tf.ManualLaunch {
 		cantLaunch = "Manual launch is not allowed"
 	}
 
@@ -109,6 +142,10 @@ func prepareTF(tf *dal.DbTaskFlow, launchInfo string, dtRef time.Time, manualLau
 				break
 			}
 			ptf.Detail[i].Task = *appSched.tasksLst[ptf.Detail[i].TaskID]
+			if err = ptf.Detail[i].replaceVars(vars); err != nil {
+				cantLaunch = fmt.Sprintf("Task ID %v : %v", ptf.Detail[i].TaskID, err)
+				break
+			}
 
 			//check agent d'execution spécifié, récup du premier existant
 			//todo : pourrait aussi s'appuyer sur un état des agents s'il existe un jour
@@ -138,52 +175,23 @@ func prepareTF(tf *dal.DbTaskFlow, launchInfo string, dtRef time.Time, manualLau
 	return ptf
 }
 
-// replaceArgsTags replace les eventuels tags <%xxx%> dans l'argument
-func replaceArgsTags(in string, dt time.Time) string {
-	out := ""
-	for in != "" {
-		iTag := strings.Index(in, "<%")
-		if iTag < 0 {
-			//pas/plus de tag
-			out += in
-			in = ""
-		} else {
-			//recup elements pre tag
-			out += in[0:iTag]
-			in = in[iTag:]
-
-			//traitement tag si présence balise de fin
-			iTag2 := strings.Index(in, "%>")
-			tag := ""
-			if iTag2 >= 2 {
-				tag = strings.ToUpper(strings.TrimSpace(in[2:iTag2]))
-			}
-			//traitement des tags gérés (tags non traité non remplacé)
-			if (tag != "") && (tag[0:3] == "DT_") {
-				valrp := ""
-				//type de tag <%DT_xxx> ou contient un element de date
-				// DD MM YYYY  HH NN SS
-				if tag[0:3] == "DT_" {
-					fmt := tag[3:]
-					fmt = strings.ReplaceAll(fmt, "YYYY", "2006") //transposé au format de la lib std
-					fmt = strings.ReplaceAll(fmt, "YY", "06")
-					fmt = strings.ReplaceAll(fmt, "MM", "01")
-					fmt = strings.ReplaceAll(fmt, "DD", "02")
-					fmt = strings.ReplaceAll(fmt, "HH", "15")
-					fmt = strings.ReplaceAll(fmt, "NN", "04")
-					fmt = strings.ReplaceAll(fmt, "SS", "05")
-					valrp = dt.Format(fmt)
-				}
-
-				out += valrp
-				in = in[iTag2+2:]
-			} else {
-				out += in
-				in = ""
-			}
+// replaceVars remplace les variables globales dans la def de la tache (copie propre au lancement)
+func (c *PreparedDetail) replaceVars(vars map[string]string) error {
+	var err error
+	if c.Task.Cmd, err = dal.ReplaceVars(c.Task.Cmd, vars); err != nil {
+		return err
+	}
+	if c.Task.StartIn, err = dal.ReplaceVars(c.Task.StartIn, vars); err != nil {
+		return err
+	}
+	args := make([]string, len(c.Task.Args))
+	for i, a := range c.Task.Args {
+		if args[i], err = dal.ReplaceVars(a, vars); err != nil {
+			return err
 		}
 	}
-	return out
+	c.Task.Args = args
+	return nil
 }
 
 // lib util ident dans les logs
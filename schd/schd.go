@@ -1,6 +1,7 @@
 package schd
 
 import (
+	"CmdScheduler/agent"
 	"CmdScheduler/dal"
 	"CmdScheduler/slog"
 	"fmt"
@@ -42,6 +43,7 @@ type scheduleurState struct {
 	tasksLst     map[int]*dal.DbTask     // liste des taches
 	taskflowsLst map[int]*dal.DbTaskFlow // liste des workflow
 	schedToTF    map[int][]int           // lien schedid = liste des taches actives à lancer liés
+	ownerGroups  map[int]int             // lien taskflow id = groupe propriétaire (explicite ou par tag)
 
 	//prochain lancement calculé
 	schdFrom        time.Time //date d'origine
@@ -177,6 +179,13 @@ func GetViewState() WipView {
 	return state
 }
 
+//Restrict état restreint aux queues et taskflows accessibles (prédicats par id)
+func (c WipView) Restrict(queue func(int) bool, taskflow func(int) bool) WipView {
+	c.WState = c.WState.Restrict(queue, taskflow)
+	c.NextTask = restrictTasks(c.NextTask, taskflow)
+	return c
+}
+
 //calcViewNextState calcul un état des prochaines exec à à mener pour affichage
 func calcViewNextState() {
 	// prochaines tache à exec : il faut trier par date
@@ -233,6 +242,9 @@ func pumpSched() {
 	// init entités en mémoire
 	updateEntitiesFromDb("*", 0)
 
+	//envoi des notifications
+	appNotifier.start()
+
 	//init worker
 	appSched.worker = NewWorker(appSched.queueLst)
 	appSched.worker.Start()
@@ -250,10 +262,12 @@ func pumpSched() {
 		case e := <-appSched.checkDbCh:
 			//traitement notif de modif des données
 			updateEntitiesFromDb(e.dType, e.ID)
+			appEvents.publish(EvtConfigReload, entityCrudCode(e.dType), ConfigReloadInfo{Entity: e.dType, ID: e.ID})
 			//recalc sched si modifié
-			if e.dType == "DbSched" {
+			if e.dType == "DbSched" || e.dType == "*" {
 				calcNextLaunch()
-			} else if e.dType == "DbQueue" {
+			}
+			if e.dType == "DbQueue" || e.dType == "*" {
 				//changement état qu'une queue peut affecter le worker (état pause)
 				for _, q := range appSched.queueLst {
 					appSched.worker.UpdateQueue(*q)
@@ -330,15 +344,19 @@ func updateEntitiesFromDb(entName string, id int) error {
 			delete(appSched.tasksLst, id)
 		}
 	}
-	//taskflows
-	if (entName == "*") || (entName == "DbTaskFlow") {
+	//taskflows, rechargés en totalité sur modif d'un groupe (propriétaire remis à null à sa suppression)
+	if (entName == "*") || (entName == "DbTaskFlow") || (entName == "DbGroup") {
 		f := dal.SearchQuery{
 			Limit:  0,
 			Offset: 0,
 		}
-		if id > 0 {
+		tfID := id
+		if entName == "DbGroup" {
+			tfID = 0
+		}
+		if tfID > 0 {
 			f.SQLFilter = "TASKFLOW.id = ?"
-			f.SQLParams = []interface{}{id}
+			f.SQLParams = []interface{}{tfID}
 		}
 		updated := make(map[int]bool)
 		resp, _, err := dal.TaskFlowList(f)
@@ -351,14 +369,14 @@ func updateEntitiesFromDb(entName string, id int) error {
 			updated[resp[e].ID] = true
 		}
 		//suppression des elements obsoletes
-		if id == 0 {
+		if tfID == 0 {
 			for _, e := range appSched.taskflowsLst {
 				if _, exists := updated[e.ID]; !exists {
 					delete(appSched.taskflowsLst, e.ID)
 				}
 			}
-		} else if _, exists := updated[id]; !exists {
-			delete(appSched.taskflowsLst, id)
+		} else if _, exists := updated[tfID]; !exists {
+			delete(appSched.taskflowsLst, tfID)
 		}
 		//on établie un lien sched id = liste de TF concerné
 		appSched.schedToTF = make(map[int][]int)
@@ -370,6 +388,15 @@ func updateEntitiesFromDb(entName string, id int) error {
 				appSched.schedToTF[tf.ScheduleID] = append(appSched.schedToTF[tf.ScheduleID], idx)
 			}
 		}
+		//groupes propriétaires, une seule lecture des groupes
+		groups, _, err := dal.GroupList(dal.SearchQuery{})
+		if err != nil {
+			return fmt.Errorf("updateEntitiesFromDb DbGroup : " + err.Error())
+		}
+		appSched.ownerGroups = make(map[int]int)
+		for idx, tf := range appSched.taskflowsLst {
+			appSched.ownerGroups[idx] = dal.TaskFlowOwnerGroup(*tf, groups)
+		}
 	}
 	//agent
 	if (entName == "*") || (entName == "DbAgent") {
@@ -390,16 +417,21 @@ func updateEntitiesFromDb(entName string, id int) error {
 		for e := range resp {
 			appSched.agentsLst[resp[e].ID] = &resp[e]
 			updated[resp[e].ID] = true
+			if resp[e].Deleted {
+				agent.ReleaseHttpTransport(resp[e].ID)
+			}
 		}
 		//suppression des elements obsoletes
 		if id == 0 {
 			for _, e := range appSched.agentsLst {
 				if _, exists := updated[e.ID]; !exists {
 					delete(appSched.agentsLst, e.ID)
+					agent.ReleaseHttpTransport(e.ID)
 				}
 			}
 		} else if _, exists := updated[id]; !exists {
 			delete(appSched.agentsLst, id)
+			agent.ReleaseHttpTransport(id)
 		}
 	}
 	//queues
@@ -433,6 +465,37 @@ func updateEntitiesFromDb(entName string, id int) error {
 			delete(appSched.queueLst, id)
 		}
 	}
+	//canaux de notification
+	if (entName == "*") || (entName == "DbNotification") {
+		f := dal.SearchQuery{
+			Limit:  0,
+			Offset: 0,
+		}
+		if id > 0 {
+			f.SQLFilter = "NOTIFICATION.id = ?"
+			f.SQLParams = []interface{}{id}
+		}
+		updated := make(map[int]bool)
+		resp, _, err := dal.NotificationList(f)
+		if err != nil {
+			return fmt.Errorf("updateEntitiesFromDb DbNotification : " + err.Error())
+		}
+		//maj tableau
+		for e := range resp {
+			appNotifier.setChannel(resp[e].ID, &resp[e])
+			updated[resp[e].ID] = true
+		}
+		//suppression des elements obsoletes
+		if id == 0 {
+			for _, e := range appNotifier.channelIDs() {
+				if _, exists := updated[e]; !exists {
+					appNotifier.setChannel(e, nil)
+				}
+			}
+		} else if _, exists := updated[id]; !exists {
+			appNotifier.setChannel(id, nil)
+		}
+	}
 	//sched
 	if (entName == "*") || (entName == "DbSched") {
 		f := dal.SearchQuery{
@@ -514,11 +577,32 @@ func launchTFBySchedId(schedid int, dtRef time.Time) {
 	}
 }
 
-//ManualLaunchTF lancement tache depuis api
-func ManualLaunchTF(tfID int, usr string) {
-	if _, exists := appSched.taskflowsLst[tfID]; exists {
-		ptf := prepareTF(appSched.taskflowsLst[tfID], fmt.Sprintf("Manual launch by %v", usr), time.Now(), true)
-		slog.Trace("api", "push taskflow %v by %v", ptf.Ident, usr)
-		appSched.worker.AppendTF(*ptf)
+//ManualLaunchTF lancement tache depuis api, args : surcharge des arguments nommés
+//retourne l'id d'exec, vide si taskflow inconnue ou arguments refusés
+func ManualLaunchTF(tfID int, usr string, args map[string]string) string {
+	tf, exists := appSched.taskflowsLst[tfID]
+	if !exists {
+		return ""
+	}
+	args, err := tf.ValidateLaunchArgs(args)
+	if err != nil {
+		slog.Warning("api", "Taskflow %v launch by %v refused : %v", tfID, usr, err)
+		return ""
+	}
+	//surcharge des arguments nommés sur une copie
+	if len(args) > 0 {
+		cp := *tf
+		cp.NamedArgs = make(map[string]string)
+		for k, v := range tf.NamedArgs {
+			cp.NamedArgs[k] = v
+		}
+		for k, v := range args {
+			cp.NamedArgs[k] = v
+		}
+		tf = &cp
 	}
+	ptf := prepareTF(tf, fmt.Sprintf("Manual launch by %v", usr), time.Now(), true)
+	slog.Trace("api", "push taskflow %v by %v", ptf.Ident, usr)
+	appSched.worker.AppendTF(*ptf)
+	return ptf.RunID
 }
@@ -0,0 +1,106 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"CmdScheduler/slog"
+	"fmt"
+	"time"
+)
+
+// nombre de dépassements de sla conservés pour consultation (WState)
+const keepSLABreaches = 50
+
+// checkSLA controle des sla des tf en file ou en cours d'exec
+// ainsi que des tf échues qui n'ont jamais atteint de file
+func (c *Worker) checkSLA() {
+	now := time.Now()
+	for e := c.taskList.Front(); e != nil; e = e.Next() {
+		tf := e.Value.(*PreparedTF)
+		if tf.State != StateTerminated {
+			c.checkTFSLA(tf, now)
+		}
+	}
+
+	//tf jamais démarrées : suivies jusqu'à la levée du démarrage tardif
+	kept := c.slaUnqueued[:0]
+	for _, tf := range c.slaUnqueued {
+		c.checkTFSLA(tf, now)
+		if !tf.hasSLABreach(dal.SLAKindStartDelay) {
+			kept = append(kept, tf)
+		}
+	}
+	c.slaUnqueued = kept
+}
+
+// trackUnqueued suivi sla d'une tf échue refusée à la mise en file (queue pleine...)
+func (c *Worker) trackUnqueued(tf *PreparedTF) {
+	if tf.slaStartDelay > 0 && !tf.DtRef.IsZero() {
+		c.slaUnqueued = append(c.slaUnqueued, tf)
+	}
+}
+
+// hasSLABreach vrai si le dépassement kind a déjà été levé pour l'exec
+func (c *PreparedTF) hasSLABreach(kind string) bool {
+	for _, k := range c.slaBreaches {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTFSLA controle des sla d'une tf à l'instant now (ou à sa fin d'exec)
+// chaque type de dépassement n'est levé qu'une fois par exec
+func (c *Worker) checkTFSLA(tf *PreparedTF, now time.Time) {
+	//démarrage tardif (ou toujours pas démarré)
+	if tf.slaStartDelay > 0 && !tf.DtRef.IsZero() {
+		if tf.StartAt.IsZero() && now.Sub(tf.DtRef) > tf.slaStartDelay {
+			c.slaBreach(tf, dal.SLAKindStartDelay, fmt.Sprintf("not started %v after reference date", tf.slaStartDelay))
+		} else if !tf.StartAt.IsZero() && tf.StartAt.Sub(tf.DtRef) > tf.slaStartDelay {
+			c.slaBreach(tf, dal.SLAKindStartDelay, fmt.Sprintf("started %v after reference date (max %v)",
+				tf.StartAt.Sub(tf.DtRef).Round(time.Second), tf.slaStartDelay))
+		}
+	}
+	//durée d'exec
+	if tf.slaMaxDur > 0 && !tf.StartAt.IsZero() && now.Sub(tf.StartAt) > tf.slaMaxDur {
+		c.slaBreach(tf, dal.SLAKindDuration, fmt.Sprintf("running for more than %v", tf.slaMaxDur))
+	}
+	//heure de fin
+	if !tf.slaDeadline.IsZero() && now.After(tf.slaDeadline) {
+		c.slaBreach(tf, dal.SLAKindFinishBy, fmt.Sprintf("not finished by %v", tf.slaDeadline.Format("2006-01-02 15:04")))
+	}
+}
+
+// slaBreach trace, historisation et notification d'un dépassement
+func (c *Worker) slaBreach(tf *PreparedTF, kind string, info string) {
+	if tf.hasSLABreach(kind) {
+		return
+	}
+	tf.slaBreaches = append(tf.slaBreaches, kind)
+	slog.Warning("worker", "SLA breach %v : %v, %v", tf.lib(), kind, info)
+
+	breach := dal.DbSLABreach{
+		TaskFlowID:  tf.TFID,
+		TaskFlowLib: tf.TFLib,
+		RunID:       tf.RunID,
+		Kind:        kind,
+		DtRef:       tf.DtRef,
+		DetectedAt:  time.Now(),
+		Info:        info,
+	}
+	if tf.TFID != 0 {
+		if err := dal.SLABreachInsert(&breach); err != nil {
+			slog.Error("worker", "SLABreachInsert fail %v", err)
+		}
+	}
+	c.slaBreaches = append(c.slaBreaches, breach)
+	if len(c.slaBreaches) > keepSLABreaches {
+		c.slaBreaches = c.slaBreaches[len(c.slaBreaches)-keepSLABreaches:]
+	}
+
+	evt := newNotifEvent(tf, dal.NotifEvtSLABreach)
+	evt.SLAKind = kind
+	evt.SLAInfo = info
+	appNotifier.push(evt)
+	appEvents.publish(EvtSLABreach, "TASKFLOW", breach)
+}
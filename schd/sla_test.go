@@ -0,0 +1,96 @@
+package schd
+
+import (
+	"CmdScheduler/dal"
+	"testing"
+	"time"
+)
+
+// TestSLA controle des dépassements de sla
+func TestSLA(t *testing.T) {
+	InitWorker(t)
+
+	dtRef := time.Date(2021, 3, 31, 6, 0, 0, 0, time.Local)
+	deadline, ok := dal.SLADeadline("07:00", dtRef)
+	if !ok || !deadline.Equal(dtRef.Add(time.Hour)) {
+		t.Errorf("deadline %v", deadline)
+	}
+	if deadline, _ = dal.SLADeadline("05:00", dtRef); !deadline.Equal(dtRef.Add(23 * time.Hour)) {
+		t.Errorf("deadline next day %v", deadline)
+	}
+
+	w := NewWorker(map[int]*dal.DbQueue{})
+	tf := &PreparedTF{
+		TFID:          9999,
+		TFLib:         "report",
+		RunID:         newRunID(),
+		DtRef:         dtRef,
+		State:         StateQueued,
+		slaStartDelay: 15 * time.Minute,
+		slaMaxDur:     30 * time.Minute,
+		slaDeadline:   dtRef.Add(time.Hour),
+	}
+
+	//en attente dans le délai : rien
+	w.checkTFSLA(tf, dtRef.Add(10*time.Minute))
+	if len(tf.slaBreaches) != 0 {
+		t.Fatalf("breaches %v", tf.slaBreaches)
+	}
+	//pas démarré à 06:16 : levé une seule fois
+	w.checkTFSLA(tf, dtRef.Add(16*time.Minute))
+	w.checkTFSLA(tf, dtRef.Add(17*time.Minute))
+	if len(tf.slaBreaches) != 1 || tf.slaBreaches[0] != dal.SLAKindStartDelay {
+		t.Fatalf("breaches %v", tf.slaBreaches)
+	}
+	//démarré à 06:20, toujours en cours à 07:01
+	tf.State = StateInProgress
+	tf.StartAt = dtRef.Add(20 * time.Minute)
+	w.checkTFSLA(tf, dtRef.Add(61*time.Minute))
+	if len(tf.slaBreaches) != 3 {
+		t.Fatalf("breaches %v", tf.slaBreaches)
+	}
+	if len(w.slaBreaches) != 3 || w.slaBreaches[2].Kind != dal.SLAKindFinishBy {
+		t.Errorf("worker breaches %+v", w.slaBreaches)
+	}
+
+	//historique en bdd
+	q := dal.SearchQuery{SQLFilter: "SLABREACH.run_id = ?", SQLParams: []interface{}{tf.RunID}}
+	arr, _, err := dal.SLABreachList(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arr) != 3 || arr[0].TaskFlowID != 9999 || !arr[0].DtRef.Equal(dtRef) {
+		t.Errorf("history %+v", arr)
+	}
+}
+
+// TestSLAUnqueued démarrage tardif levé pour une tf échue jamais mise en file
+func TestSLAUnqueued(t *testing.T) {
+	InitWorker(t)
+
+	w := NewWorker(map[int]*dal.DbQueue{})
+	tf := &PreparedTF{
+		TFLib:         "report",
+		Ident:         "TF0",
+		RunID:         newRunID(),
+		DtRef:         time.Now().Add(-20 * time.Minute),
+		QueueID:       1,
+		slaStartDelay: 15 * time.Minute,
+	}
+	//queue inconnue : refusée mais suivie
+	if w.appendTF(tf) || len(w.slaUnqueued) != 1 {
+		t.Fatalf("unqueued %v", w.slaUnqueued)
+	}
+	//sans sla de démarrage : pas de suivi
+	if w.appendTF(&PreparedTF{Ident: "TF1", QueueID: 1, DtRef: time.Now()}) || len(w.slaUnqueued) != 1 {
+		t.Fatalf("unqueued %v", w.slaUnqueued)
+	}
+
+	w.checkSLA()
+	if len(tf.slaBreaches) != 1 || tf.slaBreaches[0] != dal.SLAKindStartDelay {
+		t.Errorf("breaches %v", tf.slaBreaches)
+	}
+	if len(w.slaUnqueued) != 0 || len(w.slaBreaches) != 1 {
+		t.Errorf("unqueued %v, worker breaches %+v", w.slaUnqueued, w.slaBreaches)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"CmdScheduler/dal"
 	"CmdScheduler/slog"
 	"container/list"
+	"reflect"
 	"sort"
 	"time"
 )
@@ -31,8 +32,10 @@ type wipInfo struct {
 
 //TState info tache en cours
 type TState struct {
-	TFID  int    `json:"taskflow_id"`
-	TFLib string `json:"taskflow_lib"`
+	TFID    int    `json:"taskflow_id"`
+	TFLib   string `json:"taskflow_lib"`
+	RunID   string `json:"run_id"`
+	Version int    `json:"version"`
 
 	QueueID  int    `json:"queue_id"`
 	QueueLib string `json:"queue_lib"`
@@ -45,12 +48,40 @@ type TState struct {
 	StartAt      time.Time `json:"start_at"`
 	StopAt       time.Time `json:"stop_at"`
 	Duration     string    `json:"duration"`
+	SLABreaches  []string  `json:"sla_breaches,omitempty"`
 }
 
 //WState info taches en cours
 type WState struct {
-	QueueState []qState `json:"queues"` //états des queues
-	Tasks      []TState `json:"tasks"`  //états des taches
+	QueueState  []qState          `json:"queues"`       //états des queues
+	Tasks       []TState          `json:"tasks"`        //états des taches
+	SLABreaches []dal.DbSLABreach `json:"sla_breaches"` //derniers dépassements de sla
+}
+
+//Restrict état restreint aux queues et taskflows accessibles (prédicats par id)
+func (c WState) Restrict(queue func(int) bool, taskflow func(int) bool) WState {
+	ret := WState{
+		QueueState:  restrictQueues(c.QueueState, queue),
+		Tasks:       restrictTasks(c.Tasks, taskflow),
+		SLABreaches: make([]dal.DbSLABreach, 0),
+	}
+	for _, b := range c.SLABreaches {
+		if taskflow(b.TaskFlowID) {
+			ret.SLABreaches = append(ret.SLABreaches, b)
+		}
+	}
+	return ret
+}
+
+//restrictTasks copie restreinte aux taskflows accessibles
+func restrictTasks(arr []TState, taskflow func(int) bool) []TState {
+	ret := make([]TState, 0)
+	for _, t := range arr {
+		if taskflow(t.TFID) {
+			ret = append(ret, t)
+		}
+	}
+	return ret
 }
 
 //qState info
@@ -63,6 +94,17 @@ type qState struct {
 	Terminated int `json:"terminated"` //total globale
 }
 
+//restrictQueues copie restreinte aux queues accessibles
+func restrictQueues(arr []qState, queue func(int) bool) []qState {
+	ret := make([]qState, 0)
+	for _, q := range arr {
+		if queue(q.ID) {
+			ret = append(ret, q)
+		}
+	}
+	return ret
+}
+
 //isFull() retourne vrai si la queue est full
 func (s *qState) isFull() bool {
 	return ((s.MaxSize > 0) && ((s.Processing + s.Waiting) >= s.MaxSize))
@@ -86,7 +128,10 @@ type Worker struct {
 	taskList *list.List             // liste des taches à traiter
 	taskMP   map[string]*PreparedTF // ident unic, mise en file de doublon interdit
 
-	queueState map[int]*qState //états des queues + directe en clé 0
+	queueState  map[int]*qState   //états des queues + directe en clé 0
+	lastResult  map[int]int       //dernier résultat par tf (notification recovery)
+	slaBreaches []dal.DbSLABreach //derniers dépassements de sla constatés
+	slaUnqueued []*PreparedTF     //tf échues jamais mises en file, suivies pour le sla de démarrage
 
 	lastStateInfo *WState //informatif seulement, état des lieux taches en cours
 }
@@ -137,7 +182,9 @@ func NewWorker(initQueue map[int]*dal.DbQueue) *Worker {
 		taskList: list.New(),
 		taskMP:   make(map[string]*PreparedTF),
 
-		queueState: queueState,
+		queueState:  queueState,
+		lastResult:  make(map[int]int),
+		slaBreaches: make([]dal.DbSLABreach, 0),
 
 		lastStateInfo: &WState{},
 	}
@@ -203,6 +250,8 @@ func (c *Worker) loop() {
 			//netoayge régulier des taches
 			c.cleanTasks("")
 			c.calcState()
+			c.checkLongRunning()
+			c.checkSLA()
 		}
 		//maj taches
 		if checkTaskList {
@@ -253,6 +302,7 @@ func (c *Worker) appendTF(tf *PreparedTF) bool {
 	if _, exists := c.taskMP[tf.Ident]; exists {
 		if c.taskMP[tf.Ident].State != StateTerminated {
 			slog.Warning("worker", "Push %v - %v skipped (already in list)", tf.TFLib, tf.Ident)
+			c.trackUnqueued(tf)
 			return false
 		}
 	}
@@ -261,12 +311,14 @@ func (c *Worker) appendTF(tf *PreparedTF) bool {
 		_, qexists := c.queueState[tf.QueueID]
 		if !qexists {
 			slog.Warning("worker", "Push %v skipped (%v not exists)", tf.lib(), tf.qlib())
+			c.trackUnqueued(tf)
 			return false
 		}
 
 		c.initQueueState() //calcul état cumuls queue requis avant
 		if c.queueState[tf.QueueID].isFull() {
 			slog.Warning("worker", "Push %v skipped (%v is full)", tf.lib(), tf.qlib())
+			c.trackUnqueued(tf)
 			return false
 		}
 	}
@@ -336,6 +388,11 @@ func (c *Worker) launchTasks() {
 					c.queueState[tf.QueueID].Processing, c.queueState[tf.QueueID].Slot)
 
 				tf.StartAt = time.Now()
+				if lag := tf.StartAt.Sub(tf.DtRef); lag >= 0 {
+					metricSchedLag.observe(lag.Seconds())
+				}
+				appNotifier.push(newNotifEvent(tf, dal.NotifEvtStart))
+				appEvents.publish(EvtTaskStart, "TASKFLOW", tf.viewState())
 				go func(feedback chan<- wipInfo) {
 					tf.proceedTaskFlow(feedback)
 					//notif loop fin de tache
@@ -374,53 +431,117 @@ func (c *Worker) updTF(f wipInfo) bool {
 		if f.tf.State == StateTerminated {
 			f.tf.StopAt = time.Now()
 			slog.Trace("worker", "End %v : %v", f.tf.qlib(), f.tf.lib())
+			if f.tf.Result != dal.SchedResOK {
+				//transcript déjà expurgé des secrets
+				slog.Trace("worker", "Failed %v : %v", f.tf.lib(), f.tf.ResultMsg)
+			}
 			c.queueState[f.tf.QueueID].Terminated++
+			metricRuns.inc("result", metricResult(f.tf.Result == dal.SchedResOK), "queue", metricQueueLib(f.tf.QueueLib))
 			//persitance db
 			if f.tf.TFID != 0 {
 				errDb := dal.TaskFlowUpdateLastState(f.tf.TFID, f.tf.StartAt, f.tf.StopAt, f.tf.Result, f.tf.ResultMsg)
 				if errDb != nil {
 					slog.Error("worker", "TaskFlowUpdateLastState fail %v", errDb)
 				}
+				errDb = dal.TaskFlowRunInsert(&dal.DbTaskFlowRun{
+					RunID:        f.tf.RunID,
+					TaskFlowID:   f.tf.TFID,
+					Version:      f.tf.Version,
+					LaunchSource: f.tf.LaunchSource,
+					DtRef:        f.tf.DtRef,
+					StartAt:      f.tf.StartAt,
+					StopAt:       f.tf.StopAt,
+					Result:       f.tf.Result,
+					Msg:          f.tf.ResultMsg,
+				})
+				if errDb != nil {
+					slog.Error("worker", "TaskFlowRunInsert fail %v", errDb)
+				}
 			}
+			//sla constaté sur la fin d'exec
+			c.checkTFSLA(f.tf, f.tf.StopAt)
+			//notification (asynchrone)
+			appNotifier.push(newNotifEvent(f.tf, c.endEvent(f.tf)))
+			appEvents.publish(EvtTaskEnd, "TASKFLOW", f.tf.viewState())
 			return true
 		}
 	}
 	return false
 }
 
+// endEvent évènement de fin d'une tf : success, failure ou recovery (succès aprés échec)
+func (c *Worker) endEvent(tf *PreparedTF) string {
+	prev, exists := c.lastResult[tf.TFID]
+	if !exists {
+		prev = tf.prevResult
+	}
+	c.lastResult[tf.TFID] = tf.Result
+
+	if tf.Result != dal.SchedResOK {
+		return dal.NotifEvtFailure
+	}
+	if prev == dal.SchedResKO {
+		return dal.NotifEvtRecovery
+	}
+	return dal.NotifEvtSuccess
+}
+
+// checkLongRunning notifie les tf en cours d'exec à chaque minute écoulée
+// (le seuil est porté par les régles de notification)
+func (c *Worker) checkLongRunning() {
+	for e := c.taskList.Front(); e != nil; e = e.Next() {
+		tf := e.Value.(*PreparedTF)
+		if tf.State == StateInProgress && !tf.StartAt.IsZero() {
+			if m := int(time.Since(tf.StartAt) / time.Minute); m > tf.longRunMin {
+				tf.longRunMin = m
+				appNotifier.push(newNotifEvent(tf, dal.NotifEvtLongRunning))
+			}
+		}
+	}
+}
+
+// viewState état d'une tf pour consultation
+func (c *PreparedTF) viewState() TState {
+	duration := time.Duration(0)
+	if !c.StartAt.IsZero() {
+		if !c.StopAt.IsZero() {
+			duration = c.StopAt.Sub(c.StartAt)
+		} else {
+			duration = time.Now().Sub(c.StartAt)
+		}
+	}
+
+	return TState{
+		TFID:         c.TFID,
+		TFLib:        c.lib(),
+		RunID:        c.RunID,
+		Version:      c.Version,
+		QueueID:      c.QueueID,
+		QueueLib:     c.QueueLib,
+		State:        int(c.State),
+		LaunchSource: c.LaunchSource,
+		Success:      (c.Result == 1),
+		DtRef:        c.DtRef,
+		StartAt:      c.StartAt,
+		StopAt:       c.StopAt,
+		Duration:     duration.String(),
+		SLABreaches:  c.slaBreaches,
+	}
+}
+
 // calcState bilan état des travaux en cours
 func (c *Worker) calcState() {
 	newStateInfo := WState{
-		QueueState: make([]qState, len(c.queueState)),
-		Tasks:      make([]TState, c.taskList.Len()),
+		QueueState:  make([]qState, len(c.queueState)),
+		Tasks:       make([]TState, c.taskList.Len()),
+		SLABreaches: append([]dal.DbSLABreach{}, c.slaBreaches...),
 	}
 
 	//référencement état des taches
 	it := 0
 	for e := c.taskList.Front(); e != nil; e = e.Next() {
 		tf := e.Value.(*PreparedTF)
-		duration := time.Duration(0)
-		if !tf.StartAt.IsZero() {
-			if !tf.StopAt.IsZero() {
-				duration = tf.StopAt.Sub(tf.StartAt)
-			} else {
-				duration = time.Now().Sub(tf.StartAt)
-			}
-		}
-
-		newStateInfo.Tasks[it] = TState{
-			TFID:         tf.TFID,
-			TFLib:        tf.lib(),
-			QueueID:      tf.QueueID,
-			QueueLib:     tf.QueueLib,
-			State:        int(tf.State),
-			LaunchSource: tf.LaunchSource,
-			Success:      (tf.Result == 1),
-			DtRef:        tf.DtRef,
-			StartAt:      tf.StartAt,
-			StopAt:       tf.StopAt,
-			Duration:     duration.String(),
-		}
+		newStateInfo.Tasks[it] = tf.viewState()
 		it++
 	}
 	sort.Slice(newStateInfo.Tasks, func(i, j int) bool {
@@ -437,6 +558,10 @@ func (c *Worker) calcState() {
 		return newStateInfo.QueueState[i].ID < newStateInfo.QueueState[j].ID
 	})
 
+	//diffusion si changement d'état des queues
+	if !reflect.DeepEqual(newStateInfo.QueueState, c.lastStateInfo.QueueState) {
+		appEvents.publish(EvtQueueState, "QUEUE", newStateInfo.QueueState)
+	}
 	c.lastStateInfo = &newStateInfo
 }
 
@@ -9,33 +9,41 @@ import (
 	"time"
 )
 
-//session en mémoire global
+//store des sessions global, en mémoire tant que InitSessionStore n'est pas appelé
 var (
-	sessionsStore Store
+	sessionsStore Store = NewMemoryStore(20 * time.Minute)
 )
 
 // Session element lié à session
 type Session struct {
-	Login           string
-	Role            string
-	RightLevel      int
-	SessionId       string
-	Data            map[string]interface{} //eventuelles données attachés
-	lastActivity    time.Time
-	sessionDuration *time.Duration //durée inactivité autorisé du store
+	Login        string
+	Role         string
+	RightLevel   int
+	UserID       int
+	SessionId    string
+	Data         map[string]interface{} //eventuelles données attachés (non conservées par un store persistant)
+	LastActivity time.Time
 }
 
-//Store sessions en mémoire
-type Store struct {
-	sessions               map[string]*Session
-	mu                     sync.Mutex
-	defaultSessionDuration time.Duration
+// Store stockage des sessions, implémentation mémoire (MemoryStore) ou persistante
+type Store interface {
+	// Get session valide (nil sinon), la derniére activité est mise à jour
+	Get(sessionId string) *Session
+	// Add enregistrement d'une nouvelle session, SessionId déjà attribué
+	Add(s *Session) error
+	// Remove supprime une session donnée
+	Remove(sessionId string)
+	// RemoveUser supprime les sessions d'un utilisateur
+	RemoveUser(userID int)
+	// Purge supprime les sessions expirées
+	Purge()
+	// List copie des sessions valides
+	List() []Session
 }
 
-// InitSessionStore init cach session en mémoire
-func InitSessionStore(sessionDuration time.Duration) {
-	sessionsStore.sessions = make(map[string]*Session)
-	sessionsStore.defaultSessionDuration = sessionDuration
+// InitSessionStore init du store principal
+func InitSessionStore(store Store) {
+	sessionsStore = store
 }
 
 //gen id pseudo unique
@@ -51,91 +59,142 @@ func genUID() string {
 	return fmt.Sprintf("%x", sha256.Sum(nil))
 }
 
-// get getter session
-func (c *Store) get(skey string) *Session {
+// IsValidID controle du format d'un id de session
+func IsValidID(sessionId string) bool {
+	return len(sessionId) == 64
+}
+
+// MemoryStore sessions en mémoire, perdues au redémarrage
+type MemoryStore struct {
+	sessions        map[string]*Session
+	mu              sync.Mutex
+	sessionDuration time.Duration //durée inactivité autorisé
+}
+
+// NewMemoryStore store en mémoire
+func NewMemoryStore(sessionDuration time.Duration) *MemoryStore {
+	return &MemoryStore{
+		sessions:        make(map[string]*Session),
+		sessionDuration: sessionDuration,
+	}
+}
+
+// Get getter session
+func (c *MemoryStore) Get(skey string) *Session {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	s, exists := c.sessions[skey]
-	if len(skey) != 64 || !exists || !s.isValid() {
+	if !IsValidID(skey) || !exists || !c.isValid(s) {
 		s = nil
 	} else {
-		s.lastActivity = time.Now()
+		s.LastActivity = time.Now()
 	}
 
 	return s
 }
 
-// new create session
-func (c *Store) new() *Session {
+// Add enregistrement session
+func (c *MemoryStore) Add(s *Session) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	//nouvelle session
-	nkey := ""
-	for nkey == "" {
-		tmp := genUID()
-		if _, exists := c.sessions[tmp]; !exists {
-			nkey = tmp
-		}
+	if _, exists := c.sessions[s.SessionId]; exists {
+		return fmt.Errorf("session already exists")
 	}
-	c.sessions[nkey] = &Session{
-		SessionId:       nkey,
-		Data:            make(map[string]interface{}),
-		sessionDuration: &c.defaultSessionDuration,
-		lastActivity:    time.Now(),
-	}
-
-	return c.sessions[nkey]
+	c.sessions[s.SessionId] = s
+	return nil
 }
 
 // Purge supprime les session obsolete
-func (c *Store) purge() {
+func (c *MemoryStore) Purge() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	for k, v := range c.sessions {
-		if !v.isValid() {
+		if !c.isValid(v) {
 			delete(c.sessions, k)
 		}
 	}
 }
 
-// remove supprime une session donnée
-func (c *Store) remove(sessionId string) {
+// Remove supprime une session donnée
+func (c *MemoryStore) Remove(sessionId string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	delete(c.sessions, sessionId)
 }
 
-// IsValid test validité session
-func (c *Session) isValid() bool {
-	if c != nil && time.Since(c.lastActivity) < *c.sessionDuration {
-		return true
+// RemoveUser supprime les sessions d'un utilisateur
+func (c *MemoryStore) RemoveUser(userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range c.sessions {
+		if v.UserID == userID {
+			delete(c.sessions, k)
+		}
+	}
+}
+
+// List copie des sessions valides
+func (c *MemoryStore) List() []Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make([]Session, 0, len(c.sessions))
+	for _, s := range c.sessions {
+		if c.isValid(s) {
+			ret = append(ret, *s)
+		}
 	}
-	return false
+	return ret
+}
+
+// isValid test validité session
+func (c *MemoryStore) isValid(s *Session) bool {
+	return s != nil && time.Since(s.LastActivity) < c.sessionDuration
 }
 
 // Get getter session store principal
 func Get(skey string) *Session {
-	return sessionsStore.get(skey)
+	return sessionsStore.Get(skey)
 }
 
 // New create session store principal
-func New() *Session {
-	return sessionsStore.new()
+func New(login string, userID int, rightLevel int) (*Session, error) {
+	s := &Session{
+		Login:        login,
+		UserID:       userID,
+		RightLevel:   rightLevel,
+		SessionId:    genUID(),
+		Data:         make(map[string]interface{}),
+		LastActivity: time.Now(),
+	}
+	if err := sessionsStore.Add(s); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 // Purge purge session store principal
 func Purge() {
-	sessionsStore.purge()
+	sessionsStore.Purge()
 }
 
 // Remove supprime une session donnée
 func Remove(sessionId string) {
-	sessionsStore.remove(sessionId)
+	sessionsStore.Remove(sessionId)
+}
+
+// RemoveUser supprime les sessions d'un utilisateur
+func RemoveUser(userID int) {
+	sessionsStore.RemoveUser(userID)
+}
+
+// Count nombre de sessions valides
+func Count() int {
+	return len(sessionsStore.List())
 }
 
-// List accesseur liste des sessions en cours (token=session)
-func List() map[string]*Session {
-	return sessionsStore.sessions
+// List copie des sessions en cours
+func List() []Session {
+	return sessionsStore.List()
 }
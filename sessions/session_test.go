@@ -0,0 +1,38 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	InitSessionStore(NewMemoryStore(time.Hour))
+	s1, err := New("u1", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, _ := New("u2", 2, 100)
+	New("u1", 1, 10)
+	if Get(s1.SessionId) != s1 || Get("unknown") != nil || Count() != 3 {
+		t.Fatalf("get/count %v", Count())
+	}
+
+	//copie : pas d'accés concurrent à la map du store
+	lst := List()
+	lst[0].Login = "changed"
+	if Get(s1.SessionId).Login != "u1" || Get(s2.SessionId).Login != "u2" {
+		t.Error("list is not a copy")
+	}
+
+	RemoveUser(1)
+	if Get(s1.SessionId) != nil || Get(s2.SessionId) == nil || Count() != 1 {
+		t.Errorf("remove user %v", Count())
+	}
+
+	//expiration
+	s2.LastActivity = time.Now().Add(-2 * time.Hour)
+	Purge()
+	if Get(s2.SessionId) != nil || Count() != 0 {
+		t.Error("purge")
+	}
+}